@@ -0,0 +1,232 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dresswithpockets/openstats/app/auth"
+	"github.com/dresswithpockets/openstats/app/db"
+	"github.com/dresswithpockets/openstats/app/db/query"
+	"github.com/dresswithpockets/openstats/app/rid"
+)
+
+func RegisterRoutes(api huma.API) {
+	adminApi := huma.NewGroup(api, "/admin/v1")
+
+	// admin routes are authenticated by the session cookie, which browsers attach to requests from any site. Moderators
+	// may only review reports and anomalies, so every other operation requires the admin role.
+	adminApi.UseMiddleware(auth.CreateCsrfHandler(adminApi), auth.UserAuthHandler, auth.CreateRequireRoleHandler(adminApi, auth.RoleModerator))
+	var requireAdminMiddlewares = huma.Middlewares{auth.CreateRequireAdminAuthHandler(adminApi)}
+	adminApi.UseSimpleModifier(func(op *huma.Operation) {
+		op.Tags = append(op.Tags, "Admin")
+		op.Security = []map[string][]string{{"SessionCookie": {}}}
+		op.Errors = append(op.Errors, http.StatusUnauthorized, http.StatusForbidden)
+	})
+
+	huma.Register(adminApi, huma.Operation{
+		Method:      http.MethodGet,
+		Path:        "/users/{user}",
+		OperationID: "admin-get-user",
+		Summary:     "Get a user",
+		Description: "Get a user's account, including their role and their suspension history.",
+		Errors:      []int{http.StatusNotFound},
+
+		Middlewares: requireAdminMiddlewares,
+	}, HandleGetUser)
+
+	huma.Register(adminApi, huma.Operation{
+		Method:      http.MethodGet,
+		Path:        "/users/{user}/emails",
+		OperationID: "admin-get-user-emails",
+		Summary:     "Get a user's emails",
+		Errors:      []int{http.StatusNotFound},
+
+		Middlewares: requireAdminMiddlewares,
+	}, HandleGetUserEmails)
+
+	huma.Register(adminApi, huma.Operation{
+		Method:      http.MethodGet,
+		Path:        "/users/{user}/tokens",
+		OperationID: "admin-get-user-game-tokens",
+		Summary:     "Get a user's game tokens",
+		Description: "Get a user's unexpired game tokens. Their secrets are never returned.",
+		Errors:      []int{http.StatusNotFound},
+
+		Middlewares: requireAdminMiddlewares,
+	}, HandleGetUserGameTokens)
+
+	huma.Register(adminApi, huma.Operation{
+		Method:        http.MethodPost,
+		Path:          "/users/{user}/suspensions",
+		OperationID:   "admin-suspend-user",
+		Summary:       "Suspend or ban a user",
+		Description:   "Stop a user from signing in, or using their game tokens and game sessions, until endsAt. The user is banned if endsAt isn't set. The admin must outrank the user.",
+		DefaultStatus: http.StatusCreated,
+		Errors:        []int{http.StatusBadRequest, http.StatusNotFound},
+
+		Middlewares: requireAdminMiddlewares,
+	}, HandlePostUserSuspension)
+
+	huma.Register(adminApi, huma.Operation{
+		Method:        http.MethodDelete,
+		Path:          "/users/{user}/suspensions",
+		OperationID:   "admin-lift-user-suspension",
+		Summary:       "Lift a user's suspension",
+		Description:   "End a user's suspensions and bans early. The admin must outrank the user.",
+		DefaultStatus: http.StatusNoContent,
+		Errors:        []int{http.StatusNotFound},
+
+		Middlewares: requireAdminMiddlewares,
+	}, HandleDeleteUserSuspension)
+
+	huma.Register(adminApi, huma.Operation{
+		Method:        http.MethodPut,
+		Path:          "/users/{user}/slug",
+		OperationID:   "admin-change-user-slug",
+		Summary:       "Change a user's slug",
+		Description:   "Force a user's slug to change, e.g. if it's offensive. The admin must outrank the user.",
+		DefaultStatus: http.StatusNoContent,
+		Errors:        []int{http.StatusNotFound, http.StatusConflict},
+
+		Middlewares: requireAdminMiddlewares,
+	}, HandlePutUserSlug)
+
+	huma.Register(adminApi, huma.Operation{
+		Method:        http.MethodDelete,
+		Path:          "/users/{user}/avatar",
+		OperationID:   "admin-reset-user-avatar",
+		Summary:       "Reset a user's avatar",
+		Description:   "Remove every avatar the user has uploaded, so they have no avatar until they upload another. The admin must outrank the user.",
+		DefaultStatus: http.StatusNoContent,
+		Errors:        []int{http.StatusNotFound},
+
+		Middlewares: requireAdminMiddlewares,
+	}, HandleDeleteUserAvatar)
+
+	huma.Register(adminApi, huma.Operation{
+		Method:        http.MethodPut,
+		Path:          "/users/{user}/role",
+		OperationID:   "admin-grant-user-role",
+		Summary:       "Grant a user a role",
+		Description:   "Grant a user a role, replacing any role they have. Root may grant the admin and moderator roles, and admins may grant the moderator role. The admin must outrank the user.",
+		DefaultStatus: http.StatusNoContent,
+		Errors:        []int{http.StatusNotFound},
+
+		Middlewares: requireAdminMiddlewares,
+	}, HandlePutUserRole)
+
+	huma.Register(adminApi, huma.Operation{
+		Method:        http.MethodDelete,
+		Path:          "/users/{user}/role",
+		OperationID:   "admin-revoke-user-role",
+		Summary:       "Revoke a user's role",
+		Description:   "The admin must outrank the user.",
+		DefaultStatus: http.StatusNoContent,
+		Errors:        []int{http.StatusNotFound},
+
+		Middlewares: requireAdminMiddlewares,
+	}, HandleDeleteUserRole)
+
+	huma.Register(adminApi, huma.Operation{
+		Method:      http.MethodGet,
+		Path:        "/audit-log",
+		OperationID: "admin-get-audit-log",
+		Summary:     "Get the audit log",
+		Description: "Get every action taken by admins, newest first.",
+		Errors:      []int{http.StatusBadRequest, http.StatusNotFound},
+
+		Middlewares: requireAdminMiddlewares,
+	}, HandleGetAuditLog)
+
+	huma.Register(adminApi, huma.Operation{
+		Method:      http.MethodGet,
+		Path:        "/reports",
+		OperationID: "admin-get-reports",
+		Summary:     "Get content reports",
+		Description: "Get the moderation queue of content reported by users, newest first. Moderators may review reports.",
+		Errors:      []int{http.StatusBadRequest},
+	}, HandleGetReports)
+
+	huma.Register(adminApi, huma.Operation{
+		Method:        http.MethodPost,
+		Path:          "/reports/{report}/resolve",
+		OperationID:   "admin-resolve-report",
+		Summary:       "Resolve a content report",
+		Description:   "Action or dismiss an open report. Actioning an avatar report may hide the avatar, which reverts the user to their previous avatar, and actions every other open report of it. Moderators may resolve reports, but may only hide the avatars of users they outrank.",
+		DefaultStatus: http.StatusNoContent,
+		Errors:        []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict},
+	}, HandleResolveReport)
+
+	huma.Register(adminApi, huma.Operation{
+		Method:      http.MethodGet,
+		Path:        "/anomalies",
+		OperationID: "admin-get-anomalies",
+		Summary:     "Get progress anomalies",
+		Description: "Get achievement progress which was flagged as suspicious in every game, newest first. Moderators may review anomalies.",
+		Errors:      []int{http.StatusBadRequest},
+	}, HandleGetAnomalies)
+
+	huma.Register(adminApi, huma.Operation{
+		Method:        http.MethodPost,
+		Path:          "/anomalies/{anomaly}/resolve",
+		OperationID:   "admin-resolve-anomaly",
+		Summary:       "Resolve a progress anomaly",
+		Description:   "Dismiss an open anomaly, or revoke the unlock it was flagged for. Revoked unlocks don't count towards the achievement's rarity or the game's completions. Moderators may resolve anomalies.",
+		DefaultStatus: http.StatusNoContent,
+		Errors:        []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict},
+	}, HandleResolveAnomaly)
+}
+
+// actor gets the admin making the request, and their role
+func actor(ctx context.Context) (*auth.Principal, auth.Role, error) {
+	principal, hasPrincipal := auth.GetPrincipal(ctx)
+	if !hasPrincipal {
+		// shouldn't ever get here due to middleware check
+		return nil, "", huma.Error401Unauthorized("no session")
+	}
+
+	role, err := auth.GetUserRole(ctx, db.Queries, principal.User.ID)
+	return principal, role, err
+}
+
+// findUser finds the user identified by a user RID
+func findUser(ctx context.Context, userRid rid.RID) (query.User, error) {
+	// TODO: a huma validator for rid prefix...
+	if userRid.Prefix != auth.UserRidPrefix {
+		return query.User{}, huma.Error404NotFound("user not found")
+	}
+
+	user, err := db.Queries.FindUser(ctx, userRid.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return user, huma.Error404NotFound("user not found")
+	}
+
+	return user, err
+}
+
+// findOutrankedUser finds the user identified by a user RID, as long as the admin making the request outranks them
+func findOutrankedUser(ctx context.Context, userRid rid.RID) (principal *auth.Principal, user query.User, err error) {
+	principal, actorRole, err := actor(ctx)
+	if err != nil {
+		return
+	}
+
+	user, err = findUser(ctx, userRid)
+	if err != nil {
+		return
+	}
+
+	userRole, err := auth.GetUserRole(ctx, db.Queries, user.ID)
+	if err != nil {
+		return
+	}
+
+	if !actorRole.Outranks(userRole) {
+		err = huma.Error403Forbidden("you can only act on users you outrank")
+	}
+
+	return
+}
@@ -0,0 +1,50 @@
+package admin
+
+import (
+	"context"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dresswithpockets/openstats/app/internal"
+	"github.com/dresswithpockets/openstats/app/rid"
+	"github.com/dresswithpockets/openstats/app/validation"
+	"github.com/google/uuid"
+)
+
+type GetAnomaliesInput struct {
+	Game  validation.Optional[rid.RID] `query:"game,omitempty" doc:"Only return anomalies in this game"`
+	State validation.Optional[string]  `query:"state,omitempty" enum:"open,dismissed,revoked" doc:"Only return anomalies in this state"`
+	After validation.Optional[rid.RID] `query:"after,omitempty" doc:"Only return anomalies older than this anomaly"`
+	Limit validation.Optional[int]     `query:"limit" minimum:"1" maximum:"50" doc:"default = 20"`
+}
+
+type GetAnomaliesOutput struct {
+	Body internal.AnomalyList
+}
+
+func HandleGetAnomalies(ctx context.Context, input *GetAnomaliesInput) (*GetAnomaliesOutput, error) {
+	// TODO: a huma validator for rid prefix...
+	var gameUuid uuid.NullUUID
+	if input.Game.HasValue {
+		if input.Game.Value.Prefix != internal.GameRidPrefix {
+			return nil, huma.Error400BadRequest("invalid game id")
+		}
+
+		gameUuid = uuid.NullUUID{UUID: input.Game.Value.ID, Valid: true}
+	}
+
+	list, err := internal.GetAnomalies(ctx, gameUuid, input.State, input.After, input.Limit.ValueOr(20))
+	if err != nil {
+		return nil, err
+	}
+
+	return &GetAnomaliesOutput{Body: list}, nil
+}
+
+type ResolveAnomalyInput struct {
+	Anomaly rid.RID `path:"anomaly"`
+	Body    internal.ResolveAnomalyBody
+}
+
+func HandleResolveAnomaly(ctx context.Context, input *ResolveAnomalyInput) (*struct{}, error) {
+	return nil, internal.ResolveAnomaly(ctx, input.Anomaly, uuid.NullUUID{}, input.Body.State)
+}
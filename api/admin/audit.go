@@ -0,0 +1,102 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dresswithpockets/openstats/app/auth"
+	"github.com/dresswithpockets/openstats/app/db"
+	"github.com/dresswithpockets/openstats/app/db/query"
+	"github.com/dresswithpockets/openstats/app/internal"
+	"github.com/dresswithpockets/openstats/app/rid"
+	"github.com/dresswithpockets/openstats/app/validation"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rotisserie/eris"
+)
+
+type UserSummary struct {
+	RID  rid.RID `json:"rid" readOnly:"true"`
+	Slug string  `json:"slug" readOnly:"true"`
+}
+
+// AuditEvent is an action an admin took on a user's account, which is also in the user's security log
+type AuditEvent struct {
+	RID       rid.RID                `json:"rid" readOnly:"true"`
+	CreatedAt time.Time              `json:"createdAt" readOnly:"true"`
+	Kind      auth.SecurityEventKind `json:"kind" readOnly:"true"`
+	Details   map[string]string      `json:"details" readOnly:"true" doc:"Depends on the kind, e.g. the role that was granted, or the reason the user was suspended"`
+	User      UserSummary            `json:"user" readOnly:"true" doc:"The user the action was taken on"`
+	Actor     *UserSummary           `json:"actor,omitempty" readOnly:"true" required:"false" doc:"The admin who took the action. Omitted if the admin has since been deleted."`
+}
+
+func (e *AuditEvent) MapFromRow(row query.GetAdminSecurityEventsRow) error {
+	*e = AuditEvent{
+		RID:       rid.From(internal.SecurityEventRidPrefix, row.Uuid),
+		CreatedAt: row.CreatedAt,
+		Kind:      auth.SecurityEventKind(row.Kind),
+		User:      UserSummary{RID: rid.From(auth.UserRidPrefix, row.UserUuid), Slug: row.UserSlug},
+	}
+
+	if row.ActorUuid.Valid && row.ActorSlug != nil {
+		e.Actor = &UserSummary{RID: rid.From(auth.UserRidPrefix, row.ActorUuid.UUID), Slug: *row.ActorSlug}
+	}
+
+	return eris.Wrap(json.Unmarshal(row.Details, &e.Details), "error decoding security event details")
+}
+
+type AuditEventList struct {
+	Events []AuditEvent `json:"events"`
+}
+
+type GetAuditLogInput struct {
+	User  validation.Optional[rid.RID] `query:"user,omitempty" doc:"Only return actions taken on this user"`
+	After validation.Optional[rid.RID] `query:"after,omitempty" doc:"Only return actions older than this one"`
+	Limit validation.Optional[int]     `query:"limit" minimum:"1" maximum:"50" doc:"default = 20"`
+}
+
+type GetAuditLogOutput struct {
+	Body AuditEventList
+}
+
+func HandleGetAuditLog(ctx context.Context, input *GetAuditLogInput) (*GetAuditLogOutput, error) {
+	var userId pgtype.Int4
+	if input.User.HasValue {
+		user, err := findUser(ctx, input.User.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		userId = pgtype.Int4{Int32: user.ID, Valid: true}
+	}
+
+	// TODO: a huma validator for rid prefix...
+	var after uuid.NullUUID
+	if input.After.HasValue {
+		if input.After.Value.Prefix != internal.SecurityEventRidPrefix {
+			return nil, huma.Error400BadRequest("invalid security event id")
+		}
+
+		after = uuid.NullUUID{UUID: input.After.Value.ID, Valid: true}
+	}
+
+	rows, err := db.Queries.GetAdminSecurityEvents(ctx, query.GetAdminSecurityEventsParams{
+		Limit:  int32(input.Limit.ValueOr(20)),
+		UserID: userId,
+		After:  after,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]AuditEvent, len(rows))
+	for idx := range rows {
+		if err = events[idx].MapFromRow(rows[idx]); err != nil {
+			return nil, err
+		}
+	}
+
+	return &GetAuditLogOutput{Body: AuditEventList{Events: events}}, nil
+}
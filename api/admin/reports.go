@@ -0,0 +1,253 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dresswithpockets/openstats/app/auth"
+	"github.com/dresswithpockets/openstats/app/db"
+	"github.com/dresswithpockets/openstats/app/db/query"
+	"github.com/dresswithpockets/openstats/app/internal"
+	"github.com/dresswithpockets/openstats/app/media"
+	"github.com/dresswithpockets/openstats/app/rid"
+	"github.com/dresswithpockets/openstats/app/validation"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rotisserie/eris"
+)
+
+// ReportState is the state of a content report in the moderation queue
+type ReportState string
+
+const (
+	ReportOpen      ReportState = "open"
+	ReportActioned  ReportState = "actioned"
+	ReportDismissed ReportState = "dismissed"
+)
+
+type ReportedAvatar struct {
+	Url    string `json:"url" readOnly:"true"`
+	Hidden bool   `json:"hidden" readOnly:"true" doc:"Whether the avatar has been hidden or reset by a moderator"`
+}
+
+type ReportedGame struct {
+	RID       rid.RID `json:"rid" readOnly:"true"`
+	Slug      string  `json:"slug" readOnly:"true"`
+	Developer string  `json:"developer" readOnly:"true" doc:"The slug of the game's developer"`
+}
+
+// ReportTarget is the reported content. Only the fields for the report's targetKind are set.
+type ReportTarget struct {
+	User        *UserSummary    `json:"user,omitempty" readOnly:"true" doc:"Set for user and avatar reports"`
+	Avatar      *ReportedAvatar `json:"avatar,omitempty" readOnly:"true" doc:"Set for avatar reports"`
+	Game        *ReportedGame   `json:"game,omitempty" readOnly:"true" doc:"Set for game and achievement reports"`
+	Achievement string          `json:"achievement,omitempty" readOnly:"true" doc:"The slug of the achievement, for achievement reports"`
+}
+
+type ContentReport struct {
+	RID            rid.RID                   `json:"rid" readOnly:"true"`
+	CreatedAt      time.Time                 `json:"createdAt" readOnly:"true"`
+	TargetKind     internal.ReportTargetKind `json:"targetKind" readOnly:"true" enum:"user,avatar,game,achievement"`
+	Target         ReportTarget              `json:"target" readOnly:"true"`
+	Reason         string                    `json:"reason" readOnly:"true" enum:"offensive,spam,impersonation,cheating,other"`
+	Details        string                    `json:"details,omitempty" readOnly:"true"`
+	Reporter       string                    `json:"reporter,omitempty" readOnly:"true" doc:"The slug of the user who made the report"`
+	State          ReportState               `json:"state" readOnly:"true" enum:"open,actioned,dismissed"`
+	ResolvedAt     *time.Time                `json:"resolvedAt,omitempty" readOnly:"true"`
+	ResolvedBy     string                    `json:"resolvedBy,omitempty" readOnly:"true" doc:"The slug of the moderator who resolved the report"`
+	ResolutionNote string                    `json:"resolutionNote,omitempty" readOnly:"true"`
+}
+
+func (r *ContentReport) MapFromRow(row query.GetContentReportsRow) {
+	*r = ContentReport{
+		RID:        rid.From(internal.ContentReportRidPrefix, row.Uuid),
+		CreatedAt:  row.CreatedAt,
+		TargetKind: internal.ReportTargetKind(row.TargetKind),
+		Reason:     row.Reason,
+		Details:    row.Details,
+		State:      ReportState(row.State),
+	}
+
+	if row.ReporterSlug != nil {
+		r.Reporter = *row.ReporterSlug
+	}
+
+	if row.ResolvedAt.Valid {
+		r.ResolvedAt = &row.ResolvedAt.Time
+	}
+
+	if row.ResolvedBySlug != nil {
+		r.ResolvedBy = *row.ResolvedBySlug
+	}
+
+	if row.ResolutionNote != nil {
+		r.ResolutionNote = *row.ResolutionNote
+	}
+
+	if row.TargetUserUuid.Valid && row.TargetUserSlug != nil {
+		r.Target.User = &UserSummary{RID: rid.From(auth.UserRidPrefix, row.TargetUserUuid.UUID), Slug: *row.TargetUserSlug}
+	}
+
+	if row.TargetAvatarUuid.Valid {
+		r.Target.Avatar = &ReportedAvatar{
+			Url:    media.GetAvatarUrl("users", row.TargetAvatarUuid.UUID),
+			Hidden: row.TargetAvatarRemovedAt.Valid,
+		}
+	}
+
+	if row.TargetGameUuid.Valid && row.TargetGameSlug != nil && row.TargetDeveloperSlug != nil {
+		r.Target.Game = &ReportedGame{
+			RID:       rid.From(internal.GameRidPrefix, row.TargetGameUuid.UUID),
+			Slug:      *row.TargetGameSlug,
+			Developer: *row.TargetDeveloperSlug,
+		}
+	}
+
+	if row.TargetAchievementSlug != nil {
+		r.Target.Achievement = *row.TargetAchievementSlug
+	}
+}
+
+type ContentReportList struct {
+	Reports []ContentReport `json:"reports"`
+}
+
+type GetReportsInput struct {
+	State      validation.Optional[string]  `query:"state,omitempty" enum:"open,actioned,dismissed" doc:"Only return reports in this state"`
+	TargetKind validation.Optional[string]  `query:"targetKind,omitempty" enum:"user,avatar,game,achievement" doc:"Only return reports of this kind of content"`
+	After      validation.Optional[rid.RID] `query:"after,omitempty" doc:"Only return reports older than this report"`
+	Limit      validation.Optional[int]     `query:"limit" minimum:"1" maximum:"50" doc:"default = 20"`
+}
+
+type GetReportsOutput struct {
+	Body ContentReportList
+}
+
+func HandleGetReports(ctx context.Context, input *GetReportsInput) (*GetReportsOutput, error) {
+	params := query.GetContentReportsParams{Limit: int32(input.Limit.ValueOr(20))}
+	if input.State.HasValue {
+		params.State = &input.State.Value
+	}
+
+	if input.TargetKind.HasValue {
+		params.TargetKind = &input.TargetKind.Value
+	}
+
+	// TODO: a huma validator for rid prefix...
+	if input.After.HasValue {
+		if input.After.Value.Prefix != internal.ContentReportRidPrefix {
+			return nil, huma.Error400BadRequest("invalid report id")
+		}
+
+		params.After = uuid.NullUUID{UUID: input.After.Value.ID, Valid: true}
+	}
+
+	rows, err := db.Queries.GetContentReports(ctx, params)
+	if err != nil {
+		return nil, eris.Wrap(err, "error getting content reports")
+	}
+
+	reports := make([]ContentReport, len(rows))
+	for idx := range rows {
+		reports[idx].MapFromRow(rows[idx])
+	}
+
+	return &GetReportsOutput{Body: ContentReportList{Reports: reports}}, nil
+}
+
+type ResolveReportInput struct {
+	Report rid.RID `path:"report"`
+	Body   struct {
+		State      ReportState `json:"state" enum:"actioned,dismissed"`
+		HideAvatar bool        `json:"hideAvatar,omitempty" required:"false" doc:"Hide the reported avatar, reverting the user to their previous avatar. Only for actioned avatar reports."`
+		Note       string      `json:"note,omitempty" required:"false" maxLength:"1024" doc:"Why the report was resolved this way, for other moderators"`
+	}
+}
+
+func HandleResolveReport(ctx context.Context, input *ResolveReportInput) (*struct{}, error) {
+	principal, actorRole, err := actor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// TODO: a huma validator for rid prefix...
+	if input.Report.Prefix != internal.ContentReportRidPrefix {
+		return nil, huma.Error404NotFound("report not found")
+	}
+
+	var note *string
+	if len(input.Body.Note) > 0 {
+		note = &input.Body.Note
+	}
+
+	var hiddenAvatarUserId int32
+	err = db.DB.Transact(ctx, func(ctx context.Context, qtx *query.Queries) error {
+		report, err := qtx.GetContentReportForUpdate(ctx, input.Report.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return huma.Error404NotFound("report not found")
+		}
+
+		if err != nil {
+			return eris.Wrap(err, "error getting content report")
+		}
+
+		if ReportState(report.State) != ReportOpen {
+			return huma.Error409Conflict("the report has already been resolved")
+		}
+
+		if !input.Body.HideAvatar {
+			return qtx.ResolveContentReport(ctx, query.ResolveContentReportParams{
+				State:            string(input.Body.State),
+				ResolvedByUserID: pgtype.Int4{Int32: principal.User.ID, Valid: true},
+				ResolutionNote:   note,
+				ID:               report.ID,
+			})
+		}
+
+		if internal.ReportTargetKind(report.TargetKind) != internal.ReportTargetAvatar || input.Body.State != ReportActioned {
+			return huma.Error400BadRequest("only actioned avatar reports can hide the avatar")
+		}
+
+		userRole, err := auth.GetUserRole(ctx, qtx, report.TargetUserID.Int32)
+		if err != nil {
+			return err
+		}
+
+		if !actorRole.Outranks(userRole) {
+			return huma.Error403Forbidden("you can only hide the avatars of users you outrank")
+		}
+
+		// the avatar may already have been reset, in which case the reports are still actioned
+		if _, err = qtx.RemoveUserAvatar(ctx, query.RemoveUserAvatarParams{
+			RemovedByUserID: pgtype.Int4{Int32: principal.User.ID, Valid: true},
+			AvatarID:        report.TargetAvatarID.Int32,
+		}); err != nil {
+			return eris.Wrap(err, "error hiding avatar")
+		}
+
+		if _, err = qtx.ResolveOpenAvatarReports(ctx, query.ResolveOpenAvatarReportsParams{
+			ResolvedByUserID: pgtype.Int4{Int32: principal.User.ID, Valid: true},
+			ResolutionNote:   note,
+			AvatarID:         report.TargetAvatarID,
+		}); err != nil {
+			return eris.Wrap(err, "error resolving avatar reports")
+		}
+
+		hiddenAvatarUserId = report.TargetUserID.Int32
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if hiddenAvatarUserId != 0 {
+		auth.RecordAdminSecurityEvent(ctx, principal.User.ID, hiddenAvatarUserId, auth.SecurityEventAvatarRemoved, map[string]string{
+			"report": input.Report.String(),
+		})
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,335 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dresswithpockets/openstats/app/auth"
+	"github.com/dresswithpockets/openstats/app/db"
+	"github.com/dresswithpockets/openstats/app/db/query"
+	"github.com/dresswithpockets/openstats/app/internal"
+	"github.com/dresswithpockets/openstats/app/rid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rotisserie/eris"
+)
+
+const SuspensionRidPrefix = "us"
+
+type Suspension struct {
+	RID       rid.RID    `json:"rid" readOnly:"true"`
+	CreatedAt time.Time  `json:"createdAt" readOnly:"true"`
+	Reason    string     `json:"reason" readOnly:"true"`
+	EndsAt    *time.Time `json:"endsAt,omitempty" readOnly:"true" doc:"Not set if the user was banned"`
+	LiftedAt  *time.Time `json:"liftedAt,omitempty" readOnly:"true" doc:"Set if an admin ended the suspension early"`
+	Actor     string     `json:"actor,omitempty" readOnly:"true" doc:"The slug of the admin who suspended the user"`
+	LiftedBy  string     `json:"liftedBy,omitempty" readOnly:"true" doc:"The slug of the admin who lifted the suspension"`
+}
+
+func (s *Suspension) MapFromRow(row query.GetUserSuspensionsRow) {
+	*s = Suspension{
+		RID:       rid.From(SuspensionRidPrefix, row.Uuid),
+		CreatedAt: row.CreatedAt,
+		Reason:    row.Reason,
+	}
+
+	if row.EndsAt.Valid {
+		s.EndsAt = &row.EndsAt.Time
+	}
+
+	if row.LiftedAt.Valid {
+		s.LiftedAt = &row.LiftedAt.Time
+	}
+
+	if row.ActorSlug != nil {
+		s.Actor = *row.ActorSlug
+	}
+
+	if row.LiftedBySlug != nil {
+		s.LiftedBy = *row.LiftedBySlug
+	}
+}
+
+func (s *Suspension) IsActive(now time.Time) bool {
+	return s.LiftedAt == nil && (s.EndsAt == nil || s.EndsAt.After(now))
+}
+
+type AdminUser struct {
+	RID         rid.RID      `json:"rid" readOnly:"true"`
+	CreatedAt   time.Time    `json:"createdAt" readOnly:"true"`
+	Slug        string       `json:"slug" readOnly:"true"`
+	DisplayName string       `json:"displayName,omitempty" readOnly:"true"`
+	Role        auth.Role    `json:"role,omitempty" readOnly:"true" enum:"root,admin,moderator"`
+	Suspended   bool         `json:"suspended" readOnly:"true" doc:"Whether the user is currently suspended or banned"`
+	Suspensions []Suspension `json:"suspensions" readOnly:"true" doc:"Every time the user has been suspended or banned, newest first"`
+}
+
+type UserInput struct {
+	User rid.RID `path:"user"`
+}
+
+type GetUserOutput struct {
+	Body AdminUser
+}
+
+func HandleGetUser(ctx context.Context, input *UserInput) (*GetUserOutput, error) {
+	user, err := findUser(ctx, input.User)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := auth.GetUserRole(ctx, db.Queries, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	suspensionRows, err := db.Queries.GetUserSuspensions(ctx, user.ID)
+	if err != nil {
+		return nil, eris.Wrap(err, "error getting user suspensions")
+	}
+
+	output := &GetUserOutput{
+		Body: AdminUser{
+			RID:         input.User,
+			CreatedAt:   user.CreatedAt,
+			Slug:        user.Slug,
+			Role:        role,
+			Suspensions: make([]Suspension, len(suspensionRows)),
+		},
+	}
+
+	now := time.Now()
+	for idx := range suspensionRows {
+		output.Body.Suspensions[idx].MapFromRow(suspensionRows[idx])
+		output.Body.Suspended = output.Body.Suspended || output.Body.Suspensions[idx].IsActive(now)
+	}
+
+	displayName, err := db.Queries.GetUserLatestDisplayName(ctx, user.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, eris.Wrap(err, "error getting user display name")
+	}
+
+	output.Body.DisplayName = displayName.DisplayName
+	return output, nil
+}
+
+type Email struct {
+	Email       string     `json:"email" readOnly:"true"`
+	CreatedAt   time.Time  `json:"createdAt" readOnly:"true"`
+	ConfirmedAt *time.Time `json:"confirmedAt,omitempty" readOnly:"true"`
+}
+
+type EmailList struct {
+	Emails []Email `json:"emails"`
+}
+
+type GetUserEmailsOutput struct {
+	Body EmailList
+}
+
+func HandleGetUserEmails(ctx context.Context, input *UserInput) (*GetUserEmailsOutput, error) {
+	user, err := findUser(ctx, input.User)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Queries.GetUserEmails(ctx, user.ID)
+	if err != nil {
+		return nil, eris.Wrap(err, "error getting user emails")
+	}
+
+	emails := make([]Email, len(rows))
+	for idx, row := range rows {
+		emails[idx] = Email{Email: row.Email, CreatedAt: row.CreatedAt}
+		if row.ConfirmedAt.Valid {
+			emails[idx].ConfirmedAt = &row.ConfirmedAt.Time
+		}
+	}
+
+	return &GetUserEmailsOutput{Body: EmailList{Emails: emails}}, nil
+}
+
+type GetUserGameTokensOutput struct {
+	Body internal.GameTokenList
+}
+
+func HandleGetUserGameTokens(ctx context.Context, input *UserInput) (*GetUserGameTokensOutput, error) {
+	user, err := findUser(ctx, input.User)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Queries.FindUserGameTokens(ctx, user.Uuid)
+	if err != nil {
+		return nil, eris.Wrap(err, "error getting user game tokens")
+	}
+
+	gameTokens := make([]internal.GameToken, len(rows))
+	for idx := range rows {
+		gameTokens[idx].MapFromRow(rows[idx])
+	}
+
+	return &GetUserGameTokensOutput{Body: internal.GameTokenList{Tokens: gameTokens}}, nil
+}
+
+type PostUserSuspensionInput struct {
+	User rid.RID `path:"user"`
+	Body struct {
+		Reason string     `json:"reason" minLength:"1" maxLength:"1024" doc:"Shown to the user when they try to sign in"`
+		EndsAt *time.Time `json:"endsAt,omitempty" required:"false" doc:"When the suspension ends. The user is banned if this isn't set."`
+	}
+}
+
+type PostUserSuspensionOutput struct {
+	Body Suspension
+}
+
+func HandlePostUserSuspension(ctx context.Context, input *PostUserSuspensionInput) (*PostUserSuspensionOutput, error) {
+	if input.Body.EndsAt != nil && !input.Body.EndsAt.After(time.Now()) {
+		return nil, huma.Error400BadRequest("endsAt must be in the future")
+	}
+
+	principal, user, err := findOutrankedUser(ctx, input.User)
+	if err != nil {
+		return nil, err
+	}
+
+	suspension, err := auth.SuspendUser(ctx, principal.User.ID, user.ID, input.Body.Reason, input.Body.EndsAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PostUserSuspensionOutput{
+		Body: Suspension{
+			RID:       rid.From(SuspensionRidPrefix, suspension.Uuid),
+			CreatedAt: suspension.CreatedAt,
+			Reason:    suspension.Reason,
+			EndsAt:    input.Body.EndsAt,
+			Actor:     principal.User.Slug,
+		},
+	}, nil
+}
+
+func HandleDeleteUserSuspension(ctx context.Context, input *UserInput) (*struct{}, error) {
+	principal, user, err := findOutrankedUser(ctx, input.User)
+	if err != nil {
+		return nil, err
+	}
+
+	lifted, err := auth.LiftUserSuspension(ctx, principal.User.ID, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !lifted {
+		return nil, huma.Error404NotFound("the user isn't suspended")
+	}
+
+	return nil, nil
+}
+
+type PutUserSlugInput struct {
+	User rid.RID `path:"user"`
+	Body struct {
+		Slug string `json:"slug" pattern:"[a-z0-9-]+" patternDescription:"lowercase-alphanum with dashes" minLength:"2" maxLength:"64"`
+	}
+}
+
+func HandlePutUserSlug(ctx context.Context, input *PutUserSlugInput) (*struct{}, error) {
+	principal, user, err := findOutrankedUser(ctx, input.User)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Slug == input.Body.Slug {
+		return nil, nil
+	}
+
+	err = db.DB.Transact(ctx, func(ctx context.Context, qtx *query.Queries) error {
+		if err := qtx.ForceUserSlug(ctx, query.ForceUserSlugParams{Slug: input.Body.Slug, UserID: user.ID}); err != nil {
+			return err
+		}
+
+		return qtx.AddUserSlugHistory(ctx, query.AddUserSlugHistoryParams{UserID: user.ID, Slug: input.Body.Slug})
+	})
+	if db.IsUniqueConstraintErr(err) {
+		return nil, huma.Error409Conflict("that slug is already in use")
+	}
+
+	if err != nil {
+		return nil, eris.Wrap(err, "error changing user slug")
+	}
+
+	auth.RecordAdminSecurityEvent(ctx, principal.User.ID, user.ID, auth.SecurityEventSlugChanged, map[string]string{
+		"from": user.Slug,
+		"to":   input.Body.Slug,
+	})
+	return nil, nil
+}
+
+func HandleDeleteUserAvatar(ctx context.Context, input *UserInput) (*struct{}, error) {
+	principal, user, err := findOutrankedUser(ctx, input.User)
+	if err != nil {
+		return nil, err
+	}
+
+	removed, err := db.Queries.RemoveUserAvatars(ctx, query.RemoveUserAvatarsParams{
+		RemovedByUserID: pgtype.Int4{Int32: principal.User.ID, Valid: true},
+		UserID:          user.ID,
+	})
+	if err != nil {
+		return nil, eris.Wrap(err, "error removing user avatars")
+	}
+
+	if removed == 0 {
+		return nil, huma.Error404NotFound("the user has no avatar")
+	}
+
+	auth.RecordAdminSecurityEvent(ctx, principal.User.ID, user.ID, auth.SecurityEventAvatarRemoved, nil)
+	return nil, nil
+}
+
+type PutUserRoleInput struct {
+	User rid.RID `path:"user"`
+	Body struct {
+		Role auth.Role `json:"role" enum:"admin,moderator"`
+	}
+}
+
+func HandlePutUserRole(ctx context.Context, input *PutUserRoleInput) (*struct{}, error) {
+	principal, actorRole, err := actor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !actorRole.Outranks(input.Body.Role) {
+		return nil, huma.Error403Forbidden("you can only grant roles below your own")
+	}
+
+	_, user, err := findOutrankedUser(ctx, input.User)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, auth.SetUserRole(ctx, principal.User.ID, user.ID, input.Body.Role)
+}
+
+func HandleDeleteUserRole(ctx context.Context, input *UserInput) (*struct{}, error) {
+	principal, user, err := findOutrankedUser(ctx, input.User)
+	if err != nil {
+		return nil, err
+	}
+
+	revoked, err := auth.RevokeUserRole(ctx, principal.User.ID, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !revoked {
+		return nil, huma.Error404NotFound("the user has no role")
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,214 @@
+package anomalies
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/dresswithpockets/openstats/app/db"
+	"github.com/dresswithpockets/openstats/app/db/query"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rotisserie/eris"
+)
+
+const AnomalyRidPrefix = "aa"
+
+type Kind string
+
+// these must match the kinds allowed by the achievement_anomaly table
+const (
+	BurstUnlock          Kind = "burst-unlock"
+	UnlockAtSessionStart Kind = "unlock-at-session-start"
+	ProgressJump         Kind = "progress-jump"
+)
+
+type State string
+
+const (
+	Open      State = "open"
+	Dismissed State = "dismissed"
+	Revoked   State = "revoked"
+)
+
+const (
+	// BurstWindow is how close together unlocks must be to count towards a burst
+	BurstWindow = 10 * time.Second
+
+	// BurstMinUnlocks is the fewest unlocks within BurstWindow which are flagged as a burst, so that games with only a
+	// handful of achievements aren't flagged whenever they're finished
+	BurstMinUnlocks = 5
+
+	// BurstMinFraction is the fraction of the game's achievements which must be unlocked within BurstWindow to be
+	// flagged as a burst
+	BurstMinFraction = 0.8
+
+	// SessionStartWindow is how soon after a game session starts that an unlock is flagged
+	SessionStartWindow = 5 * time.Second
+
+	// ProgressJumpMinRequirement is the smallest progress requirement for which progress jumps are flagged. Progress
+	// towards achievements with small requirements, like 1, always jumps.
+	ProgressJumpMinRequirement = 10
+
+	// ProgressJumpMaxFraction is the largest fraction of an achievement's requirement that progress may jump by in one
+	// submission before it's flagged
+	ProgressJumpMaxFraction = 0.5
+)
+
+var (
+	ErrAnomalyNotFound        = errors.New("anomaly not found")
+	ErrAnomalyAlreadyReviewed = errors.New("the anomaly has already been reviewed")
+)
+
+// ProgressChange is a change to a user's progress towards an achievement, as saved by a progress submission
+type ProgressChange struct {
+	UserID              int32
+	AchievementID       int32
+	OldProgress         int32
+	Progress            int32
+	ProgressRequirement int32
+}
+
+// Unlocked returns true if the change unlocked the achievement
+func (c ProgressChange) Unlocked() bool {
+	return c.OldProgress < c.ProgressRequirement && c.Progress >= c.ProgressRequirement
+}
+
+// Check flags any of the changes submitted in the game session which look like cheating. Flagged unlocks are
+// kept, but are open for review by moderators and the game's developer. Each unlock is only flagged once per kind while
+// it's open.
+func Check(ctx context.Context, sessionUuid uuid.UUID, changes []ProgressChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	session, err := db.Queries.GetGameSessionStart(ctx, sessionUuid)
+	if err != nil {
+		return eris.Wrap(err, "error getting game session")
+	}
+
+	sessionId := uuid.NullUUID{UUID: session.ID, Valid: true}
+	now := time.Now()
+	anyUnlocked := false
+	for _, change := range changes {
+		if change.Unlocked() {
+			anyUnlocked = true
+			if sessionAge := now.Sub(session.CreatedAt); sessionAge < SessionStartWindow {
+				err = flag(ctx, change.UserID, change.AchievementID, sessionId, UnlockAtSessionStart, map[string]string{
+					"sessionAge": sessionAge.Round(time.Millisecond).String(),
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		jump := change.Progress - change.OldProgress
+		if change.ProgressRequirement >= ProgressJumpMinRequirement && float64(jump) > ProgressJumpMaxFraction*float64(change.ProgressRequirement) {
+			err = flag(ctx, change.UserID, change.AchievementID, sessionId, ProgressJump, map[string]string{
+				"from":        strconv.Itoa(int(change.OldProgress)),
+				"to":          strconv.Itoa(int(change.Progress)),
+				"requirement": strconv.Itoa(int(change.ProgressRequirement)),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if !anyUnlocked {
+		return nil
+	}
+
+	// the burst may have been spread over several submissions, so every recent unlock in the game is counted
+	unlocks, err := db.Queries.GetRecentUnlocks(ctx, query.GetRecentUnlocksParams{
+		GameSessionID: session.ID,
+		UnlockedSince: now.Add(-BurstWindow),
+	})
+	if err != nil {
+		return eris.Wrap(err, "error getting recent unlocks")
+	}
+
+	if len(unlocks) < BurstMinUnlocks || float64(len(unlocks)) < BurstMinFraction*float64(session.AchievementCount) {
+		return nil
+	}
+
+	details := map[string]string{
+		"unlocks":      strconv.Itoa(len(unlocks)),
+		"achievements": strconv.FormatInt(session.AchievementCount, 10),
+		"window":       BurstWindow.String(),
+	}
+	for _, unlock := range unlocks {
+		if err = flag(ctx, session.UserID, unlock.AchievementID, sessionId, BurstUnlock, details); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func flag(ctx context.Context, userId, achievementId int32, sessionId uuid.NullUUID, kind Kind, details map[string]string) error {
+	detailsJson, err := json.Marshal(details)
+	if err != nil {
+		return eris.Wrap(err, "error encoding anomaly details")
+	}
+
+	err = db.Queries.CreateAchievementAnomaly(ctx, query.CreateAchievementAnomalyParams{
+		UserID:        userId,
+		AchievementID: achievementId,
+		GameSessionID: sessionId,
+		Kind:          string(kind),
+		Details:       detailsJson,
+	})
+	return eris.Wrap(err, "error flagging achievement anomaly")
+}
+
+// Resolve reviews an open anomaly, as the reviewer. Revoking it revokes the unlock, which resolves every other open
+// anomaly flagged for the same unlock. If gameUuid is set, the anomaly must belong to that game.
+func Resolve(ctx context.Context, reviewerId int32, anomalyUuid uuid.UUID, gameUuid uuid.NullUUID, state State) error {
+	reviewer := pgtype.Int4{Int32: reviewerId, Valid: true}
+	return db.DB.Transact(ctx, func(ctx context.Context, qtx *query.Queries) error {
+		anomaly, err := qtx.GetAchievementAnomalyForUpdate(ctx, query.GetAchievementAnomalyForUpdateParams{
+			Uuid:     anomalyUuid,
+			GameUuid: gameUuid,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrAnomalyNotFound
+		}
+
+		if err != nil {
+			return eris.Wrap(err, "error getting achievement anomaly")
+		}
+
+		if State(anomaly.State) != Open {
+			return ErrAnomalyAlreadyReviewed
+		}
+
+		if state == Dismissed {
+			err = qtx.DismissAchievementAnomaly(ctx, query.DismissAchievementAnomalyParams{
+				ReviewedByUserID: reviewer,
+				ID:               anomaly.ID,
+			})
+			return eris.Wrap(err, "error dismissing achievement anomaly")
+		}
+
+		err = qtx.RevokeAchievementProgress(ctx, query.RevokeAchievementProgressParams{
+			RevokedByUserID: reviewer,
+			UserID:          anomaly.UserID,
+			AchievementID:   anomaly.AchievementID,
+		})
+		if err != nil {
+			return eris.Wrap(err, "error revoking achievement progress")
+		}
+
+		err = qtx.ResolveRevokedAchievementAnomalies(ctx, query.ResolveRevokedAchievementAnomaliesParams{
+			ReviewedByUserID: reviewer,
+			UserID:           anomaly.UserID,
+			AchievementID:    anomaly.AchievementID,
+		})
+		return eris.Wrap(err, "error resolving achievement anomalies")
+	})
+}
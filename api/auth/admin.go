@@ -2,38 +2,271 @@ package auth
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
 	"errors"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
 	"github.com/dresswithpockets/openstats/app/db"
 	"github.com/dresswithpockets/openstats/app/db/query"
+	"github.com/dresswithpockets/openstats/app/env"
+	"github.com/dresswithpockets/openstats/app/log"
+	"github.com/dresswithpockets/openstats/app/password"
+	"github.com/dresswithpockets/openstats/app/rid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rotisserie/eris"
 )
 
+// Role grants a user access to admin operations. Each role includes the roles below it.
+type Role string
+
 const (
-	RootUserDisplayName = "Admin"
-	RootUserEmail       = ""
-	RootUserSlug        = "openstats"
-	RootUserPass        = "openstatsadmin"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+	RoleRoot      Role = "root"
+)
+
+var roleRanks = map[Role]int{
+	RoleModerator: 1,
+	RoleAdmin:     2,
+	RoleRoot:      3,
+}
+
+// Includes returns true if the role grants everything that other grants
+func (r Role) Includes(other Role) bool {
+	rank, ok := roleRanks[r]
+	return ok && rank >= roleRanks[other]
+}
+
+// Outranks returns true if the role is above other. Admins may only act on users they outrank, so no one can act on
+// users with their own role, including themselves.
+func (r Role) Outranks(other Role) bool {
+	return roleRanks[r] > roleRanks[other]
+}
+
+var (
+	ErrInvalidAdminSetupToken = errors.New("invalid admin setup token")
+	ErrRootExists             = errors.New("a root user already exists")
 )
 
-func AddRootAdminUser(ctx context.Context) error {
-	_, newUserErr := AddNewUser(ctx, RootUserDisplayName, RootUserEmail, RootUserSlug, RootUserPass)
-	// this function is expected to be idempotent - if called multiple times, it shouldn't fail even if the admin
-	// already exists
-	if newUserErr != nil && !errors.Is(newUserErr, db.ErrSlugAlreadyInUse) {
-		return newUserErr
+// GetUserRole gets the user's role, or an empty Role if they don't have one
+func GetUserRole(ctx context.Context, q *query.Queries, userId int32) (Role, error) {
+	role, err := q.GetUserRole(ctx, userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
 	}
 
-	return nil
+	if err != nil {
+		return "", eris.Wrap(err, "error getting user role")
+	}
+
+	return Role(role), nil
+}
+
+// HasRole returns true if the user's role includes role
+func HasRole(ctx context.Context, userId int32, role Role) (bool, error) {
+	userRole, err := GetUserRole(ctx, db.Queries, userId)
+	return userRole.Includes(role), err
 }
 
-func IsAdmin(user query.User) bool {
-	// TODO: add distinction between Admin and Root - Root should be able to add non-root Admin users, which can do
-	//       everything except add other Admins
-	return user.Slug == RootUserSlug
+func IsAdmin(ctx context.Context, userId int32) (bool, error) {
+	return HasRole(ctx, userId, RoleAdmin)
 }
 
 // IsRoot returns true if the user is determined to have Root privileges
+func IsRoot(ctx context.Context, userId int32) (bool, error) {
+	return HasRole(ctx, userId, RoleRoot)
+}
+
+func hashAdminSetupToken(token string) []byte {
+	hash := sha256.Sum256([]byte(token))
+	return hash[:]
+}
+
+// the user which was made admin before roles existed, by its slug. It was created with a well-known password.
+const (
+	legacyRootUserSlug     = "openstats"
+	legacyRootUserPassword = "openstatsadmin"
+)
+
+// disableLegacyRootUser removes the password of the legacy admin user if it's still the well-known one it was created
+// with, so no one can sign in with it. The user never had an email, so the password can't be reset - the account can
+// only be used again by an admin.
+func disableLegacyRootUser(ctx context.Context) error {
+	user, err := db.Queries.FindUserBySlugWithPassword(ctx, legacyRootUserSlug)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+
+	if err != nil {
+		return eris.Wrap(err, "error finding the legacy admin user")
+	}
+
+	if password.VerifyPassword(legacyRootUserPassword, user.EncodedHash) != nil {
+		return nil
+	}
+
+	if _, err = db.Queries.DeleteUserPassword(ctx, user.ID); err != nil {
+		return eris.Wrap(err, "error removing the legacy admin user's password")
+	}
+
+	RecordSecurityEvent(ctx, user.ID, SecurityEventPasswordRemoved, map[string]string{"reason": "well-known-password"})
+	log.Logger.Warn("removed the well-known password of the legacy admin user, so it can no longer sign in", "slug", legacyRootUserSlug)
+	return nil
+}
+
+// BootstrapRoot makes sure there's a way to get a root user, while there is none. If OPENSTATS_ROOT_USER is set to a
+// user's RID, that user is made root. Otherwise, a one-time setup token is created and logged the first time the API
+// starts - any signed-in user can present it to /internal/session/admin-setup to become root. If the logged token is
+// lost, OPENSTATS_REGENERATE_ADMIN_SETUP_TOKEN replaces it with a new one.
 //
-//goland:noinspection GoUnusedExportedFunction
-func IsRoot(user query.User) bool {
-	return user.Slug == RootUserSlug
+// OPENSTATS_ROOT_USER is a RID rather than a slug, since slugs can be changed and claimed by anyone who signs up.
+func BootstrapRoot(ctx context.Context) error {
+	if err := disableLegacyRootUser(ctx); err != nil {
+		return err
+	}
+
+	rootExists, err := db.Queries.RootExists(ctx)
+	if err != nil || rootExists {
+		return eris.Wrap(err, "error checking for a root user")
+	}
+
+	if value := env.GetString("OPENSTATS_ROOT_USER"); len(value) > 0 {
+		userRid, err := rid.ParseString(value)
+		if err != nil || userRid.Prefix != UserRidPrefix {
+			return eris.Errorf("OPENSTATS_ROOT_USER must be a user RID e.g. u_AZhjuMmhePWkHFALenFEfg, not '%s'", value)
+		}
+
+		user, err := db.Queries.FindUser(ctx, userRid.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			// the setup token is still created, so there's another way to get a root user
+			log.Logger.Warn("OPENSTATS_ROOT_USER doesn't exist, so it can't be made root", "rid", value)
+		} else if err != nil {
+			return eris.Wrap(err, "error finding OPENSTATS_ROOT_USER")
+		} else {
+			if err = db.Queries.SetUserRole(ctx, query.SetUserRoleParams{UserID: user.ID, Role: string(RoleRoot)}); err != nil {
+				return eris.Wrap(err, "error making OPENSTATS_ROOT_USER root")
+			}
+
+			RecordSecurityEvent(ctx, user.ID, SecurityEventRoleGranted, map[string]string{"role": string(RoleRoot), "via": "env"})
+			return db.Queries.DeleteAdminSetupToken(ctx)
+		}
+	}
+
+	token := rand.Text()
+	created := int64(1)
+	if env.GetBool("OPENSTATS_REGENERATE_ADMIN_SETUP_TOKEN") {
+		err = db.Queries.ReplaceAdminSetupToken(ctx, hashAdminSetupToken(token))
+	} else {
+		created, err = db.Queries.CreateAdminSetupToken(ctx, hashAdminSetupToken(token))
+	}
+
+	if err != nil {
+		return eris.Wrap(err, "error creating admin setup token")
+	}
+
+	// only the hash is stored, so the token can only be logged when it's created
+	if created > 0 {
+		log.Logger.Warn("there is no root user. Sign in as the user who should be root, and POST this token to /internal/session/admin-setup", "token", token)
+	}
+
+	return nil
+}
+
+// ClaimRoot makes the user root with the setup token created by BootstrapRoot. The token can only be used once, and
+// only while there is no root.
+func ClaimRoot(ctx context.Context, userId int32, token string) error {
+	err := db.DB.Transact(ctx, func(ctx context.Context, qtx *query.Queries) error {
+		consumed, err := qtx.ConsumeAdminSetupToken(ctx, hashAdminSetupToken(token))
+		if err != nil {
+			return eris.Wrap(err, "error consuming admin setup token")
+		}
+
+		if consumed == 0 {
+			return ErrInvalidAdminSetupToken
+		}
+
+		rootExists, err := qtx.RootExists(ctx)
+		if err != nil {
+			return eris.Wrap(err, "error checking for a root user")
+		}
+
+		if rootExists {
+			return ErrRootExists
+		}
+
+		return qtx.SetUserRole(ctx, query.SetUserRoleParams{UserID: userId, Role: string(RoleRoot)})
+	})
+	if err != nil {
+		return err
+	}
+
+	RecordSecurityEvent(ctx, userId, SecurityEventRoleGranted, map[string]string{"role": string(RoleRoot), "via": "setup-token"})
+	return nil
+}
+
+// SetUserRole grants the role to the user, replacing any role they had, as an action taken by the actor
+func SetUserRole(ctx context.Context, actorUserId, userId int32, role Role) error {
+	err := db.Queries.SetUserRole(ctx, query.SetUserRoleParams{
+		UserID:          userId,
+		Role:            string(role),
+		GrantedByUserID: pgtype.Int4{Int32: actorUserId, Valid: true},
+	})
+	if err != nil {
+		return eris.Wrap(err, "error setting user role")
+	}
+
+	RecordAdminSecurityEvent(ctx, actorUserId, userId, SecurityEventRoleGranted, map[string]string{"role": string(role)})
+	return nil
+}
+
+// RevokeUserRole removes the user's role, as an action taken by the actor. It returns false if they didn't have one.
+func RevokeUserRole(ctx context.Context, actorUserId, userId int32) (bool, error) {
+	rows, err := db.Queries.DeleteUserRole(ctx, userId)
+	if err != nil {
+		return false, eris.Wrap(err, "error revoking user role")
+	}
+
+	if rows > 0 {
+		RecordAdminSecurityEvent(ctx, actorUserId, userId, SecurityEventRoleRevoked, nil)
+	}
+
+	return rows > 0, nil
+}
+
+// CreateRequireRoleHandler rejects requests unless they're made by a user whose role includes role. Third-party apps
+// can never act as admins, even on behalf of one.
+func CreateRequireRoleHandler(api huma.API, role Role) func(ctx huma.Context, next func(huma.Context)) {
+	return func(ctx huma.Context, next func(huma.Context)) {
+		principal, ok := GetPrincipal(ctx.Context())
+		if !ok {
+			writeUnauthenticatedErr(api, ctx)
+			return
+		}
+
+		if principal.Scopes != nil {
+			_ = huma.WriteErr(api, ctx, http.StatusForbidden, "third-party apps can't perform admin operations")
+			return
+		}
+
+		hasRole, err := HasRole(ctx.Context(), principal.User.ID, role)
+		if err != nil {
+			log.Logger.Error("error checking user role", "error", err)
+			_ = huma.WriteErr(api, ctx, http.StatusInternalServerError, "")
+			return
+		}
+
+		if !hasRole {
+			_ = huma.WriteErr(api, ctx, http.StatusForbidden, "requires the "+string(role)+" role")
+			return
+		}
+
+		next(ctx)
+	}
+}
+
+func CreateRequireAdminAuthHandler(api huma.API) func(ctx huma.Context, next func(huma.Context)) {
+	return CreateRequireRoleHandler(api, RoleAdmin)
 }
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/dresswithpockets/openstats/app/db"
+	"github.com/dresswithpockets/openstats/app/db/query"
+	"github.com/dresswithpockets/openstats/app/log"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// SecurityEventKind is the kind of a security event in a user's security log
+type SecurityEventKind string
+
+const (
+	SecurityEventSignIn           SecurityEventKind = "sign-in"
+	SecurityEventSignInFailed     SecurityEventKind = "sign-in-failed"
+	SecurityEventAccountLocked    SecurityEventKind = "account-locked"
+	SecurityEventPasswordChanged  SecurityEventKind = "password-changed"
+	SecurityEventPasswordReset    SecurityEventKind = "password-reset"
+	SecurityEventPasswordRemoved  SecurityEventKind = "password-removed"
+	SecurityEventEmailAdded       SecurityEventKind = "email-added"
+	SecurityEventEmailConfirmed   SecurityEventKind = "email-confirmed"
+	SecurityEventEmailRemoved     SecurityEventKind = "email-removed"
+	SecurityEventGameTokenCreated SecurityEventKind = "game-token-created"
+	SecurityEventGameTokenDeleted SecurityEventKind = "game-token-deleted"
+	SecurityEventGameTokenRotated SecurityEventKind = "game-token-rotated"
+	SecurityEventRoleGranted      SecurityEventKind = "role-granted"
+	SecurityEventRoleRevoked      SecurityEventKind = "role-revoked"
+	SecurityEventUserSuspended    SecurityEventKind = "user-suspended"
+	SecurityEventUserBanned       SecurityEventKind = "user-banned"
+	SecurityEventSuspensionLifted SecurityEventKind = "suspension-lifted"
+	SecurityEventSlugChanged      SecurityEventKind = "slug-changed"
+	SecurityEventAvatarRemoved    SecurityEventKind = "avatar-removed"
+	SecurityEventIdentityLinked   SecurityEventKind = "identity-linked"
+)
+
+// RecordSecurityEvent appends an event to the user's security log, along with the client that caused it. The action
+// being recorded has already happened by the time it's recorded, so errors are logged instead of returned.
+func RecordSecurityEvent(ctx context.Context, userId int32, kind SecurityEventKind, details map[string]string) {
+	recordSecurityEvent(ctx, pgtype.Int4{}, userId, kind, details)
+}
+
+// RecordAdminSecurityEvent appends an event to the user's security log, for an action an admin took on their account
+func RecordAdminSecurityEvent(ctx context.Context, actorUserId, userId int32, kind SecurityEventKind, details map[string]string) {
+	recordSecurityEvent(ctx, pgtype.Int4{Int32: actorUserId, Valid: true}, userId, kind, details)
+}
+
+func recordSecurityEvent(ctx context.Context, actorUserId pgtype.Int4, userId int32, kind SecurityEventKind, details map[string]string) {
+	if details == nil {
+		details = map[string]string{}
+	}
+
+	encodedDetails, err := json.Marshal(details)
+	if err != nil {
+		log.Logger.Error("error encoding security event details", "error", err, "kind", kind)
+		return
+	}
+
+	params := query.CreateSecurityEventParams{
+		UserID:      userId,
+		ActorUserID: actorUserId,
+		Kind:        string(kind),
+		Details:     encodedDetails,
+	}
+
+	if client, ok := GetClientInfo(ctx); ok {
+		params.IpAddress = &client.IPAddress
+		params.UserAgent = &client.UserAgent
+	}
+
+	// the event is recorded even if ctx is cancelled by the client going away, since it's already happened
+	if err = db.Queries.CreateSecurityEvent(context.WithoutCancel(ctx), params); err != nil {
+		log.Logger.Error("error recording security event", "error", err, "kind", kind, "user", userId)
+	}
+}
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"github.com/dresswithpockets/openstats/app/db"
 	"github.com/dresswithpockets/openstats/app/db/query"
@@ -10,9 +11,12 @@ import (
 	"github.com/dresswithpockets/openstats/app/validation"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/pquerna/otp"
 	"github.com/pquerna/otp/totp"
 	"github.com/rotisserie/eris"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -27,21 +31,27 @@ var ArgonParameters = password.Parameters{
 const (
 	SessionCookieName   = "sessionid"
 	SessionIssuer       = "openstats"
-	SessionAudience     = "openstats"
+	SessionAudience     = "openstats-session"
 	SessionDuration     = time.Hour * 24 * 7
 	SessionJitter       = time.Minute
 	PrincipalContextKey = "principal"
 
 	GameSessionIssuer   = "openstats"
-	GameSessionAudience = "openstats"
+	GameSessionAudience = "openstats-game-session"
 )
 
-var SessionTokenSecret = []byte("blahblahblah")
-
 type Principal struct {
 	User    query.User
 	TokenID uuid.UUID
 	Claims  *jwt.RegisteredClaims
+
+	// Scopes are the OAuth scopes granted to a third-party app's access token. They're nil for first-party sessions,
+	// which have every scope.
+	Scopes []string
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	return p.Scopes == nil || slices.Contains(p.Scopes, scope)
 }
 
 func GetPrincipal(ctx context.Context) (result *Principal, ok bool) {
@@ -81,6 +91,7 @@ var (
 	ErrInvalidDisplayName  = errors.New("invalid display name")
 	ErrInvalidSlug         = errors.New("invalid slug")
 	ErrInvalidPassword     = errors.New("invalid password")
+	ErrInvalidTotpCode     = errors.New("invalid totp code")
 )
 
 func AddNewUser(ctx context.Context, displayName, email, slug, pass string) (newUser *db.CreatedUser, err error) {
@@ -108,39 +119,52 @@ func AddNewUser(ctx context.Context, displayName, email, slug, pass string) (new
 	return db.DB.CreateUser(ctx, slug, encodedPassword, email, displayName)
 }
 
-func ReplaceUserPasswordWithTotpValidation(ctx context.Context, userId int32, otp, newPassword string) error {
+func ReplaceUserPasswordWithTotpValidation(ctx context.Context, userId int32, code, newPassword string) error {
 	if !validation.ValidPassword(newPassword) {
 		return eris.Wrap(ErrInvalidPassword, "validation error")
 	}
 
-	return db.DB.Transact(ctx, func(ctx context.Context, qtx *query.Queries) error {
-		hmacSecret, dbErr := db.Queries.SecretRead(ctx, query.SecretReadParams{
-			Path: db.PrivateUser2faHmacSecretPath,
-			Key:  strconv.FormatInt(int64(userId), 10),
-		})
+	if err := ReserveAttempt(ctx, userId, CodeAttempts); err != nil {
+		return err
+	}
 
-		if dbErr != nil {
-			return eris.Wrap(dbErr, "error getting user hmac secret")
-		}
+	hmacSecret, dbErr := db.Queries.SecretRead(ctx, query.SecretReadParams{
+		Path: db.PrivateUser2faHmacSecretPath,
+		Key:  strconv.FormatInt(int64(userId), 10),
+	})
 
-		validated, validateErr := totp.ValidateCustom(otp, hmacSecret, time.Now(), ValidateOptions)
-		if validateErr != nil {
-			return eris.Wrap(validateErr, "error validating OTP")
-		}
+	if dbErr != nil {
+		return eris.Wrap(dbErr, "error getting user hmac secret")
+	}
 
-		if !validated {
-			return eris.Wrap(validateErr, "couldn't validate OTP")
-		}
+	validated, validateErr := totp.ValidateCustom(code, hmacSecret, time.Now(), ValidateOptions)
+	if validateErr != nil && !errors.Is(validateErr, otp.ErrValidateInputInvalidLength) {
+		return eris.Wrap(validateErr, "error validating OTP")
+	}
+
+	if !validated {
+		return ErrInvalidTotpCode
+	}
 
+	return db.DB.Transact(ctx, func(ctx context.Context, qtx *query.Queries) error {
 		encodedHash, passwordErr := password.EncodePassword(newPassword, ArgonParameters)
 		if passwordErr != nil {
 			return passwordErr
 		}
 
-		return qtx.ReplacePassword(ctx, query.ReplacePasswordParams{
+		if err := qtx.ReplacePassword(ctx, query.ReplacePasswordParams{
 			UserID:      userId,
 			EncodedHash: encodedHash,
-		})
+		}); err != nil {
+			return err
+		}
+
+		// proving they own the account's email also ends any lockout, so locked out users can recover their account
+		if err := ClearFailedAttempts(ctx, qtx, userId, CodeAttempts); err != nil {
+			return err
+		}
+
+		return ClearFailedAttempts(ctx, qtx, userId, SignInAttempts)
 	})
 }
 
@@ -172,16 +196,35 @@ func ReplaceUserPassword(ctx context.Context, userId int32, oldPassword, newPass
 	})
 }
 
+// CreateSessionToken signs the user in. It returns a UserSuspendedError instead if the user is suspended.
 func CreateSessionToken(ctx context.Context, userLookupId uuid.UUID) (signedToken string, token query.Token, err error) {
+	suspension, err := GetUserSuspension(ctx, userLookupId)
+	if err != nil {
+		return
+	}
+
+	if suspension != nil {
+		err = suspension
+		return
+	}
+
 	nowTime := time.Now().UTC()
-	token, err = db.Queries.CreateToken(ctx, query.CreateTokenParams{
+	params := query.CreateTokenParams{
 		Issuer:    SessionIssuer,
 		Subject:   userLookupId.String(),
 		Audience:  SessionAudience,
 		ExpiresAt: nowTime.Add(SessionDuration),
 		NotBefore: nowTime.Add(-SessionJitter),
 		IssuedAt:  nowTime,
-	})
+	}
+
+	// the client is recorded so the user can recognise their sessions
+	if client, ok := GetClientInfo(ctx); ok {
+		params.IpAddress = &client.IPAddress
+		params.UserAgent = &client.UserAgent
+	}
+
+	token, err = db.Queries.CreateToken(ctx, params)
 	if err != nil {
 		return
 	}
@@ -196,7 +239,7 @@ func CreateSessionToken(ctx context.Context, userLookupId uuid.UUID) (signedToke
 		ID:        token.ID.String(),
 	}
 
-	signedToken, err = jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(SessionTokenSecret)
+	signedToken, err = SessionKeys.Sign(claims)
 	if err != nil {
 		return
 	}
@@ -204,11 +247,12 @@ func CreateSessionToken(ctx context.Context, userLookupId uuid.UUID) (signedToke
 	return
 }
 
-func CreateGameSessionToken(ctx context.Context, gameTokenUuid uuid.UUID, userRid, gameRid rid.RID) (signedToken string, gameSession query.GameSession, err error) {
+func CreateGameSessionToken(ctx context.Context, gameTokenUuid uuid.UUID, gameTokenHash []byte, userRid, gameRid rid.RID, scopes []string) (signedToken string, gameSession query.GameSession, err error) {
 	var token query.Token
 	token, gameSession, err = db.DB.CreateGameSessionAndToken(
 		ctx,
 		gameTokenUuid,
+		gameTokenHash,
 		userRid,
 		gameRid,
 		GameSessionIssuer,
@@ -216,21 +260,31 @@ func CreateGameSessionToken(ctx context.Context, gameTokenUuid uuid.UUID, userRi
 		time.Hour,
 		SessionJitter,
 	)
+	if errors.Is(err, sql.ErrNoRows) {
+		// the game token was rotated or expired since the request was authenticated
+		err = ErrGameTokenExpired
+		return
+	}
+
 	if err != nil {
 		return
 	}
 
-	claims := jwt.RegisteredClaims{
-		Issuer:    token.Issuer,
-		Subject:   token.Subject,
-		Audience:  []string{token.Audience},
-		ExpiresAt: jwt.NewNumericDate(token.ExpiresAt),
-		NotBefore: jwt.NewNumericDate(token.NotBefore),
-		IssuedAt:  jwt.NewNumericDate(token.IssuedAt),
-		ID:        token.ID.String(),
+	scope := strings.Join(scopes, " ")
+	claims := GameSessionClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    token.Issuer,
+			Subject:   token.Subject,
+			Audience:  []string{token.Audience},
+			ExpiresAt: jwt.NewNumericDate(token.ExpiresAt),
+			NotBefore: jwt.NewNumericDate(token.NotBefore),
+			IssuedAt:  jwt.NewNumericDate(token.IssuedAt),
+			ID:        token.ID.String(),
+		},
+		Scope: &scope,
 	}
 
-	signedToken, err = jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(SessionTokenSecret)
+	signedToken, err = GameSessionKeys.Sign(claims)
 	if err != nil {
 		return
 	}
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/dresswithpockets/openstats/app/env"
+)
+
+type clientInfoContextKey struct{}
+
+// ClientInfo describes the client that made a request
+type ClientInfo struct {
+	IPAddress string
+	UserAgent string
+}
+
+// ClientInfoMiddleware records the ClientInfo of every request in its context. X-Forwarded-For is only trusted when
+// OPENSTATS_TRUST_PROXY_HEADERS is enabled, i.e. when the API is only reachable through a reverse proxy that sets it.
+func ClientInfoMiddleware(next http.Handler) http.Handler {
+	trustProxyHeaders := env.GetBool("OPENSTATS_TRUST_PROXY_HEADERS")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ipAddress, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ipAddress = r.RemoteAddr
+		}
+
+		if forwardedFor := r.Header.Get("X-Forwarded-For"); trustProxyHeaders && forwardedFor != "" {
+			client, _, _ := strings.Cut(forwardedFor, ",")
+			ipAddress = strings.TrimSpace(client)
+		}
+
+		ctx := context.WithValue(r.Context(), clientInfoContextKey{}, ClientInfo{
+			IPAddress: ipAddress,
+			UserAgent: r.UserAgent(),
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// GetClientInfo gets the ClientInfo recorded by ClientInfoMiddleware, if any
+func GetClientInfo(ctx context.Context) (ClientInfo, bool) {
+	info, ok := ctx.Value(clientInfoContextKey{}).(ClientInfo)
+	return info, ok
+}
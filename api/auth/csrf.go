@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dresswithpockets/openstats/app/env"
+)
+
+// AllowedOrigins gets the origins which may make credentialed cross-origin requests, i.e. the web app's, from
+// OPENSTATS_ALLOWED_ORIGINS
+func AllowedOrigins() []string {
+	var origins []string
+	for _, origin := range env.GetList("OPENSTATS_ALLOWED_ORIGINS") {
+		if origin = strings.TrimSpace(origin); len(origin) > 0 {
+			origins = append(origins, strings.TrimSuffix(origin, "/"))
+		}
+	}
+
+	return origins
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// CreateCsrfHandler rejects state-changing requests made by a browser on behalf of another site. Browsers send
+// Sec-Fetch-Site, and Origin on every cross-origin request, so a request is only allowed if it's same-origin, was
+// directly initiated by the user, or comes from one of the AllowedOrigins. Requests without either header aren't made by
+// browsers, so they can't carry a session cookie the client didn't choose to send.
+//
+// Every request is checked, not just those with a session cookie, so another site can't sign a victim into the
+// attacker's account either.
+func CreateCsrfHandler(api huma.API) func(ctx huma.Context, next func(huma.Context)) {
+	allowedOrigins := AllowedOrigins()
+	return func(ctx huma.Context, next func(huma.Context)) {
+		if isSafeMethod(ctx.Method()) {
+			next(ctx)
+			return
+		}
+
+		fetchSite := ctx.Header("Sec-Fetch-Site")
+		if fetchSite == "same-origin" || fetchSite == "none" {
+			next(ctx)
+			return
+		}
+
+		origin := ctx.Header("Origin")
+		if len(fetchSite) == 0 && len(origin) == 0 {
+			next(ctx)
+			return
+		}
+
+		if len(origin) > 0 && slices.Contains(allowedOrigins, origin) {
+			next(ctx)
+			return
+		}
+
+		_ = huma.WriteErr(api, ctx, http.StatusForbidden, "cross-origin request rejected")
+	}
+}
@@ -0,0 +1,255 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dresswithpockets/openstats/app/db"
+	"github.com/dresswithpockets/openstats/app/db/query"
+	"github.com/dresswithpockets/openstats/app/env"
+	"github.com/dresswithpockets/openstats/app/rid"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rotisserie/eris"
+)
+
+const (
+	DeviceCodeLifetime       = 15 * time.Minute
+	DevicePollInterval       = 5 * time.Second
+	DeviceSlowDownIncrement  = 5 * time.Second
+	DeviceGameTokenComment   = "Device sign in"
+	deviceUserCodeAlphabet   = "BCDFGHJKLMNPQRSTVWXZ"
+	deviceUserCodeHalfLength = 4
+	deviceUserCodeAttempts   = 5
+)
+
+var (
+	ErrUnknownDeviceClient        = errors.New("unknown client")
+	ErrInvalidDeviceCode          = errors.New("device code is invalid")
+	ErrDeviceAuthorizationPending = errors.New("device authorization is pending")
+	ErrDeviceSlowDown             = errors.New("device is polling too quickly")
+	ErrDeviceAccessDenied         = errors.New("device authorization was denied")
+	ErrDeviceCodeExpired          = errors.New("device code has expired")
+	ErrInvalidUserCode            = errors.New("user code is invalid or expired")
+)
+
+// DeviceAuthorization is a started device authorization grant. The DeviceCode is kept secret by the game, and the
+// UserCode is shown to the player to enter on the website.
+type DeviceAuthorization struct {
+	DeviceCode              string
+	UserCode                string
+	VerificationUri         string
+	VerificationUriComplete string
+	ExpiresAt               time.Time
+	Interval                time.Duration
+}
+
+func hashDeviceCode(deviceCode string) []byte {
+	hash := sha256.Sum256([]byte(deviceCode))
+	return hash[:]
+}
+
+// newDeviceUserCode generates a code like BCDF-GHJK. Only consonants are used so codes can't spell words, and they're
+// easy to type on a controller.
+func newDeviceUserCode() (string, error) {
+	var builder strings.Builder
+	alphabetLength := big.NewInt(int64(len(deviceUserCodeAlphabet)))
+	for idx := range deviceUserCodeHalfLength * 2 {
+		if idx == deviceUserCodeHalfLength {
+			builder.WriteByte('-')
+		}
+
+		letter, err := rand.Int(rand.Reader, alphabetLength)
+		if err != nil {
+			return "", eris.Wrap(err, "error generating user code")
+		}
+
+		builder.WriteByte(deviceUserCodeAlphabet[letter.Int64()])
+	}
+
+	return builder.String(), nil
+}
+
+// NormalizeDeviceUserCode uppercases the user code and restores its dash, since players may type it either way
+func NormalizeDeviceUserCode(userCode string) string {
+	userCode = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(userCode))
+	if len(userCode) != deviceUserCodeHalfLength*2 {
+		return userCode
+	}
+
+	return userCode[:deviceUserCodeHalfLength] + "-" + userCode[deviceUserCodeHalfLength:]
+}
+
+// StartDeviceAuthorization starts a device authorization grant for the game
+func StartDeviceAuthorization(ctx context.Context, gameUuid uuid.UUID) (DeviceAuthorization, error) {
+	// expired grants are kept around for a while so games polling them are told they've expired, rather than invalid
+	if err := db.Queries.DeleteExpiredDeviceAuthorizations(ctx); err != nil {
+		return DeviceAuthorization{}, eris.Wrap(err, "error deleting expired device authorizations")
+	}
+
+	verificationUri := env.GetString("OPENSTATS_DEVICE_VERIFICATION_URL")
+
+	// user codes are short enough that they may collide with another pending grant, so a few are tried
+	for range deviceUserCodeAttempts {
+		userCode, err := newDeviceUserCode()
+		if err != nil {
+			return DeviceAuthorization{}, err
+		}
+
+		authorization := DeviceAuthorization{
+			DeviceCode:      rand.Text(),
+			UserCode:        userCode,
+			VerificationUri: verificationUri,
+			ExpiresAt:       time.Now().UTC().Add(DeviceCodeLifetime),
+			Interval:        DevicePollInterval,
+		}
+		authorization.VerificationUriComplete = verificationUri + "?" + url.Values{"code": {authorization.UserCode}}.Encode()
+
+		_, err = db.Queries.CreateDeviceAuthorization(ctx, query.CreateDeviceAuthorizationParams{
+			DeviceCodeHash: hashDeviceCode(authorization.DeviceCode),
+			UserCode:       authorization.UserCode,
+			PollInterval:   int32(authorization.Interval.Seconds()),
+			ExpiresAt:      authorization.ExpiresAt,
+			GameUuid:       gameUuid,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			return DeviceAuthorization{}, ErrUnknownDeviceClient
+		}
+
+		if db.IsUniqueConstraintErr(err) {
+			continue
+		}
+
+		return authorization, eris.Wrap(err, "error creating device authorization")
+	}
+
+	return DeviceAuthorization{}, eris.Errorf("error creating device authorization: no unique user code after %d attempts", deviceUserCodeAttempts)
+}
+
+// FindPendingDeviceAuthorization gets the game requesting authorization, so the player can check it before approving
+func FindPendingDeviceAuthorization(ctx context.Context, userCode string) (query.FindPendingDeviceAuthorizationRow, error) {
+	row, err := db.Queries.FindPendingDeviceAuthorization(ctx, NormalizeDeviceUserCode(userCode))
+	if errors.Is(err, sql.ErrNoRows) {
+		return row, ErrInvalidUserCode
+	}
+
+	return row, eris.Wrap(err, "error finding device authorization")
+}
+
+// ApproveDeviceAuthorization approves the pending grant for the user, so the game receives a game token for them on
+// its next poll
+func ApproveDeviceAuthorization(ctx context.Context, userCode string, userId int32) error {
+	rows, err := db.Queries.ApproveDeviceAuthorization(ctx, query.ApproveDeviceAuthorizationParams{
+		UserID:   pgtype.Int4{Int32: userId, Valid: true},
+		UserCode: NormalizeDeviceUserCode(userCode),
+	})
+	if err != nil {
+		return eris.Wrap(err, "error approving device authorization")
+	}
+
+	if rows == 0 {
+		return ErrInvalidUserCode
+	}
+
+	return nil
+}
+
+// DenyDeviceAuthorization denies the pending grant, recording the user who denied it
+func DenyDeviceAuthorization(ctx context.Context, userCode string, userId int32) error {
+	rows, err := db.Queries.DenyDeviceAuthorization(ctx, query.DenyDeviceAuthorizationParams{
+		UserID:   pgtype.Int4{Int32: userId, Valid: true},
+		UserCode: NormalizeDeviceUserCode(userCode),
+	})
+	if err != nil {
+		return eris.Wrap(err, "error denying device authorization")
+	}
+
+	if rows == 0 {
+		return ErrInvalidUserCode
+	}
+
+	return nil
+}
+
+// PollDeviceAuthorization creates a game token once the player has approved the grant. Until then, it returns
+// ErrDeviceAuthorizationPending - or ErrDeviceSlowDown, if the game isn't waiting long enough between polls.
+func PollDeviceAuthorization(ctx context.Context, gameUuid uuid.UUID, deviceCode string) (token string, row query.CreateGameTokenRow, err error) {
+	lifetime, err := env.GetMatched("OPENSTATS_DEVICE_GAME_TOKEN_LIFETIME", time.ParseDuration)
+	if err != nil {
+		return token, row, err
+	}
+
+	// the outcome is kept separate from err, since pending polls must still commit their updated poll time
+	var outcome error
+	err = db.DB.Transact(ctx, func(ctx context.Context, qtx *query.Queries) error {
+		authorization, err := qtx.GetDeviceAuthorizationForUpdate(ctx, hashDeviceCode(deviceCode))
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && authorization.GameUuid != gameUuid) {
+			outcome = ErrInvalidDeviceCode
+			return nil
+		}
+
+		if err != nil {
+			return eris.Wrap(err, "error getting device authorization")
+		}
+
+		now := time.Now().UTC()
+		if !authorization.ExpiresAt.After(now) {
+			outcome = ErrDeviceCodeExpired
+			return nil
+		}
+
+		if authorization.DeniedAt.Valid {
+			outcome = ErrDeviceAccessDenied
+			return qtx.DeleteDeviceAuthorization(ctx, authorization.ID)
+		}
+
+		if authorization.ApprovedAt.Valid && authorization.UserUuid.Valid {
+			token, row, err = CreateGameToken(ctx, qtx, query.CreateGameTokenParams{
+				ExpiresAt: now.Add(lifetime),
+				Comment:   DeviceGameTokenComment,
+				Scopes:    GameScopes,
+				UserUuid:  authorization.UserUuid.UUID,
+				GameUuid:  authorization.GameUuid,
+			})
+			if err != nil {
+				return err
+			}
+
+			return qtx.DeleteDeviceAuthorization(ctx, authorization.ID)
+		}
+
+		interval := time.Duration(authorization.PollInterval) * time.Second
+		outcome = ErrDeviceAuthorizationPending
+		if authorization.LastPolledAt.Valid && now.Sub(authorization.LastPolledAt.Time) < interval {
+			interval += DeviceSlowDownIncrement
+			outcome = ErrDeviceSlowDown
+		}
+
+		return qtx.TouchDeviceAuthorizationPoll(ctx, query.TouchDeviceAuthorizationPollParams{
+			ID:           authorization.ID,
+			PollInterval: int32(interval.Seconds()),
+		})
+	})
+
+	if err != nil {
+		return token, row, err
+	}
+
+	if outcome == nil {
+		tokenRid := rid.From(GameTokenRidPrefix, row.Uuid)
+		RecordSecurityEvent(ctx, row.UserID, SecurityEventGameTokenCreated, map[string]string{
+			"gameToken": tokenRid.String(),
+			"game":      row.DeveloperSlug + "/" + row.GameSlug,
+			"via":       "device",
+		})
+	}
+
+	return token, row, outcome
+}
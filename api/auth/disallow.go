@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/dresswithpockets/openstats/app/db"
+	"github.com/dresswithpockets/openstats/app/db/query"
+	"github.com/dresswithpockets/openstats/app/env"
+	"github.com/dresswithpockets/openstats/app/log"
+	"github.com/google/uuid"
+	"github.com/rotisserie/eris"
+)
+
+// DisallowedTokensChannel is the postgres NOTIFY channel that disallowed token ids are published on
+const DisallowedTokensChannel = "openstats_disallowed_tokens"
+
+// TokenSweepGrace is how long tokens are kept after they expire, so that tokens which are still accepted thanks to
+// clock skew aren't swept while they can be disallowed
+const TokenSweepGrace = time.Hour
+
+type disallowEntry struct {
+	disallowed bool
+	expiresAt  time.Time
+}
+
+// disallowCache caches whether tokens are in the disallow list. The cache is only used while it's listening on
+// DisallowedTokensChannel, since it can't know which tokens have been disallowed otherwise.
+type disallowCache struct {
+	mu         sync.RWMutex
+	listening  bool
+	generation uint64
+	entries    map[uuid.UUID]disallowEntry
+}
+
+var disallowed = &disallowCache{entries: make(map[uuid.UUID]disallowEntry)}
+
+// reset empties the cache whenever it starts or stops listening, since notifications may have been missed in between
+func (c *disallowCache) reset(listening bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.listening = listening
+	c.generation++
+	c.entries = make(map[uuid.UUID]disallowEntry)
+}
+
+func (c *disallowCache) get(tokenId uuid.UUID) (entry disallowEntry, ok bool, generation uint64) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok = c.entries[tokenId]
+	return entry, ok && c.listening, c.generation
+}
+
+// put caches the result of a lookup made during the generation. Existing entries are kept, since a notification may
+// have disallowed the token after it was looked up.
+func (c *disallowCache) put(tokenId uuid.UUID, entry disallowEntry, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.listening || c.generation != generation {
+		return
+	}
+
+	if _, exists := c.entries[tokenId]; !exists {
+		c.entries[tokenId] = entry
+	}
+}
+
+func (c *disallowCache) disallow(tokenId uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := c.entries[tokenId]
+	entry.disallowed = true
+	if entry.expiresAt.IsZero() {
+		// we don't know when the token expires, so it's kept until the cache is next reset
+		entry.expiresAt = time.Now().UTC().Add(SessionDuration)
+	}
+
+	c.entries[tokenId] = entry
+}
+
+func (c *disallowCache) prune(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for tokenId, entry := range c.entries {
+		if entry.expiresAt.Before(now) {
+			delete(c.entries, tokenId)
+		}
+	}
+}
+
+// IsTokenDisallowed checks whether the token has been disallowed, e.g. by signing out. expiresAt is when the token
+// expires, after which it no longer needs to be cached.
+func IsTokenDisallowed(ctx context.Context, tokenId uuid.UUID, expiresAt time.Time) (bool, error) {
+	entry, ok, generation := disallowed.get(tokenId)
+	if ok {
+		return entry.disallowed, nil
+	}
+
+	isDisallowed, err := db.Queries.IsTokenDisallowed(ctx, tokenId)
+	if err != nil {
+		return false, eris.Wrap(err, "error checking the token disallow list")
+	}
+
+	disallowed.put(tokenId, disallowEntry{disallowed: isDisallowed, expiresAt: expiresAt}, generation)
+	return isDisallowed, nil
+}
+
+// RunDisallowListener keeps the disallow list cache up to date with tokens disallowed by any replica, until ctx is
+// done. If the listening connection fails, the cache is bypassed until RunDisallowListener reconnects after retryDelay.
+func RunDisallowListener(ctx context.Context, retryDelay time.Duration) {
+	for {
+		err := db.DB.ListenReady(ctx, DisallowedTokensChannel, func() {
+			disallowed.reset(true)
+		}, func(payload string) {
+			tokenId, err := uuid.Parse(payload)
+			if err != nil {
+				log.Logger.Error("error decoding disallowed token id", "error", err, "payload", payload)
+				return
+			}
+
+			disallowed.disallow(tokenId)
+		})
+		disallowed.reset(false)
+		if err != nil {
+			log.Logger.Error("error listening for disallowed tokens", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryDelay):
+		}
+	}
+}
+
+// SweepExpiredTokens deletes tokens, and their disallow list entries, once they've expired. Expired tokens are rejected
+// regardless of the disallow list, so their entries are no longer needed.
+func SweepExpiredTokens(ctx context.Context) (tokens int64, err error) {
+	now := time.Now().UTC()
+	expiredBefore := now.Add(-TokenSweepGrace)
+	err = db.DB.Transact(ctx, func(ctx context.Context, qtx *query.Queries) error {
+		if _, err := qtx.DeleteExpiredDisallowedTokens(ctx, expiredBefore); err != nil {
+			return eris.Wrap(err, "error deleting expired disallow list entries")
+		}
+
+		tokens, err = qtx.DeleteExpiredTokens(ctx, expiredBefore)
+		return eris.Wrap(err, "error deleting expired tokens")
+	})
+
+	disallowed.prune(now)
+	pruneSessionTouches(now)
+	return tokens, err
+}
+
+// RunTokenSweeper calls SweepExpiredTokens every OPENSTATS_TOKEN_SWEEP_INTERVAL until ctx is done. It is intended to be
+// run in its own goroutine.
+func RunTokenSweeper(ctx context.Context) error {
+	interval, err := env.GetMatched("OPENSTATS_TOKEN_SWEEP_INTERVAL", time.ParseDuration)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		count, err := SweepExpiredTokens(ctx)
+		if err != nil {
+			log.Logger.Error("error sweeping expired tokens", "error", err)
+		} else if count > 0 {
+			log.Logger.Debug("swept expired tokens", "count", count)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/dresswithpockets/openstats/app/db"
+	"github.com/dresswithpockets/openstats/app/db/query"
+	"github.com/dresswithpockets/openstats/app/env"
+	"github.com/dresswithpockets/openstats/app/rid"
+	"github.com/google/uuid"
+	"github.com/rotisserie/eris"
+)
+
+const (
+	GameTokenPrefix          = "osgt"
+	GameTokenRidPrefix       = "gt"
+	gameTokenLookupLength    = 8
+	gameTokenLookupSeparator = "_"
+
+	// lookup prefixes are short enough that they may collide with another token or key, so a few are tried
+	lookupPrefixAttempts = 5
+)
+
+var (
+	ErrInvalidGameToken = errors.New("invalid game token")
+	ErrGameTokenExpired = errors.New("game token not found or expired")
+)
+
+// GameTokenSecret is a newly issued game token. Token is only known when it's issued, since only LookupPrefix and Hash
+// are stored.
+type GameTokenSecret struct {
+	Token        string
+	LookupPrefix string
+	Hash         []byte
+}
+
+func hashGameToken(token string) []byte {
+	hash := sha256.Sum256([]byte(token))
+	return hash[:]
+}
+
+// NewGameTokenSecret generates a game token like osgt_ABCDEFGH_{secret}. The lookup prefix finds the token without
+// storing it, and lets users tell their tokens apart.
+func NewGameTokenSecret() GameTokenSecret {
+	lookupPrefix := rand.Text()[:gameTokenLookupLength]
+	token := GameTokenPrefix + gameTokenLookupSeparator + lookupPrefix + gameTokenLookupSeparator + rand.Text()
+	return GameTokenSecret{
+		Token:        token,
+		LookupPrefix: lookupPrefix,
+		Hash:         hashGameToken(token),
+	}
+}
+
+// CreateGameToken creates a game token with a new secret, using q so that it may be part of a transaction
+func CreateGameToken(ctx context.Context, q *query.Queries, params query.CreateGameTokenParams) (string, query.CreateGameTokenRow, error) {
+	for range lookupPrefixAttempts {
+		secret := NewGameTokenSecret()
+		params.LookupPrefix = secret.LookupPrefix
+		params.TokenHash = secret.Hash
+
+		row, err := q.CreateGameToken(ctx, params)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+
+		if err != nil {
+			return "", row, eris.Wrap(err, "error creating game token")
+		}
+
+		return secret.Token, row, nil
+	}
+
+	return "", query.CreateGameTokenRow{}, eris.Errorf("error creating game token: no unique lookup prefix after %d attempts", lookupPrefixAttempts)
+}
+
+// RotateGameToken replaces the secret of one of the user's game tokens, so the old secret stops working and the sessions
+// started with it are ended. Legacy tokens are rotated to stop authenticating with their RID.
+func RotateGameToken(ctx context.Context, q *query.Queries, userUuid, tokenUuid uuid.UUID) (string, error) {
+	for range lookupPrefixAttempts {
+		secret := NewGameTokenSecret()
+		rows, err := q.RotateGameToken(ctx, query.RotateGameTokenParams{
+			LookupPrefix: secret.LookupPrefix,
+			TokenHash:    secret.Hash,
+			UserUuid:     userUuid,
+			Uuid:         tokenUuid,
+		})
+		if db.IsUniqueConstraintErr(err) {
+			continue
+		}
+
+		if err != nil {
+			return "", eris.Wrap(err, "error rotating game token")
+		}
+
+		if rows == 0 {
+			return "", ErrGameTokenExpired
+		}
+
+		return secret.Token, nil
+	}
+
+	return "", eris.Errorf("error rotating game token: no unique lookup prefix after %d attempts", lookupPrefixAttempts)
+}
+
+// FindGameToken finds the unexpired game token that the bearer token authenticates as. Tokens issued before they were
+// hashed are their RID, and they're only accepted while OPENSTATS_ALLOW_LEGACY_GAME_TOKENS is enabled.
+func FindGameToken(ctx context.Context, q *query.Queries, token string) (query.FindLegacyTokenWithUserRow, error) {
+	lookupPrefix, isToken := strings.CutPrefix(token, GameTokenPrefix+gameTokenLookupSeparator)
+	if !isToken {
+		return findLegacyGameToken(ctx, q, token)
+	}
+
+	lookupPrefix, _, hasSecret := strings.Cut(lookupPrefix, gameTokenLookupSeparator)
+	if !hasSecret || len(lookupPrefix) != gameTokenLookupLength {
+		return query.FindLegacyTokenWithUserRow{}, ErrInvalidGameToken
+	}
+
+	row, err := q.FindTokenWithUser(ctx, lookupPrefix)
+	if errors.Is(err, sql.ErrNoRows) {
+		return query.FindLegacyTokenWithUserRow{}, ErrInvalidGameToken
+	}
+
+	if err != nil {
+		return query.FindLegacyTokenWithUserRow{}, eris.Wrap(err, "error finding game token")
+	}
+
+	if subtle.ConstantTimeCompare(row.TokenHash, hashGameToken(token)) != 1 {
+		return query.FindLegacyTokenWithUserRow{}, ErrInvalidGameToken
+	}
+
+	return query.FindLegacyTokenWithUserRow{
+		Uuid:      row.Uuid,
+		TokenHash: row.TokenHash,
+		Scopes:    row.Scopes,
+		UserUuid:  row.UserUuid,
+		GameUuid:  row.GameUuid,
+	}, nil
+}
+
+func findLegacyGameToken(ctx context.Context, q *query.Queries, token string) (query.FindLegacyTokenWithUserRow, error) {
+	if !env.GetBool("OPENSTATS_ALLOW_LEGACY_GAME_TOKENS") {
+		return query.FindLegacyTokenWithUserRow{}, ErrInvalidGameToken
+	}
+
+	tokenRid, err := rid.ParseString(token)
+	if err != nil || tokenRid.Prefix != GameTokenRidPrefix {
+		return query.FindLegacyTokenWithUserRow{}, ErrInvalidGameToken
+	}
+
+	row, err := q.FindLegacyTokenWithUser(ctx, tokenRid.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return row, ErrInvalidGameToken
+	}
+
+	return row, eris.Wrap(err, "error finding legacy game token")
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/google/uuid"
 	"log"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 )
@@ -20,18 +21,44 @@ const UserRidPrefix = "u"
 const GameRidPrefix = "g"
 const GameSessionRidPrefix = "gs"
 
+// Game token scopes limit what a game may do with a user's game token, and the game sessions created with it. The
+// user chooses them when creating the token.
+const (
+	GameScopeReadProfile   = "read-profile"
+	GameScopeWriteProgress = "write-progress"
+	GameScopeReadFriends   = "read-friends"
+	GameScopeWriteStats    = "write-stats"
+)
+
+// GameScopes are every game token scope, which tokens created by device authorization are given
+var GameScopes = []string{GameScopeReadProfile, GameScopeWriteProgress, GameScopeReadFriends, GameScopeWriteStats}
+
+// GameSessionClaims are the claims of game session tokens. Scope is the space-delimited scopes of the game token that
+// the session was created with.
+type GameSessionClaims struct {
+	jwt.RegisteredClaims
+	Scope *string `json:"scope,omitempty"`
+}
+
 type GameSessionPrincipal struct {
+	TokenID       uuid.UUID
 	SessionRid    rid.RID
 	UserRid       rid.RID
 	GameRid       rid.RID
 	GameTokenUuid uuid.UUID
+	GameTokenHash []byte
 	LastPulse     time.Time
 	ExpiresAt     time.Time
+	Scopes        []string
+}
+
+func (p *GameSessionPrincipal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
 }
 
 var ErrInvalidGameSessionToken = errors.New("invalid game session token")
 
-func ensureGameSessionPrincipal(ctx context.Context, claims *jwt.RegisteredClaims) (principal *GameSessionPrincipal, err error) {
+func ensureGameSessionPrincipal(ctx context.Context, claims *GameSessionClaims) (principal *GameSessionPrincipal, err error) {
 	// at the moment there is only one format for Subject
 	// Subject identifies the authorized user, in format `users/v1/{userRID}`
 
@@ -74,13 +101,22 @@ func ensureGameSessionPrincipal(ctx context.Context, claims *jwt.RegisteredClaim
 		return nil, dbErr
 	}
 
+	// tokens issued before game tokens had scopes don't have a scope claim, so they get the game token's scopes
+	scopes := result.GameTokenScopes
+	if claims.Scope != nil {
+		scopes = strings.Fields(*claims.Scope)
+	}
+
 	return &GameSessionPrincipal{
+		TokenID:       tokenId,
 		SessionRid:    sessionRid,
 		UserRid:       userRid,
 		GameRid:       gameRid,
 		GameTokenUuid: result.GameTokenUuid,
+		GameTokenHash: result.GameTokenHash,
 		LastPulse:     result.LastPulseAt,
 		ExpiresAt:     claims.ExpiresAt.Time,
+		Scopes:        scopes,
 	}, nil
 }
 
@@ -100,6 +136,7 @@ func GameSessionAuthHandler(ctx huma.Context, next func(huma.Context)) {
 		nbf: always the timestamp that the token was created at
 		iat: always the timestamp that the token was created at
 		jti: a unique identifier for the JWT, unique across all openstats JWTs
+		scope: the space-delimited scopes of the game token the session was created with
 
 		the claims are used to verify that the submitter has permission to submit achievement progress and
 		game stats for a particular user.
@@ -110,9 +147,9 @@ func GameSessionAuthHandler(ctx huma.Context, next func(huma.Context)) {
 
 	token, parseErr := jwt.ParseWithClaims(
 		tokenString,
-		&jwt.RegisteredClaims{},
-		func(token *jwt.Token) (any, error) { return SessionTokenSecret, nil },
-		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		&GameSessionClaims{},
+		GameSessionKeys.Keyfunc,
+		jwt.WithValidMethods(GameSessionKeys.Methods()),
 		jwt.WithExpirationRequired(),
 		jwt.WithIssuer(GameSessionIssuer),
 		jwt.WithAudience(GameSessionAudience),
@@ -122,8 +159,8 @@ func GameSessionAuthHandler(ctx huma.Context, next func(huma.Context)) {
 		return
 	}
 
-	gameSessionClaims, isRegisteredClaims := token.Claims.(*jwt.RegisteredClaims)
-	if !isRegisteredClaims {
+	gameSessionClaims, isGameSessionClaims := token.Claims.(*GameSessionClaims)
+	if !isGameSessionClaims {
 		next(ctx)
 		return
 	}
@@ -134,14 +171,26 @@ func GameSessionAuthHandler(ctx huma.Context, next func(huma.Context)) {
 		return
 	}
 
+	ctx, suspended := checkUserSuspension(ctx, principal.UserRid.ID)
+	if suspended {
+		next(ctx)
+		return
+	}
+
 	ctx = huma.WithValue(ctx, PrincipalContextKey, principal)
 	next(ctx)
 }
 
 type GameTokenPrincipal struct {
 	TokenUuid uuid.UUID
+	TokenHash []byte
 	UserRid   rid.RID
 	GameRid   rid.RID
+	Scopes    []string
+}
+
+func (p *GameTokenPrincipal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
 }
 
 func GameTokenAuthHandler(ctx huma.Context, next func(huma.Context)) {
@@ -157,23 +206,25 @@ func GameTokenAuthHandler(ctx huma.Context, next func(huma.Context)) {
 		return
 	}
 
-	tokenRid, decodeErr := rid.ParseString(tokenString)
-	if decodeErr != nil {
+	tokenInfo, findErr := FindGameToken(ctx.Context(), db.Queries, tokenString)
+	if findErr != nil {
 		next(ctx)
 		return
 	}
 
-	tokenInfo, findErr := db.Queries.FindTokenWithUser(ctx.Context(), tokenRid.ID)
-	if findErr != nil {
+	ctx, suspended := checkUserSuspension(ctx, tokenInfo.UserUuid)
+	if suspended {
 		next(ctx)
 		return
 	}
 
 	// TODO: differentiate between a User Identity/Principal and a GameToken Identity/Principal
 	ctx = huma.WithValue(ctx, PrincipalContextKey, &GameTokenPrincipal{
-		TokenUuid: tokenRid.ID,
+		TokenUuid: tokenInfo.Uuid,
+		TokenHash: tokenInfo.TokenHash,
 		UserRid:   rid.From(UserRidPrefix, tokenInfo.UserUuid),
 		GameRid:   rid.From(GameRidPrefix, tokenInfo.GameUuid),
+		Scopes:    tokenInfo.Scopes,
 	})
 	next(ctx)
 }
@@ -185,9 +236,8 @@ func UserAuthHandler(ctx huma.Context, next func(huma.Context)) {
 		return
 	}
 
-	token, parseErr := jwt.ParseWithClaims(sessionCookie.Value, &jwt.RegisteredClaims{}, func(token *jwt.Token) (any, error) {
-		return SessionTokenSecret, nil
-	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithIssuer(SessionIssuer), jwt.WithAudience(SessionAudience))
+	token, parseErr := jwt.ParseWithClaims(sessionCookie.Value, &jwt.RegisteredClaims{}, SessionKeys.Keyfunc,
+		jwt.WithValidMethods(SessionKeys.Methods()), jwt.WithIssuer(SessionIssuer), jwt.WithAudience(SessionAudience))
 	if parseErr != nil {
 		next(ctx)
 		return
@@ -226,7 +276,23 @@ func UserAuthHandler(ctx huma.Context, next func(huma.Context)) {
 		return
 	}
 
-	// TODO: the tokenId shouldn't be in the disallow list...
+	// signing out disallows the session's token, so a stolen cookie can't be used after the user signs out
+	isDisallowed, disallowErr := IsTokenDisallowed(ctx.Context(), tokenId, token.Claims.(*jwt.RegisteredClaims).ExpiresAt.Time)
+	if disallowErr != nil || isDisallowed {
+		// TODO: huma.WriteErr() as problem details if we couldn't check the disallow list
+		next(ctx)
+		return
+	}
+
+	if touchErr := TouchSessionToken(ctx.Context(), tokenId); touchErr != nil {
+		log.Println(touchErr)
+	}
+
+	ctx, suspended := checkUserSuspension(ctx, sessionUser.Uuid)
+	if suspended {
+		next(ctx)
+		return
+	}
 
 	ctx = huma.WithValue(ctx, PrincipalContextKey, &Principal{
 		User:    sessionUser,
@@ -250,7 +316,7 @@ func CreateRequireNoUserAuthHandler(api huma.API) func(ctx huma.Context, next fu
 func CreateRequireUserAuthHandler(api huma.API) func(ctx huma.Context, next func(huma.Context)) {
 	return func(ctx huma.Context, next func(huma.Context)) {
 		if !HasPrincipal(ctx.Context()) {
-			_ = huma.WriteErr(api, ctx, http.StatusUnauthorized, "")
+			writeUnauthenticatedErr(api, ctx)
 			return
 		}
 
@@ -261,7 +327,7 @@ func CreateRequireUserAuthHandler(api huma.API) func(ctx huma.Context, next func
 func CreateRequireGameTokenAuthHandler(api huma.API) func(ctx huma.Context, next func(huma.Context)) {
 	return func(ctx huma.Context, next func(huma.Context)) {
 		if !HasGameTokenPrincipal(ctx.Context()) {
-			_ = huma.WriteErr(api, ctx, http.StatusUnauthorized, "")
+			writeUnauthenticatedErr(api, ctx)
 			return
 		}
 
@@ -272,7 +338,7 @@ func CreateRequireGameTokenAuthHandler(api huma.API) func(ctx huma.Context, next
 func CreateRequireGameSessionAuthHandler(api huma.API) func(ctx huma.Context, next func(huma.Context)) {
 	return func(ctx huma.Context, next func(huma.Context)) {
 		if !HasGameSessionPrincipal(ctx.Context()) {
-			_ = huma.WriteErr(api, ctx, http.StatusUnauthorized, "")
+			writeUnauthenticatedErr(api, ctx)
 			return
 		}
 
@@ -280,12 +346,32 @@ func CreateRequireGameSessionAuthHandler(api huma.API) func(ctx huma.Context, ne
 	}
 }
 
-//goland:noinspection GoUnusedExportedFunction
-func CreateRequireAdminAuthHandler(api huma.API) func(ctx huma.Context, next func(huma.Context)) {
+// CreateRequireOAuthScopeHandler rejects access tokens which weren't granted the scope. First-party sessions have every
+// scope, so they're always allowed.
+func CreateRequireOAuthScopeHandler(api huma.API, scope string) func(ctx huma.Context, next func(huma.Context)) {
 	return func(ctx huma.Context, next func(huma.Context)) {
-		// TODO: include role in JWT?
-		if principal, ok := GetPrincipal(ctx.Context()); !ok || !IsAdmin(principal.User) {
-			_ = huma.WriteErr(api, ctx, http.StatusUnauthorized, "")
+		if principal, ok := GetPrincipal(ctx.Context()); ok && !principal.HasScope(scope) {
+			_ = huma.WriteErr(api, ctx, http.StatusForbidden, "the access token doesn't have the "+scope+" scope")
+			return
+		}
+
+		next(ctx)
+	}
+}
+
+// CreateRequireGameScopeHandler rejects game tokens and game session tokens which weren't granted the scope
+func CreateRequireGameScopeHandler(api huma.API, scope string) func(ctx huma.Context, next func(huma.Context)) {
+	return func(ctx huma.Context, next func(huma.Context)) {
+		hasScope := false
+		if principal, ok := GetGameTokenPrincipal(ctx.Context()); ok {
+			hasScope = principal.HasScope(scope)
+		} else if principal, ok := GetGameSessionPrincipal(ctx.Context()); ok {
+			hasScope = principal.HasScope(scope)
+		}
+
+		if !hasScope {
+			_ = huma.WriteErr(api, ctx, http.StatusForbidden, "the game token doesn't have the "+scope+" scope")
+			return
 		}
 
 		next(ctx)
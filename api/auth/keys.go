@@ -0,0 +1,261 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/dresswithpockets/openstats/app/env"
+	"github.com/dresswithpockets/openstats/app/validation"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rotisserie/eris"
+)
+
+var ErrUnknownSigningKey = errors.New("unknown signing key")
+
+// SigningKey is a key that signs or verifies JWTs. Its ID is set as the kid header of every JWT it signs.
+type SigningKey struct {
+	ID        string
+	method    jwt.SigningMethod
+	signKey   any
+	verifyKey any
+}
+
+// KeySet is the keys used for one purpose - e.g. web sessions. The first key signs new tokens, and every key verifies
+// them, so a new key can be published and later promoted in front of the old one while tokens signed by the old one are
+// still in use.
+type KeySet struct {
+	Purpose string
+	Keys    []*SigningKey
+}
+
+// SessionKeys, GameSessionKeys and OAuthKeys are kept separate so that a token issued for one purpose can never be
+// accepted for another
+var (
+	SessionKeys     = &KeySet{Purpose: "session"}
+	GameSessionKeys = &KeySet{Purpose: "game-session"}
+	OAuthKeys       = &KeySet{Purpose: "oauth"}
+)
+
+// Sign signs the claims with the set's first key
+func (s *KeySet) Sign(claims jwt.Claims) (string, error) {
+	if len(s.Keys) == 0 {
+		return "", eris.Errorf("no %s signing keys are configured", s.Purpose)
+	}
+
+	key := s.Keys[0]
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.signKey)
+}
+
+// Keyfunc finds the key that a token was signed with by its kid header, for jwt.Parse
+func (s *KeySet) Keyfunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	for _, key := range s.Keys {
+		// the algorithm must match the key's, so e.g. a public key can't be used as an HMAC secret
+		if key.ID == kid && key.method.Alg() == token.Method.Alg() {
+			return key.verifyKey, nil
+		}
+	}
+
+	return nil, ErrUnknownSigningKey
+}
+
+// Methods lists the algorithms of every key in the set, for jwt.WithValidMethods
+func (s *KeySet) Methods() []string {
+	methods := make([]string, 0, len(s.Keys))
+	for _, key := range s.Keys {
+		methods = append(methods, key.method.Alg())
+	}
+
+	return methods
+}
+
+// SetupSigningKeys loads each KeySet from OPENSTATS_JWT_{PURPOSE}_KEYS, a comma-separated list of key names. The first
+// key signs new tokens. Keys listed in OPENSTATS_JWT_{PURPOSE}_VERIFY_KEYS only verify tokens, so a new key can be
+// published before it signs anything. Each key is configured by:
+//
+//	OPENSTATS_JWT_KEY_{NAME}_ALG   HS256, ES256, or EdDSA
+//	OPENSTATS_JWT_KEY_{NAME}       a base64 HS256 secret, or a PKCS #8 PEM private key for ES256 and EdDSA
+//	OPENSTATS_JWT_KEY_{NAME}_FILE  alternatively, a file containing the key, e.g. a mounted secret
+//
+// A key may only be used for one purpose, so that a token issued for one purpose can never be accepted for another.
+// This is checked by the key's material too, so the same secret or key pair can't be configured under another name.
+func SetupSigningKeys() error {
+	purposes := make(map[string]string)
+	materialPurposes := make(map[string]string)
+	for _, set := range []*KeySet{SessionKeys, GameSessionKeys, OAuthKeys} {
+		listKey := "OPENSTATS_JWT_" + envName(set.Purpose) + "_KEYS"
+		verifyListKey := "OPENSTATS_JWT_" + envName(set.Purpose) + "_VERIFY_KEYS"
+
+		set.Keys = nil
+		for idx, list := range [][]string{env.GetList(listKey), env.GetList(verifyListKey)} {
+			for _, name := range list {
+				name = strings.TrimSpace(name)
+				if len(name) == 0 {
+					continue
+				}
+
+				if purpose, exists := purposes[name]; exists {
+					return eris.Errorf("JWT key '%s' is configured for both %s and %s, each key must only be used for one purpose", name, purpose, set.Purpose)
+				}
+
+				purposes[name] = set.Purpose
+
+				key, err := loadSigningKey(name)
+				if err != nil {
+					return err
+				}
+
+				material, err := key.material()
+				if err != nil {
+					return err
+				}
+
+				if purpose, exists := materialPurposes[material]; exists && purpose != set.Purpose {
+					return eris.Errorf("JWT key '%s' has the same key material as a %s key, each key must only be used for one purpose", name, purpose)
+				}
+
+				materialPurposes[material] = set.Purpose
+				set.Keys = append(set.Keys, key)
+			}
+
+			if idx == 0 && len(set.Keys) == 0 {
+				return eris.Errorf("%s must list at least one key", listKey)
+			}
+		}
+	}
+
+	return nil
+}
+
+// material identifies the key by its HS256 secret or its public key, whatever it's named
+func (k *SigningKey) material() (string, error) {
+	if secret, isSecret := k.verifyKey.([]byte); isSecret {
+		return k.method.Alg() + ":" + string(secret), nil
+	}
+
+	publicKey, err := x509.MarshalPKIXPublicKey(k.verifyKey)
+	if err != nil {
+		return "", eris.Wrapf(err, "error encoding JWT key '%s'", k.ID)
+	}
+
+	return "public:" + string(publicKey), nil
+}
+
+func envName(name string) string {
+	return strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+func loadSigningKey(name string) (*SigningKey, error) {
+	if !validation.ValidSlug(name) {
+		return nil, eris.Errorf("invalid JWT key name '%s', expected lowercase-alphanum with dashes", name)
+	}
+
+	envKey := "OPENSTATS_JWT_KEY_" + envName(name)
+	material := []byte(env.GetString(envKey))
+	if path := env.GetString(envKey + "_FILE"); len(path) > 0 {
+		var err error
+		if material, err = os.ReadFile(path); err != nil {
+			return nil, eris.Wrapf(err, "error reading %s_FILE", envKey)
+		}
+	}
+
+	if len(material) == 0 {
+		return nil, eris.Errorf("%s or %s_FILE must be set", envKey, envKey)
+	}
+
+	key := &SigningKey{ID: name}
+	switch alg := env.GetString(envKey + "_ALG"); alg {
+	case jwt.SigningMethodHS256.Alg():
+		secret, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(material)))
+		if err != nil {
+			return nil, eris.Wrapf(err, "%s must be base64", envKey)
+		}
+
+		if len(secret) < 32 {
+			return nil, eris.Errorf("%s must be at least 32 bytes", envKey)
+		}
+
+		key.method, key.signKey, key.verifyKey = jwt.SigningMethodHS256, secret, secret
+	case jwt.SigningMethodES256.Alg():
+		privateKey, err := parsePrivateKey(material)
+		ecdsaKey, ok := privateKey.(*ecdsa.PrivateKey)
+		if err != nil || !ok || ecdsaKey.Curve != elliptic.P256() {
+			return nil, eris.Errorf("%s must be a PKCS #8 PEM P-256 private key", envKey)
+		}
+
+		key.method, key.signKey, key.verifyKey = jwt.SigningMethodES256, ecdsaKey, &ecdsaKey.PublicKey
+	case jwt.SigningMethodEdDSA.Alg():
+		privateKey, err := parsePrivateKey(material)
+		ed25519Key, ok := privateKey.(ed25519.PrivateKey)
+		if err != nil || !ok {
+			return nil, eris.Errorf("%s must be a PKCS #8 PEM Ed25519 private key", envKey)
+		}
+
+		key.method, key.signKey, key.verifyKey = jwt.SigningMethodEdDSA, ed25519Key, ed25519Key.Public()
+	default:
+		return nil, eris.Errorf("%s_ALG must be HS256, ES256, or EdDSA", envKey)
+	}
+
+	return key, nil
+}
+
+func parsePrivateKey(material []byte) (any, error) {
+	block, _ := pem.Decode(material)
+	if block == nil {
+		return nil, eris.New("expected a PEM block")
+	}
+
+	return x509.ParsePKCS8PrivateKey(block.Bytes)
+}
+
+// JWK is a public key in JSON Web Key format
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyId     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	Y         string `json:"y,omitempty"`
+}
+
+// PublicJWKs gets the public keys which verify game session tokens and OAuth access tokens, so they can be verified
+// without calling openstats. HS256 keys are secret, so they're never published.
+func PublicJWKs() []JWK {
+	jwks := make([]JWK, 0)
+	for _, set := range []*KeySet{GameSessionKeys, OAuthKeys} {
+		for _, key := range set.Keys {
+			jwk := JWK{KeyId: key.ID, Use: "sig", Algorithm: key.method.Alg()}
+			switch publicKey := key.verifyKey.(type) {
+			case ed25519.PublicKey:
+				jwk.KeyType, jwk.Curve = "OKP", "Ed25519"
+				jwk.X = base64.RawURLEncoding.EncodeToString(publicKey)
+			case *ecdsa.PublicKey:
+				// the coordinates are the uncompressed point's, without its leading 0x04
+				point, err := publicKey.Bytes()
+				if err != nil {
+					continue
+				}
+
+				jwk.KeyType, jwk.Curve = "EC", "P-256"
+				jwk.X = base64.RawURLEncoding.EncodeToString(point[1:33])
+				jwk.Y = base64.RawURLEncoding.EncodeToString(point[33:])
+			default:
+				continue
+			}
+
+			jwks = append(jwks, jwk)
+		}
+	}
+
+	return jwks
+}
@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func setTestKey(t *testing.T, name, secret string) {
+	t.Helper()
+
+	envKey := "OPENSTATS_JWT_KEY_" + envName(name)
+	t.Setenv(envKey+"_ALG", "HS256")
+	t.Setenv(envKey, secret)
+}
+
+func setTestKeys(t *testing.T, session, sessionVerify, gameSession, oauth string) {
+	t.Helper()
+
+	setTestKey(t, "session-a", "Z6COWaUF/ae2J7/VP2yLrd/iO+O21yFlNgbOv1GJOWw=")
+	setTestKey(t, "session-b", "9oQNyB3lx0fZNowdPJjerrFZEtAtKf30xLBRXVYnPwg=")
+	setTestKey(t, "game-a", "7yEgx9eAoOWlBPJr7XRPJTf82/aR94wx8NptuWtWnDU=")
+	setTestKey(t, "oauth-a", "r3YJrkOVdhQdtFGIdINQ2bQzNBQREC0qzVYueBFBmgU=")
+	t.Setenv("OPENSTATS_JWT_SESSION_KEYS", session)
+	t.Setenv("OPENSTATS_JWT_SESSION_VERIFY_KEYS", sessionVerify)
+	t.Setenv("OPENSTATS_JWT_GAME_SESSION_KEYS", gameSession)
+	t.Setenv("OPENSTATS_JWT_GAME_SESSION_VERIFY_KEYS", "")
+	t.Setenv("OPENSTATS_JWT_OAUTH_KEYS", oauth)
+	t.Setenv("OPENSTATS_JWT_OAUTH_VERIFY_KEYS", "")
+}
+
+func TestSetupSigningKeysVerifyOnly(t *testing.T) {
+	setTestKeys(t, "session-a", "session-b", "game-a", "oauth-a")
+	if err := SetupSigningKeys(); err != nil {
+		t.Fatal(err)
+	}
+
+	claims := jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))}
+	signed, err := SessionKeys.Sign(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := jwt.Parse(signed, SessionKeys.Keyfunc, jwt.WithValidMethods(SessionKeys.Methods()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if kid := token.Header["kid"]; kid != "session-a" {
+		t.Fatalf("signed with %v, want session-a", kid)
+	}
+
+	// a token signed by the verify-only key, e.g. by another replica that has already promoted it, is accepted
+	promoted := &KeySet{Purpose: "session", Keys: []*SigningKey{SessionKeys.Keys[1]}}
+	signed, err = promoted.Sign(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = jwt.Parse(signed, SessionKeys.Keyfunc, jwt.WithValidMethods(SessionKeys.Methods())); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSetupSigningKeysRejectsSharedKeys(t *testing.T) {
+	tests := []struct {
+		name          string
+		session       string
+		sessionVerify string
+		oauth         string
+	}{
+		{"between purposes", "session-a", "", "session-a"},
+		{"between signing and verify-only", "session-a", "session-a", "oauth-a"},
+		{"verify-only in another purpose", "session-a", "oauth-a", "oauth-a"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setTestKeys(t, test.session, test.sessionVerify, "game-a", test.oauth)
+			err := SetupSigningKeys()
+			if err == nil || !strings.Contains(err.Error(), "only be used for one purpose") {
+				t.Fatalf("got %v, want an error about sharing keys", err)
+			}
+		})
+	}
+}
+
+func TestSetupSigningKeysRejectsSharedMaterial(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+	}{
+		{"same secret as a session key", "Z6COWaUF/ae2J7/VP2yLrd/iO+O21yFlNgbOv1GJOWw="},
+		{"same secret as a verify-only session key", "9oQNyB3lx0fZNowdPJjerrFZEtAtKf30xLBRXVYnPwg="},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setTestKeys(t, "session-a", "session-b", "game-a", "oauth-a")
+			setTestKey(t, "game-a", test.secret)
+			err := SetupSigningKeys()
+			if err == nil || !strings.Contains(err.Error(), "same key material") {
+				t.Fatalf("got %v, want an error about sharing key material", err)
+			}
+		})
+	}
+
+	// the same key pair is rejected whatever it's named too
+	privateKey := testPrivateKeyPem(t)
+	setTestKeys(t, "session-a", "", "game-a", "oauth-a")
+	for _, name := range []string{"game-a", "oauth-a"} {
+		envKey := "OPENSTATS_JWT_KEY_" + envName(name)
+		t.Setenv(envKey+"_ALG", "EdDSA")
+		t.Setenv(envKey, privateKey)
+	}
+
+	err := SetupSigningKeys()
+	if err == nil || !strings.Contains(err.Error(), "same key material") {
+		t.Fatalf("got %v, want an error about sharing key material", err)
+	}
+}
+
+func testPrivateKeyPem(t *testing.T) string {
+	t.Helper()
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+func TestSetupSigningKeysRequiresSigningKey(t *testing.T) {
+	setTestKeys(t, "", "session-b", "game-a", "oauth-a")
+	err := SetupSigningKeys()
+	if err == nil || !strings.Contains(err.Error(), "must list at least one key") {
+		t.Fatalf("got %v, want an error about the missing signing key", err)
+	}
+}
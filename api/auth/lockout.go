@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dresswithpockets/openstats/app/db"
+	"github.com/dresswithpockets/openstats/app/db/query"
+	"github.com/dresswithpockets/openstats/app/log"
+	"github.com/dresswithpockets/openstats/app/mail"
+	"github.com/rotisserie/eris"
+)
+
+// AttemptKind separates the credentials that failed attempts are counted against
+type AttemptKind string
+
+const (
+	// SignInAttempts are attempts at the user's password, authenticator app codes, and recovery codes
+	SignInAttempts AttemptKind = "sign-in"
+
+	// CodeAttempts are attempts at the codes emailed to the user, which reset their password and confirm their email
+	CodeAttempts AttemptKind = "code"
+)
+
+const (
+	// FreeFailedAttempts is how many attempts may fail before each further attempt is delayed
+	FreeFailedAttempts = 3
+
+	// FailedAttemptDelay is the delay after the first delayed attempt, which doubles with each further failure
+	FailedAttemptDelay = time.Second
+
+	// LockoutThreshold is how many attempts may fail before the account is locked
+	LockoutThreshold = 10
+
+	// LockoutDuration is how long the first lockout lasts. Each further lockout lasts twice as long, up to
+	// MaxLockoutDuration.
+	LockoutDuration    = 15 * time.Minute
+	MaxLockoutDuration = 24 * time.Hour
+
+	// FailedAttemptWindow is how long failed attempts are remembered for after the last failure
+	FailedAttemptWindow = 24 * time.Hour
+)
+
+// AccountLockedError is returned instead of checking the user's credentials, when the account is locked or the
+// attempt is made too soon after a failed one
+type AccountLockedError struct {
+	RetryAfter time.Duration
+	Locked     bool
+}
+
+func (e *AccountLockedError) Error() string {
+	if e.Locked {
+		return fmt.Sprintf("account locked, retry after %s", e.RetryAfter.Round(time.Second))
+	}
+
+	return fmt.Sprintf("too many failed attempts, retry after %s", e.RetryAfter.Round(time.Second))
+}
+
+func failedAttemptDelay(failedCount int32) time.Duration {
+	if failedCount < FreeFailedAttempts {
+		return 0
+	}
+
+	return min(FailedAttemptDelay<<min(failedCount-FreeFailedAttempts, 16), LockoutDuration)
+}
+
+func lockoutDuration(lockoutCount int32) time.Duration {
+	return min(LockoutDuration<<min(lockoutCount, 16), MaxLockoutDuration)
+}
+
+// ReserveAttempt counts an attempt at the user's credentials of this kind as failed before they're checked, so that
+// concurrent attempts are each checked against the failures before them. ClearFailedAttempts forgets it once the
+// credentials turn out to be right. It returns an AccountLockedError instead if the credentials mustn't be checked yet,
+// and locks the account once LockoutThreshold attempts have failed. It isn't part of any transaction, so that the
+// attempt is counted even though the attempt's transaction is rolled back.
+func ReserveAttempt(ctx context.Context, userId int32, kind AttemptKind) error {
+	now := time.Now().UTC()
+	var rejected *AccountLockedError
+	var lockedFor time.Duration
+	err := db.DB.Transact(ctx, func(ctx context.Context, qtx *query.Queries) error {
+		lockout, err := qtx.LockAccountLockout(ctx, query.LockAccountLockoutParams{
+			UserID: userId,
+			Kind:   string(kind),
+			Now:    now,
+		})
+		if err != nil {
+			return eris.Wrap(err, "error locking account lockout")
+		}
+
+		if lockout.LockedUntil.Valid && lockout.LockedUntil.Time.After(now) {
+			rejected = &AccountLockedError{RetryAfter: lockout.LockedUntil.Time.Sub(now), Locked: true}
+			return nil
+		}
+
+		if !lockout.LastFailedAt.Before(now.Add(-FailedAttemptWindow)) {
+			if lockout.FailedCount >= LockoutThreshold {
+				// the failed count starts over once the account is locked, so it's only locked once per threshold
+				duration := lockoutDuration(lockout.LockoutCount)
+				if err = qtx.LockAccount(ctx, query.LockAccountParams{
+					LockedUntil: now.Add(duration),
+					UserID:      userId,
+					Kind:        string(kind),
+				}); err != nil {
+					return eris.Wrap(err, "error locking account")
+				}
+
+				rejected = &AccountLockedError{RetryAfter: duration, Locked: true}
+				lockedFor = duration
+				return nil
+			}
+
+			if retryAt := lockout.LastFailedAt.Add(failedAttemptDelay(lockout.FailedCount)); retryAt.After(now) {
+				rejected = &AccountLockedError{RetryAfter: retryAt.Sub(now)}
+				return nil
+			}
+		}
+
+		_, err = qtx.RecordFailedAttempt(ctx, query.RecordFailedAttemptParams{
+			UserID:      userId,
+			Kind:        string(kind),
+			FailedAt:    now,
+			ResetBefore: now.Add(-FailedAttemptWindow),
+		})
+		return eris.Wrap(err, "error recording attempt")
+	})
+	if err != nil {
+		return err
+	}
+
+	if rejected == nil {
+		return nil
+	}
+
+	if lockedFor > 0 {
+		RecordSecurityEvent(ctx, userId, SecurityEventAccountLocked, map[string]string{
+			"kind":     string(kind),
+			"duration": lockedFor.String(),
+		})
+
+		// the lockout has already happened, so the user not being told about it shouldn't fail the request
+		if err = sendLockoutEmail(ctx, userId, kind, lockedFor); err != nil {
+			log.Logger.Error("error sending account lockout email", "error", err, "user", userId)
+		}
+	}
+
+	return rejected
+}
+
+// ClearFailedAttempts forgets the failed attempts of this kind, once the user has proven they know the credentials
+func ClearFailedAttempts(ctx context.Context, q *query.Queries, userId int32, kind AttemptKind) error {
+	err := q.ClearFailedAttempts(ctx, query.ClearFailedAttemptsParams{UserID: userId, Kind: string(kind)})
+	return eris.Wrap(err, "error clearing failed attempts")
+}
+
+func sendLockoutEmail(ctx context.Context, userId int32, kind AttemptKind, duration time.Duration) error {
+	contact, err := db.Queries.FindUserLockoutContact(ctx, userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		// users without a confirmed email can't be told
+		return nil
+	}
+
+	if err != nil {
+		return eris.Wrap(err, "error getting user email")
+	}
+
+	attempted := "sign into your account"
+	if kind == CodeAttempts {
+		attempted = "use a security code for your account"
+	}
+
+	body := fmt.Sprintf(
+		"Hi %s,<br/><br/>"+
+			"There were too many failed attempts to %s, so it has been locked for %s. If this wasn't you, someone "+
+			"may be trying to guess your password - we recommend resetting your password, and enabling two-factor "+
+			"authentication.", contact.Slug, attempted, duration)
+
+	return mail.Default.Send(ctx, mail.Mail{
+		From:    "noreply@openstats.me",
+		To:      contact.Email,
+		Subject: "Your Openstats Account Has Been Locked",
+		Body:    body,
+	})
+}
@@ -0,0 +1,408 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"image/png"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dresswithpockets/openstats/app/db"
+	"github.com/dresswithpockets/openstats/app/db/query"
+	"github.com/dresswithpockets/openstats/app/password"
+	"github.com/google/uuid"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"github.com/rotisserie/eris"
+)
+
+const (
+	MfaIssuer               = "openstats"
+	MfaQrCodeSize           = 256
+	MfaChallengeDuration    = 5 * time.Minute
+	MfaChallengeMaxAttempts = 5
+	RecoveryCodeCount       = 10
+	RecoveryCodeLength      = 10
+)
+
+// MfaValidateOptions are the options used for authenticator app TOTPs. These differ from ValidateOptions since most
+// authenticator apps only support the defaults from the Key URI Format.
+var MfaValidateOptions = totp.ValidateOpts{
+	Period:    30,
+	Skew:      1,
+	Digits:    otp.DigitsSix,
+	Algorithm: otp.AlgorithmSHA1,
+}
+
+var (
+	ErrMfaAlreadyEnabled   = errors.New("mfa is already enabled")
+	ErrMfaNotEnrolling     = errors.New("mfa enrollment hasn't been started")
+	ErrMfaNotEnabled       = errors.New("mfa isn't enabled")
+	ErrInvalidMfaCode      = errors.New("invalid mfa code")
+	ErrInvalidMfaChallenge = errors.New("mfa challenge is invalid, expired, or out of attempts")
+)
+
+type MfaEnrollment struct {
+	Uri   string
+	QrPng []byte
+}
+
+// StartMfaEnrollment generates a new TOTP secret for the user, which must be confirmed with ConfirmMfaEnrollment
+// before MFA is enabled. Starting enrollment again before confirming replaces the secret.
+func StartMfaEnrollment(ctx context.Context, user query.User) (enrollment MfaEnrollment, err error) {
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      MfaIssuer,
+		AccountName: user.Slug,
+		Period:      uint(MfaValidateOptions.Period),
+		Digits:      MfaValidateOptions.Digits,
+		Algorithm:   MfaValidateOptions.Algorithm,
+	})
+	if err != nil {
+		return MfaEnrollment{}, eris.Wrap(err, "error generating totp key")
+	}
+
+	err = db.DB.Transact(ctx, func(ctx context.Context, qtx *query.Queries) error {
+		rows, txErr := qtx.StartUserMfaEnrollment(ctx, user.ID)
+		if txErr != nil {
+			return eris.Wrap(txErr, "error starting mfa enrollment")
+		}
+
+		if rows == 0 {
+			return ErrMfaAlreadyEnabled
+		}
+
+		return qtx.SecretPut(ctx, query.SecretPutParams{
+			Path:  db.SharedUserMfaHmacSecretPath,
+			Key:   strconv.FormatInt(int64(user.ID), 10),
+			Value: key.Secret(),
+		})
+	})
+	if err != nil {
+		return MfaEnrollment{}, err
+	}
+
+	image, err := key.Image(MfaQrCodeSize, MfaQrCodeSize)
+	if err != nil {
+		return MfaEnrollment{}, eris.Wrap(err, "error generating totp qr code")
+	}
+
+	var qrPng bytes.Buffer
+	if err = png.Encode(&qrPng, image); err != nil {
+		return MfaEnrollment{}, eris.Wrap(err, "error encoding totp qr code")
+	}
+
+	return MfaEnrollment{
+		Uri:   key.URL(),
+		QrPng: qrPng.Bytes(),
+	}, nil
+}
+
+// ConfirmMfaEnrollment enables MFA for the user if code is valid for the secret generated by StartMfaEnrollment. The
+// returned recovery codes are only ever available here and from RegenerateRecoveryCodes.
+func ConfirmMfaEnrollment(ctx context.Context, userId int32, code string) (recoveryCodes []string, err error) {
+	err = db.DB.Transact(ctx, func(ctx context.Context, qtx *query.Queries) error {
+		mfa, txErr := qtx.FindUserMfa(ctx, userId)
+		if errors.Is(txErr, sql.ErrNoRows) {
+			return ErrMfaNotEnrolling
+		}
+
+		if txErr != nil {
+			return eris.Wrap(txErr, "error getting user mfa")
+		}
+
+		if mfa.ConfirmedAt.Valid {
+			return ErrMfaAlreadyEnabled
+		}
+
+		if txErr = validateMfaCode(ctx, qtx, userId, code); txErr != nil {
+			return txErr
+		}
+
+		if _, txErr = qtx.ConfirmUserMfa(ctx, userId); txErr != nil {
+			return eris.Wrap(txErr, "error confirming user mfa")
+		}
+
+		recoveryCodes, txErr = replaceRecoveryCodes(ctx, qtx, userId)
+		return txErr
+	})
+
+	return
+}
+
+// DisableMfa removes the user's TOTP secret and recovery codes, after verifying their current password
+func DisableMfa(ctx context.Context, userId int32, currentPassword string) error {
+	return db.DB.Transact(ctx, func(ctx context.Context, qtx *query.Queries) error {
+		if err := verifyUserPassword(ctx, qtx, userId, currentPassword); err != nil {
+			return err
+		}
+
+		if err := qtx.DeleteUserMfa(ctx, userId); err != nil {
+			return eris.Wrap(err, "error deleting user mfa")
+		}
+
+		if err := qtx.DeleteUserRecoveryCodes(ctx, userId); err != nil {
+			return eris.Wrap(err, "error deleting user recovery codes")
+		}
+
+		return qtx.SecretDelete(ctx, query.SecretDeleteParams{
+			Path: db.SharedUserMfaHmacSecretPath,
+			Key:  strconv.FormatInt(int64(userId), 10),
+		})
+	})
+}
+
+// RegenerateRecoveryCodes replaces all of the user's recovery codes, after verifying their current password
+func RegenerateRecoveryCodes(ctx context.Context, userId int32, currentPassword string) (recoveryCodes []string, err error) {
+	err = db.DB.Transact(ctx, func(ctx context.Context, qtx *query.Queries) error {
+		if txErr := verifyUserPassword(ctx, qtx, userId, currentPassword); txErr != nil {
+			return txErr
+		}
+
+		enabled, txErr := isMfaEnabled(ctx, qtx, userId)
+		if txErr != nil {
+			return txErr
+		}
+
+		if !enabled {
+			return ErrMfaNotEnabled
+		}
+
+		recoveryCodes, txErr = replaceRecoveryCodes(ctx, qtx, userId)
+		return txErr
+	})
+
+	return
+}
+
+func IsMfaEnabled(ctx context.Context, userId int32) (bool, error) {
+	return isMfaEnabled(ctx, db.Queries, userId)
+}
+
+// CreateMfaChallenge creates a challenge that must be completed with CompleteMfaChallenge before the user can sign in
+func CreateMfaChallenge(ctx context.Context, userId int32) (query.MfaChallenge, error) {
+	challenge, err := db.Queries.CreateMfaChallenge(ctx, query.CreateMfaChallengeParams{
+		UserID:    userId,
+		ExpiresAt: time.Now().UTC().Add(MfaChallengeDuration),
+	})
+
+	return challenge, eris.Wrap(err, "error creating mfa challenge")
+}
+
+// CompleteMfaChallenge validates either the TOTP code or the recovery code against the challenge's user, and returns
+// the user's uuid if successful. Each challenge can only be completed once, and only MfaChallengeMaxAttempts attempts
+// can be made against it.
+func CompleteMfaChallenge(ctx context.Context, challengeUuid uuid.UUID, code, recoveryCode string) (uuid.UUID, error) {
+	// attempts are counted outside the transaction, so that failed attempts are still counted
+	challenge, err := db.Queries.AttemptMfaChallenge(ctx, query.AttemptMfaChallengeParams{
+		ChallengeUuid: challengeUuid,
+		MaxAttempts:   MfaChallengeMaxAttempts,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return uuid.UUID{}, ErrInvalidMfaChallenge
+	}
+
+	if err != nil {
+		return uuid.UUID{}, eris.Wrap(err, "error attempting mfa challenge")
+	}
+
+	// the user's password was right, but they may still be guessing codes over many challenges
+	if err = ReserveAttempt(ctx, challenge.UserID, SignInAttempts); err != nil {
+		return uuid.UUID{}, err
+	}
+
+	err = db.DB.Transact(ctx, func(ctx context.Context, qtx *query.Queries) error {
+		var txErr error
+		if recoveryCode != "" {
+			txErr = useRecoveryCode(ctx, qtx, challenge.UserID, recoveryCode)
+		} else {
+			txErr = validateMfaCode(ctx, qtx, challenge.UserID, code)
+		}
+
+		if txErr != nil {
+			return txErr
+		}
+
+		if txErr = ClearFailedAttempts(ctx, qtx, challenge.UserID, SignInAttempts); txErr != nil {
+			return txErr
+		}
+
+		rows, txErr := qtx.CompleteMfaChallenge(ctx, challenge.ID)
+		if txErr != nil {
+			return eris.Wrap(txErr, "error completing mfa challenge")
+		}
+
+		if rows == 0 {
+			return ErrInvalidMfaChallenge
+		}
+
+		return nil
+	})
+	method := "mfa"
+	if recoveryCode != "" {
+		method = "recovery-code"
+	}
+
+	if errors.Is(err, ErrInvalidMfaCode) {
+		RecordSecurityEvent(ctx, challenge.UserID, SecurityEventSignInFailed, map[string]string{"method": method})
+	}
+
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+
+	RecordSecurityEvent(ctx, challenge.UserID, SecurityEventSignIn, map[string]string{"method": method})
+	return challenge.UserUuid, nil
+}
+
+func isMfaEnabled(ctx context.Context, q *query.Queries, userId int32) (bool, error) {
+	mfa, err := q.FindUserMfa(ctx, userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, eris.Wrap(err, "error getting user mfa")
+	}
+
+	return mfa.ConfirmedAt.Valid, nil
+}
+
+// mfaCodeStep returns the latest time step within the skew of now that the code is valid for
+func mfaCodeStep(secret, code string, now time.Time) (int64, bool, error) {
+	if len(code) != MfaValidateOptions.Digits.Length() {
+		return 0, false, nil
+	}
+
+	period := int64(MfaValidateOptions.Period)
+	current := now.Unix() / period
+	for step := current + int64(MfaValidateOptions.Skew); step >= current-int64(MfaValidateOptions.Skew); step-- {
+		expected, err := totp.GenerateCodeCustom(secret, time.Unix(step*period, 0).UTC(), MfaValidateOptions)
+		if err != nil {
+			return 0, false, eris.Wrap(err, "error generating mfa code")
+		}
+
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true, nil
+		}
+	}
+
+	return 0, false, nil
+}
+
+// validateMfaCode checks the code against the user's TOTP secret. Each code is only accepted once - the code's time step
+// is recorded, and codes from that step or earlier are rejected afterwards, so an observed code can't be replayed.
+func validateMfaCode(ctx context.Context, qtx *query.Queries, userId int32, code string) error {
+	secret, err := qtx.SecretRead(ctx, query.SecretReadParams{
+		Path: db.SharedUserMfaHmacSecretPath,
+		Key:  strconv.FormatInt(int64(userId), 10),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrMfaNotEnabled
+	}
+
+	if err != nil {
+		return eris.Wrap(err, "error getting user mfa secret")
+	}
+
+	step, validated, err := mfaCodeStep(secret, code, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	if !validated {
+		return ErrInvalidMfaCode
+	}
+
+	rows, err := qtx.UseUserMfaStep(ctx, query.UseUserMfaStepParams{Step: step, UserID: userId})
+	if err != nil {
+		return eris.Wrap(err, "error recording mfa code use")
+	}
+
+	if rows == 0 {
+		return ErrInvalidMfaCode
+	}
+
+	return nil
+}
+
+func verifyUserPassword(ctx context.Context, qtx *query.Queries, userId int32, currentPassword string) error {
+	result, err := qtx.GetUserPassword(ctx, userId)
+	if err != nil {
+		return eris.Wrap(err, "error getting user password")
+	}
+
+	return password.VerifyPassword(currentPassword, result.EncodedHash)
+}
+
+// normalizeRecoveryCode removes formatting from the code, so that codes are accepted regardless of case or dashes
+func normalizeRecoveryCode(code string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+func replaceRecoveryCodes(ctx context.Context, qtx *query.Queries, userId int32) ([]string, error) {
+	if err := qtx.DeleteUserRecoveryCodes(ctx, userId); err != nil {
+		return nil, eris.Wrap(err, "error deleting user recovery codes")
+	}
+
+	codes := make([]string, RecoveryCodeCount)
+	hashes := make([]string, RecoveryCodeCount)
+	for idx := range codes {
+		code := rand.Text()[:RecoveryCodeLength]
+		codes[idx] = code[:RecoveryCodeLength/2] + "-" + code[RecoveryCodeLength/2:]
+
+		hash, err := password.EncodePassword(code, ArgonParameters)
+		if err != nil {
+			return nil, err
+		}
+
+		hashes[idx] = hash
+	}
+
+	err := qtx.AddUserRecoveryCodes(ctx, query.AddUserRecoveryCodesParams{
+		UserID:        userId,
+		EncodedHashes: hashes,
+	})
+	if err != nil {
+		return nil, eris.Wrap(err, "error adding user recovery codes")
+	}
+
+	return codes, nil
+}
+
+func useRecoveryCode(ctx context.Context, qtx *query.Queries, userId int32, code string) error {
+	unused, err := qtx.GetUnusedRecoveryCodes(ctx, userId)
+	if err != nil {
+		return eris.Wrap(err, "error getting user recovery codes")
+	}
+
+	code = normalizeRecoveryCode(code)
+	for _, recoveryCode := range unused {
+		verifyErr := password.VerifyPassword(code, recoveryCode.EncodedHash)
+		if errors.Is(verifyErr, password.ErrHashMismatch) {
+			continue
+		}
+
+		if verifyErr != nil {
+			return verifyErr
+		}
+
+		rows, err := qtx.UseRecoveryCode(ctx, recoveryCode.ID)
+		if err != nil {
+			return eris.Wrap(err, "error using recovery code")
+		}
+
+		if rows == 0 {
+			// the code was used concurrently
+			return ErrInvalidMfaCode
+		}
+
+		return nil
+	}
+
+	return ErrInvalidMfaCode
+}
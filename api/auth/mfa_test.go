@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+)
+
+func TestMfaCodeStep(t *testing.T) {
+	const secret = "JBSWY3DPEHPK3PXP"
+	now := time.Unix(1_800_000_015, 0).UTC()
+	current := now.Unix() / 30
+
+	code := func(t *testing.T, at time.Time) string {
+		t.Helper()
+
+		generated, err := totp.GenerateCodeCustom(secret, at, MfaValidateOptions)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return generated
+	}
+
+	tests := []struct {
+		name     string
+		at       time.Time
+		step     int64
+		accepted bool
+	}{
+		{"current", now, current, true},
+		{"previous", now.Add(-30 * time.Second), current - 1, true},
+		{"next", now.Add(30 * time.Second), current + 1, true},
+		{"too old", now.Add(-60 * time.Second), 0, false},
+		{"too new", now.Add(60 * time.Second), 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			step, accepted, err := mfaCodeStep(secret, code(t, test.at), now)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if accepted != test.accepted || step != test.step {
+				t.Fatalf("got (%d, %v), want (%d, %v)", step, accepted, test.step, test.accepted)
+			}
+		})
+	}
+
+	for _, invalid := range []string{"", "12345", "1234567", "abcdef"} {
+		if _, accepted, _ := mfaCodeStep(secret, invalid, now); accepted {
+			t.Fatalf("accepted invalid code %q", invalid)
+		}
+	}
+}
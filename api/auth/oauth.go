@@ -0,0 +1,385 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dresswithpockets/openstats/app/db"
+	"github.com/dresswithpockets/openstats/app/db/query"
+	"github.com/dresswithpockets/openstats/app/rid"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/rotisserie/eris"
+)
+
+const (
+	OAuthScopeReadProfile      = "read-profile"
+	OAuthScopeReadAchievements = "read-achievements"
+
+	OAuthClientRidPrefix            = "oc"
+	OAuthAccessTokenIssuer          = "openstats"
+	OAuthAccessTokenAudience        = "openstats-oauth"
+	OAuthAccessTokenDuration        = time.Hour
+	OAuthRefreshTokenDuration       = 30 * 24 * time.Hour
+	OAuthAuthorizationCodeLifetime  = 5 * time.Minute
+	OAuthCodeChallengeMethodS256    = "S256"
+	oauthAuthorizationCodeByteCount = 32
+)
+
+// OAuthScopes describes each scope a third-party app may request, for the consent screen
+var OAuthScopes = map[string]string{
+	OAuthScopeReadProfile:      "See your slug, display name, and profile",
+	OAuthScopeReadAchievements: "See your achievement progress in every game, including locked achievements",
+}
+
+var (
+	ErrUnknownOAuthClient    = errors.New("unknown OAuth client")
+	ErrInvalidOAuthClient    = errors.New("OAuth client authentication failed")
+	ErrInvalidOAuthRedirect  = errors.New("redirect_uri isn't registered for the OAuth client")
+	ErrInvalidOAuthScope     = errors.New("invalid OAuth scope")
+	ErrInvalidOAuthGrant     = errors.New("OAuth grant is invalid or expired")
+	ErrInvalidOAuthChallenge = errors.New("an S256 PKCE code_challenge is required")
+)
+
+// AccessTokenClaims are the claims of the access tokens issued to third-party apps, following RFC 9068
+type AccessTokenClaims struct {
+	jwt.RegisteredClaims
+	ClientId string `json:"client_id"`
+	Scope    string `json:"scope"`
+}
+
+// OAuthTokens are issued to a client by the token endpoint
+type OAuthTokens struct {
+	AccessToken  string
+	ExpiresAt    time.Time
+	RefreshToken string
+	Scopes       []string
+}
+
+func hashOAuthSecret(secret string) []byte {
+	hash := sha256.Sum256([]byte(secret))
+	return hash[:]
+}
+
+// ParseOAuthScopes parses a space-delimited scope parameter, rejecting unknown scopes. The result is sorted and has no
+// duplicates.
+func ParseOAuthScopes(scope string) ([]string, error) {
+	scopes := strings.Fields(scope)
+	if len(scopes) == 0 {
+		return nil, eris.Wrap(ErrInvalidOAuthScope, "at least one scope is required")
+	}
+
+	for _, s := range scopes {
+		if _, ok := OAuthScopes[s]; !ok {
+			return nil, eris.Wrapf(ErrInvalidOAuthScope, "unknown scope '%s'", s)
+		}
+	}
+
+	slices.Sort(scopes)
+	return slices.Compact(scopes), nil
+}
+
+// CreateOAuthClient registers a new client for the developer. Confidential clients are given a secret, which is
+// returned here and never again.
+func CreateOAuthClient(ctx context.Context, developerUuid uuid.UUID, name string, redirectUris []string, confidential bool) (client query.OauthClient, secret string, err error) {
+	var secretHash []byte
+	if confidential {
+		secret = rand.Text()
+		secretHash = hashOAuthSecret(secret)
+	}
+
+	client, err = db.Queries.CreateOAuthClient(ctx, query.CreateOAuthClientParams{
+		Name:          name,
+		RedirectUris:  redirectUris,
+		SecretHash:    secretHash,
+		DeveloperUuid: developerUuid,
+	})
+
+	return client, secret, eris.Wrap(err, "error creating OAuth client")
+}
+
+// FindOAuthClient gets the client identified by a client_id, which is the client's RID
+func FindOAuthClient(ctx context.Context, clientId string) (query.FindOAuthClientRow, error) {
+	clientRid, err := rid.ParseString(clientId)
+	if err != nil || clientRid.Prefix != OAuthClientRidPrefix {
+		return query.FindOAuthClientRow{}, ErrUnknownOAuthClient
+	}
+
+	client, err := db.Queries.FindOAuthClient(ctx, clientRid.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return client, ErrUnknownOAuthClient
+	}
+
+	return client, eris.Wrap(err, "error finding OAuth client")
+}
+
+// AuthenticateOAuthClient verifies the client's secret. Public clients have no secret, so they must not send one.
+func AuthenticateOAuthClient(client query.FindOAuthClientRow, secret string) error {
+	if client.SecretHash == nil {
+		if len(secret) > 0 {
+			return ErrInvalidOAuthClient
+		}
+
+		return nil
+	}
+
+	if subtle.ConstantTimeCompare(client.SecretHash, hashOAuthSecret(secret)) != 1 {
+		return ErrInvalidOAuthClient
+	}
+
+	return nil
+}
+
+// ValidateOAuthRedirectUri checks that the redirect_uri exactly matches one registered for the client
+func ValidateOAuthRedirectUri(client query.FindOAuthClientRow, redirectUri string) error {
+	if !slices.Contains(client.RedirectUris, redirectUri) {
+		return ErrInvalidOAuthRedirect
+	}
+
+	return nil
+}
+
+// CreateOAuthAuthorizationCode creates the code returned to the client once the user consents to its request. PKCE is
+// required for every client, and only the S256 method is supported.
+func CreateOAuthAuthorizationCode(ctx context.Context, client query.FindOAuthClientRow, userId int32, redirectUri string, scopes []string, codeChallenge, codeChallengeMethod string) (string, error) {
+	if len(codeChallenge) == 0 || codeChallengeMethod != OAuthCodeChallengeMethodS256 {
+		return "", ErrInvalidOAuthChallenge
+	}
+
+	// abandoned codes are never exchanged, so they're cleaned up whenever new ones are created
+	if err := db.Queries.DeleteExpiredOAuthAuthorizationCodes(ctx); err != nil {
+		return "", eris.Wrap(err, "error deleting expired authorization codes")
+	}
+
+	codeBytes := make([]byte, oauthAuthorizationCodeByteCount)
+	_, _ = rand.Read(codeBytes)
+	code := base64.RawURLEncoding.EncodeToString(codeBytes)
+
+	err := db.Queries.CreateOAuthAuthorizationCode(ctx, query.CreateOAuthAuthorizationCodeParams{
+		CodeHash:      hashOAuthSecret(code),
+		ClientID:      client.ID,
+		UserID:        userId,
+		RedirectUri:   redirectUri,
+		Scopes:        scopes,
+		CodeChallenge: codeChallenge,
+		ExpiresAt:     time.Now().UTC().Add(OAuthAuthorizationCodeLifetime),
+	})
+
+	return code, eris.Wrap(err, "error creating authorization code")
+}
+
+// ExchangeOAuthAuthorizationCode verifies the code and its PKCE code_verifier, and issues tokens for it. Each code can
+// only be exchanged once.
+func ExchangeOAuthAuthorizationCode(ctx context.Context, client query.FindOAuthClientRow, code, redirectUri, codeVerifier string) (tokens OAuthTokens, err error) {
+	err = db.DB.Transact(ctx, func(ctx context.Context, qtx *query.Queries) error {
+		authorization, err := qtx.TakeOAuthAuthorizationCode(ctx, hashOAuthSecret(code))
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidOAuthGrant
+		}
+
+		if err != nil {
+			return eris.Wrap(err, "error getting authorization code")
+		}
+
+		if authorization.ClientID != client.ID || authorization.RedirectUri != redirectUri || !authorization.ExpiresAt.After(time.Now()) {
+			return ErrInvalidOAuthGrant
+		}
+
+		challenge := sha256.Sum256([]byte(codeVerifier))
+		if subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(challenge[:])), []byte(authorization.CodeChallenge)) != 1 {
+			return eris.Wrap(ErrInvalidOAuthGrant, "code_verifier doesn't match the code_challenge")
+		}
+
+		tokens, err = issueOAuthTokens(ctx, qtx, client, authorization.UserID, authorization.Scopes)
+		return err
+	})
+
+	return
+}
+
+// RefreshOAuthTokens exchanges a refresh token for new tokens. The refresh token is rotated, so it can't be used again.
+// If scopes is set, it must be a subset of the refresh token's scopes.
+func RefreshOAuthTokens(ctx context.Context, client query.FindOAuthClientRow, refreshToken string, scopes []string) (tokens OAuthTokens, err error) {
+	err = db.DB.Transact(ctx, func(ctx context.Context, qtx *query.Queries) error {
+		previous, err := qtx.TakeOAuthRefreshToken(ctx, hashOAuthSecret(refreshToken))
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidOAuthGrant
+		}
+
+		if err != nil {
+			return eris.Wrap(err, "error getting refresh token")
+		}
+
+		if previous.ClientID != client.ID || !previous.ExpiresAt.After(time.Now()) {
+			return ErrInvalidOAuthGrant
+		}
+
+		if scopes == nil {
+			scopes = previous.Scopes
+		}
+
+		for _, scope := range scopes {
+			if !slices.Contains(previous.Scopes, scope) {
+				return eris.Wrapf(ErrInvalidOAuthScope, "scope '%s' wasn't granted", scope)
+			}
+		}
+
+		tokens, err = issueOAuthTokens(ctx, qtx, client, previous.UserID, scopes)
+		return err
+	})
+
+	return
+}
+
+func issueOAuthTokens(ctx context.Context, qtx *query.Queries, client query.FindOAuthClientRow, userId int32, scopes []string) (OAuthTokens, error) {
+	user, err := qtx.FindUserById(ctx, userId)
+	if err != nil {
+		return OAuthTokens{}, eris.Wrap(err, "error finding user")
+	}
+
+	nowTime := time.Now().UTC()
+	token, err := qtx.CreateToken(ctx, query.CreateTokenParams{
+		Issuer:    OAuthAccessTokenIssuer,
+		Subject:   user.Uuid.String(),
+		Audience:  OAuthAccessTokenAudience,
+		ExpiresAt: nowTime.Add(OAuthAccessTokenDuration),
+		NotBefore: nowTime.Add(-SessionJitter),
+		IssuedAt:  nowTime,
+	})
+	if err != nil {
+		return OAuthTokens{}, eris.Wrap(err, "error creating access token")
+	}
+
+	clientRid := rid.From(OAuthClientRidPrefix, client.Uuid)
+	claims := AccessTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    token.Issuer,
+			Subject:   token.Subject,
+			Audience:  []string{token.Audience},
+			ExpiresAt: jwt.NewNumericDate(token.ExpiresAt),
+			NotBefore: jwt.NewNumericDate(token.NotBefore),
+			IssuedAt:  jwt.NewNumericDate(token.IssuedAt),
+			ID:        token.ID.String(),
+		},
+		ClientId: clientRid.String(),
+		Scope:    strings.Join(scopes, " "),
+	}
+
+	tokens := OAuthTokens{
+		ExpiresAt:    token.ExpiresAt,
+		RefreshToken: rand.Text(),
+		Scopes:       scopes,
+	}
+
+	tokens.AccessToken, err = OAuthKeys.Sign(claims)
+	if err != nil {
+		return OAuthTokens{}, eris.Wrap(err, "error signing access token")
+	}
+
+	err = qtx.CreateOAuthRefreshToken(ctx, query.CreateOAuthRefreshTokenParams{
+		TokenHash: hashOAuthSecret(tokens.RefreshToken),
+		ClientID:  client.ID,
+		UserID:    userId,
+		Scopes:    scopes,
+		ExpiresAt: nowTime.Add(OAuthRefreshTokenDuration),
+	})
+
+	return tokens, eris.Wrap(err, "error creating refresh token")
+}
+
+// OAuthAccessTokenHandler authenticates a user by an access token issued to a third-party app. The principal's Scopes
+// are limited to what the user consented to, so operations accepting access tokens must also require a scope with
+// CreateRequireOAuthScopeHandler. Requests already authenticated by UserAuthHandler are left as-is.
+//
+// Access tokens are only accepted while the user's grant to the app exists, so revoking the app or deleting its client
+// takes effect immediately rather than once the app's access tokens expire.
+func OAuthAccessTokenHandler(ctx huma.Context, next func(huma.Context)) {
+	if HasPrincipal(ctx.Context()) {
+		next(ctx)
+		return
+	}
+
+	authHeader := ctx.Header("Authorization")
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	if tokenString == "" || tokenString == authHeader {
+		next(ctx)
+		return
+	}
+
+	claims := &AccessTokenClaims{}
+	_, parseErr := jwt.ParseWithClaims(
+		tokenString,
+		claims,
+		OAuthKeys.Keyfunc,
+		jwt.WithValidMethods(OAuthKeys.Methods()),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuer(OAuthAccessTokenIssuer),
+		jwt.WithAudience(OAuthAccessTokenAudience),
+	)
+	if parseErr != nil {
+		next(ctx)
+		return
+	}
+
+	subjectUuid, uuidErr := uuid.Parse(claims.Subject)
+	if uuidErr != nil {
+		next(ctx)
+		return
+	}
+
+	tokenId, tokenIdErr := uuid.Parse(claims.ID)
+	if tokenIdErr != nil {
+		next(ctx)
+		return
+	}
+
+	clientRid, clientErr := rid.ParseString(claims.ClientId)
+	if clientErr != nil || clientRid.Prefix != OAuthClientRidPrefix {
+		next(ctx)
+		return
+	}
+
+	user, findErr := db.Queries.FindUser(ctx.Context(), subjectUuid)
+	if findErr != nil {
+		next(ctx)
+		return
+	}
+
+	isDisallowed, disallowErr := IsTokenDisallowed(ctx.Context(), tokenId, claims.ExpiresAt.Time)
+	if disallowErr != nil || isDisallowed {
+		next(ctx)
+		return
+	}
+
+	hasGrant, grantErr := db.Queries.HasOAuthGrant(ctx.Context(), query.HasOAuthGrantParams{
+		UserID:     user.ID,
+		ClientUuid: clientRid.ID,
+	})
+	if grantErr != nil || !hasGrant {
+		next(ctx)
+		return
+	}
+
+	ctx, suspended := checkUserSuspension(ctx, user.Uuid)
+	if suspended {
+		next(ctx)
+		return
+	}
+
+	ctx = huma.WithValue(ctx, PrincipalContextKey, &Principal{
+		User:    user,
+		TokenID: tokenId,
+		Claims:  &claims.RegisteredClaims,
+		Scopes:  strings.Fields(claims.Scope),
+	})
+	next(ctx)
+}
@@ -0,0 +1,401 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/dresswithpockets/openstats/app/db"
+	"github.com/dresswithpockets/openstats/app/db/query"
+	"github.com/dresswithpockets/openstats/app/env"
+	"github.com/dresswithpockets/openstats/app/validation"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rotisserie/eris"
+	"golang.org/x/oauth2"
+)
+
+const OidcAuthorizationTimeout = 10 * time.Minute
+
+var (
+	ErrUnknownOidcProvider      = errors.New("unknown OpenID Connect provider")
+	ErrInvalidOidcAuthorization = errors.New("authorization is invalid or expired")
+	ErrOidcFailed               = errors.New("OpenID Connect verification failed")
+	ErrIdentityAlreadyLinked    = errors.New("identity is already linked to another user")
+	ErrOidcEmailInUse           = errors.New("the identity's email belongs to an existing user, who must sign in to link it")
+)
+
+// OidcProvider is an external OpenID Connect identity provider users can sign in with. Its discovery document is
+// fetched the first time it's used, so an unreachable provider doesn't prevent the API from starting.
+type OidcProvider struct {
+	Name        string
+	DisplayName string
+	Issuer      string
+
+	// TrustEmail is true if the provider's email_verified claim is trusted, so that an identity's first sign in may be
+	// linked to the existing user with the same confirmed email. Any provider which lets its users set email_verified
+	// could take over accounts if it were trusted.
+	TrustEmail bool
+
+	clientId     string
+	clientSecret string
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+// OidcProviders are configured by SetupOidc, in the order they're listed in OPENSTATS_OIDC_PROVIDERS
+var OidcProviders []*OidcProvider
+
+// SetupOidc configures each provider listed in OPENSTATS_OIDC_PROVIDERS. A provider named "example" is configured by
+// OPENSTATS_OIDC_EXAMPLE_ISSUER, OPENSTATS_OIDC_EXAMPLE_CLIENT_ID, OPENSTATS_OIDC_EXAMPLE_CLIENT_SECRET, and optionally
+// OPENSTATS_OIDC_EXAMPLE_DISPLAY_NAME and OPENSTATS_OIDC_EXAMPLE_TRUST_EMAIL.
+func SetupOidc() error {
+	OidcProviders = nil
+	for _, name := range env.GetList("OPENSTATS_OIDC_PROVIDERS") {
+		name = strings.TrimSpace(name)
+		if len(name) == 0 {
+			continue
+		}
+
+		if !validation.ValidSlug(name) {
+			return eris.Errorf("invalid OpenID Connect provider name '%s', expected lowercase-alphanum with dashes", name)
+		}
+
+		key := "OPENSTATS_OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+		provider := &OidcProvider{
+			Name:         name,
+			DisplayName:  env.GetString(key + "_DISPLAY_NAME"),
+			Issuer:       env.GetString(key + "_ISSUER"),
+			TrustEmail:   env.GetBool(key + "_TRUST_EMAIL"),
+			clientId:     env.GetString(key + "_CLIENT_ID"),
+			clientSecret: env.GetString(key + "_CLIENT_SECRET"),
+		}
+
+		if len(provider.Issuer) == 0 || len(provider.clientId) == 0 {
+			return eris.Errorf("%s_ISSUER and %s_CLIENT_ID must be set", key, key)
+		}
+
+		if len(provider.DisplayName) == 0 {
+			provider.DisplayName = name
+		}
+
+		OidcProviders = append(OidcProviders, provider)
+	}
+
+	return nil
+}
+
+func FindOidcProvider(name string) (*OidcProvider, error) {
+	for _, provider := range OidcProviders {
+		if provider.Name == name {
+			return provider, nil
+		}
+	}
+
+	return nil, ErrUnknownOidcProvider
+}
+
+func (p *OidcProvider) discover(ctx context.Context) (*oidc.Provider, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.provider != nil {
+		return p.provider, nil
+	}
+
+	// the provider keeps the context to refresh its signing keys later, so it mustn't be cancelled with the request
+	provider, err := oidc.NewProvider(context.WithoutCancel(ctx), p.Issuer)
+	if err != nil {
+		return nil, eris.Wrapf(err, "error discovering OpenID Connect provider '%s'", p.Name)
+	}
+
+	p.provider = provider
+	return provider, nil
+}
+
+func (p *OidcProvider) config(provider *oidc.Provider) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     p.clientId,
+		ClientSecret: p.clientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  env.GetString("OPENSTATS_APP_BASEURL") + "/internal/session/oidc/" + url.PathEscape(p.Name) + "/callback",
+		Scopes:       []string{oidc.ScopeOpenID, "profile", "email"},
+	}
+}
+
+// OidcIdentity is the identity asserted by a provider's ID token
+type OidcIdentity struct {
+	Provider          string
+	Issuer            string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+	Name              string
+}
+
+func (i OidcIdentity) params(userId int32) query.AddUserIdentityParams {
+	params := query.AddUserIdentityParams{
+		UserID:   userId,
+		Provider: i.Provider,
+		Issuer:   i.Issuer,
+		Subject:  i.Subject,
+	}
+
+	if len(i.Email) > 0 {
+		params.Email = &i.Email
+	}
+
+	return params
+}
+
+// BeginOidcAuthorization starts an authorization code flow with the provider, and returns the URL the user must be sent
+// to. If userId is set, the identity will be linked to that user instead of signing in.
+func BeginOidcAuthorization(ctx context.Context, p *OidcProvider, userId pgtype.Int4) (string, error) {
+	provider, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	// abandoned authorizations are never completed, so they're cleaned up whenever new ones are started
+	if err = db.Queries.DeleteExpiredOidcAuthorizations(ctx); err != nil {
+		return "", eris.Wrap(err, "error deleting expired authorizations")
+	}
+
+	state := rand.Text()
+	nonce := rand.Text()
+	verifier := oauth2.GenerateVerifier()
+
+	if err = db.Queries.CreateOidcAuthorization(ctx, query.CreateOidcAuthorizationParams{
+		State:        state,
+		Provider:     p.Name,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		UserID:       userId,
+		ExpiresAt:    time.Now().UTC().Add(OidcAuthorizationTimeout),
+	}); err != nil {
+		return "", eris.Wrap(err, "error creating authorization")
+	}
+
+	return p.config(provider).AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+// FinishOidcAuthorization exchanges the code returned to the callback for an ID token, and verifies it. The returned
+// authorization's UserID is set if the flow was started to link an identity.
+func FinishOidcAuthorization(ctx context.Context, p *OidcProvider, state, code string) (query.OidcAuthorization, OidcIdentity, error) {
+	authorization, err := db.Queries.TakeOidcAuthorization(ctx, query.TakeOidcAuthorizationParams{
+		State:    state,
+		Provider: p.Name,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return authorization, OidcIdentity{}, ErrInvalidOidcAuthorization
+	}
+
+	if err != nil {
+		return authorization, OidcIdentity{}, eris.Wrap(err, "error getting authorization")
+	}
+
+	provider, err := p.discover(ctx)
+	if err != nil {
+		return authorization, OidcIdentity{}, err
+	}
+
+	token, err := p.config(provider).Exchange(ctx, code, oauth2.VerifierOption(authorization.CodeVerifier))
+	if err != nil {
+		return authorization, OidcIdentity{}, eris.Wrap(ErrOidcFailed, err.Error())
+	}
+
+	rawIdToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return authorization, OidcIdentity{}, eris.Wrap(ErrOidcFailed, "token response didn't include an id_token")
+	}
+
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: p.clientId}).Verify(ctx, rawIdToken)
+	if err != nil {
+		return authorization, OidcIdentity{}, eris.Wrap(ErrOidcFailed, err.Error())
+	}
+
+	if idToken.Nonce != authorization.Nonce {
+		return authorization, OidcIdentity{}, eris.Wrap(ErrOidcFailed, "id_token nonce doesn't match")
+	}
+
+	var claims struct {
+		Email             string `json:"email"`
+		EmailVerified     bool   `json:"email_verified"`
+		PreferredUsername string `json:"preferred_username"`
+		Name              string `json:"name"`
+	}
+	if err = idToken.Claims(&claims); err != nil {
+		return authorization, OidcIdentity{}, eris.Wrap(ErrOidcFailed, err.Error())
+	}
+
+	return authorization, OidcIdentity{
+		Provider:          p.Name,
+		Issuer:            idToken.Issuer,
+		Subject:           idToken.Subject,
+		Email:             claims.Email,
+		EmailVerified:     claims.EmailVerified,
+		PreferredUsername: claims.PreferredUsername,
+		Name:              claims.Name,
+	}, nil
+}
+
+// SignInWithOidc finds the user linked to the identity. On the identity's first sign in, it's linked to the only user
+// with a matching confirmed email if the provider verified it and is trusted to - otherwise, a new user is created for
+// it. If the email belongs to an existing user but can't be trusted, ErrOidcEmailInUse is returned, since the user must
+// sign in and link the identity themselves.
+func SignInWithOidc(ctx context.Context, p *OidcProvider, identity OidcIdentity) (query.User, error) {
+	user, err := db.Queries.FindUserByIdentity(ctx, query.FindUserByIdentityParams{
+		Issuer:  identity.Issuer,
+		Subject: identity.Subject,
+	})
+	if err == nil {
+		err = db.Queries.TouchUserIdentity(ctx, query.TouchUserIdentityParams{
+			Email:   identity.params(user.ID).Email,
+			Issuer:  identity.Issuer,
+			Subject: identity.Subject,
+		})
+		return user, eris.Wrap(err, "error updating user identity")
+	}
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		return user, eris.Wrap(err, "error finding user identity")
+	}
+
+	if identity.EmailVerified && len(identity.Email) > 0 {
+		users, err := db.Queries.FindUsersByConfirmedEmail(ctx, identity.Email)
+		if err != nil {
+			return query.User{}, eris.Wrap(err, "error finding users by email")
+		}
+
+		if len(users) > 0 && (!p.TrustEmail || len(users) > 1) {
+			return query.User{}, ErrOidcEmailInUse
+		}
+
+		if len(users) == 1 {
+			if _, err = db.Queries.AddUserIdentity(ctx, identity.params(users[0].ID)); err != nil {
+				return query.User{}, eris.Wrap(err, "error adding user identity")
+			}
+
+			RecordSecurityEvent(ctx, users[0].ID, SecurityEventIdentityLinked, map[string]string{
+				"provider": p.Name,
+				"method":   "verified-email",
+			})
+			return users[0], nil
+		}
+	}
+
+	createdUser, err := addExternalUser(ctx, p, identity)
+	if err != nil {
+		return query.User{}, err
+	}
+
+	return createdUser.User, nil
+}
+
+// LinkOidcIdentity links the identity to the user, so they can sign in with it
+func LinkOidcIdentity(ctx context.Context, userId int32, identity OidcIdentity) error {
+	user, err := db.Queries.FindUserByIdentity(ctx, query.FindUserByIdentityParams{
+		Issuer:  identity.Issuer,
+		Subject: identity.Subject,
+	})
+	if err == nil {
+		if user.ID != userId {
+			return ErrIdentityAlreadyLinked
+		}
+
+		// already linked to this user
+		return nil
+	}
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		return eris.Wrap(err, "error finding user identity")
+	}
+
+	_, err = db.Queries.AddUserIdentity(ctx, identity.params(userId))
+	if db.IsUniqueConstraintErr(err) {
+		return ErrIdentityAlreadyLinked
+	}
+
+	if err != nil {
+		return eris.Wrap(err, "error adding user identity")
+	}
+
+	RecordSecurityEvent(ctx, userId, SecurityEventIdentityLinked, map[string]string{"provider": identity.Provider, "method": "link"})
+	return nil
+}
+
+const maxExternalUserSlugAttempts = 5
+
+// addExternalUser creates a new user for the identity, with a slug derived from the identity's claims. If the slug is
+// already in use, a random numeric suffix is added. The identity's email is only kept if the provider is trusted to have
+// verified it.
+func addExternalUser(ctx context.Context, p *OidcProvider, identity OidcIdentity) (*db.CreatedUser, error) {
+	base := externalUserSlug(identity)
+
+	displayName := identity.Name
+	if !validation.ValidDisplayName(displayName) {
+		displayName = ""
+	}
+
+	email := ""
+	if p.TrustEmail && identity.EmailVerified && validation.ValidEmailAddress(identity.Email) {
+		email = identity.Email
+	}
+
+	slug := base
+	for attempt := 0; attempt < maxExternalUserSlugAttempts; attempt++ {
+		createdUser, err := db.DB.CreateExternalUser(ctx, slug, email, displayName, identity.params(0))
+		if !errors.Is(err, db.ErrSlugAlreadyInUse) {
+			return createdUser, err
+		}
+
+		suffix, err := rand.Int(rand.Reader, big.NewInt(10000))
+		if err != nil {
+			return nil, eris.Wrap(err, "error generating slug suffix")
+		}
+
+		slug = fmt.Sprintf("%s-%04d", base, suffix.Int64())
+	}
+
+	return nil, eris.Wrapf(db.ErrSlugAlreadyInUse, "couldn't find an unused slug for '%s'", base)
+}
+
+// externalUserSlug derives a valid slug from the identity's preferred username, email, or name - whichever is usable
+// first. Leaves enough room for a suffix to be added if the slug is already in use.
+func externalUserSlug(identity OidcIdentity) string {
+	emailName, _, _ := strings.Cut(identity.Email, "@")
+
+	for _, candidate := range []string{identity.PreferredUsername, emailName, identity.Name} {
+		var builder strings.Builder
+		dash := false
+		for _, r := range strings.ToLower(candidate) {
+			if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+				builder.WriteRune(r)
+				dash = false
+			} else if !dash && builder.Len() > 0 {
+				builder.WriteRune('-')
+				dash = true
+			}
+		}
+
+		slug := strings.TrimRight(builder.String(), "-")
+		if len(slug) > validation.MaxSlugNameLength-5 {
+			slug = strings.TrimRight(slug[:validation.MaxSlugNameLength-5], "-")
+		}
+
+		if validation.ValidSlug(slug) {
+			return slug
+		}
+	}
+
+	return "player"
+}
@@ -0,0 +1,634 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dresswithpockets/openstats/app/db"
+	"github.com/dresswithpockets/openstats/app/db/query"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	testOidcClientId     = "openstats"
+	testOidcClientSecret = "client-secret"
+	testOidcKeyId        = "test-key"
+)
+
+// mockIdp is an OpenID Connect provider which authorizes every request as its current subject
+type mockIdp struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu            sync.Mutex
+	grants        map[string]mockGrant
+	subject       string
+	email         string
+	emailVerified bool
+	// nonce replaces the nonce from the authorization request in the id_token, if set
+	nonce string
+}
+
+type mockGrant struct {
+	nonce       string
+	challenge   string
+	redirectUri string
+}
+
+func newMockIdp(t *testing.T) *mockIdp {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := &mockIdp{t: t, key: key, grants: map[string]mockGrant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", idp.handleDiscovery)
+	mux.HandleFunc("GET /jwks", idp.handleJwks)
+	mux.HandleFunc("GET /authorize", idp.handleAuthorize)
+	mux.HandleFunc("POST /token", idp.handleToken)
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+
+	return idp
+}
+
+func (idp *mockIdp) setUser(subject, email string, emailVerified bool) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	idp.subject, idp.email, idp.emailVerified = subject, email, emailVerified
+}
+
+func writeJson(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+func (idp *mockIdp) handleDiscovery(w http.ResponseWriter, _ *http.Request) {
+	writeJson(w, http.StatusOK, map[string]any{
+		"issuer":                                idp.server.URL,
+		"authorization_endpoint":                idp.server.URL + "/authorize",
+		"token_endpoint":                        idp.server.URL + "/token",
+		"jwks_uri":                              idp.server.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (idp *mockIdp) handleJwks(w http.ResponseWriter, _ *http.Request) {
+	writeJson(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": testOidcKeyId,
+			"n":   base64.RawURLEncoding.EncodeToString(idp.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idp.key.E)).Bytes()),
+		}},
+	})
+}
+
+// handleAuthorize immediately redirects back to the client with a code, as if the user had signed in and consented
+func (idp *mockIdp) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	if values.Get("client_id") != testOidcClientId || values.Get("response_type") != "code" || values.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+
+	code := rand.Text()
+	idp.mu.Lock()
+	idp.grants[code] = mockGrant{
+		nonce:       values.Get("nonce"),
+		challenge:   values.Get("code_challenge"),
+		redirectUri: values.Get("redirect_uri"),
+	}
+	idp.mu.Unlock()
+
+	redirect, err := url.Parse(values.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	redirect.RawQuery = url.Values{"code": {code}, "state": {values.Get("state")}}.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (idp *mockIdp) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	clientId, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientId, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	if clientId != testOidcClientId || clientSecret != testOidcClientSecret {
+		writeJson(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	grant, ok := idp.grants[r.PostForm.Get("code")]
+	delete(idp.grants, r.PostForm.Get("code"))
+
+	verifierHash := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || r.PostForm.Get("grant_type") != "authorization_code" ||
+		r.PostForm.Get("redirect_uri") != grant.redirectUri ||
+		base64.RawURLEncoding.EncodeToString(verifierHash[:]) != grant.challenge {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	nonce := grant.nonce
+	if idp.nonce != "" {
+		nonce = idp.nonce
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            idp.server.URL,
+		"sub":            idp.subject,
+		"aud":            testOidcClientId,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+		"nonce":          nonce,
+		"email":          idp.email,
+		"email_verified": idp.emailVerified,
+	})
+	token.Header["kid"] = testOidcKeyId
+
+	idToken, err := token.SignedString(idp.key)
+	if err != nil {
+		idp.t.Errorf("error signing id_token: %v", err)
+		return
+	}
+
+	writeJson(w, http.StatusOK, map[string]any{
+		"access_token": rand.Text(),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+// authorize follows the authorization URL to the provider and back, returning the state and code sent to the callback
+func (idp *mockIdp) authorize(t *testing.T, authorizationUrl string) (state, code string) {
+	t.Helper()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	response, err := client.Get(authorizationUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = response.Body.Close()
+	if response.StatusCode != http.StatusFound {
+		t.Fatalf("provider responded with %d, want %d", response.StatusCode, http.StatusFound)
+	}
+
+	location, err := response.Location()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if callback := "http://openstats.example/internal/session/oidc/mock/callback"; location.Scheme+"://"+location.Host+location.Path != callback {
+		t.Fatalf("provider redirected to %s, want %s", location, callback)
+	}
+
+	return location.Query().Get("state"), location.Query().Get("code")
+}
+
+// fakeOidcStore is an in-memory stand-in for the queries used by OpenID Connect sign in
+type fakeOidcStore struct {
+	authorizations map[string]query.OidcAuthorization
+	users          map[int32]query.User
+	confirmedEmail map[int32]string
+	identities     []query.UserIdentity
+	securityEvents []string
+}
+
+func newFakeOidcStore(t *testing.T) *fakeOidcStore {
+	t.Helper()
+
+	store := &fakeOidcStore{
+		authorizations: map[string]query.OidcAuthorization{},
+		users:          map[int32]query.User{},
+		confirmedEmail: map[int32]string{},
+	}
+
+	previous := db.Queries
+	db.Queries = query.New(store)
+	t.Cleanup(func() { db.Queries = previous })
+
+	return store
+}
+
+func (s *fakeOidcStore) addUser(slug, email string) query.User {
+	user := query.User{ID: int32(len(s.users) + 1), Uuid: uuid.Must(uuid.NewV7()), Slug: slug}
+	s.users[user.ID] = user
+	s.confirmedEmail[user.ID] = email
+	return user
+}
+
+var queryNamePattern = regexp.MustCompile(`^-- name: (\w+)`)
+
+func queryName(statement string) string {
+	match := queryNamePattern.FindStringSubmatch(statement)
+	if match == nil {
+		return ""
+	}
+
+	return match[1]
+}
+
+func (s *fakeOidcStore) Exec(_ context.Context, statement string, args ...interface{}) (pgconn.CommandTag, error) {
+	switch queryName(statement) {
+	case "DeleteExpiredOidcAuthorizations", "TouchUserIdentity":
+	case "CreateOidcAuthorization":
+		s.authorizations[args[0].(string)] = query.OidcAuthorization{
+			State:        args[0].(string),
+			Provider:     args[1].(string),
+			Nonce:        args[2].(string),
+			CodeVerifier: args[3].(string),
+			UserID:       args[4].(pgtype.Int4),
+			ExpiresAt:    args[5].(time.Time),
+		}
+	case "CreateSecurityEvent":
+		s.securityEvents = append(s.securityEvents, fmt.Sprintf("%d:%s", args[0], args[2]))
+	default:
+		return pgconn.CommandTag{}, fmt.Errorf("unexpected query %q", queryName(statement))
+	}
+
+	return pgconn.NewCommandTag("OK 1"), nil
+}
+
+func (s *fakeOidcStore) QueryRow(_ context.Context, statement string, args ...interface{}) pgx.Row {
+	switch queryName(statement) {
+	case "TakeOidcAuthorization":
+		authorization, ok := s.authorizations[args[0].(string)]
+		if !ok || authorization.Provider != args[1].(string) || !authorization.ExpiresAt.After(time.Now()) {
+			return fakeRow{err: sql.ErrNoRows}
+		}
+
+		delete(s.authorizations, authorization.State)
+		return fakeRow{value: authorization}
+	case "FindUserByIdentity":
+		for _, identity := range s.identities {
+			if identity.Issuer == args[0].(string) && identity.Subject == args[1].(string) {
+				return fakeRow{value: s.users[identity.UserID]}
+			}
+		}
+
+		return fakeRow{err: sql.ErrNoRows}
+	case "AddUserIdentity":
+		identity := query.UserIdentity{
+			ID:       int32(len(s.identities) + 1),
+			Uuid:     uuid.Must(uuid.NewV7()),
+			UserID:   args[0].(int32),
+			Provider: args[1].(string),
+			Issuer:   args[2].(string),
+			Subject:  args[3].(string),
+			Email:    args[4].(*string),
+		}
+		s.identities = append(s.identities, identity)
+		return fakeRow{value: identity}
+	}
+
+	return fakeRow{err: fmt.Errorf("unexpected query %q", queryName(statement))}
+}
+
+func (s *fakeOidcStore) Query(_ context.Context, statement string, args ...interface{}) (pgx.Rows, error) {
+	if queryName(statement) != "FindUsersByConfirmedEmail" {
+		return nil, fmt.Errorf("unexpected query %q", queryName(statement))
+	}
+
+	rows := &fakeRows{}
+	for id, email := range s.confirmedEmail {
+		if email == args[0].(string) {
+			rows.values = append(rows.values, s.users[id])
+		}
+	}
+
+	return rows, nil
+}
+
+func (s *fakeOidcStore) SendBatch(context.Context, *pgx.Batch) pgx.BatchResults {
+	panic("unexpected batch")
+}
+
+// scanStruct scans each field of value into dest, in order. sqlc scans columns in the order of the row struct's fields.
+func scanStruct(value any, dest []any) error {
+	fields := reflect.ValueOf(value)
+	if fields.NumField() != len(dest) {
+		return fmt.Errorf("can't scan %d fields into %d columns", fields.NumField(), len(dest))
+	}
+
+	for idx := range dest {
+		reflect.ValueOf(dest[idx]).Elem().Set(fields.Field(idx))
+	}
+
+	return nil
+}
+
+type fakeRow struct {
+	value any
+	err   error
+}
+
+func (r fakeRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+
+	return scanStruct(r.value, dest)
+}
+
+type fakeRows struct {
+	values []any
+	next   int
+}
+
+func (r *fakeRows) Close()                                       {}
+func (r *fakeRows) Err() error                                   { return nil }
+func (r *fakeRows) CommandTag() pgconn.CommandTag                { return pgconn.NewCommandTag("SELECT") }
+func (r *fakeRows) FieldDescriptions() []pgconn.FieldDescription { return nil }
+func (r *fakeRows) Values() ([]any, error)                       { return nil, errors.New("not supported") }
+func (r *fakeRows) RawValues() [][]byte                          { return nil }
+func (r *fakeRows) Conn() *pgx.Conn                              { return nil }
+
+func (r *fakeRows) Next() bool {
+	r.next++
+	return r.next <= len(r.values)
+}
+
+func (r *fakeRows) Scan(dest ...any) error {
+	return scanStruct(r.values[r.next-1], dest)
+}
+
+func setupMockOidcProvider(t *testing.T, trustEmail bool) (*mockIdp, *OidcProvider, *fakeOidcStore) {
+	t.Helper()
+
+	t.Setenv("OPENSTATS_APP_BASEURL", "http://openstats.example")
+	idp := newMockIdp(t)
+	provider := &OidcProvider{
+		Name:         "mock",
+		DisplayName:  "Mock",
+		Issuer:       idp.server.URL,
+		TrustEmail:   trustEmail,
+		clientId:     testOidcClientId,
+		clientSecret: testOidcClientSecret,
+	}
+
+	return idp, provider, newFakeOidcStore(t)
+}
+
+func TestOidcAuthorization(t *testing.T) {
+	ctx := context.Background()
+	idp, provider, store := setupMockOidcProvider(t, false)
+	idp.setUser("subject-1", "alice@example.com", true)
+
+	authorizationUrl, err := BeginOidcAuthorization(ctx, provider, pgtype.Int4{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, code := idp.authorize(t, authorizationUrl)
+	authorization, identity, err := FinishOidcAuthorization(ctx, provider, state, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if authorization.UserID.Valid {
+		t.Fatal("a sign in authorization shouldn't link to a user")
+	}
+
+	want := OidcIdentity{Provider: "mock", Issuer: idp.server.URL, Subject: "subject-1", Email: "alice@example.com", EmailVerified: true}
+	if identity != want {
+		t.Fatalf("got identity %+v, want %+v", identity, want)
+	}
+
+	if len(store.authorizations) != 0 {
+		t.Fatal("the authorization should be used up")
+	}
+
+	t.Run("replayed state", func(t *testing.T) {
+		if _, _, err := FinishOidcAuthorization(ctx, provider, state, code); !errors.Is(err, ErrInvalidOidcAuthorization) {
+			t.Fatalf("got %v, want %v", err, ErrInvalidOidcAuthorization)
+		}
+	})
+
+	t.Run("unknown state", func(t *testing.T) {
+		authorizationUrl, err := BeginOidcAuthorization(ctx, provider, pgtype.Int4{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, code := idp.authorize(t, authorizationUrl)
+		if _, _, err = FinishOidcAuthorization(ctx, provider, rand.Text(), code); !errors.Is(err, ErrInvalidOidcAuthorization) {
+			t.Fatalf("got %v, want %v", err, ErrInvalidOidcAuthorization)
+		}
+	})
+
+	t.Run("another provider's state", func(t *testing.T) {
+		authorizationUrl, err := BeginOidcAuthorization(ctx, provider, pgtype.Int4{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		state, code := idp.authorize(t, authorizationUrl)
+		other := &OidcProvider{Name: "other", Issuer: provider.Issuer, clientId: testOidcClientId, clientSecret: testOidcClientSecret}
+		if _, _, err = FinishOidcAuthorization(ctx, other, state, code); !errors.Is(err, ErrInvalidOidcAuthorization) {
+			t.Fatalf("got %v, want %v", err, ErrInvalidOidcAuthorization)
+		}
+	})
+
+	t.Run("mismatched nonce", func(t *testing.T) {
+		idp.mu.Lock()
+		idp.nonce = rand.Text()
+		idp.mu.Unlock()
+		t.Cleanup(func() {
+			idp.mu.Lock()
+			idp.nonce = ""
+			idp.mu.Unlock()
+		})
+
+		authorizationUrl, err := BeginOidcAuthorization(ctx, provider, pgtype.Int4{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		state, code := idp.authorize(t, authorizationUrl)
+		if _, _, err = FinishOidcAuthorization(ctx, provider, state, code); !errors.Is(err, ErrOidcFailed) {
+			t.Fatalf("got %v, want %v", err, ErrOidcFailed)
+		}
+	})
+
+	t.Run("another authorization's code", func(t *testing.T) {
+		authorizationUrl, err := BeginOidcAuthorization(ctx, provider, pgtype.Int4{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		otherUrl, err := BeginOidcAuthorization(ctx, provider, pgtype.Int4{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the code was issued for the other authorization's PKCE challenge, so the provider rejects this verifier
+		state, _ := idp.authorize(t, authorizationUrl)
+		_, code := idp.authorize(t, otherUrl)
+		if _, _, err = FinishOidcAuthorization(ctx, provider, state, code); !errors.Is(err, ErrOidcFailed) {
+			t.Fatalf("got %v, want %v", err, ErrOidcFailed)
+		}
+	})
+}
+
+// signInWithMockIdp runs a sign in authorization as the provider's current user
+func signInWithMockIdp(t *testing.T, idp *mockIdp, provider *OidcProvider) (query.User, error) {
+	t.Helper()
+
+	ctx := context.Background()
+	authorizationUrl, err := BeginOidcAuthorization(ctx, provider, pgtype.Int4{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, code := idp.authorize(t, authorizationUrl)
+	_, identity, err := FinishOidcAuthorization(ctx, provider, state, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return SignInWithOidc(ctx, provider, identity)
+}
+
+func TestOidcSignInDoesntLinkUntrustedEmails(t *testing.T) {
+	idp, provider, store := setupMockOidcProvider(t, false)
+	store.addUser("alice", "alice@example.com")
+	idp.setUser("subject-1", "alice@example.com", true)
+
+	if _, err := signInWithMockIdp(t, idp, provider); !errors.Is(err, ErrOidcEmailInUse) {
+		t.Fatalf("got %v, want %v", err, ErrOidcEmailInUse)
+	}
+
+	if len(store.identities) != 0 {
+		t.Fatal("the identity shouldn't have been linked")
+	}
+}
+
+func TestOidcSignInLinksTrustedEmails(t *testing.T) {
+	idp, provider, store := setupMockOidcProvider(t, true)
+	alice := store.addUser("alice", "alice@example.com")
+
+	idp.setUser("subject-1", "alice@example.com", true)
+	user, err := signInWithMockIdp(t, idp, provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user.ID != alice.ID || len(store.identities) != 1 || store.identities[0].UserID != alice.ID {
+		t.Fatalf("the identity should have been linked to %v, got %+v", alice.ID, store.identities)
+	}
+
+	if want := fmt.Sprintf("%d:%s", alice.ID, SecurityEventIdentityLinked); len(store.securityEvents) != 1 || store.securityEvents[0] != want {
+		t.Fatalf("got security events %v, want [%s]", store.securityEvents, want)
+	}
+
+	// once linked, the identity signs in as the user even if their email changes
+	idp.setUser("subject-1", "alice@elsewhere.example", true)
+	user, err = signInWithMockIdp(t, idp, provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user.ID != alice.ID || len(store.identities) != 1 {
+		t.Fatalf("signed in as %v, want %v", user.ID, alice.ID)
+	}
+}
+
+func TestOidcLinking(t *testing.T) {
+	ctx := context.Background()
+	idp, provider, store := setupMockOidcProvider(t, false)
+	alice := store.addUser("alice", "alice@example.com")
+	bob := store.addUser("bob", "bob@example.com")
+
+	// the provider's email doesn't matter when the user links the identity themselves
+	idp.setUser("subject-1", "someone@example.com", false)
+
+	link := func(userId int32) error {
+		authorizationUrl, err := BeginOidcAuthorization(ctx, provider, pgtype.Int4{Int32: userId, Valid: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		state, code := idp.authorize(t, authorizationUrl)
+		authorization, identity, err := FinishOidcAuthorization(ctx, provider, state, code)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if authorization.UserID != (pgtype.Int4{Int32: userId, Valid: true}) {
+			t.Fatalf("got authorization for %v, want %v", authorization.UserID, userId)
+		}
+
+		return LinkOidcIdentity(ctx, authorization.UserID.Int32, identity)
+	}
+
+	if err := link(alice.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := link(alice.ID); err != nil {
+		t.Fatalf("linking the same identity again should do nothing, got %v", err)
+	}
+
+	if err := link(bob.ID); !errors.Is(err, ErrIdentityAlreadyLinked) {
+		t.Fatalf("got %v, want %v", err, ErrIdentityAlreadyLinked)
+	}
+
+	if len(store.identities) != 1 || store.identities[0].UserID != alice.ID {
+		t.Fatalf("got identities %+v, want one linked to %v", store.identities, alice.ID)
+	}
+
+	user, err := signInWithMockIdp(t, idp, provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user.ID != alice.ID {
+		t.Fatalf("signed in as %v, want %v", user.ID, alice.ID)
+	}
+}
@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dresswithpockets/openstats/app/db"
+	"github.com/dresswithpockets/openstats/app/db/query"
+	"github.com/dresswithpockets/openstats/app/log"
+	"github.com/dresswithpockets/openstats/app/rid"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rotisserie/eris"
+)
+
+const (
+	GameServerKeyPrefix          = "osgs"
+	GameServerKeyRidPrefix       = "gk"
+	gameServerKeyLookupLength    = 8
+	gameServerKeyLookupSeparator = "_"
+)
+
+var ErrInvalidGameServerKey = errors.New("invalid game server key")
+
+// GameServerPrincipal is a developer's game server, which may act on behalf of any player of the game
+type GameServerPrincipal struct {
+	KeyUuid uuid.UUID
+	GameRid rid.RID
+}
+
+func GetGameServerPrincipal(ctx context.Context) (result *GameServerPrincipal, ok bool) {
+	result, ok = ctx.Value(PrincipalContextKey).(*GameServerPrincipal)
+	ok = ok && result != nil
+	return
+}
+
+func HasGameServerPrincipal(ctx context.Context) bool {
+	result, ok := ctx.Value(PrincipalContextKey).(*GameServerPrincipal)
+	return ok && result != nil
+}
+
+func hashGameServerKey(key string) []byte {
+	hash := sha256.Sum256([]byte(key))
+	return hash[:]
+}
+
+// CreateGameServerKey creates a server key like osgs_ABCDEFGH_{secret} for the game, as the developer's member. The key
+// is only known when it's created, since only its lookup prefix and hash are stored.
+func CreateGameServerKey(ctx context.Context, gameUuid uuid.UUID, userId int32, comment string) (string, query.GameServerKey, error) {
+	for range lookupPrefixAttempts {
+		lookupPrefix := rand.Text()[:gameServerKeyLookupLength]
+		key := GameServerKeyPrefix + gameServerKeyLookupSeparator + lookupPrefix + gameServerKeyLookupSeparator + rand.Text()
+
+		row, err := db.Queries.CreateGameServerKey(ctx, query.CreateGameServerKeyParams{
+			Comment:         comment,
+			LookupPrefix:    lookupPrefix,
+			KeyHash:         hashGameServerKey(key),
+			CreatedByUserID: pgtype.Int4{Int32: userId, Valid: true},
+			GameUuid:        gameUuid,
+		})
+		if db.IsUniqueConstraintErr(err) {
+			continue
+		}
+
+		if err != nil {
+			return "", row, eris.Wrap(err, "error creating game server key")
+		}
+
+		return key, row, nil
+	}
+
+	return "", query.GameServerKey{}, eris.Errorf("error creating game server key: no unique lookup prefix after %d attempts", lookupPrefixAttempts)
+}
+
+// FindGameServerKey finds the server key that the bearer token authenticates as
+func FindGameServerKey(ctx context.Context, q *query.Queries, key string) (query.FindGameServerKeyRow, error) {
+	lookupPrefix, isKey := strings.CutPrefix(key, GameServerKeyPrefix+gameServerKeyLookupSeparator)
+	if !isKey {
+		return query.FindGameServerKeyRow{}, ErrInvalidGameServerKey
+	}
+
+	lookupPrefix, _, hasSecret := strings.Cut(lookupPrefix, gameServerKeyLookupSeparator)
+	if !hasSecret || len(lookupPrefix) != gameServerKeyLookupLength {
+		return query.FindGameServerKeyRow{}, ErrInvalidGameServerKey
+	}
+
+	row, err := q.FindGameServerKey(ctx, lookupPrefix)
+	if errors.Is(err, sql.ErrNoRows) {
+		return row, ErrInvalidGameServerKey
+	}
+
+	if err != nil {
+		return row, eris.Wrap(err, "error finding game server key")
+	}
+
+	if subtle.ConstantTimeCompare(row.KeyHash, hashGameServerKey(key)) != 1 {
+		return query.FindGameServerKeyRow{}, ErrInvalidGameServerKey
+	}
+
+	return row, nil
+}
+
+func GameServerAuthHandler(ctx huma.Context, next func(huma.Context)) {
+	authHeader := ctx.Header("Authorization")
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	if tokenString == "" || tokenString == authHeader {
+		next(ctx)
+		return
+	}
+
+	keyInfo, findErr := FindGameServerKey(ctx.Context(), db.Queries, tokenString)
+	if findErr != nil {
+		next(ctx)
+		return
+	}
+
+	// last use is only informational, so that developers can tell which keys are safe to delete
+	if touchErr := db.Queries.TouchGameServerKey(ctx.Context(), keyInfo.Uuid); touchErr != nil {
+		log.Logger.Error("error updating game server key last use", "error", touchErr)
+	}
+
+	ctx = huma.WithValue(ctx, PrincipalContextKey, &GameServerPrincipal{
+		KeyUuid: keyInfo.Uuid,
+		GameRid: rid.From(GameRidPrefix, keyInfo.GameUuid),
+	})
+	next(ctx)
+}
+
+func CreateRequireGameServerAuthHandler(api huma.API) func(ctx huma.Context, next func(huma.Context)) {
+	return func(ctx huma.Context, next func(huma.Context)) {
+		if !HasGameServerPrincipal(ctx.Context()) {
+			writeUnauthenticatedErr(api, ctx)
+			return
+		}
+
+		next(ctx)
+	}
+}
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/dresswithpockets/openstats/app/db"
+	"github.com/google/uuid"
+	"github.com/rotisserie/eris"
+)
+
+// SessionTouchInterval is how often a session token's last_seen_at is updated while it's being used
+const SessionTouchInterval = 5 * time.Minute
+
+// sessionTouches tracks when this replica last updated each session token's last_seen_at, so it isn't written on every
+// request
+var sessionTouches = struct {
+	mu      sync.Mutex
+	touched map[uuid.UUID]time.Time
+}{touched: make(map[uuid.UUID]time.Time)}
+
+// TouchSessionToken records that the session token was just used, at most once per SessionTouchInterval
+func TouchSessionToken(ctx context.Context, tokenId uuid.UUID) error {
+	now := time.Now().UTC()
+
+	sessionTouches.mu.Lock()
+	if now.Sub(sessionTouches.touched[tokenId]) < SessionTouchInterval {
+		sessionTouches.mu.Unlock()
+		return nil
+	}
+
+	sessionTouches.touched[tokenId] = now
+	sessionTouches.mu.Unlock()
+
+	return eris.Wrap(db.Queries.TouchToken(ctx, tokenId), "error touching session token")
+}
+
+// pruneSessionTouches forgets tokens that haven't been touched recently, which have usually expired or signed out
+func pruneSessionTouches(now time.Time) {
+	sessionTouches.mu.Lock()
+	defer sessionTouches.mu.Unlock()
+
+	for tokenId, touchedAt := range sessionTouches.touched {
+		if now.Sub(touchedAt) >= SessionTouchInterval {
+			delete(sessionTouches.touched, tokenId)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dresswithpockets/openstats/app/db"
+	"github.com/dresswithpockets/openstats/app/db/query"
+	"github.com/dresswithpockets/openstats/app/log"
+	"github.com/dresswithpockets/openstats/app/rid"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rotisserie/eris"
+)
+
+// GameBuildSecretPath is the path of each game build's HMAC secret, keyed by build id. The secret is shared with the
+// game's developer so that they can embed it in the build.
+const GameBuildSecretPath = "shared.game-build.hmac"
+
+const (
+	GameBuildRidPrefix = "gb"
+
+	BuildHeader     = "X-Openstats-Build"
+	SignatureHeader = "X-Openstats-Signature"
+
+	// SignatureTolerance is how far a signature's timestamp may be from the server's clock. Nonces are only remembered
+	// for this long after the timestamp, so a signature can't be replayed after it expires.
+	SignatureTolerance = 5 * time.Minute
+
+	// NoncePruneInterval is how often RunNoncePruner deletes nonces whose signatures have expired
+	NoncePruneInterval = 10 * time.Minute
+
+	minNonceLength = 16
+	maxNonceLength = 64
+)
+
+var (
+	ErrInvalidSignature  = errors.New("invalid progress signature")
+	ErrSignatureExpired  = fmt.Errorf("%w: the signature has expired", ErrInvalidSignature)
+	ErrSignatureReplayed = fmt.Errorf("%w: the nonce has already been used", ErrInvalidSignature)
+)
+
+// CreateGameBuild creates a build of the game, along with its secret
+func CreateGameBuild(ctx context.Context, gameUuid uuid.UUID, userId int32, name string) (build query.GameBuild, secret string, err error) {
+	secret = rand.Text()
+	err = db.DB.Transact(ctx, func(ctx context.Context, qtx *query.Queries) (txErr error) {
+		build, txErr = qtx.CreateGameBuild(ctx, query.CreateGameBuildParams{
+			Name:            name,
+			CreatedByUserID: pgtype.Int4{Int32: userId, Valid: true},
+			GameUuid:        gameUuid,
+		})
+		if txErr != nil {
+			return eris.Wrap(txErr, "error adding game build")
+		}
+
+		return qtx.SecretCreate(ctx, query.SecretCreateParams{
+			Path:  GameBuildSecretPath,
+			Key:   strconv.FormatInt(int64(build.ID), 10),
+			Value: secret,
+		})
+	})
+
+	return
+}
+
+// DeleteGameBuild deletes the game's build and its secret, so the build's signatures are no longer accepted. It returns
+// false if the game has no such build.
+func DeleteGameBuild(ctx context.Context, gameUuid, buildUuid uuid.UUID) (bool, error) {
+	err := db.DB.Transact(ctx, func(ctx context.Context, qtx *query.Queries) error {
+		buildId, err := qtx.DeleteGameBuild(ctx, query.DeleteGameBuildParams{GameUuid: gameUuid, BuildUuid: buildUuid})
+		if err != nil {
+			return err
+		}
+
+		return qtx.SecretDelete(ctx, query.SecretDeleteParams{
+			Path: GameBuildSecretPath,
+			Key:  strconv.FormatInt(int64(buildId), 10),
+		})
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+
+	return err == nil, eris.Wrap(err, "error deleting game build")
+}
+
+// SignProgress returns the value of the SignatureHeader for the request, in the format `t={timestamp},n={nonce},v1={signature}`,
+// where timestamp is the unix time in seconds and signature is the hex-encoded HMAC-SHA256 of
+// `{timestamp}.{nonce}.{method}.{path}.{body}`, keyed by the build's secret. The method is uppercase, and the path is the
+// request's path without its query string, so a signature can't be replayed to another endpoint or user. Each nonce may
+// only be used once.
+func SignProgress(secret string, timestamp time.Time, nonce, method, path string, body []byte) string {
+	unix := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + unix + ",n=" + nonce + ",v1=" + hex.EncodeToString(progressMac(secret, unix, nonce, method, path, body))
+}
+
+func progressMac(secret, unix, nonce, method, path string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	for _, part := range []string{unix, nonce, method, path} {
+		mac.Write([]byte(part))
+		mac.Write([]byte("."))
+	}
+
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// parseSignature parses a SignatureHeader value
+func parseSignature(header string) (timestamp time.Time, unix, nonce string, signature []byte, err error) {
+	for part := range strings.SplitSeq(header, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			unix = value
+		case "n":
+			nonce = value
+		case "v1":
+			signature, err = hex.DecodeString(value)
+			if err != nil {
+				return timestamp, "", "", nil, ErrInvalidSignature
+			}
+		}
+	}
+
+	seconds, parseErr := strconv.ParseInt(unix, 10, 64)
+	if parseErr != nil || len(nonce) < minNonceLength || len(nonce) > maxNonceLength || len(signature) == 0 {
+		return timestamp, "", "", nil, ErrInvalidSignature
+	}
+
+	return time.Unix(seconds, 0), unix, nonce, signature, nil
+}
+
+// verifyProgressSignature verifies that the request was signed by the game's build, and that the signature hasn't been
+// used before
+func verifyProgressSignature(ctx context.Context, gameUuid uuid.UUID, buildHeader, signatureHeader, method, path string, body []byte) error {
+	buildRid, err := rid.ParseString(buildHeader)
+	if err != nil || buildRid.Prefix != GameBuildRidPrefix {
+		return ErrInvalidSignature
+	}
+
+	timestamp, unix, nonce, signature, err := parseSignature(signatureHeader)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if timestamp.Before(now.Add(-SignatureTolerance)) || timestamp.After(now.Add(SignatureTolerance)) {
+		return ErrSignatureExpired
+	}
+
+	buildId, err := db.Queries.FindGameBuild(ctx, query.FindGameBuildParams{GameUuid: gameUuid, BuildUuid: buildRid.ID})
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrInvalidSignature
+	}
+
+	if err != nil {
+		return eris.Wrap(err, "error finding game build")
+	}
+
+	secret, err := db.Queries.SecretRead(ctx, query.SecretReadParams{
+		Path: GameBuildSecretPath,
+		Key:  strconv.FormatInt(int64(buildId), 10),
+	})
+	if err != nil {
+		return eris.Wrap(err, "error reading game build secret")
+	}
+
+	if !hmac.Equal(signature, progressMac(secret, unix, nonce, method, path, body)) {
+		return ErrInvalidSignature
+	}
+
+	// the nonce is only recorded once the signature is known to be valid, so that forged requests can't use up nonces
+	used, err := db.Queries.UseGameBuildNonce(ctx, query.UseGameBuildNonceParams{
+		GameBuildID: buildId,
+		Nonce:       nonce,
+		ExpiresAt:   timestamp.Add(SignatureTolerance),
+	})
+	if err != nil {
+		return eris.Wrap(err, "error recording progress signature nonce")
+	}
+
+	if used == 0 {
+		return ErrSignatureReplayed
+	}
+
+	return nil
+}
+
+// humaContext is embedded by bodyContext, since an embedded huma.Context field would hide its Context method
+type humaContext = huma.Context
+
+// bodyContext replays a request body which was already read by a middleware
+type bodyContext struct {
+	humaContext
+	body []byte
+}
+
+func (c *bodyContext) BodyReader() io.Reader {
+	return bytes.NewReader(c.body)
+}
+
+// CreateRequireSignedProgressHandler rejects progress submitted by game sessions of games which require signed progress,
+// unless the request has a valid SignatureHeader from one of the game's builds, named by the BuildHeader. It must follow
+// GameSessionAuthHandler.
+func CreateRequireSignedProgressHandler(api huma.API) func(ctx huma.Context, next func(huma.Context)) {
+	return func(ctx huma.Context, next func(huma.Context)) {
+		principal, ok := GetGameSessionPrincipal(ctx.Context())
+		if !ok {
+			next(ctx)
+			return
+		}
+
+		settings, err := db.Queries.GetGameProgressSettings(ctx.Context(), principal.GameRid.ID)
+		if err != nil {
+			log.Logger.Error("error getting game progress settings", "error", err)
+			_ = huma.WriteErr(api, ctx, http.StatusInternalServerError, "")
+			return
+		}
+
+		if !settings.RequireSignedProgress {
+			next(ctx)
+			return
+		}
+
+		buildHeader := ctx.Header(BuildHeader)
+		signatureHeader := ctx.Header(SignatureHeader)
+		if buildHeader == "" || signatureHeader == "" {
+			_ = huma.WriteErr(api, ctx, http.StatusUnauthorized, "this game requires progress to be signed")
+			return
+		}
+
+		reader := ctx.BodyReader()
+		if maxBytes := ctx.Operation().MaxBodyBytes; maxBytes > 0 {
+			reader = io.LimitReader(reader, maxBytes)
+		}
+
+		body, err := io.ReadAll(reader)
+		if err != nil {
+			_ = huma.WriteErr(api, ctx, http.StatusBadRequest, "error reading request body")
+			return
+		}
+
+		err = verifyProgressSignature(ctx.Context(), principal.GameRid.ID, buildHeader, signatureHeader, ctx.Method(), ctx.URL().Path, body)
+		if errors.Is(err, ErrInvalidSignature) {
+			_ = huma.WriteErr(api, ctx, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		if err != nil {
+			log.Logger.Error("error verifying progress signature", "error", err)
+			_ = huma.WriteErr(api, ctx, http.StatusInternalServerError, "")
+			return
+		}
+
+		next(&bodyContext{humaContext: ctx, body: body})
+	}
+}
+
+// RunNoncePruner deletes the nonces of expired progress signatures every NoncePruneInterval until ctx is done. It is
+// intended to be run in its own goroutine.
+func RunNoncePruner(ctx context.Context) {
+	ticker := time.NewTicker(NoncePruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := db.Queries.DeleteExpiredGameBuildNonces(ctx); err != nil {
+			log.Logger.Error("error pruning progress signature nonces", "error", err)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"testing"
+	"time"
+)
+
+func TestSignProgressCoversRequest(t *testing.T) {
+	const (
+		secret = "build-secret"
+		nonce  = "0123456789abcdef"
+		method = "POST"
+		path   = "/users/v1/u_AZhjuMmhePWkHFALenFEfg/games/g_AZhjuMmhePWkHFALenFEfg/achievements"
+	)
+
+	body := []byte(`{"progress":{"first-win":1}}`)
+	header := SignProgress(secret, time.Now(), nonce, method, path, body)
+
+	_, unix, parsedNonce, signature, err := parseSignature(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !hmac.Equal(signature, progressMac(secret, unix, parsedNonce, method, path, body)) {
+		t.Fatal("signature doesn't verify for the request it was made for")
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   []byte
+	}{
+		{"another method", "PUT", path, body},
+		{"another path", method, "/users/v1/u_AZhjuMmhePWkHFALenFEfh/games/g_AZhjuMmhePWkHFALenFEfg/achievements", body},
+		{"another body", method, path, []byte(`{"progress":{"first-win":2}}`)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if hmac.Equal(signature, progressMac(secret, unix, parsedNonce, test.method, test.path, test.body)) {
+				t.Fatal("signature verified for a different request")
+			}
+		})
+	}
+}
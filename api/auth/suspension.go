@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dresswithpockets/openstats/app/db"
+	"github.com/dresswithpockets/openstats/app/db/query"
+	"github.com/dresswithpockets/openstats/app/log"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rotisserie/eris"
+)
+
+// UserSuspendedError is returned instead of signing in a suspended user. EndsAt is nil if the user is banned.
+type UserSuspendedError struct {
+	Reason string
+	EndsAt *time.Time
+}
+
+func (e *UserSuspendedError) Error() string {
+	if e.EndsAt == nil {
+		return "account banned: " + e.Reason
+	}
+
+	return fmt.Sprintf("account suspended until %s: %s", e.EndsAt.UTC().Format(time.RFC3339), e.Reason)
+}
+
+type suspensionContextKey struct{}
+
+// GetUserSuspension returns a UserSuspendedError if the user is currently suspended or banned, or nil if they aren't
+func GetUserSuspension(ctx context.Context, userUuid uuid.UUID) (*UserSuspendedError, error) {
+	suspension, err := db.Queries.GetActiveUserSuspension(ctx, userUuid)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, eris.Wrap(err, "error getting user suspension")
+	}
+
+	suspendedErr := &UserSuspendedError{Reason: suspension.Reason}
+	if suspension.EndsAt.Valid {
+		suspendedErr.EndsAt = &suspension.EndsAt.Time
+	}
+
+	return suspendedErr, nil
+}
+
+// checkUserSuspension is used by the auth handlers before they add a principal for the user. Suspended users are
+// left unauthenticated, with their suspension added to the context instead so the Require handlers can say why.
+func checkUserSuspension(ctx huma.Context, userUuid uuid.UUID) (huma.Context, bool) {
+	suspension, err := GetUserSuspension(ctx.Context(), userUuid)
+	if err != nil {
+		// the user can't be allowed in if it's unknown whether they're suspended
+		log.Logger.Error("error checking user suspension", "error", err, "user", userUuid)
+		return ctx, true
+	}
+
+	if suspension != nil {
+		return huma.WithValue(ctx, suspensionContextKey{}, suspension), true
+	}
+
+	return ctx, false
+}
+
+// writeUnauthenticatedErr rejects a request which wasn't authenticated, explaining why if the user is suspended
+func writeUnauthenticatedErr(api huma.API, ctx huma.Context) {
+	if suspension, ok := ctx.Context().Value(suspensionContextKey{}).(*UserSuspendedError); ok {
+		_ = huma.WriteErr(api, ctx, http.StatusForbidden, suspension.Error())
+		return
+	}
+
+	_ = huma.WriteErr(api, ctx, http.StatusUnauthorized, "")
+}
+
+// SuspendUser stops the user from signing in or using their game tokens until endsAt, as an action taken by the actor.
+// The user is banned if endsAt is nil.
+func SuspendUser(ctx context.Context, actorUserId, userId int32, reason string, endsAt *time.Time) (query.UserSuspension, error) {
+	params := query.CreateUserSuspensionParams{
+		UserID:      userId,
+		ActorUserID: pgtype.Int4{Int32: actorUserId, Valid: true},
+		Reason:      reason,
+	}
+
+	details := map[string]string{"reason": reason}
+	kind := SecurityEventUserBanned
+	if endsAt != nil {
+		params.EndsAt = pgtype.Timestamptz{Time: *endsAt, Valid: true}
+		details["endsAt"] = endsAt.UTC().Format(time.RFC3339)
+		kind = SecurityEventUserSuspended
+	}
+
+	suspension, err := db.Queries.CreateUserSuspension(ctx, params)
+	if err != nil {
+		return suspension, eris.Wrap(err, "error suspending user")
+	}
+
+	RecordAdminSecurityEvent(ctx, actorUserId, userId, kind, details)
+	return suspension, nil
+}
+
+// LiftUserSuspension ends the user's suspensions and bans early, as an action taken by the actor. It returns false if
+// the user wasn't suspended.
+func LiftUserSuspension(ctx context.Context, actorUserId, userId int32) (bool, error) {
+	rows, err := db.Queries.LiftUserSuspensions(ctx, query.LiftUserSuspensionsParams{
+		LiftedByUserID: pgtype.Int4{Int32: actorUserId, Valid: true},
+		UserID:         userId,
+	})
+	if err != nil {
+		return false, eris.Wrap(err, "error lifting user suspension")
+	}
+
+	if rows > 0 {
+		RecordAdminSecurityEvent(ctx, actorUserId, userId, SecurityEventSuspensionLifted, nil)
+	}
+
+	return rows > 0, nil
+}
@@ -0,0 +1,300 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/dresswithpockets/openstats/app/db"
+	"github.com/dresswithpockets/openstats/app/db/query"
+	"github.com/dresswithpockets/openstats/app/env"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rotisserie/eris"
+)
+
+const (
+	WebAuthnCeremonyRegistration = "registration"
+	WebAuthnCeremonySignIn       = "sign-in"
+	WebAuthnCeremonyTimeout      = 5 * time.Minute
+)
+
+var (
+	ErrInvalidWebAuthnCeremony = errors.New("passkey ceremony is invalid or expired")
+	ErrWebAuthnFailed          = errors.New("passkey verification failed")
+)
+
+// WebAuthn is configured by SetupWebAuthn
+var WebAuthn *webauthn.WebAuthn
+
+func SetupWebAuthn() (err error) {
+	timeout := webauthn.TimeoutConfig{
+		Enforce:    true,
+		Timeout:    WebAuthnCeremonyTimeout,
+		TimeoutUVD: WebAuthnCeremonyTimeout,
+	}
+
+	WebAuthn, err = webauthn.New(&webauthn.Config{
+		RPID:          env.GetString("OPENSTATS_WEBAUTHN_RP_ID"),
+		RPDisplayName: env.GetString("OPENSTATS_WEBAUTHN_RP_DISPLAY_NAME"),
+		RPOrigins:     env.GetList("OPENSTATS_WEBAUTHN_RP_ORIGINS"),
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        timeout,
+			Registration: timeout,
+		},
+	})
+
+	return eris.Wrap(err, "error configuring webauthn")
+}
+
+// webAuthnUser adapts a user and their passkeys to webauthn.User. The user handle is the user's uuid.
+type webAuthnUser struct {
+	user        query.User
+	credentials []webauthn.Credential
+}
+
+func (u *webAuthnUser) WebAuthnID() []byte {
+	return u.user.Uuid[:]
+}
+
+func (u *webAuthnUser) WebAuthnName() string {
+	return u.user.Slug
+}
+
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	return u.user.Slug
+}
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+func loadWebAuthnUser(ctx context.Context, user query.User) (*webAuthnUser, error) {
+	rows, err := db.Queries.GetUserWebAuthnCredentials(ctx, user.ID)
+	if err != nil {
+		return nil, eris.Wrap(err, "error getting user passkeys")
+	}
+
+	result := &webAuthnUser{
+		user:        user,
+		credentials: make([]webauthn.Credential, len(rows)),
+	}
+
+	for idx, row := range rows {
+		if err = json.Unmarshal(row.Credential, &result.credentials[idx]); err != nil {
+			return nil, eris.Wrap(err, "error decoding user passkey")
+		}
+	}
+
+	return result, nil
+}
+
+func createWebAuthnCeremony(ctx context.Context, userId pgtype.Int4, kind string, session *webauthn.SessionData) (uuid.UUID, error) {
+	// expired ceremonies are never finished, so they're cleaned up whenever new ones are started
+	if err := db.Queries.DeleteExpiredWebAuthnCeremonies(ctx); err != nil {
+		return uuid.UUID{}, eris.Wrap(err, "error deleting expired passkey ceremonies")
+	}
+
+	sessionData, err := json.Marshal(session)
+	if err != nil {
+		return uuid.UUID{}, eris.Wrap(err, "error encoding passkey session")
+	}
+
+	ceremonyUuid, err := db.Queries.CreateWebAuthnCeremony(ctx, query.CreateWebAuthnCeremonyParams{
+		UserID:      userId,
+		Kind:        kind,
+		SessionData: sessionData,
+		ExpiresAt:   time.Now().UTC().Add(WebAuthnCeremonyTimeout),
+	})
+
+	return ceremonyUuid, eris.Wrap(err, "error creating passkey ceremony")
+}
+
+func takeWebAuthnCeremony(ctx context.Context, ceremonyUuid uuid.UUID, userId pgtype.Int4, kind string) (session webauthn.SessionData, err error) {
+	sessionData, err := db.Queries.TakeWebAuthnCeremony(ctx, query.TakeWebAuthnCeremonyParams{
+		CeremonyUuid: ceremonyUuid,
+		Kind:         kind,
+		UserID:       userId,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return session, ErrInvalidWebAuthnCeremony
+	}
+
+	if err != nil {
+		return session, eris.Wrap(err, "error getting passkey ceremony")
+	}
+
+	err = json.Unmarshal(sessionData, &session)
+	return session, eris.Wrap(err, "error decoding passkey session")
+}
+
+// passkeyRegistrationOptions returns the options for a registration ceremony, which require a discoverable passkey that
+// isn't one of the user's existing passkeys
+func passkeyRegistrationOptions(webUser *webAuthnUser) (*protocol.CredentialCreation, *webauthn.SessionData, error) {
+	return WebAuthn.BeginRegistration(
+		webUser,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		webauthn.WithExclusions(webauthn.Credentials(webUser.credentials).CredentialDescriptors()),
+	)
+}
+
+// createPasskeyCredential verifies the client's response to a registration ceremony, returning the new passkey
+func createPasskeyCredential(webUser *webAuthnUser, session webauthn.SessionData, response []byte) (*webauthn.Credential, error) {
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(response)
+	if err != nil {
+		return nil, eris.Wrap(ErrWebAuthnFailed, err.Error())
+	}
+
+	credential, err := WebAuthn.CreateCredential(webUser, session, parsed)
+	if err != nil {
+		return nil, eris.Wrap(ErrWebAuthnFailed, err.Error())
+	}
+
+	return credential, nil
+}
+
+// passkeySignInOptions returns the options for a discoverable sign in ceremony, which require user verification
+func passkeySignInOptions() (*protocol.CredentialAssertion, *webauthn.SessionData, error) {
+	return WebAuthn.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+}
+
+// validatePasskeySignIn verifies the client's response to a sign in ceremony, returning the user who owns the passkey,
+// as loaded by loadUser from the passkey's user handle, and the passkey with its updated sign count
+func validatePasskeySignIn(session webauthn.SessionData, response []byte, loadUser func(userUuid uuid.UUID) (*webAuthnUser, error)) (*webAuthnUser, *webauthn.Credential, error) {
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return nil, nil, eris.Wrap(ErrWebAuthnFailed, err.Error())
+	}
+
+	user, credential, err := WebAuthn.ValidatePasskeyLogin(func(_, userHandle []byte) (webauthn.User, error) {
+		userUuid, err := uuid.FromBytes(userHandle)
+		if err != nil {
+			return nil, err
+		}
+
+		return loadUser(userUuid)
+	}, session, parsed)
+	if err != nil {
+		return nil, nil, eris.Wrap(ErrWebAuthnFailed, err.Error())
+	}
+
+	if credential.Authenticator.CloneWarning {
+		return nil, nil, eris.Wrap(ErrWebAuthnFailed, "passkey sign count went backwards; the authenticator may be cloned")
+	}
+
+	return user.(*webAuthnUser), credential, nil
+}
+
+// BeginPasskeyRegistration starts a registration ceremony for a new passkey. The returned options must be passed to
+// navigator.credentials.create() by the client, and its response passed to FinishPasskeyRegistration.
+func BeginPasskeyRegistration(ctx context.Context, user query.User) (ceremonyUuid uuid.UUID, options json.RawMessage, err error) {
+	webUser, err := loadWebAuthnUser(ctx, user)
+	if err != nil {
+		return
+	}
+
+	creation, session, err := passkeyRegistrationOptions(webUser)
+	if err != nil {
+		return uuid.UUID{}, nil, eris.Wrap(err, "error beginning passkey registration")
+	}
+
+	ceremonyUuid, err = createWebAuthnCeremony(ctx, pgtype.Int4{Int32: user.ID, Valid: true}, WebAuthnCeremonyRegistration, session)
+	if err != nil {
+		return uuid.UUID{}, nil, err
+	}
+
+	options, err = json.Marshal(creation)
+	return ceremonyUuid, options, eris.Wrap(err, "error encoding passkey registration options")
+}
+
+// FinishPasskeyRegistration verifies the client's response to the registration ceremony, and stores the new passkey
+func FinishPasskeyRegistration(ctx context.Context, user query.User, ceremonyUuid uuid.UUID, name string, response []byte) (query.WebauthnCredential, error) {
+	session, err := takeWebAuthnCeremony(ctx, ceremonyUuid, pgtype.Int4{Int32: user.ID, Valid: true}, WebAuthnCeremonyRegistration)
+	if err != nil {
+		return query.WebauthnCredential{}, err
+	}
+
+	webUser, err := loadWebAuthnUser(ctx, user)
+	if err != nil {
+		return query.WebauthnCredential{}, err
+	}
+
+	credential, err := createPasskeyCredential(webUser, session, response)
+	if err != nil {
+		return query.WebauthnCredential{}, err
+	}
+
+	encoded, err := json.Marshal(credential)
+	if err != nil {
+		return query.WebauthnCredential{}, eris.Wrap(err, "error encoding passkey")
+	}
+
+	row, err := db.Queries.AddWebAuthnCredential(ctx, query.AddWebAuthnCredentialParams{
+		UserID:       user.ID,
+		CredentialID: credential.ID,
+		Name:         name,
+		Credential:   encoded,
+	})
+
+	return row, eris.Wrap(err, "error adding passkey")
+}
+
+// BeginPasskeySignIn starts a discoverable sign in ceremony, where the user is identified by the passkey they choose.
+// The returned options must be passed to navigator.credentials.get() by the client, and its response passed to
+// FinishPasskeySignIn.
+func BeginPasskeySignIn(ctx context.Context) (ceremonyUuid uuid.UUID, options json.RawMessage, err error) {
+	assertion, session, err := passkeySignInOptions()
+	if err != nil {
+		return uuid.UUID{}, nil, eris.Wrap(err, "error beginning passkey sign in")
+	}
+
+	ceremonyUuid, err = createWebAuthnCeremony(ctx, pgtype.Int4{}, WebAuthnCeremonySignIn, session)
+	if err != nil {
+		return uuid.UUID{}, nil, err
+	}
+
+	options, err = json.Marshal(assertion)
+	return ceremonyUuid, options, eris.Wrap(err, "error encoding passkey sign in options")
+}
+
+// FinishPasskeySignIn verifies the client's response to the sign in ceremony, and returns the uuid of the user who owns
+// the passkey
+func FinishPasskeySignIn(ctx context.Context, ceremonyUuid uuid.UUID, response []byte) (uuid.UUID, error) {
+	session, err := takeWebAuthnCeremony(ctx, ceremonyUuid, pgtype.Int4{}, WebAuthnCeremonySignIn)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+
+	webUser, credential, err := validatePasskeySignIn(session, response, func(userUuid uuid.UUID) (*webAuthnUser, error) {
+		user, err := db.Queries.FindUser(ctx, userUuid)
+		if err != nil {
+			return nil, err
+		}
+
+		return loadWebAuthnUser(ctx, user)
+	})
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+
+	encoded, err := json.Marshal(credential)
+	if err != nil {
+		return uuid.UUID{}, eris.Wrap(err, "error encoding passkey")
+	}
+
+	err = db.Queries.UpdateWebAuthnCredential(ctx, query.UpdateWebAuthnCredentialParams{
+		Credential:   encoded,
+		CredentialID: credential.ID,
+	})
+	if err != nil {
+		return uuid.UUID{}, eris.Wrap(err, "error updating passkey")
+	}
+
+	signedInUser := webUser.user
+	RecordSecurityEvent(ctx, signedInUser.ID, SecurityEventSignIn, map[string]string{"method": "passkey"})
+	return signedInUser.Uuid, nil
+}
@@ -0,0 +1,343 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/dresswithpockets/openstats/app/db/query"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+)
+
+const (
+	testRPID   = "openstats.example"
+	testOrigin = "https://openstats.example"
+)
+
+var b64 = base64.RawURLEncoding
+
+// softwareAuthenticator is a passkey authenticator with a single ES256 credential, which answers ceremonies the way a
+// browser and platform authenticator would
+type softwareAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialId []byte
+	userHandle   []byte
+	signCount    uint32
+}
+
+func newSoftwareAuthenticator(t *testing.T) *softwareAuthenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	credentialId := make([]byte, 32)
+	_, _ = rand.Read(credentialId)
+	return &softwareAuthenticator{key: key, credentialId: credentialId}
+}
+
+// options is the subset of the registration and sign in options that the authenticator needs
+type options struct {
+	PublicKey struct {
+		Challenge string `json:"challenge"`
+		RP        struct {
+			ID string `json:"id"`
+		} `json:"rp"`
+		RPID string `json:"rpId"`
+		User struct {
+			ID string `json:"id"`
+		} `json:"user"`
+	} `json:"publicKey"`
+}
+
+func parseOptions(t *testing.T, value any) options {
+	t.Helper()
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result options
+	if err = json.Unmarshal(encoded, &result); err != nil {
+		t.Fatal(err)
+	}
+
+	return result
+}
+
+func (a *softwareAuthenticator) clientData(t *testing.T, kind, challenge, origin string) []byte {
+	t.Helper()
+
+	clientData, err := json.Marshal(map[string]string{"type": kind, "challenge": challenge, "origin": origin})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return clientData
+}
+
+func (a *softwareAuthenticator) authenticatorData(t *testing.T, rpId string, attested bool) []byte {
+	t.Helper()
+
+	rpIdHash := sha256.Sum256([]byte(rpId))
+	flags := byte(0x01 | 0x04) // user present, user verified
+	if attested {
+		flags |= 0x40
+	}
+
+	data := append(rpIdHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	if !attested {
+		return data
+	}
+
+	publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  int64(webauthncose.P256),
+		XCoord: a.key.PublicKey.X.FillBytes(make([]byte, 32)),
+		YCoord: a.key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data = append(data, make([]byte, 16)...) // aaguid
+	data = binary.BigEndian.AppendUint16(data, uint16(len(a.credentialId)))
+	data = append(data, a.credentialId...)
+	return append(data, publicKey...)
+}
+
+// register answers navigator.credentials.create() with a "none" attestation
+func (a *softwareAuthenticator) register(t *testing.T, creation options, origin string) []byte {
+	t.Helper()
+
+	userHandle, err := b64.DecodeString(creation.PublicKey.User.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a.userHandle = userHandle
+	attestation, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": a.authenticatorData(t, creation.PublicKey.RP.ID, true),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := json.Marshal(map[string]any{
+		"id":    b64.EncodeToString(a.credentialId),
+		"rawId": b64.EncodeToString(a.credentialId),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64.EncodeToString(a.clientData(t, "webauthn.create", creation.PublicKey.Challenge, origin)),
+			"attestationObject": b64.EncodeToString(attestation),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return response
+}
+
+// signIn answers navigator.credentials.get() with an assertion from the authenticator's credential
+func (a *softwareAuthenticator) signIn(t *testing.T, assertion options, origin string) []byte {
+	t.Helper()
+
+	a.signCount++
+	authData := a.authenticatorData(t, assertion.PublicKey.RPID, false)
+	clientData := a.clientData(t, "webauthn.get", assertion.PublicKey.Challenge, origin)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(authData, clientDataHash[:]...))
+
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := json.Marshal(map[string]any{
+		"id":    b64.EncodeToString(a.credentialId),
+		"rawId": b64.EncodeToString(a.credentialId),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64.EncodeToString(clientData),
+			"authenticatorData": b64.EncodeToString(authData),
+			"signature":         b64.EncodeToString(signature),
+			"userHandle":        b64.EncodeToString(a.userHandle),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return response
+}
+
+// roundTrip encodes and decodes the session, the same as it is when stored with the ceremony
+func roundTrip(t *testing.T, session *webauthn.SessionData) webauthn.SessionData {
+	t.Helper()
+
+	encoded, err := json.Marshal(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result webauthn.SessionData
+	if err = json.Unmarshal(encoded, &result); err != nil {
+		t.Fatal(err)
+	}
+
+	return result
+}
+
+func setupTestWebAuthn(t *testing.T) {
+	t.Helper()
+
+	t.Setenv("OPENSTATS_WEBAUTHN_RP_ID", testRPID)
+	t.Setenv("OPENSTATS_WEBAUTHN_RP_DISPLAY_NAME", "openstats")
+	t.Setenv("OPENSTATS_WEBAUTHN_RP_ORIGINS", testOrigin)
+	if err := SetupWebAuthn(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// registerPasskey runs a registration ceremony for the user, returning the user with their new passkey
+func registerPasskey(t *testing.T, authenticator *softwareAuthenticator) *webAuthnUser {
+	t.Helper()
+
+	user := &webAuthnUser{user: query.User{ID: 1, Uuid: uuid.Must(uuid.NewV7()), Slug: "alice"}}
+	creation, session, err := passkeyRegistrationOptions(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response := authenticator.register(t, parseOptions(t, creation), testOrigin)
+	credential, err := createPasskeyCredential(user, roundTrip(t, session), response)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user.credentials = append(user.credentials, *credential)
+	return user
+}
+
+func TestPasskeyRegistrationAndSignIn(t *testing.T) {
+	setupTestWebAuthn(t)
+
+	authenticator := newSoftwareAuthenticator(t)
+	user := registerPasskey(t, authenticator)
+
+	loadUser := func(userUuid uuid.UUID) (*webAuthnUser, error) {
+		if userUuid != user.user.Uuid {
+			return nil, errors.New("unknown user")
+		}
+
+		return user, nil
+	}
+
+	for attempt := range 2 {
+		assertion, session, err := passkeySignInOptions()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		response := authenticator.signIn(t, parseOptions(t, assertion), testOrigin)
+		signedIn, credential, err := validatePasskeySignIn(roundTrip(t, session), response, loadUser)
+		if err != nil {
+			t.Fatalf("sign in %d: %v", attempt+1, err)
+		}
+
+		if signedIn.user.Uuid != user.user.Uuid {
+			t.Fatalf("sign in %d: signed in as %v, want %v", attempt+1, signedIn.user.Uuid, user.user.Uuid)
+		}
+
+		if credential.Authenticator.SignCount != authenticator.signCount {
+			t.Fatalf("sign in %d: sign count is %d, want %d", attempt+1, credential.Authenticator.SignCount, authenticator.signCount)
+		}
+
+		user.credentials[0] = *credential
+	}
+}
+
+func TestPasskeySignInFailures(t *testing.T) {
+	setupTestWebAuthn(t)
+
+	authenticator := newSoftwareAuthenticator(t)
+	user := registerPasskey(t, authenticator)
+	loadUser := func(uuid.UUID) (*webAuthnUser, error) { return user, nil }
+
+	t.Run("wrong origin", func(t *testing.T) {
+		assertion, session, err := passkeySignInOptions()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		response := authenticator.signIn(t, parseOptions(t, assertion), "https://evil.example")
+		if _, _, err = validatePasskeySignIn(roundTrip(t, session), response, loadUser); !errors.Is(err, ErrWebAuthnFailed) {
+			t.Fatalf("got %v, want %v", err, ErrWebAuthnFailed)
+		}
+	})
+
+	t.Run("another ceremony's challenge", func(t *testing.T) {
+		assertion, _, err := passkeySignInOptions()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, otherSession, err := passkeySignInOptions()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		response := authenticator.signIn(t, parseOptions(t, assertion), testOrigin)
+		if _, _, err = validatePasskeySignIn(roundTrip(t, otherSession), response, loadUser); !errors.Is(err, ErrWebAuthnFailed) {
+			t.Fatalf("got %v, want %v", err, ErrWebAuthnFailed)
+		}
+	})
+
+	t.Run("cloned authenticator", func(t *testing.T) {
+		user.credentials[0].Authenticator.SignCount = 100
+
+		assertion, session, err := passkeySignInOptions()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		response := authenticator.signIn(t, parseOptions(t, assertion), testOrigin)
+		if _, _, err = validatePasskeySignIn(roundTrip(t, session), response, loadUser); !errors.Is(err, ErrWebAuthnFailed) {
+			t.Fatalf("got %v, want %v", err, ErrWebAuthnFailed)
+		}
+	})
+}
+
+func TestPasskeyRegistrationRejectsWrongOrigin(t *testing.T) {
+	setupTestWebAuthn(t)
+
+	user := &webAuthnUser{user: query.User{ID: 1, Uuid: uuid.Must(uuid.NewV7()), Slug: "alice"}}
+	creation, session, err := passkeyRegistrationOptions(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response := newSoftwareAuthenticator(t).register(t, parseOptions(t, creation), "https://evil.example")
+	if _, err = createPasskeyCredential(user, roundTrip(t, session), response); !errors.Is(err, ErrWebAuthnFailed) {
+		t.Fatalf("got %v, want %v", err, ErrWebAuthnFailed)
+	}
+}
@@ -0,0 +1,4 @@
+drop trigger if exists achievement_notify_added on achievement;
+drop function if exists notify_game_achievements_added;
+drop index if exists notification_user_id_uuid;
+drop table if exists notification;
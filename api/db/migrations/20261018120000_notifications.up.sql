@@ -0,0 +1,53 @@
+/*
+notifications are generated server-side in response to events relevant to a user. The kind determines which of the
+nullable reference columns are populated:
+
+    rare-achievement-unlocked: game_id, achievement_id
+    game-achievements-added:   game_id, achievement_count
+    game-token-expiring:       game_id, game_token_id
+    email-confirmed:           email
+
+dedupe_key is optional; when set, only one notification with that key may exist per user, which lets generators be
+idempotent without having to check for prior notifications first.
+*/
+create table if not exists notification
+(
+    id                serial primary key,
+    created_at        timestamptz not null default now(),
+    uuid              uuid        not null unique default gen_uuid_v7(),
+    user_id           integer     not null references users,
+    kind              text        not null,
+    game_id           integer references game on delete cascade,
+    achievement_id    integer references achievement on delete cascade,
+    game_token_id     integer references game_token on delete cascade,
+    achievement_count integer,
+    email             text,
+    dedupe_key        text,
+    read_at           timestamptz,
+
+    unique (user_id, dedupe_key)
+);
+
+create index if not exists notification_user_id_uuid on notification(user_id, uuid);
+
+-- when achievements are added to a game, every user who has played that game is notified once per statement, so that
+-- bulk inserts of many achievements don't flood the user with notifications
+create or replace function notify_game_achievements_added() returns trigger
+as
+$$
+begin
+    insert into notification (user_id, kind, game_id, achievement_count)
+    select distinct gs.user_id, 'game-achievements-added', added.game_id, added.achievement_count
+    from (select game_id, count(*)::integer as achievement_count from new_achievements group by game_id) added
+         join game_session gs on gs.game_id = added.game_id;
+
+    return null;
+end;
+$$ language plpgsql;
+
+create or replace trigger achievement_notify_added
+    after insert
+    on achievement
+    referencing new table as new_achievements
+    for each statement
+execute function notify_game_achievements_added();
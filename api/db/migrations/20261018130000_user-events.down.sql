@@ -0,0 +1,5 @@
+drop trigger if exists game_session_notify_event on game_session;
+drop function if exists notify_game_session_event;
+drop trigger if exists achievement_progress_notify_event on achievement_progress;
+drop function if exists notify_achievement_progress_event;
+alter table game_session drop column if exists ended_at;
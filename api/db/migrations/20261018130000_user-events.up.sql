@@ -0,0 +1,76 @@
+alter table game_session add column if not exists ended_at timestamptz;
+
+/*
+user events are published on the openstats_user_events channel via pg_notify, so that every API replica can relay them
+to subscribers - e.g. Server-Sent Event streams - regardless of which replica handled the write.
+
+each payload is a json object with these keys:
+    kind:                one of achievement-unlocked, progress-changed, session-started, session-ended
+    userUuid:            the user the event concerns
+    gameUuid:            the game the event concerns
+    sessionUuid:         set for session-started and session-ended
+    achievementSlug:     set for achievement-unlocked and progress-changed
+    progress:            set for achievement-unlocked and progress-changed
+    progressRequirement: set for achievement-unlocked and progress-changed
+*/
+create or replace function notify_achievement_progress_event() returns trigger
+as
+$$
+declare
+    old_progress integer := case when tg_op = 'UPDATE' then old.progress else 0 end;
+begin
+    if tg_op = 'UPDATE' and old.progress = new.progress then
+        return null;
+    end if;
+
+    perform pg_notify('openstats_user_events', json_build_object(
+        'kind', case when old_progress < a.progress_requirement and new.progress >= a.progress_requirement
+                     then 'achievement-unlocked'
+                     else 'progress-changed' end,
+        'userUuid', u.uuid,
+        'gameUuid', g.uuid,
+        'achievementSlug', a.slug,
+        'progress', new.progress,
+        'progressRequirement', a.progress_requirement
+    )::text)
+    from achievement a
+         join game g on a.game_id = g.id,
+         users u
+    where a.id = new.achievement_id and u.id = new.user_id;
+
+    return null;
+end;
+$$ language plpgsql;
+
+create or replace trigger achievement_progress_notify_event
+    after insert or update
+    on achievement_progress
+    for each row
+execute function notify_achievement_progress_event();
+
+create or replace function notify_game_session_event() returns trigger
+as
+$$
+begin
+    if tg_op = 'UPDATE' and (old.ended_at is not null or new.ended_at is null) then
+        return null;
+    end if;
+
+    perform pg_notify('openstats_user_events', json_build_object(
+        'kind', case when tg_op = 'INSERT' then 'session-started' else 'session-ended' end,
+        'userUuid', u.uuid,
+        'gameUuid', g.uuid,
+        'sessionUuid', new.uuid
+    )::text)
+    from game g, users u
+    where g.id = new.game_id and u.id = new.user_id;
+
+    return null;
+end;
+$$ language plpgsql;
+
+create or replace trigger game_session_notify_event
+    after insert or update of ended_at
+    on game_session
+    for each row
+execute function notify_game_session_event();
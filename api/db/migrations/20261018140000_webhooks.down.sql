@@ -0,0 +1,58 @@
+-- restore the trigger functions from the user-events migration, which only notify listeners
+create or replace function notify_achievement_progress_event() returns trigger
+as
+$$
+declare
+    old_progress integer := case when tg_op = 'UPDATE' then old.progress else 0 end;
+begin
+    if tg_op = 'UPDATE' and old.progress = new.progress then
+        return null;
+    end if;
+
+    perform pg_notify('openstats_user_events', json_build_object(
+        'kind', case when old_progress < a.progress_requirement and new.progress >= a.progress_requirement
+                     then 'achievement-unlocked'
+                     else 'progress-changed' end,
+        'userUuid', u.uuid,
+        'gameUuid', g.uuid,
+        'achievementSlug', a.slug,
+        'progress', new.progress,
+        'progressRequirement', a.progress_requirement
+    )::text)
+    from achievement a
+         join game g on a.game_id = g.id,
+         users u
+    where a.id = new.achievement_id and u.id = new.user_id;
+
+    return null;
+end;
+$$ language plpgsql;
+
+create or replace function notify_game_session_event() returns trigger
+as
+$$
+begin
+    if tg_op = 'UPDATE' and (old.ended_at is not null or new.ended_at is null) then
+        return null;
+    end if;
+
+    perform pg_notify('openstats_user_events', json_build_object(
+        'kind', case when tg_op = 'INSERT' then 'session-started' else 'session-ended' end,
+        'userUuid', u.uuid,
+        'gameUuid', g.uuid,
+        'sessionUuid', new.uuid
+    )::text)
+    from game g, users u
+    where g.id = new.game_id and u.id = new.user_id;
+
+    return null;
+end;
+$$ language plpgsql;
+
+drop function if exists publish_user_event;
+drop index if exists webhook_delivery_webhook_id_uuid;
+drop index if exists webhook_delivery_pending;
+drop table if exists webhook_delivery;
+drop trigger if exists webhook_moddatetime on webhook;
+drop table if exists webhook;
+delete from secret where path = 'shared.webhook.hmac';
@@ -0,0 +1,130 @@
+/*
+webhooks are subscribed to by game developers to receive user events for their game. events is the list of event kinds
+that the webhook receives: achievement-unlocked, game-completed, session-started, session-ended
+
+each webhook has a shared.webhook.hmac secret, keyed by webhook id, used to sign delivery payloads.
+*/
+create table if not exists webhook
+(
+    id         serial primary key,
+    created_at timestamptz not null default now(),
+    updated_at timestamptz not null default now(),
+    uuid       uuid        not null unique default gen_uuid_v7(),
+    game_id    integer     not null references game,
+    url        text        not null,
+    events     text[]      not null,
+    enabled    boolean     not null default true
+);
+create or replace trigger webhook_moddatetime
+    before update
+    on webhook
+    for each row
+execute function moddatetime(updated_at);
+
+/*
+webhook_delivery is a durable queue of events to deliver to webhooks, and doubles as the delivery log. Deliveries are
+pending until they either succeed, or fail too many times. next_attempt_at is pushed into the future while a delivery
+is being attempted, so that a crashed worker's deliveries are eventually retried by another.
+
+event has the same shape as the payloads published on the openstats_user_events channel.
+*/
+create table if not exists webhook_delivery
+(
+    id               serial primary key,
+    created_at       timestamptz not null default now(),
+    uuid             uuid        not null unique default gen_uuid_v7(),
+    webhook_id       integer     not null references webhook on delete cascade,
+    event            jsonb       not null,
+    status           text        not null default 'pending',
+    attempt_count    integer     not null default 0,
+    next_attempt_at  timestamptz not null default now(),
+    last_attempt_at  timestamptz,
+    last_status_code integer,
+    last_error       text,
+    delivered_at     timestamptz
+);
+
+create index if not exists webhook_delivery_pending on webhook_delivery(next_attempt_at) where status = 'pending';
+create index if not exists webhook_delivery_webhook_id_uuid on webhook_delivery(webhook_id, uuid);
+
+-- publish_user_event notifies listeners of the event, and enqueues a delivery to every enabled webhook for the game
+-- that is subscribed to the event's kind
+create or replace function publish_user_event(event json, target_game_id integer) returns void
+as
+$$
+begin
+    perform pg_notify('openstats_user_events', event::text);
+
+    insert into webhook_delivery (webhook_id, event)
+    select w.id, event::jsonb
+    from webhook w
+    where w.game_id = target_game_id
+      and w.enabled
+      and event ->> 'kind' = any (w.events);
+end;
+$$ language plpgsql;
+
+create or replace function notify_achievement_progress_event() returns trigger
+as
+$$
+declare
+    old_progress integer := case when tg_op = 'UPDATE' then old.progress else 0 end;
+    target       record;
+begin
+    if tg_op = 'UPDATE' and old.progress = new.progress then
+        return null;
+    end if;
+
+    select a.slug, a.progress_requirement, g.id as game_id, g.uuid as game_uuid, u.uuid as user_uuid
+    into target
+    from achievement a
+         join game g on a.game_id = g.id,
+         users u
+    where a.id = new.achievement_id and u.id = new.user_id;
+
+    perform publish_user_event(json_build_object(
+        'kind', case when old_progress < target.progress_requirement and new.progress >= target.progress_requirement
+                     then 'achievement-unlocked'
+                     else 'progress-changed' end,
+        'userUuid', target.user_uuid,
+        'gameUuid', target.game_uuid,
+        'achievementSlug', target.slug,
+        'progress', new.progress,
+        'progressRequirement', target.progress_requirement
+    ), target.game_id);
+
+    if old_progress < target.progress_requirement
+        and new.progress >= target.progress_requirement
+        and exists (select * from game_completion gc
+                    where gc.game_id = target.game_id and gc.user_id = new.user_id and gc.has_every_achievement) then
+        perform publish_user_event(json_build_object(
+            'kind', 'game-completed',
+            'userUuid', target.user_uuid,
+            'gameUuid', target.game_uuid
+        ), target.game_id);
+    end if;
+
+    return null;
+end;
+$$ language plpgsql;
+
+create or replace function notify_game_session_event() returns trigger
+as
+$$
+begin
+    if tg_op = 'UPDATE' and (old.ended_at is not null or new.ended_at is null) then
+        return null;
+    end if;
+
+    perform publish_user_event(json_build_object(
+        'kind', case when tg_op = 'INSERT' then 'session-started' else 'session-ended' end,
+        'userUuid', u.uuid,
+        'gameUuid', g.uuid,
+        'sessionUuid', new.uuid
+    ), new.game_id)
+    from game g, users u
+    where g.id = new.game_id and u.id = new.user_id;
+
+    return null;
+end;
+$$ language plpgsql;
@@ -0,0 +1,4 @@
+drop table if exists user_showcase_game;
+drop table if exists user_showcase_achievement;
+drop trigger if exists user_showcase_moddatetime on user_showcase;
+drop table if exists user_showcase;
@@ -0,0 +1,40 @@
+/*
+a user's showcase is the curated part of their profile. Every section of the profile is visible unless it is listed in
+hidden_sections, and a user without a user_showcase row just gets the default, fully computed profile.
+
+pinned achievements and games are kept in ordered slots; the maximum number of slots is enforced by the slot check
+constraints, and must be kept in sync with internal.MaxShowcaseAchievements and internal.MaxShowcaseGames.
+*/
+create table if not exists user_showcase
+(
+    user_id          integer primary key references users,
+    created_at       timestamptz not null default now(),
+    updated_at       timestamptz not null default now(),
+    featured_game_id integer references game on delete set null,
+    hidden_sections  text[]      not null default '{}'
+);
+create or replace trigger user_showcase_moddatetime
+    before update
+    on user_showcase
+    for each row
+execute function moddatetime(updated_at);
+
+create table if not exists user_showcase_achievement
+(
+    user_id        integer  not null references users,
+    slot           smallint not null check (slot >= 0 and slot < 8),
+    achievement_id integer  not null references achievement on delete cascade,
+
+    primary key (user_id, slot),
+    unique (user_id, achievement_id)
+);
+
+create table if not exists user_showcase_game
+(
+    user_id integer  not null references users,
+    slot    smallint not null check (slot >= 0 and slot < 4),
+    game_id integer  not null references game on delete cascade,
+
+    primary key (user_id, slot),
+    unique (user_id, game_id)
+);
@@ -0,0 +1,6 @@
+drop table if exists user_link;
+
+alter table users
+    drop column if exists bio_text,
+    drop column if exists pronouns,
+    drop column if exists country;
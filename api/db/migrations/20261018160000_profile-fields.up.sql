@@ -0,0 +1,25 @@
+alter table users
+    add column if not exists bio_text text check (char_length(bio_text) <= 1024),
+    add column if not exists pronouns text check (char_length(pronouns) <= 32),
+    add column if not exists country  text check (country ~ '^[A-Z]{2}$');
+
+comment on column users.bio_text is 'markdown-subset bio, validated by validation.ValidBioText before being stored';
+comment on column users.country is 'ISO 3166-1 alpha-2 country code';
+
+/*
+external links shown on a user's profile, in position order. A link is verified when the linked page has a rel=me link
+back to the user's openstats profile; verified_at is cleared if a later check fails.
+*/
+create table if not exists user_link
+(
+    id          serial primary key,
+    created_at  timestamptz not null default now(),
+    uuid        uuid        not null unique default gen_uuid_v7(),
+    user_id     integer     not null references users,
+    position    integer     not null,
+    url         text        not null,
+    checked_at  timestamptz,
+    verified_at timestamptz,
+
+    unique (user_id, url)
+);
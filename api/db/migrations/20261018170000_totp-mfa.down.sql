@@ -0,0 +1,6 @@
+drop table if exists mfa_challenge;
+drop index if exists user_recovery_code_user_id;
+drop table if exists user_recovery_code;
+drop table if exists user_mfa;
+
+delete from secret where path = 'shared.user.mfa-hmac';
@@ -0,0 +1,35 @@
+/*
+a user has TOTP MFA enabled once their enrollment is confirmed. The TOTP secret itself is stored in the secret table at
+'shared.user.mfa-hmac', keyed by user id, since it's shared with the user's authenticator app.
+*/
+create table if not exists user_mfa
+(
+    user_id      integer primary key references users,
+    created_at   timestamptz not null default now(),
+    confirmed_at timestamptz
+);
+
+-- one-time recovery codes, hashed with the same parameters as user passwords
+create table if not exists user_recovery_code
+(
+    id           serial primary key,
+    created_at   timestamptz not null default now(),
+    user_id      integer     not null references users,
+    encoded_hash text        not null,
+    used_at      timestamptz
+);
+
+create index if not exists user_recovery_code_user_id on user_recovery_code(user_id) where used_at is null;
+
+-- issued by sign-in when the user's password is correct but they have MFA enabled. The challenge must be completed
+-- with a TOTP or recovery code before a session is created.
+create table if not exists mfa_challenge
+(
+    id            serial primary key,
+    created_at    timestamptz not null default now(),
+    uuid          uuid        not null unique default gen_uuid_v7(),
+    user_id       integer     not null references users,
+    expires_at    timestamptz not null,
+    attempt_count integer     not null default 0,
+    completed_at  timestamptz
+);
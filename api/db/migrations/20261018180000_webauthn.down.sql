@@ -0,0 +1,3 @@
+drop table if exists webauthn_ceremony;
+drop index if exists webauthn_credential_user_id;
+drop table if exists webauthn_credential;
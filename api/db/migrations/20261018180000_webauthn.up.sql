@@ -0,0 +1,35 @@
+/*
+passkeys registered by users. credential is the JSON-serialized webauthn.Credential, which includes the public key and
+the authenticator's sign count; it's replaced after every successful sign in so the sign count stays current.
+
+WebAuthn user handles are the raw bytes of users.uuid.
+*/
+create table if not exists webauthn_credential
+(
+    id            serial primary key,
+    created_at    timestamptz not null default now(),
+    uuid          uuid        not null unique default gen_uuid_v7(),
+    user_id       integer     not null references users,
+    credential_id bytea       not null unique,
+    name          text        not null,
+    credential    jsonb       not null,
+    last_used_at  timestamptz
+);
+
+create index if not exists webauthn_credential_user_id on webauthn_credential(user_id);
+
+/*
+the server-side state of an in-progress registration or sign in ceremony. session_data is the JSON-serialized
+webauthn.SessionData; each ceremony can only be finished once. user_id is null for discoverable sign ins, since the
+user isn't known until the assertion is received.
+*/
+create table if not exists webauthn_ceremony
+(
+    id           serial primary key,
+    created_at   timestamptz not null default now(),
+    uuid         uuid        not null unique default gen_uuid_v7(),
+    user_id      integer references users,
+    kind         text        not null,
+    session_data jsonb       not null,
+    expires_at   timestamptz not null
+);
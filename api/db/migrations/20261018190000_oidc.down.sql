@@ -0,0 +1,3 @@
+drop table if exists oidc_authorization;
+drop index if exists user_identity_user_id;
+drop table if exists user_identity;
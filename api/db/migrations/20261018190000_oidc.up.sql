@@ -0,0 +1,36 @@
+/*
+external OpenID Connect identities linked to users. The subject is only unique per issuer, so identities are keyed by
+(issuer, subject) rather than by the configured provider name - renaming a provider doesn't orphan its identities.
+*/
+create table if not exists user_identity
+(
+    id           serial primary key,
+    created_at   timestamptz not null default now(),
+    uuid         uuid        not null unique default gen_uuid_v7(),
+    user_id      integer     not null references users,
+    provider     text        not null,
+    issuer       text        not null,
+    subject      text        not null,
+    email        text,
+    last_used_at timestamptz,
+
+    unique (issuer, subject)
+);
+
+create index if not exists user_identity_user_id on user_identity(user_id);
+
+/*
+the server-side state of an in-progress authorization code flow. user_id is set when an authenticated user is linking
+a new identity, and null when signing in. Each authorization can only be completed once.
+*/
+create table if not exists oidc_authorization
+(
+    id            serial primary key,
+    created_at    timestamptz not null default now(),
+    state         text        not null unique,
+    provider      text        not null,
+    nonce         text        not null,
+    code_verifier text        not null,
+    user_id       integer references users,
+    expires_at    timestamptz not null
+);
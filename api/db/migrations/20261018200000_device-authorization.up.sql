@@ -0,0 +1,22 @@
+/*
+OAuth 2.0 device authorization grants (RFC 8628), which let a game get a game token without the player copying one
+from the website. The game polls with the device code, which is only stored as a sha256 hash; the player approves the
+request on the website by entering the short user code.
+
+user_id is set once a player approves or denies the request. The row is deleted when the game receives its game token, or when
+the request is denied and the game is told so.
+*/
+create table if not exists device_authorization
+(
+    id               serial primary key,
+    created_at       timestamptz not null default now(),
+    device_code_hash bytea       not null unique,
+    user_code        text        not null unique,
+    game_id          integer     not null references game,
+    user_id          integer references users,
+    approved_at      timestamptz,
+    denied_at        timestamptz,
+    poll_interval    integer     not null,
+    last_polled_at   timestamptz,
+    expires_at       timestamptz not null
+);
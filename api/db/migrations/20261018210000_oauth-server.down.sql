@@ -0,0 +1,5 @@
+drop index if exists oauth_refresh_token_user_id;
+drop table if exists oauth_refresh_token;
+drop table if exists oauth_authorization_code;
+drop index if exists oauth_client_developer_id;
+drop table if exists oauth_client;
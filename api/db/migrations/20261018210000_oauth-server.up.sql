@@ -0,0 +1,52 @@
+/*
+third-party apps registered by developers, which users can authorize to access their data with OAuth 2.0.
+
+secret_hash is the sha256 hash of the client secret, which is only shown when the client is created. Public clients,
+like mobile apps that can't keep a secret, have no secret and rely on PKCE alone.
+*/
+create table if not exists oauth_client
+(
+    id            serial primary key,
+    created_at    timestamptz not null default now(),
+    uuid          uuid        not null unique default gen_uuid_v7(),
+    developer_id  integer     not null references developer,
+    name          text        not null,
+    redirect_uris text[]      not null,
+    secret_hash   bytea
+);
+
+create index if not exists oauth_client_developer_id on oauth_client(developer_id);
+
+/*
+authorization codes issued once a user consents to a client's request, exchanged for tokens at the token endpoint.
+Codes are only stored as sha256 hashes, and can only be exchanged once.
+*/
+create table if not exists oauth_authorization_code
+(
+    id             serial primary key,
+    created_at     timestamptz not null default now(),
+    code_hash      bytea       not null unique,
+    client_id      integer     not null references oauth_client on delete cascade,
+    user_id        integer     not null references users,
+    redirect_uri   text        not null,
+    scopes         text[]      not null,
+    code_challenge text        not null,
+    expires_at     timestamptz not null
+);
+
+/*
+refresh tokens issued to clients, only stored as sha256 hashes. Refresh tokens are rotated: each one is deleted when
+it's used, and replaced by a new one. Deleting a user's refresh tokens for a client revokes its access.
+*/
+create table if not exists oauth_refresh_token
+(
+    id         serial primary key,
+    created_at timestamptz not null default now(),
+    token_hash bytea       not null unique,
+    client_id  integer     not null references oauth_client on delete cascade,
+    user_id    integer     not null references users,
+    scopes     text[]      not null,
+    expires_at timestamptz not null
+);
+
+create index if not exists oauth_refresh_token_user_id on oauth_refresh_token(user_id);
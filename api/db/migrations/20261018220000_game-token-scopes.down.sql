@@ -0,0 +1,2 @@
+alter table game_token
+    drop column if exists scopes;
@@ -0,0 +1,7 @@
+-- tokens created before scopes existed had full access, so they keep every scope
+alter table game_token
+    add column if not exists scopes text[] not null default '{read-profile,write-progress,read-friends,write-stats}';
+
+-- new tokens must choose their scopes
+alter table game_token
+    alter column scopes drop default;
@@ -0,0 +1,4 @@
+alter table game_token
+    drop constraint if exists game_token_hashed,
+    drop column if exists token_hash,
+    drop column if exists lookup_prefix;
@@ -0,0 +1,9 @@
+-- game tokens are random secrets like osgt_{lookup_prefix}_{secret}. Only the prefix, used to find the token, and a
+-- SHA-256 hash of the whole token are stored. Tokens created before this have neither. Their RID, which anyone who can
+-- read the database can see, only authenticates them while OPENSTATS_ALLOW_LEGACY_GAME_TOKENS is enabled and until
+-- they're rotated. It's disabled by default: enable it while migrating, ask players to rotate their legacy tokens, then
+-- disable it again.
+alter table game_token
+    add column if not exists lookup_prefix text unique,
+    add column if not exists token_hash    bytea,
+    add constraint game_token_hashed check ((lookup_prefix is null) = (token_hash is null));
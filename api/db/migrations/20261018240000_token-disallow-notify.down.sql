@@ -0,0 +1,2 @@
+drop trigger if exists token_disallow_list_notify on token_disallow_list;
+drop function if exists notify_token_disallowed;
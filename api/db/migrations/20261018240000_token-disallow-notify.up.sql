@@ -0,0 +1,18 @@
+/*
+disallowed tokens are published on the openstats_disallowed_tokens channel via pg_notify, so that every API replica can
+invalidate its cache of the disallow list. Each payload is the disallowed token's id.
+*/
+create or replace function notify_token_disallowed() returns trigger
+as
+$$
+begin
+    perform pg_notify('openstats_disallowed_tokens', new.token_id::text);
+    return null;
+end;
+$$ language plpgsql;
+
+create or replace trigger token_disallow_list_notify
+    after insert
+    on token_disallow_list
+    for each row
+execute function notify_token_disallowed();
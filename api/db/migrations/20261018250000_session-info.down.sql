@@ -0,0 +1,4 @@
+alter table token
+    drop column if exists last_seen_at,
+    drop column if exists user_agent,
+    drop column if exists ip_address;
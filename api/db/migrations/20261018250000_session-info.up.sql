@@ -0,0 +1,5 @@
+-- session tokens record where they were created, and when they were last used, so users can see where they're signed in
+alter table token
+    add column if not exists ip_address   text,
+    add column if not exists user_agent   text,
+    add column if not exists last_seen_at timestamptz;
@@ -0,0 +1,11 @@
+-- token buckets for rate limiting, shared by every replica when OPENSTATS_RATE_LIMIT_STORE is Postgres
+create table if not exists rate_limit_bucket
+(
+    key        text primary key,
+    tokens     double precision not null,
+    updated_at timestamptz      not null,
+    -- when the bucket will have refilled, after which it's no different to a missing bucket and can be deleted
+    full_at    timestamptz      not null
+);
+
+create index if not exists rate_limit_bucket_full_at on rate_limit_bucket (full_at);
@@ -0,0 +1,12 @@
+-- failed attempts at guessing a user's credentials, counted per account so that guesses from many IP addresses are
+-- still limited. kind separates sign in attempts from attempts at the codes emailed to the user.
+create table if not exists account_lockout
+(
+    user_id        integer     not null references users on delete cascade,
+    kind           text        not null,
+    failed_count   integer     not null default 0,
+    last_failed_at timestamptz not null,
+    lockout_count  integer     not null default 0,
+    locked_until   timestamptz,
+    primary key (user_id, kind)
+);
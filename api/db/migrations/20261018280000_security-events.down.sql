@@ -0,0 +1,3 @@
+drop trigger if exists security_event_append_only on security_event;
+drop function if exists reject_security_event_update();
+drop table if exists security_event;
@@ -0,0 +1,33 @@
+/*
+security events are an append-only log of security-relevant changes to a user's account, such as signing in or changing
+their password, so the user can review their account's history. actor_user_id is set when an admin acted on the user's
+account. details depends on the kind, e.g. the sign in method or the email that was added.
+*/
+create table if not exists security_event
+(
+    id            bigserial primary key,
+    created_at    timestamptz not null default now(),
+    uuid          uuid        not null unique default gen_uuid_v7(),
+    user_id       integer     not null references users on delete cascade,
+    actor_user_id integer references users on delete set null,
+    kind          text        not null,
+    ip_address    text,
+    user_agent    text,
+    details       jsonb       not null default '{}'
+);
+
+create index if not exists security_event_user_id_uuid on security_event (user_id, uuid);
+
+create or replace function reject_security_event_update() returns trigger as
+$$
+begin
+    raise exception 'security events are append-only';
+end;
+$$ language plpgsql;
+
+-- actor_user_id is left out, so that admins can still be deleted
+create or replace trigger security_event_append_only
+    before update of created_at, uuid, user_id, kind, ip_address, user_agent, details
+    on security_event
+    for each row
+execute function reject_security_event_update();
@@ -0,0 +1,2 @@
+drop table if exists admin_setup_token;
+drop table if exists user_role;
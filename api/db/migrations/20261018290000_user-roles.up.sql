@@ -0,0 +1,28 @@
+/*
+roles grant users access to admin operations. Each user has at most one role, and each role includes the ones below it:
+
+    root:      everything, including granting and revoking the admin role
+    admin:     managing users and content, and granting and revoking the moderator role
+    moderator: reviewing reported content
+
+Admins were previously whichever user had the slug 'openstats', which was created with a well-known password. That
+user isn't made root here - the first root is bootstrapped by OPENSTATS_ROOT_USER, or by the one-time setup token.
+*/
+create table if not exists user_role
+(
+    user_id            integer primary key references users on delete cascade,
+    role               text        not null check (role in ('root', 'admin', 'moderator')),
+    granted_at         timestamptz not null default now(),
+    granted_by_user_id integer references users on delete set null
+);
+
+create index if not exists user_role_role on user_role (role);
+
+-- the one-time token which lets the first user to present it become root, while there is no root. There is only ever
+-- one, so that every replica agrees on it.
+create table if not exists admin_setup_token
+(
+    id         boolean primary key default true check (id),
+    created_at timestamptz not null default now(),
+    token_hash bytea       not null
+);
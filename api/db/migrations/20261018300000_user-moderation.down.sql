@@ -0,0 +1,7 @@
+drop view if exists user_current_avatar;
+
+alter table user_avatar
+    drop column if exists removed_by_user_id,
+    drop column if exists removed_at;
+
+drop table if exists user_suspension;
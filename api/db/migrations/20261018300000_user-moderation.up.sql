@@ -0,0 +1,30 @@
+/*
+suspensions stop a user from signing in or using their game tokens until ends_at. Bans are suspensions without an
+ends_at. Suspensions are kept after they end or are lifted, so admins can see a user's history.
+*/
+create table if not exists user_suspension
+(
+    id                serial primary key,
+    created_at        timestamptz not null default now(),
+    uuid              uuid        not null unique default gen_uuid_v7(),
+    user_id           integer     not null references users on delete cascade,
+    actor_user_id     integer references users on delete set null,
+    reason            text        not null,
+    ends_at           timestamptz,
+    lifted_at         timestamptz,
+    lifted_by_user_id integer references users on delete set null
+);
+
+create index if not exists user_suspension_user_id on user_suspension (user_id) where lifted_at is null;
+
+-- avatars removed by an admin are kept, so the removal can be reviewed, but they're never shown
+alter table user_avatar
+    add column if not exists removed_at         timestamptz,
+    add column if not exists removed_by_user_id integer references users on delete set null;
+
+-- users may upload many avatars; only the most recent one that hasn't been removed is shown
+create or replace view user_current_avatar as
+select distinct on (ua.user_id) ua.*
+from user_avatar ua
+where ua.removed_at is null
+order by ua.user_id, ua.created_at desc, ua.id desc;
@@ -0,0 +1,42 @@
+/*
+users report content they think breaks the rules, which moderators review in a queue. Each report targets exactly one
+piece of content, depending on target_kind:
+
+    user:        target_user_id, e.g. for an offensive slug or display name
+    avatar:      target_avatar_id, the avatar the user had when it was reported, and target_user_id
+    game:        target_game_id
+    achievement: target_achievement_id, and target_game_id
+
+reports are open until a moderator either takes action on them, or dismisses them.
+*/
+create table if not exists content_report
+(
+    id                    serial primary key,
+    created_at            timestamptz not null default now(),
+    uuid                  uuid        not null unique default gen_uuid_v7(),
+    reporter_user_id      integer references users on delete set null,
+    target_kind           text        not null check (target_kind in ('user', 'avatar', 'game', 'achievement')),
+    target_user_id        integer references users on delete cascade,
+    target_avatar_id      integer references user_avatar on delete cascade,
+    target_game_id        integer references game on delete cascade,
+    target_achievement_id integer references achievement on delete cascade,
+    reason                text        not null check (reason in ('offensive', 'spam', 'impersonation', 'cheating', 'other')),
+    details               text        not null default '',
+    state                 text        not null default 'open' check (state in ('open', 'actioned', 'dismissed')),
+    resolved_at           timestamptz,
+    resolved_by_user_id   integer references users on delete set null,
+    resolution_note       text,
+
+    check ((target_kind = 'user') = (target_user_id is not null and target_avatar_id is null and target_game_id is null)),
+    check ((target_kind = 'avatar') = (target_avatar_id is not null)),
+    check ((target_kind = 'game') = (target_game_id is not null and target_achievement_id is null and target_user_id is null)),
+    check ((target_kind = 'achievement') = (target_achievement_id is not null))
+);
+
+create index if not exists content_report_state_uuid on content_report (state, uuid);
+
+-- a user can only have one open report of the same content
+create unique index if not exists content_report_open_per_reporter on content_report (
+    reporter_user_id, target_kind, coalesce(target_user_id, 0), coalesce(target_avatar_id, 0),
+    coalesce(target_game_id, 0), coalesce(target_achievement_id, 0)
+) where state = 'open';
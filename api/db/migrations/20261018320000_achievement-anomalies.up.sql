@@ -0,0 +1,80 @@
+-- when progress first reached the achievement's requirement. Progress unlocked before this was tracked is assumed to
+-- have been unlocked when it was first submitted.
+alter table achievement_progress
+    add column if not exists unlocked_at timestamptz;
+
+update achievement_progress ap
+set unlocked_at = ap.created_at
+from achievement a
+where ap.achievement_id = a.id
+  and ap.progress >= a.progress_requirement
+  and ap.unlocked_at is null;
+
+/*
+unlocks which are revoked by a moderator or the game's developer, e.g. because they were cheated, are kept so the
+revocation can be reviewed, but they don't count towards rarity or completion. They stay revoked even if the game
+submits more progress for them.
+*/
+alter table achievement_progress
+    add column if not exists revoked_at         timestamptz,
+    add column if not exists revoked_by_user_id integer references users on delete set null;
+
+/*
+anomalies are suspicious progress, flagged by heuristics when it's submitted:
+
+    burst-unlock:           most of a game's achievements were unlocked within seconds of each other
+    unlock-at-session-start: the achievement was unlocked within seconds of the game session starting
+    progress-jump:          progress towards an achievement jumped further in one submission than is plausible
+
+anomalies are open until they're reviewed, which either dismisses them or revokes the unlock.
+*/
+create table if not exists achievement_anomaly
+(
+    id                  serial primary key,
+    created_at          timestamptz not null default now(),
+    uuid                uuid        not null unique default gen_uuid_v7(),
+    user_id             integer     not null references users on delete cascade,
+    achievement_id      integer     not null references achievement on delete cascade,
+    game_session_id     uuid references game_session on delete set null,
+    kind                text        not null check (kind in ('burst-unlock', 'unlock-at-session-start', 'progress-jump')),
+    details             jsonb       not null default '{}',
+    state               text        not null default 'open' check (state in ('open', 'dismissed', 'revoked')),
+    reviewed_at         timestamptz,
+    reviewed_by_user_id integer references users on delete set null
+);
+
+create index if not exists achievement_anomaly_state_uuid on achievement_anomaly (state, uuid);
+
+-- the same unlock is only flagged once for each kind while it's open
+create unique index if not exists achievement_anomaly_open on achievement_anomaly (user_id, achievement_id, kind)
+    where state = 'open';
+
+create or replace view achievement_rarity as
+select a.*,
+       count(*)::float as completion_count,
+       (count(*)::float / (select count(distinct gs.user_id)
+                           from game_session gs
+                           where gs.game_id = a.game_id))::float as completion_percent
+from achievement_progress ap
+     join achievement a on ap.achievement_id = a.id
+where ap.progress >= a.progress_requirement
+  and ap.revoked_at is null
+group by a.id;
+
+create or replace view game_completion as
+select g.id as game_id,
+       u.id as user_id,
+       (select ap1.created_at
+        from achievement_progress ap1
+             join achievement a1 on ap1.achievement_id = a1.id
+        where a1.game_id = g.id and ap1.user_id = u.id and ap1.revoked_at is null
+        order by ap1.created_at
+        limit 1) as unlocked_at,
+       count(*) as unlock_count,
+       count(*) = (select count(*) from achievement ga where ga.game_id = g.id) as has_every_achievement
+from achievement a
+     join game g on a.game_id = g.id
+     join achievement_progress ap
+          on a.id = ap.achievement_id and ap.progress >= a.progress_requirement and ap.revoked_at is null
+     join users u on ap.user_id = u.id
+group by g.id, u.id;
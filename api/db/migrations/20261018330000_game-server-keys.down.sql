@@ -0,0 +1,4 @@
+alter table game
+    drop column if exists server_only_progress;
+
+drop table if exists game_server_key;
@@ -0,0 +1,23 @@
+/*
+game server keys are random secrets like osgs_{lookup_prefix}_{secret}, created by a game's developer so that their
+game servers can submit progress for any player of the game. Like game tokens, only the lookup prefix and a SHA-256
+hash of the whole key are stored.
+*/
+create table if not exists game_server_key
+(
+    id                 serial primary key,
+    created_at         timestamptz not null default now(),
+    uuid               uuid        not null unique default gen_uuid_v7(),
+    game_id            integer     not null references game on delete cascade,
+    comment            text        not null,
+    lookup_prefix      text        not null unique,
+    key_hash           bytea       not null,
+    created_by_user_id integer references users on delete set null,
+    last_used_at       timestamptz
+);
+
+create index if not exists game_server_key_game_id on game_server_key (game_id);
+
+-- when set, progress is only accepted from the game's servers, and game sessions may not submit progress
+alter table game
+    add column if not exists server_only_progress boolean not null default false;
@@ -0,0 +1,10 @@
+drop table if exists game_build_nonce;
+
+alter table game
+    drop column if exists require_signed_progress;
+
+delete
+from secret
+where path = 'shared.game-build.hmac';
+
+drop table if exists game_build;
@@ -0,0 +1,35 @@
+/*
+game builds are the released builds of a game, e.g. 1.2.0 for Windows. Each build has a shared.game-build.hmac secret,
+keyed by build id, which is embedded in the build so that it can sign its progress submissions. Deleting a build stops
+its signatures being accepted, e.g. once its secret has leaked.
+*/
+create table if not exists game_build
+(
+    id                 serial primary key,
+    created_at         timestamptz not null default now(),
+    uuid               uuid        not null unique default gen_uuid_v7(),
+    game_id            integer     not null references game on delete cascade,
+    name               text        not null,
+    created_by_user_id integer references users on delete set null
+);
+
+create index if not exists game_build_game_id on game_build (game_id);
+
+-- when set, progress submitted by game sessions must be signed by one of the game's builds
+alter table game
+    add column if not exists require_signed_progress boolean not null default false;
+
+/*
+the nonces of signed progress submissions, so that each signed submission is only accepted once. Signatures expire, so
+nonces are only kept until the signatures they were used in would have expired anyway.
+*/
+create table if not exists game_build_nonce
+(
+    game_build_id integer     not null references game_build on delete cascade,
+    nonce         text        not null,
+    expires_at    timestamptz not null,
+
+    primary key (game_build_id, nonce)
+);
+
+create index if not exists game_build_nonce_expires_at on game_build_nonce (expires_at);
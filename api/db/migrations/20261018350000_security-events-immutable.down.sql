@@ -0,0 +1,15 @@
+drop trigger if exists security_event_append_only on security_event;
+
+create or replace function reject_security_event_update() returns trigger as
+$$
+begin
+    raise exception 'security events are append-only';
+end;
+$$ language plpgsql;
+
+-- actor_user_id is left out, so that admins can still be deleted
+create or replace trigger security_event_append_only
+    before update of created_at, uuid, user_id, kind, ip_address, user_agent, details
+    on security_event
+    for each row
+execute function reject_security_event_update();
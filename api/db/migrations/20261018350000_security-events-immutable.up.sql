@@ -0,0 +1,31 @@
+/*
+the security_event_append_only trigger only covered updates to some columns. Every update and delete is now rejected,
+except the changes made by the table's foreign keys: actor_user_id is set to null when the admin is deleted, and a
+user's events are deleted along with them.
+*/
+drop trigger if exists security_event_append_only on security_event;
+
+create or replace function reject_security_event_update() returns trigger as
+$$
+begin
+    if tg_op = 'UPDATE'
+        and old.actor_user_id is not null
+        and new.actor_user_id is null
+        and to_jsonb(new) - 'actor_user_id' = to_jsonb(old) - 'actor_user_id'
+        and not exists (select from users where id = old.actor_user_id) then
+        return new;
+    end if;
+
+    if tg_op = 'DELETE' and not exists (select from users where id = old.user_id) then
+        return old;
+    end if;
+
+    raise exception 'security events are append-only';
+end;
+$$ language plpgsql;
+
+create or replace trigger security_event_append_only
+    before update or delete
+    on security_event
+    for each row
+execute function reject_security_event_update();
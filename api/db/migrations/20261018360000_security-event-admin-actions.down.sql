@@ -0,0 +1,4 @@
+drop index if exists security_event_by_admin_uuid;
+
+alter table security_event
+    drop column if exists by_admin;
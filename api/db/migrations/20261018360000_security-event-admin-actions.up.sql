@@ -0,0 +1,20 @@
+/*
+events were only known to be admin actions by their actor_user_id, which is set to null when the admin is deleted -
+hiding their actions from the audit log. by_admin keeps them there.
+
+The append-only trigger is disabled to set by_admin on existing events, since it rejects every other update.
+*/
+alter table security_event
+    add column if not exists by_admin boolean not null default false;
+
+alter table security_event
+    disable trigger security_event_append_only;
+
+update security_event
+set by_admin = true
+where actor_user_id is not null;
+
+alter table security_event
+    enable trigger security_event_append_only;
+
+create index if not exists security_event_by_admin_uuid on security_event (uuid) where by_admin;
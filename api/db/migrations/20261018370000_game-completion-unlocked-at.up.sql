@@ -0,0 +1,14 @@
+-- a game's unlocked_at is when the user first unlocked one of its achievements, which was previously taken from when
+-- they first submitted any progress for it
+create or replace view game_completion as
+select g.id as game_id,
+       u.id as user_id,
+       min(ap.unlocked_at)::timestamptz as unlocked_at,
+       count(*) as unlock_count,
+       count(*) = (select count(*) from achievement ga where ga.game_id = g.id) as has_every_achievement
+from achievement a
+     join game g on a.game_id = g.id
+     join achievement_progress ap
+          on a.id = ap.achievement_id and ap.progress >= a.progress_requirement and ap.revoked_at is null
+     join users u on ap.user_id = u.id
+group by g.id, u.id;
@@ -0,0 +1,3 @@
+alter table notification
+    drop constraint if exists notification_user_id_fkey,
+    add constraint notification_user_id_fkey foreign key (user_id) references users;
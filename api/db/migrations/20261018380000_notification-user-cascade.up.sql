@@ -0,0 +1,4 @@
+-- a user's notifications are deleted along with them, so that users with notifications can be deleted
+alter table notification
+    drop constraint if exists notification_user_id_fkey,
+    add constraint notification_user_id_fkey foreign key (user_id) references users on delete cascade;
@@ -0,0 +1,6 @@
+drop trigger if exists webhook_delete_secret on webhook;
+drop function if exists delete_webhook_secret();
+
+alter table webhook
+    drop constraint if exists webhook_game_id_fkey,
+    add constraint webhook_game_id_fkey foreign key (game_id) references game;
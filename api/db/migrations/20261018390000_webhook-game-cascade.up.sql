@@ -0,0 +1,21 @@
+/*
+a game's webhooks are deleted along with it, so that games with webhooks can be deleted. Webhooks deleted by the
+cascade also have their shared.webhook.hmac secret deleted, the same as webhooks deleted through the API.
+*/
+alter table webhook
+    drop constraint if exists webhook_game_id_fkey,
+    add constraint webhook_game_id_fkey foreign key (game_id) references game on delete cascade;
+
+create or replace function delete_webhook_secret() returns trigger as
+$$
+begin
+    delete from secret where path = 'shared.webhook.hmac' and key = old.id::text;
+    return old;
+end;
+$$ language plpgsql;
+
+create or replace trigger webhook_delete_secret
+    after delete
+    on webhook
+    for each row
+execute function delete_webhook_secret();
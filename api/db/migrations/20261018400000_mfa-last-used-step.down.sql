@@ -0,0 +1,2 @@
+alter table user_mfa
+    drop column if exists last_used_step;
@@ -0,0 +1,4 @@
+-- the TOTP time step of the last code the user signed in with, so that a code can't be used again while it's still
+-- within the validation window
+alter table user_mfa
+    add column if not exists last_used_step bigint;
@@ -0,0 +1,2 @@
+alter table game_session
+    drop column if exists game_token_hash;
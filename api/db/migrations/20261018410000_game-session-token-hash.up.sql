@@ -0,0 +1,5 @@
+-- the hash of the game token's secret when the session was started, so that sessions started with a secret stop working
+-- once the token is rotated. Sessions started with a legacy token's RID have none, and stop working once it's rotated.
+-- Sessions started before this have none either, so those started with a hashed token must be started again.
+alter table game_session
+    add column if not exists game_token_hash bytea;
@@ -19,6 +19,10 @@ import (
 
 var PrivateUser2faHmacSecretPath = "private.user.2fa-hmac"
 
+// SharedUserMfaHmacSecretPath is the path of each user's TOTP MFA secret. Unlike PrivateUser2faHmacSecretPath, this
+// secret is shared with the user's authenticator app when they enroll.
+var SharedUserMfaHmacSecretPath = "shared.user.mfa-hmac"
+
 var ErrSlugAlreadyInUse = eris.New("slug already in use")
 
 type Actions struct {
@@ -87,8 +91,61 @@ func (a *Actions) CreateUser(ctx context.Context, slug, encodedPasswordHash, ema
 	//goland:noinspection GoUnhandledErrorResult
 	defer tx.Rollback(ctx)
 
+	createdUser, err := createUser(ctx, a.queries.WithTx(tx), slug, encodedPasswordHash, email, displayName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, eris.Wrap(err, "error committing transaction")
+	}
+
+	return createdUser, nil
+}
+
+// CreateExternalUser creates a user who signs in with an external identity rather than a password. If email is
+// provided, it has already been verified by the identity provider, so it's added as confirmed.
+func (a *Actions) CreateExternalUser(ctx context.Context, slug, email, displayName string, identity query.AddUserIdentityParams) (*CreatedUser, error) {
+	tx, err := a.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, eris.Wrap(err, "error beginning transaction")
+	}
+
+	//goland:noinspection GoUnhandledErrorResult
+	defer tx.Rollback(ctx)
+
 	qtx := a.queries.WithTx(tx)
 
+	createdUser, err := createUser(ctx, qtx, slug, "", email, displayName)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(email) > 0 {
+		if _, err = qtx.ConfirmEmail(ctx, query.ConfirmEmailParams{
+			UserID: createdUser.User.ID,
+			Email:  email,
+		}); err != nil {
+			return nil, eris.Wrap(err, "error confirming user email")
+		}
+	}
+
+	identity.UserID = createdUser.User.ID
+	if _, err = qtx.AddUserIdentity(ctx, identity); err != nil {
+		return nil, eris.Wrap(err, "error adding user identity")
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, eris.Wrap(err, "error committing transaction")
+	}
+
+	return createdUser, nil
+}
+
+// createUser adds a new user and their slug history, password, secrets, email, and display name. The password is
+// skipped when encodedPasswordHash is empty, for users who only sign in with an external identity.
+func createUser(ctx context.Context, qtx *query.Queries, slug, encodedPasswordHash, email, displayName string) (*CreatedUser, error) {
+	var err error
 	createdUser := &CreatedUser{
 		HmacSecret: rand.Text(),
 	}
@@ -108,11 +165,13 @@ func (a *Actions) CreateUser(ctx context.Context, slug, encodedPasswordHash, ema
 		return nil, eris.Wrap(err, "error adding slug to history")
 	}
 
-	if err = qtx.AddUserPassword(ctx, query.AddUserPasswordParams{
-		UserID:      createdUser.User.ID,
-		EncodedHash: encodedPasswordHash,
-	}); err != nil {
-		return nil, eris.Wrap(err, "error adding user password")
+	if len(encodedPasswordHash) > 0 {
+		if err = qtx.AddUserPassword(ctx, query.AddUserPasswordParams{
+			UserID:      createdUser.User.ID,
+			EncodedHash: encodedPasswordHash,
+		}); err != nil {
+			return nil, eris.Wrap(err, "error adding user password")
+		}
 	}
 
 	// this secret is used for TOTP 2FA when verifying
@@ -143,16 +202,13 @@ func (a *Actions) CreateUser(ctx context.Context, slug, encodedPasswordHash, ema
 		}
 	}
 
-	if err = tx.Commit(ctx); err != nil {
-		return nil, eris.Wrap(err, "error committing transaction")
-	}
-
 	return createdUser, nil
 }
 
 func (a *Actions) CreateGameSessionAndToken(
 	ctx context.Context,
 	gameToken uuid.UUID,
+	gameTokenHash []byte,
 	userRid, gameRid rid.RID,
 	issuer, audience string,
 	duration time.Duration,
@@ -172,6 +228,7 @@ func (a *Actions) CreateGameSessionAndToken(
 		GameUuid:      gameRid.ID,
 		UserUuid:      userRid.ID,
 		GameTokenUuid: gameToken,
+		GameTokenHash: gameTokenHash,
 	})
 	if err != nil {
 		return
@@ -200,6 +257,44 @@ func (a *Actions) CreateGameSessionAndToken(
 	return
 }
 
+// Listen LISTENs on the channel using a dedicated connection from the pool, and calls handle with the payload of every
+// notification received on it. Listen blocks until ctx is done, or until the connection fails.
+func (a *Actions) Listen(ctx context.Context, channel string, handle func(payload string)) error {
+	return a.ListenReady(ctx, channel, nil, handle)
+}
+
+// ListenReady is like Listen, but calls ready once it is listening - and so won't miss any notifications - if ready
+// isn't nil
+func (a *Actions) ListenReady(ctx context.Context, channel string, ready func(), handle func(payload string)) error {
+	conn, err := a.pool.Acquire(ctx)
+	if err != nil {
+		return eris.Wrap(err, "error acquiring connection to listen on")
+	}
+
+	defer conn.Release()
+
+	if _, err = conn.Exec(ctx, "listen "+pgx.Identifier{channel}.Sanitize()); err != nil {
+		return eris.Wrapf(err, "error listening on %s", channel)
+	}
+
+	if ready != nil {
+		ready()
+	}
+
+	for {
+		notification, waitErr := conn.Conn().WaitForNotification(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if waitErr != nil {
+			return eris.Wrapf(waitErr, "error waiting for notification on %s", channel)
+		}
+
+		handle(notification.Payload)
+	}
+}
+
 func (a *Actions) Transact(ctx context.Context, do func(context.Context, *query.Queries) error) (err error) {
 	var tx pgx.Tx
 	tx, err = a.pool.BeginTx(ctx, pgx.TxOptions{})
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 const findAchievementBySlug = `-- name: FindAchievementBySlug :one
@@ -96,6 +97,7 @@ from achievement_progress ap
      left outer join user_latest_display_name uldn on u.id = uldn.user_id
 where u.uuid != $2
   and ap.progress >= a.progress_requirement
+  and ap.revoked_at is null
 order by ap.created_at desc
 limit $1
 `
@@ -160,7 +162,7 @@ from achievement_progress ap
      join achievement_rarity ar on ap.achievement_id = ar.id
      join game g on ar.game_id = g.id
      join users u on ap.user_id = u.id
-where g.uuid = $2 and ap.progress >= ar.progress_requirement
+where g.uuid = $2 and ap.progress >= ar.progress_requirement and ap.revoked_at is null
 order by ap.created_at desc
 limit $1
 `
@@ -264,6 +266,7 @@ from achievement_progress ap
      join developer d on g.developer_id = d.id
 where u.uuid = $2
   and ap.progress >= a.progress_requirement
+  and ap.revoked_at is null
 order by ap.created_at desc
 limit $1
 `
@@ -364,12 +367,12 @@ func (q *Queries) GetUsersCompletedGames(ctx context.Context, arg GetUsersComple
 }
 
 const getUsersRarestAchievements = `-- name: GetUsersRarestAchievements :many
-select ap.created_at, ap.updated_at, ap.user_id, ap.achievement_id, ap.progress, g.uuid game_uuid, ar.slug, ar.name, ar.description, ar.completion_percent::double precision as rarity
+select ap.created_at, ap.updated_at, ap.user_id, ap.achievement_id, ap.progress, ap.unlocked_at, ap.revoked_at, ap.revoked_by_user_id, g.uuid game_uuid, ar.slug, ar.name, ar.description, ar.completion_percent::double precision as rarity
 from achievement_progress ap
      join achievement_rarity ar on ap.achievement_id = ar.id and ap.progress >= ar.progress_requirement
      join game g on ar.game_id = g.id
      join users u on ap.user_id = u.id
-where u.uuid = $2 and ar.completion_percent <= $3::float
+where u.uuid = $2 and ar.completion_percent <= $3::float and ap.revoked_at is null
 order by ar.completion_percent
 limit $1
 `
@@ -381,16 +384,19 @@ type GetUsersRarestAchievementsParams struct {
 }
 
 type GetUsersRarestAchievementsRow struct {
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
-	UserID        int32
-	AchievementID int32
-	Progress      int32
-	GameUuid      uuid.UUID
-	Slug          string
-	Name          string
-	Description   string
-	Rarity        float64
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	UserID          int32
+	AchievementID   int32
+	Progress        int32
+	UnlockedAt      pgtype.Timestamptz
+	RevokedAt       pgtype.Timestamptz
+	RevokedByUserID pgtype.Int4
+	GameUuid        uuid.UUID
+	Slug            string
+	Name            string
+	Description     string
+	Rarity          float64
 }
 
 func (q *Queries) GetUsersRarestAchievements(ctx context.Context, arg GetUsersRarestAchievementsParams) ([]GetUsersRarestAchievementsRow, error) {
@@ -408,6 +414,9 @@ func (q *Queries) GetUsersRarestAchievements(ctx context.Context, arg GetUsersRa
 			&i.UserID,
 			&i.AchievementID,
 			&i.Progress,
+			&i.UnlockedAt,
+			&i.RevokedAt,
+			&i.RevokedByUserID,
 			&i.GameUuid,
 			&i.Slug,
 			&i.Name,
@@ -0,0 +1,303 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: anomaly.sql
+
+package query
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const createAchievementAnomaly = `-- name: CreateAchievementAnomaly :exec
+insert into achievement_anomaly (user_id, achievement_id, game_session_id, kind, details)
+values ($1, $2, $3, $4, $5)
+on conflict do nothing
+`
+
+type CreateAchievementAnomalyParams struct {
+	UserID        int32
+	AchievementID int32
+	GameSessionID uuid.NullUUID
+	Kind          string
+	Details       []byte
+}
+
+func (q *Queries) CreateAchievementAnomaly(ctx context.Context, arg CreateAchievementAnomalyParams) error {
+	_, err := q.db.Exec(ctx, createAchievementAnomaly,
+		arg.UserID,
+		arg.AchievementID,
+		arg.GameSessionID,
+		arg.Kind,
+		arg.Details,
+	)
+	return err
+}
+
+const dismissAchievementAnomaly = `-- name: DismissAchievementAnomaly :exec
+update achievement_anomaly
+set state               = 'dismissed',
+    reviewed_at         = now(),
+    reviewed_by_user_id = $1
+where id = $2
+`
+
+type DismissAchievementAnomalyParams struct {
+	ReviewedByUserID pgtype.Int4
+	ID               int32
+}
+
+func (q *Queries) DismissAchievementAnomaly(ctx context.Context, arg DismissAchievementAnomalyParams) error {
+	_, err := q.db.Exec(ctx, dismissAchievementAnomaly, arg.ReviewedByUserID, arg.ID)
+	return err
+}
+
+const getAchievementAnomalies = `-- name: GetAchievementAnomalies :many
+select aa.uuid,
+       aa.created_at,
+       aa.kind,
+       aa.details,
+       aa.state,
+       aa.reviewed_at,
+       reviewer.slug                 as reviewed_by_slug,
+       u.uuid                        as user_uuid,
+       u.slug                        as user_slug,
+       g.uuid                        as game_uuid,
+       g.slug                        as game_slug,
+       a.slug                        as achievement_slug,
+       ap.progress,
+       a.progress_requirement,
+       ap.unlocked_at,
+       (ap.revoked_at is not null)::bool as revoked,
+       gs.uuid                       as game_session_uuid
+from achievement_anomaly aa
+     join users u on aa.user_id = u.id
+     join achievement a on aa.achievement_id = a.id
+     join game g on a.game_id = g.id
+     left outer join achievement_progress ap on aa.user_id = ap.user_id and aa.achievement_id = ap.achievement_id
+     left outer join users reviewer on aa.reviewed_by_user_id = reviewer.id
+     left outer join game_session gs on aa.game_session_id = gs.id
+where ($2::uuid is null or g.uuid = $2::uuid)
+  and ($3::text is null or aa.state = $3::text)
+  and ($4::uuid is null or aa.uuid < $4::uuid)
+order by aa.uuid desc
+limit $1
+`
+
+type GetAchievementAnomaliesParams struct {
+	Limit    int32
+	GameUuid uuid.NullUUID
+	State    *string
+	After    uuid.NullUUID
+}
+
+type GetAchievementAnomaliesRow struct {
+	Uuid                uuid.UUID
+	CreatedAt           time.Time
+	Kind                string
+	Details             []byte
+	State               string
+	ReviewedAt          pgtype.Timestamptz
+	ReviewedBySlug      *string
+	UserUuid            uuid.UUID
+	UserSlug            string
+	GameUuid            uuid.UUID
+	GameSlug            string
+	AchievementSlug     string
+	Progress            pgtype.Int4
+	ProgressRequirement int32
+	UnlockedAt          pgtype.Timestamptz
+	Revoked             bool
+	GameSessionUuid     uuid.NullUUID
+}
+
+func (q *Queries) GetAchievementAnomalies(ctx context.Context, arg GetAchievementAnomaliesParams) ([]GetAchievementAnomaliesRow, error) {
+	rows, err := q.db.Query(ctx, getAchievementAnomalies,
+		arg.Limit,
+		arg.GameUuid,
+		arg.State,
+		arg.After,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetAchievementAnomaliesRow
+	for rows.Next() {
+		var i GetAchievementAnomaliesRow
+		if err := rows.Scan(
+			&i.Uuid,
+			&i.CreatedAt,
+			&i.Kind,
+			&i.Details,
+			&i.State,
+			&i.ReviewedAt,
+			&i.ReviewedBySlug,
+			&i.UserUuid,
+			&i.UserSlug,
+			&i.GameUuid,
+			&i.GameSlug,
+			&i.AchievementSlug,
+			&i.Progress,
+			&i.ProgressRequirement,
+			&i.UnlockedAt,
+			&i.Revoked,
+			&i.GameSessionUuid,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAchievementAnomalyForUpdate = `-- name: GetAchievementAnomalyForUpdate :one
+select aa.id, aa.created_at, aa.uuid, aa.user_id, aa.achievement_id, aa.game_session_id, aa.kind, aa.details, aa.state, aa.reviewed_at, aa.reviewed_by_user_id
+from achievement_anomaly aa
+     join achievement a on aa.achievement_id = a.id
+     join game g on a.game_id = g.id
+where aa.uuid = $1
+  and ($2::uuid is null or g.uuid = $2::uuid)
+for update of aa
+`
+
+type GetAchievementAnomalyForUpdateParams struct {
+	Uuid     uuid.UUID
+	GameUuid uuid.NullUUID
+}
+
+func (q *Queries) GetAchievementAnomalyForUpdate(ctx context.Context, arg GetAchievementAnomalyForUpdateParams) (AchievementAnomaly, error) {
+	row := q.db.QueryRow(ctx, getAchievementAnomalyForUpdate, arg.Uuid, arg.GameUuid)
+	var i AchievementAnomaly
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.Uuid,
+		&i.UserID,
+		&i.AchievementID,
+		&i.GameSessionID,
+		&i.Kind,
+		&i.Details,
+		&i.State,
+		&i.ReviewedAt,
+		&i.ReviewedByUserID,
+	)
+	return i, err
+}
+
+const getGameSessionStart = `-- name: GetGameSessionStart :one
+select gs.id,
+       gs.created_at,
+       gs.user_id,
+       (select count(*) from achievement a where a.game_id = gs.game_id) as achievement_count
+from game_session gs
+where gs.uuid = $1
+`
+
+type GetGameSessionStartRow struct {
+	ID               uuid.UUID
+	CreatedAt        time.Time
+	UserID           int32
+	AchievementCount int64
+}
+
+// the game session's start, and how many achievements its game has
+func (q *Queries) GetGameSessionStart(ctx context.Context, sessionUuid uuid.UUID) (GetGameSessionStartRow, error) {
+	row := q.db.QueryRow(ctx, getGameSessionStart, sessionUuid)
+	var i GetGameSessionStartRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UserID,
+		&i.AchievementCount,
+	)
+	return i, err
+}
+
+const getRecentUnlocks = `-- name: GetRecentUnlocks :many
+select ap.achievement_id, ap.unlocked_at
+from achievement_progress ap
+     join achievement a on ap.achievement_id = a.id
+     join game_session gs on a.game_id = gs.game_id
+where gs.id = $1
+  and ap.user_id = gs.user_id
+  and ap.unlocked_at >= $2::timestamptz
+  and ap.revoked_at is null
+`
+
+type GetRecentUnlocksParams struct {
+	GameSessionID uuid.UUID
+	UnlockedSince time.Time
+}
+
+type GetRecentUnlocksRow struct {
+	AchievementID int32
+	UnlockedAt    pgtype.Timestamptz
+}
+
+func (q *Queries) GetRecentUnlocks(ctx context.Context, arg GetRecentUnlocksParams) ([]GetRecentUnlocksRow, error) {
+	rows, err := q.db.Query(ctx, getRecentUnlocks, arg.GameSessionID, arg.UnlockedSince)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetRecentUnlocksRow
+	for rows.Next() {
+		var i GetRecentUnlocksRow
+		if err := rows.Scan(&i.AchievementID, &i.UnlockedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const resolveRevokedAchievementAnomalies = `-- name: ResolveRevokedAchievementAnomalies :exec
+update achievement_anomaly
+set state               = 'revoked',
+    reviewed_at         = now(),
+    reviewed_by_user_id = $1
+where user_id = $2
+  and achievement_id = $3
+  and state = 'open'
+`
+
+type ResolveRevokedAchievementAnomaliesParams struct {
+	ReviewedByUserID pgtype.Int4
+	UserID           int32
+	AchievementID    int32
+}
+
+func (q *Queries) ResolveRevokedAchievementAnomalies(ctx context.Context, arg ResolveRevokedAchievementAnomaliesParams) error {
+	_, err := q.db.Exec(ctx, resolveRevokedAchievementAnomalies, arg.ReviewedByUserID, arg.UserID, arg.AchievementID)
+	return err
+}
+
+const revokeAchievementProgress = `-- name: RevokeAchievementProgress :exec
+update achievement_progress
+set revoked_at         = coalesce(revoked_at, now()),
+    revoked_by_user_id = coalesce(revoked_by_user_id, $1)
+where user_id = $2
+  and achievement_id = $3
+`
+
+type RevokeAchievementProgressParams struct {
+	RevokedByUserID pgtype.Int4
+	UserID          int32
+	AchievementID   int32
+}
+
+func (q *Queries) RevokeAchievementProgress(ctx context.Context, arg RevokeAchievementProgressParams) error {
+	_, err := q.db.Exec(ctx, revokeAchievementProgress, arg.RevokedByUserID, arg.UserID, arg.AchievementID)
+	return err
+}
@@ -9,6 +9,7 @@ import (
 	"context"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 const addAchievementAvatar = `-- name: AddAchievementAvatar :one
@@ -90,7 +91,7 @@ func (q *Queries) AddGameAvatar(ctx context.Context, arg AddGameAvatarParams) (G
 const addUserAvatar = `-- name: AddUserAvatar :one
 insert into user_avatar (user_id, blurhash)
 select u.id, $1 from users u where u.uuid = $2
-returning id, created_at, uuid, blurhash, user_id
+returning id, created_at, uuid, blurhash, user_id, removed_at, removed_by_user_id
 `
 
 type AddUserAvatarParams struct {
@@ -107,6 +108,42 @@ func (q *Queries) AddUserAvatar(ctx context.Context, arg AddUserAvatarParams) (U
 		&i.Uuid,
 		&i.Blurhash,
 		&i.UserID,
+		&i.RemovedAt,
+		&i.RemovedByUserID,
 	)
 	return i, err
 }
+
+const getUserCurrentAvatarId = `-- name: GetUserCurrentAvatarId :one
+select id
+from user_current_avatar
+where user_id = $1
+`
+
+func (q *Queries) GetUserCurrentAvatarId(ctx context.Context, userID int32) (int32, error) {
+	row := q.db.QueryRow(ctx, getUserCurrentAvatarId, userID)
+	var id int32
+	err := row.Scan(&id)
+	return id, err
+}
+
+const removeUserAvatar = `-- name: RemoveUserAvatar :execrows
+update user_avatar
+set removed_at         = now(),
+    removed_by_user_id = $1
+where id = $2
+  and removed_at is null
+`
+
+type RemoveUserAvatarParams struct {
+	RemovedByUserID pgtype.Int4
+	AvatarID        int32
+}
+
+func (q *Queries) RemoveUserAvatar(ctx context.Context, arg RemoveUserAvatarParams) (int64, error) {
+	result, err := q.db.Exec(ctx, removeUserAvatar, arg.RemovedByUserID, arg.AvatarID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
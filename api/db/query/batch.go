@@ -26,14 +26,26 @@ with target_user as (
     join game g on a.game_id = g.id
     where a.slug = $3 and g.uuid = $4
 )
-insert into achievement_progress (user_id, achievement_id, progress)
-select target_user.id, target_achievement.id, $1
+insert into achievement_progress (user_id, achievement_id, progress, unlocked_at)
+select target_user.id,
+       target_achievement.id,
+       $1,
+       case when $1 >= target_achievement.progress_requirement then now() end
 from target_user, target_achievement
 where $1 <= target_achievement.progress_requirement
 on conflict (user_id, achievement_id)
-    do update set progress = excluded.progress
+    do update set progress    = excluded.progress,
+                  unlocked_at = coalesce(achievement_progress.unlocked_at, excluded.unlocked_at)
     where excluded.progress >= achievement_progress.progress
-returning (select target_achievement.slug from target_achievement), achievement_progress.progress
+returning (select target_achievement.slug from target_achievement),
+          achievement_progress.progress,
+          achievement_progress.user_id,
+          achievement_progress.achievement_id,
+          (select target_achievement.progress_requirement from target_achievement),
+          -- subqueries see the table as it was before the insert, so this is the progress being replaced
+          coalesce((select ap.progress
+                    from achievement_progress ap, target_user, target_achievement
+                    where ap.user_id = target_user.id and ap.achievement_id = target_achievement.id), 0)::integer as old_progress
 `
 
 type UpdateGameSessionUserProgressBatchResults struct {
@@ -50,8 +62,12 @@ type UpdateGameSessionUserProgressParams struct {
 }
 
 type UpdateGameSessionUserProgressRow struct {
-	Slug     string
-	Progress int32
+	Slug                string
+	Progress            int32
+	UserID              int32
+	AchievementID       int32
+	ProgressRequirement int32
+	OldProgress         int32
 }
 
 func (q *Queries) UpdateGameSessionUserProgress(ctx context.Context, arg []UpdateGameSessionUserProgressParams) *UpdateGameSessionUserProgressBatchResults {
@@ -80,7 +96,14 @@ func (b *UpdateGameSessionUserProgressBatchResults) QueryRow(f func(int, UpdateG
 			continue
 		}
 		row := b.br.QueryRow()
-		err := row.Scan(&i.Slug, &i.Progress)
+		err := row.Scan(
+			&i.Slug,
+			&i.Progress,
+			&i.UserID,
+			&i.AchievementID,
+			&i.ProgressRequirement,
+			&i.OldProgress,
+		)
 		if f != nil {
 			f(t, i, err)
 		}
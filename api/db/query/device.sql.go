@@ -0,0 +1,206 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: device.sql
+
+package query
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const approveDeviceAuthorization = `-- name: ApproveDeviceAuthorization :execrows
+update device_authorization
+set user_id     = $1,
+    approved_at = now()
+where user_code = $2
+  and approved_at is null
+  and denied_at is null
+  and expires_at > now()
+`
+
+type ApproveDeviceAuthorizationParams struct {
+	UserID   pgtype.Int4
+	UserCode string
+}
+
+func (q *Queries) ApproveDeviceAuthorization(ctx context.Context, arg ApproveDeviceAuthorizationParams) (int64, error) {
+	result, err := q.db.Exec(ctx, approveDeviceAuthorization, arg.UserID, arg.UserCode)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const createDeviceAuthorization = `-- name: CreateDeviceAuthorization :one
+insert into device_authorization (device_code_hash, user_code, game_id, poll_interval, expires_at)
+select $1, $2, g.id, $3, $4
+from game g
+where g.uuid = $5
+returning id
+`
+
+type CreateDeviceAuthorizationParams struct {
+	DeviceCodeHash []byte
+	UserCode       string
+	PollInterval   int32
+	ExpiresAt      time.Time
+	GameUuid       uuid.UUID
+}
+
+func (q *Queries) CreateDeviceAuthorization(ctx context.Context, arg CreateDeviceAuthorizationParams) (int32, error) {
+	row := q.db.QueryRow(ctx, createDeviceAuthorization,
+		arg.DeviceCodeHash,
+		arg.UserCode,
+		arg.PollInterval,
+		arg.ExpiresAt,
+		arg.GameUuid,
+	)
+	var id int32
+	err := row.Scan(&id)
+	return id, err
+}
+
+const deleteDeviceAuthorization = `-- name: DeleteDeviceAuthorization :exec
+delete
+from device_authorization
+where id = $1
+`
+
+func (q *Queries) DeleteDeviceAuthorization(ctx context.Context, id int32) error {
+	_, err := q.db.Exec(ctx, deleteDeviceAuthorization, id)
+	return err
+}
+
+const deleteExpiredDeviceAuthorizations = `-- name: DeleteExpiredDeviceAuthorizations :exec
+delete
+from device_authorization
+where expires_at <= now() - interval '1 day'
+`
+
+func (q *Queries) DeleteExpiredDeviceAuthorizations(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, deleteExpiredDeviceAuthorizations)
+	return err
+}
+
+const denyDeviceAuthorization = `-- name: DenyDeviceAuthorization :execrows
+update device_authorization
+set user_id   = $1,
+    denied_at = now()
+where user_code = $2
+  and approved_at is null
+  and denied_at is null
+  and expires_at > now()
+`
+
+type DenyDeviceAuthorizationParams struct {
+	UserID   pgtype.Int4
+	UserCode string
+}
+
+func (q *Queries) DenyDeviceAuthorization(ctx context.Context, arg DenyDeviceAuthorizationParams) (int64, error) {
+	result, err := q.db.Exec(ctx, denyDeviceAuthorization, arg.UserID, arg.UserCode)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const findPendingDeviceAuthorization = `-- name: FindPendingDeviceAuthorization :one
+select da.created_at, da.expires_at, g.uuid as game_uuid, g.slug as game_slug, d.slug as developer_slug
+from device_authorization da
+     join game g on da.game_id = g.id
+     join developer d on g.developer_id = d.id
+where da.user_code = $1
+  and da.approved_at is null
+  and da.denied_at is null
+  and da.expires_at > now()
+`
+
+type FindPendingDeviceAuthorizationRow struct {
+	CreatedAt     time.Time
+	ExpiresAt     time.Time
+	GameUuid      uuid.UUID
+	GameSlug      string
+	DeveloperSlug string
+}
+
+func (q *Queries) FindPendingDeviceAuthorization(ctx context.Context, userCode string) (FindPendingDeviceAuthorizationRow, error) {
+	row := q.db.QueryRow(ctx, findPendingDeviceAuthorization, userCode)
+	var i FindPendingDeviceAuthorizationRow
+	err := row.Scan(
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.GameUuid,
+		&i.GameSlug,
+		&i.DeveloperSlug,
+	)
+	return i, err
+}
+
+const getDeviceAuthorizationForUpdate = `-- name: GetDeviceAuthorizationForUpdate :one
+select da.id, da.created_at, da.device_code_hash, da.user_code, da.game_id, da.user_id, da.approved_at, da.denied_at, da.poll_interval, da.last_polled_at, da.expires_at, g.uuid as game_uuid, u.uuid as user_uuid
+from device_authorization da
+     join game g on da.game_id = g.id
+     left join users u on da.user_id = u.id
+where da.device_code_hash = $1
+for update of da
+`
+
+type GetDeviceAuthorizationForUpdateRow struct {
+	ID             int32
+	CreatedAt      time.Time
+	DeviceCodeHash []byte
+	UserCode       string
+	GameID         int32
+	UserID         pgtype.Int4
+	ApprovedAt     pgtype.Timestamptz
+	DeniedAt       pgtype.Timestamptz
+	PollInterval   int32
+	LastPolledAt   pgtype.Timestamptz
+	ExpiresAt      time.Time
+	GameUuid       uuid.UUID
+	UserUuid       uuid.NullUUID
+}
+
+func (q *Queries) GetDeviceAuthorizationForUpdate(ctx context.Context, deviceCodeHash []byte) (GetDeviceAuthorizationForUpdateRow, error) {
+	row := q.db.QueryRow(ctx, getDeviceAuthorizationForUpdate, deviceCodeHash)
+	var i GetDeviceAuthorizationForUpdateRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.DeviceCodeHash,
+		&i.UserCode,
+		&i.GameID,
+		&i.UserID,
+		&i.ApprovedAt,
+		&i.DeniedAt,
+		&i.PollInterval,
+		&i.LastPolledAt,
+		&i.ExpiresAt,
+		&i.GameUuid,
+		&i.UserUuid,
+	)
+	return i, err
+}
+
+const touchDeviceAuthorizationPoll = `-- name: TouchDeviceAuthorizationPoll :exec
+update device_authorization
+set last_polled_at = now(),
+    poll_interval  = $1
+where id = $2
+`
+
+type TouchDeviceAuthorizationPollParams struct {
+	PollInterval int32
+	ID           int32
+}
+
+func (q *Queries) TouchDeviceAuthorizationPoll(ctx context.Context, arg TouchDeviceAuthorizationPollParams) error {
+	_, err := q.db.Exec(ctx, touchDeviceAuthorizationPoll, arg.PollInterval, arg.ID)
+	return err
+}
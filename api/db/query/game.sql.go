@@ -13,19 +13,21 @@ import (
 )
 
 const allGames = `-- name: AllGames :many
-select game.id, game.created_at, game.updated_at, game.developer_id, game.uuid, game.slug, developer.slug as developer_slug
+select game.id, game.created_at, game.updated_at, game.developer_id, game.uuid, game.slug, game.server_only_progress, game.require_signed_progress, developer.slug as developer_slug
 from game
      join developer on game.developer_id = developer.id
 `
 
 type AllGamesRow struct {
-	ID            int32
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
-	DeveloperID   int32
-	Uuid          uuid.UUID
-	Slug          string
-	DeveloperSlug string
+	ID                    int32
+	CreatedAt             time.Time
+	UpdatedAt             time.Time
+	DeveloperID           int32
+	Uuid                  uuid.UUID
+	Slug                  string
+	ServerOnlyProgress    bool
+	RequireSignedProgress bool
+	DeveloperSlug         string
 }
 
 func (q *Queries) AllGames(ctx context.Context) ([]AllGamesRow, error) {
@@ -44,6 +46,8 @@ func (q *Queries) AllGames(ctx context.Context) ([]AllGamesRow, error) {
 			&i.DeveloperID,
 			&i.Uuid,
 			&i.Slug,
+			&i.ServerOnlyProgress,
+			&i.RequireSignedProgress,
 			&i.DeveloperSlug,
 		); err != nil {
 			return nil, err
@@ -57,7 +61,7 @@ func (q *Queries) AllGames(ctx context.Context) ([]AllGamesRow, error) {
 }
 
 const findGame = `-- name: FindGame :one
-select id, created_at, updated_at, developer_id, uuid, slug from game where uuid = $1 limit 1
+select id, created_at, updated_at, developer_id, uuid, slug, server_only_progress, require_signed_progress from game where uuid = $1 limit 1
 `
 
 func (q *Queries) FindGame(ctx context.Context, gameUuid uuid.UUID) (Game, error) {
@@ -70,12 +74,14 @@ func (q *Queries) FindGame(ctx context.Context, gameUuid uuid.UUID) (Game, error
 		&i.DeveloperID,
 		&i.Uuid,
 		&i.Slug,
+		&i.ServerOnlyProgress,
+		&i.RequireSignedProgress,
 	)
 	return i, err
 }
 
 const findGameById = `-- name: FindGameById :one
-select id, created_at, updated_at, developer_id, uuid, slug from game where id = $1 limit 1
+select id, created_at, updated_at, developer_id, uuid, slug, server_only_progress, require_signed_progress from game where id = $1 limit 1
 `
 
 func (q *Queries) FindGameById(ctx context.Context, gameID int32) (Game, error) {
@@ -88,12 +94,14 @@ func (q *Queries) FindGameById(ctx context.Context, gameID int32) (Game, error)
 		&i.DeveloperID,
 		&i.Uuid,
 		&i.Slug,
+		&i.ServerOnlyProgress,
+		&i.RequireSignedProgress,
 	)
 	return i, err
 }
 
 const findGameBySlug = `-- name: FindGameBySlug :one
-select game.id, game.created_at, game.updated_at, game.developer_id, game.uuid, game.slug
+select game.id, game.created_at, game.updated_at, game.developer_id, game.uuid, game.slug, game.server_only_progress, game.require_signed_progress
 from game
      join developer on game.developer_id = developer.id
 where game.slug = $1 and developer.slug = $2
@@ -114,6 +122,8 @@ func (q *Queries) FindGameBySlug(ctx context.Context, arg FindGameBySlugParams)
 		&i.DeveloperID,
 		&i.Uuid,
 		&i.Slug,
+		&i.ServerOnlyProgress,
+		&i.RequireSignedProgress,
 	)
 	return i, err
 }
@@ -170,3 +180,39 @@ func (q *Queries) GetGameProfile(ctx context.Context, gameUuid uuid.UUID) (GetGa
 	err := row.Scan(&i.Slug, &i.DeveloperSlug)
 	return i, err
 }
+
+const getGameProgressSettings = `-- name: GetGameProgressSettings :one
+select server_only_progress, require_signed_progress
+from game
+where uuid = $1
+`
+
+type GetGameProgressSettingsRow struct {
+	ServerOnlyProgress    bool
+	RequireSignedProgress bool
+}
+
+func (q *Queries) GetGameProgressSettings(ctx context.Context, gameUuid uuid.UUID) (GetGameProgressSettingsRow, error) {
+	row := q.db.QueryRow(ctx, getGameProgressSettings, gameUuid)
+	var i GetGameProgressSettingsRow
+	err := row.Scan(&i.ServerOnlyProgress, &i.RequireSignedProgress)
+	return i, err
+}
+
+const setGameProgressSettings = `-- name: SetGameProgressSettings :exec
+update game
+set server_only_progress    = $1,
+    require_signed_progress = $2
+where uuid = $3
+`
+
+type SetGameProgressSettingsParams struct {
+	ServerOnlyProgress    bool
+	RequireSignedProgress bool
+	GameUuid              uuid.UUID
+}
+
+func (q *Queries) SetGameProgressSettings(ctx context.Context, arg SetGameProgressSettingsParams) error {
+	_, err := q.db.Exec(ctx, setGameProgressSettings, arg.ServerOnlyProgress, arg.RequireSignedProgress, arg.GameUuid)
+	return err
+}
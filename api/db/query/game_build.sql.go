@@ -0,0 +1,162 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: game_build.sql
+
+package query
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const createGameBuild = `-- name: CreateGameBuild :one
+insert into game_build (game_id, name, created_by_user_id)
+select g.id, $1, $2
+from game g
+where g.uuid = $3
+returning id, created_at, uuid, game_id, name, created_by_user_id
+`
+
+type CreateGameBuildParams struct {
+	Name            string
+	CreatedByUserID pgtype.Int4
+	GameUuid        uuid.UUID
+}
+
+func (q *Queries) CreateGameBuild(ctx context.Context, arg CreateGameBuildParams) (GameBuild, error) {
+	row := q.db.QueryRow(ctx, createGameBuild, arg.Name, arg.CreatedByUserID, arg.GameUuid)
+	var i GameBuild
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.Uuid,
+		&i.GameID,
+		&i.Name,
+		&i.CreatedByUserID,
+	)
+	return i, err
+}
+
+const deleteExpiredGameBuildNonces = `-- name: DeleteExpiredGameBuildNonces :execrows
+delete
+from game_build_nonce
+where expires_at <= now()
+`
+
+func (q *Queries) DeleteExpiredGameBuildNonces(ctx context.Context) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteExpiredGameBuildNonces)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteGameBuild = `-- name: DeleteGameBuild :one
+delete
+from game_build gb
+using game g
+where gb.game_id = g.id and g.uuid = $1 and gb.uuid = $2
+returning gb.id
+`
+
+type DeleteGameBuildParams struct {
+	GameUuid  uuid.UUID
+	BuildUuid uuid.UUID
+}
+
+func (q *Queries) DeleteGameBuild(ctx context.Context, arg DeleteGameBuildParams) (int32, error) {
+	row := q.db.QueryRow(ctx, deleteGameBuild, arg.GameUuid, arg.BuildUuid)
+	var id int32
+	err := row.Scan(&id)
+	return id, err
+}
+
+const findGameBuild = `-- name: FindGameBuild :one
+select gb.id
+from game_build gb
+     join game g on gb.game_id = g.id
+where g.uuid = $1 and gb.uuid = $2
+`
+
+type FindGameBuildParams struct {
+	GameUuid  uuid.UUID
+	BuildUuid uuid.UUID
+}
+
+func (q *Queries) FindGameBuild(ctx context.Context, arg FindGameBuildParams) (int32, error) {
+	row := q.db.QueryRow(ctx, findGameBuild, arg.GameUuid, arg.BuildUuid)
+	var id int32
+	err := row.Scan(&id)
+	return id, err
+}
+
+const getGameBuilds = `-- name: GetGameBuilds :many
+select gb.id, gb.created_at, gb.uuid, gb.game_id, gb.name, gb.created_by_user_id, u.slug as created_by_slug
+from game_build gb
+     join game g on gb.game_id = g.id
+     left outer join users u on gb.created_by_user_id = u.id
+where g.uuid = $1
+order by gb.uuid
+`
+
+type GetGameBuildsRow struct {
+	ID              int32
+	CreatedAt       time.Time
+	Uuid            uuid.UUID
+	GameID          int32
+	Name            string
+	CreatedByUserID pgtype.Int4
+	CreatedBySlug   *string
+}
+
+func (q *Queries) GetGameBuilds(ctx context.Context, gameUuid uuid.UUID) ([]GetGameBuildsRow, error) {
+	rows, err := q.db.Query(ctx, getGameBuilds, gameUuid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetGameBuildsRow
+	for rows.Next() {
+		var i GetGameBuildsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.Uuid,
+			&i.GameID,
+			&i.Name,
+			&i.CreatedByUserID,
+			&i.CreatedBySlug,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const useGameBuildNonce = `-- name: UseGameBuildNonce :execrows
+insert into game_build_nonce (game_build_id, nonce, expires_at)
+values ($1, $2, $3)
+on conflict do nothing
+`
+
+type UseGameBuildNonceParams struct {
+	GameBuildID int32
+	Nonce       string
+	ExpiresAt   time.Time
+}
+
+func (q *Queries) UseGameBuildNonce(ctx context.Context, arg UseGameBuildNonceParams) (int64, error) {
+	result, err := q.db.Exec(ctx, useGameBuildNonce, arg.GameBuildID, arg.Nonce, arg.ExpiresAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
@@ -14,26 +14,37 @@ import (
 
 const createGameSession = `-- name: CreateGameSession :one
 with target_game as (
-    select id from game where game.uuid = $1
+    select id from game where game.uuid = $2
 ), target_user as (
-    select id from users where users.uuid = $2
+    select id from users where users.uuid = $3
 ), target_game_token as (
-    select id from game_token where game_token.uuid = $3
+    -- nothing is created if the token was rotated or expired after the request was authenticated
+    select id
+    from game_token
+    where game_token.uuid = $4
+      and game_token.token_hash is not distinct from $1::bytea
+      and game_token.expires_at > now()
 )
-insert into game_session (game_id, user_id, game_token_id)
-select target_game.id, target_user.id, target_game_token.id
+insert into game_session (game_id, user_id, game_token_id, game_token_hash)
+select target_game.id, target_user.id, target_game_token.id, $1::bytea
 from target_game, target_user, target_game_token
-returning id, created_at, uuid, game_id, user_id, game_token_id, last_pulse_at
+returning id, created_at, uuid, game_id, user_id, game_token_id, last_pulse_at, ended_at, game_token_hash
 `
 
 type CreateGameSessionParams struct {
+	GameTokenHash []byte
 	GameUuid      uuid.UUID
 	UserUuid      uuid.UUID
 	GameTokenUuid uuid.UUID
 }
 
 func (q *Queries) CreateGameSession(ctx context.Context, arg CreateGameSessionParams) (GameSession, error) {
-	row := q.db.QueryRow(ctx, createGameSession, arg.GameUuid, arg.UserUuid, arg.GameTokenUuid)
+	row := q.db.QueryRow(ctx, createGameSession,
+		arg.GameTokenHash,
+		arg.GameUuid,
+		arg.UserUuid,
+		arg.GameTokenUuid,
+	)
 	var i GameSession
 	err := row.Scan(
 		&i.ID,
@@ -43,10 +54,59 @@ func (q *Queries) CreateGameSession(ctx context.Context, arg CreateGameSessionPa
 		&i.UserID,
 		&i.GameTokenID,
 		&i.LastPulseAt,
+		&i.EndedAt,
+		&i.GameTokenHash,
 	)
 	return i, err
 }
 
+const endGameSession = `-- name: EndGameSession :execrows
+update game_session
+set ended_at = now()
+where uuid = $1 and ended_at is null
+`
+
+func (q *Queries) EndGameSession(ctx context.Context, sessionUuid uuid.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, endGameSession, sessionUuid)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const endUserGameSession = `-- name: EndUserGameSession :execrows
+update game_session
+set ended_at = now()
+where user_id = $1 and uuid = $2 and ended_at is null
+`
+
+type EndUserGameSessionParams struct {
+	UserID      int32
+	SessionUuid uuid.UUID
+}
+
+func (q *Queries) EndUserGameSession(ctx context.Context, arg EndUserGameSessionParams) (int64, error) {
+	result, err := q.db.Exec(ctx, endUserGameSession, arg.UserID, arg.SessionUuid)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const endUserGameSessions = `-- name: EndUserGameSessions :execrows
+update game_session
+set ended_at = now()
+where user_id = $1 and ended_at is null
+`
+
+func (q *Queries) EndUserGameSessions(ctx context.Context, userID int32) (int64, error) {
+	result, err := q.db.Exec(ctx, endUserGameSessions, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const getGameSessionRidCounts = `-- name: GetGameSessionRidCounts :one
 with target_user as (
     select count() as user_count from users where users.uuid = $1
@@ -101,7 +161,7 @@ from achievement_progress ap
 join users u on ap.user_id = u.id
 join achievement a on ap.achievement_id = a.id
 join game g on a.game_id = g.id
-where u.uuid = $1 and g.uuid = $2
+where u.uuid = $1 and g.uuid = $2 and ap.revoked_at is null
 `
 
 type GetGameSessionUserProgressParams struct {
@@ -134,13 +194,73 @@ func (q *Queries) GetGameSessionUserProgress(ctx context.Context, arg GetGameSes
 	return items, nil
 }
 
+const getUserActiveGameSessions = `-- name: GetUserActiveGameSessions :many
+select gs.uuid, gs.created_at, gs.last_pulse_at, g.uuid as game_uuid, g.slug as game_slug, d.slug as developer_slug,
+       gt.uuid as game_token_uuid, gt.comment as game_token_comment
+from game_session gs
+     join game g on gs.game_id = g.id
+     join developer d on g.developer_id = d.id
+     join game_token gt on gs.game_token_id = gt.id
+where gs.user_id = $1 and gs.ended_at is null and gs.last_pulse_at > $2
+order by gs.last_pulse_at desc
+`
+
+type GetUserActiveGameSessionsParams struct {
+	UserID      int32
+	ActiveAfter time.Time
+}
+
+type GetUserActiveGameSessionsRow struct {
+	Uuid             uuid.UUID
+	CreatedAt        time.Time
+	LastPulseAt      time.Time
+	GameUuid         uuid.UUID
+	GameSlug         string
+	DeveloperSlug    string
+	GameTokenUuid    uuid.UUID
+	GameTokenComment string
+}
+
+func (q *Queries) GetUserActiveGameSessions(ctx context.Context, arg GetUserActiveGameSessionsParams) ([]GetUserActiveGameSessionsRow, error) {
+	rows, err := q.db.Query(ctx, getUserActiveGameSessions, arg.UserID, arg.ActiveAfter)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUserActiveGameSessionsRow
+	for rows.Next() {
+		var i GetUserActiveGameSessionsRow
+		if err := rows.Scan(
+			&i.Uuid,
+			&i.CreatedAt,
+			&i.LastPulseAt,
+			&i.GameUuid,
+			&i.GameSlug,
+			&i.DeveloperSlug,
+			&i.GameTokenUuid,
+			&i.GameTokenComment,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getValidSession = `-- name: GetValidSession :one
-select gs.last_pulse_at, gt.uuid as game_token_uuid
+select gs.last_pulse_at, gt.uuid as game_token_uuid, gt.scopes as game_token_scopes, gs.game_token_hash
 from game_session gs
     join game_token gt on gs.game_token_id = gt.id
     join game g on gs.game_id = g.id
     join users u on gs.user_id = u.id
 where not exists (select token_id, created_at from token_disallow_list tdl where tdl.token_id = $1)
+  and gs.ended_at is null
+  and gt.expires_at > now()
+  -- the session was started with the token's current secret, or with its RID before it was ever rotated
+  and gs.game_token_hash is not distinct from gt.token_hash
   and g.uuid = $2
   and u.uuid = $3
   and gs.uuid = $4
@@ -155,8 +275,10 @@ type GetValidSessionParams struct {
 }
 
 type GetValidSessionRow struct {
-	LastPulseAt   time.Time
-	GameTokenUuid uuid.UUID
+	LastPulseAt     time.Time
+	GameTokenUuid   uuid.UUID
+	GameTokenScopes []string
+	GameTokenHash   []byte
 }
 
 func (q *Queries) GetValidSession(ctx context.Context, arg GetValidSessionParams) (GetValidSessionRow, error) {
@@ -167,7 +289,12 @@ func (q *Queries) GetValidSession(ctx context.Context, arg GetValidSessionParams
 		arg.SessionUuid,
 	)
 	var i GetValidSessionRow
-	err := row.Scan(&i.LastPulseAt, &i.GameTokenUuid)
+	err := row.Scan(
+		&i.LastPulseAt,
+		&i.GameTokenUuid,
+		&i.GameTokenScopes,
+		&i.GameTokenHash,
+	)
 	return i, err
 }
 
@@ -0,0 +1,140 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: lockout.sql
+
+package query
+
+import (
+	"context"
+	"time"
+)
+
+const clearFailedAttempts = `-- name: ClearFailedAttempts :exec
+delete
+from account_lockout
+where user_id = $1
+  and kind = $2
+`
+
+type ClearFailedAttemptsParams struct {
+	UserID int32
+	Kind   string
+}
+
+func (q *Queries) ClearFailedAttempts(ctx context.Context, arg ClearFailedAttemptsParams) error {
+	_, err := q.db.Exec(ctx, clearFailedAttempts, arg.UserID, arg.Kind)
+	return err
+}
+
+const findUserLockoutContact = `-- name: FindUserLockoutContact :one
+select u.slug, ue.email
+from users u
+     join user_email ue on u.id = ue.user_id
+where u.id = $1
+  and ue.confirmed_at is not null
+`
+
+type FindUserLockoutContactRow struct {
+	Slug  string
+	Email string
+}
+
+func (q *Queries) FindUserLockoutContact(ctx context.Context, userID int32) (FindUserLockoutContactRow, error) {
+	row := q.db.QueryRow(ctx, findUserLockoutContact, userID)
+	var i FindUserLockoutContactRow
+	err := row.Scan(&i.Slug, &i.Email)
+	return i, err
+}
+
+const lockAccount = `-- name: LockAccount :exec
+update account_lockout
+set failed_count  = 0,
+    lockout_count = lockout_count + 1,
+    locked_until  = $1::timestamptz
+where user_id = $2
+  and kind = $3
+`
+
+type LockAccountParams struct {
+	LockedUntil time.Time
+	UserID      int32
+	Kind        string
+}
+
+// the failed count starts over once the lockout ends, and each further lockout lasts longer
+func (q *Queries) LockAccount(ctx context.Context, arg LockAccountParams) error {
+	_, err := q.db.Exec(ctx, lockAccount, arg.LockedUntil, arg.UserID, arg.Kind)
+	return err
+}
+
+const lockAccountLockout = `-- name: LockAccountLockout :one
+insert into account_lockout (user_id, kind, last_failed_at)
+values ($1, $2, $3)
+on conflict (user_id, kind) do update
+    set kind = excluded.kind
+returning user_id, kind, failed_count, last_failed_at, lockout_count, locked_until
+`
+
+type LockAccountLockoutParams struct {
+	UserID int32
+	Kind   string
+	Now    time.Time
+}
+
+// the row is created if the user has none, and locked until the end of the transaction either way, so that concurrent
+// attempts are counted one at a time
+func (q *Queries) LockAccountLockout(ctx context.Context, arg LockAccountLockoutParams) (AccountLockout, error) {
+	row := q.db.QueryRow(ctx, lockAccountLockout, arg.UserID, arg.Kind, arg.Now)
+	var i AccountLockout
+	err := row.Scan(
+		&i.UserID,
+		&i.Kind,
+		&i.FailedCount,
+		&i.LastFailedAt,
+		&i.LockoutCount,
+		&i.LockedUntil,
+	)
+	return i, err
+}
+
+const recordFailedAttempt = `-- name: RecordFailedAttempt :one
+insert into account_lockout (user_id, kind, failed_count, last_failed_at)
+values ($1, $2, 1, $3)
+on conflict (user_id, kind) do update
+    set failed_count   = case
+                             when account_lockout.last_failed_at < $4::timestamptz then 1
+                             else account_lockout.failed_count + 1 end,
+        lockout_count  = case
+                             when account_lockout.last_failed_at < $4::timestamptz then 0
+                             else account_lockout.lockout_count end,
+        last_failed_at = excluded.last_failed_at
+returning user_id, kind, failed_count, last_failed_at, lockout_count, locked_until
+`
+
+type RecordFailedAttemptParams struct {
+	UserID      int32
+	Kind        string
+	FailedAt    time.Time
+	ResetBefore time.Time
+}
+
+// failures older than @reset_before are forgotten, so that occasional typos never add up to a lockout
+func (q *Queries) RecordFailedAttempt(ctx context.Context, arg RecordFailedAttemptParams) (AccountLockout, error) {
+	row := q.db.QueryRow(ctx, recordFailedAttempt,
+		arg.UserID,
+		arg.Kind,
+		arg.FailedAt,
+		arg.ResetBefore,
+	)
+	var i AccountLockout
+	err := row.Scan(
+		&i.UserID,
+		&i.Kind,
+		&i.FailedCount,
+		&i.LastFailedAt,
+		&i.LockoutCount,
+		&i.LockedUntil,
+	)
+	return i, err
+}
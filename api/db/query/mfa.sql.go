@@ -0,0 +1,231 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: mfa.sql
+
+package query
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const addUserRecoveryCodes = `-- name: AddUserRecoveryCodes :exec
+insert into user_recovery_code (user_id, encoded_hash)
+select $1, unnest($2::text[])
+`
+
+type AddUserRecoveryCodesParams struct {
+	UserID        int32
+	EncodedHashes []string
+}
+
+func (q *Queries) AddUserRecoveryCodes(ctx context.Context, arg AddUserRecoveryCodesParams) error {
+	_, err := q.db.Exec(ctx, addUserRecoveryCodes, arg.UserID, arg.EncodedHashes)
+	return err
+}
+
+const attemptMfaChallenge = `-- name: AttemptMfaChallenge :one
+update mfa_challenge mc
+set attempt_count = mc.attempt_count + 1
+from users u
+where mc.uuid = $1
+  and mc.user_id = u.id
+  and mc.completed_at is null
+  and mc.expires_at > now()
+  and mc.attempt_count < $2
+returning mc.id, u.id as user_id, u.uuid as user_uuid
+`
+
+type AttemptMfaChallengeParams struct {
+	ChallengeUuid uuid.UUID
+	MaxAttempts   int32
+}
+
+type AttemptMfaChallengeRow struct {
+	ID       int32
+	UserID   int32
+	UserUuid uuid.UUID
+}
+
+func (q *Queries) AttemptMfaChallenge(ctx context.Context, arg AttemptMfaChallengeParams) (AttemptMfaChallengeRow, error) {
+	row := q.db.QueryRow(ctx, attemptMfaChallenge, arg.ChallengeUuid, arg.MaxAttempts)
+	var i AttemptMfaChallengeRow
+	err := row.Scan(&i.ID, &i.UserID, &i.UserUuid)
+	return i, err
+}
+
+const completeMfaChallenge = `-- name: CompleteMfaChallenge :execrows
+update mfa_challenge
+set completed_at = now()
+where id = $1 and completed_at is null
+`
+
+func (q *Queries) CompleteMfaChallenge(ctx context.Context, id int32) (int64, error) {
+	result, err := q.db.Exec(ctx, completeMfaChallenge, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const confirmUserMfa = `-- name: ConfirmUserMfa :execrows
+update user_mfa
+set confirmed_at = now()
+where user_id = $1 and confirmed_at is null
+`
+
+func (q *Queries) ConfirmUserMfa(ctx context.Context, userID int32) (int64, error) {
+	result, err := q.db.Exec(ctx, confirmUserMfa, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const createMfaChallenge = `-- name: CreateMfaChallenge :one
+insert into mfa_challenge (user_id, expires_at)
+values ($1, $2)
+returning id, created_at, uuid, user_id, expires_at, attempt_count, completed_at
+`
+
+type CreateMfaChallengeParams struct {
+	UserID    int32
+	ExpiresAt time.Time
+}
+
+func (q *Queries) CreateMfaChallenge(ctx context.Context, arg CreateMfaChallengeParams) (MfaChallenge, error) {
+	row := q.db.QueryRow(ctx, createMfaChallenge, arg.UserID, arg.ExpiresAt)
+	var i MfaChallenge
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.Uuid,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.AttemptCount,
+		&i.CompletedAt,
+	)
+	return i, err
+}
+
+const deleteUserMfa = `-- name: DeleteUserMfa :exec
+delete
+from user_mfa
+where user_id = $1
+`
+
+func (q *Queries) DeleteUserMfa(ctx context.Context, userID int32) error {
+	_, err := q.db.Exec(ctx, deleteUserMfa, userID)
+	return err
+}
+
+const deleteUserRecoveryCodes = `-- name: DeleteUserRecoveryCodes :exec
+delete
+from user_recovery_code
+where user_id = $1
+`
+
+func (q *Queries) DeleteUserRecoveryCodes(ctx context.Context, userID int32) error {
+	_, err := q.db.Exec(ctx, deleteUserRecoveryCodes, userID)
+	return err
+}
+
+const findUserMfa = `-- name: FindUserMfa :one
+select user_id, created_at, confirmed_at, last_used_step
+from user_mfa
+where user_id = $1
+`
+
+func (q *Queries) FindUserMfa(ctx context.Context, userID int32) (UserMfa, error) {
+	row := q.db.QueryRow(ctx, findUserMfa, userID)
+	var i UserMfa
+	err := row.Scan(
+		&i.UserID,
+		&i.CreatedAt,
+		&i.ConfirmedAt,
+		&i.LastUsedStep,
+	)
+	return i, err
+}
+
+const getUnusedRecoveryCodes = `-- name: GetUnusedRecoveryCodes :many
+select id, encoded_hash
+from user_recovery_code
+where user_id = $1 and used_at is null
+`
+
+type GetUnusedRecoveryCodesRow struct {
+	ID          int32
+	EncodedHash string
+}
+
+func (q *Queries) GetUnusedRecoveryCodes(ctx context.Context, userID int32) ([]GetUnusedRecoveryCodesRow, error) {
+	rows, err := q.db.Query(ctx, getUnusedRecoveryCodes, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUnusedRecoveryCodesRow
+	for rows.Next() {
+		var i GetUnusedRecoveryCodesRow
+		if err := rows.Scan(&i.ID, &i.EncodedHash); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const startUserMfaEnrollment = `-- name: StartUserMfaEnrollment :execrows
+insert into user_mfa (user_id)
+values ($1)
+on conflict (user_id) do update set created_at = now()
+where user_mfa.confirmed_at is null
+`
+
+func (q *Queries) StartUserMfaEnrollment(ctx context.Context, userID int32) (int64, error) {
+	result, err := q.db.Exec(ctx, startUserMfaEnrollment, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const useRecoveryCode = `-- name: UseRecoveryCode :execrows
+update user_recovery_code
+set used_at = now()
+where id = $1 and used_at is null
+`
+
+func (q *Queries) UseRecoveryCode(ctx context.Context, id int32) (int64, error) {
+	result, err := q.db.Exec(ctx, useRecoveryCode, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const useUserMfaStep = `-- name: UseUserMfaStep :execrows
+update user_mfa
+set last_used_step = $1::bigint
+where user_id = $2 and (last_used_step is null or last_used_step < $1::bigint)
+`
+
+type UseUserMfaStepParams struct {
+	Step   int64
+	UserID int32
+}
+
+func (q *Queries) UseUserMfaStep(ctx context.Context, arg UseUserMfaStepParams) (int64, error) {
+	result, err := q.db.Exec(ctx, useUserMfaStep, arg.Step, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
@@ -11,6 +11,15 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type AccountLockout struct {
+	UserID       int32
+	Kind         string
+	FailedCount  int32
+	LastFailedAt time.Time
+	LockoutCount int32
+	LockedUntil  pgtype.Timestamptz
+}
+
 type Achievement struct {
 	ID                  int32
 	CreatedAt           time.Time
@@ -22,6 +31,20 @@ type Achievement struct {
 	ProgressRequirement int32
 }
 
+type AchievementAnomaly struct {
+	ID               int32
+	CreatedAt        time.Time
+	Uuid             uuid.UUID
+	UserID           int32
+	AchievementID    int32
+	GameSessionID    uuid.NullUUID
+	Kind             string
+	Details          []byte
+	State            string
+	ReviewedAt       pgtype.Timestamptz
+	ReviewedByUserID pgtype.Int4
+}
+
 type AchievementAvatar struct {
 	ID            int32
 	CreatedAt     time.Time
@@ -31,11 +54,14 @@ type AchievementAvatar struct {
 }
 
 type AchievementProgress struct {
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
-	UserID        int32
-	AchievementID int32
-	Progress      int32
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	UserID          int32
+	AchievementID   int32
+	Progress        int32
+	UnlockedAt      pgtype.Timestamptz
+	RevokedAt       pgtype.Timestamptz
+	RevokedByUserID pgtype.Int4
 }
 
 type AchievementRarity struct {
@@ -51,6 +77,30 @@ type AchievementRarity struct {
 	CompletionPercent   float64
 }
 
+type AdminSetupToken struct {
+	ID        bool
+	CreatedAt time.Time
+	TokenHash []byte
+}
+
+type ContentReport struct {
+	ID                  int32
+	CreatedAt           time.Time
+	Uuid                uuid.UUID
+	ReporterUserID      pgtype.Int4
+	TargetKind          string
+	TargetUserID        pgtype.Int4
+	TargetAvatarID      pgtype.Int4
+	TargetGameID        pgtype.Int4
+	TargetAchievementID pgtype.Int4
+	Reason              string
+	Details             string
+	State               string
+	ResolvedAt          pgtype.Timestamptz
+	ResolvedByUserID    pgtype.Int4
+	ResolutionNote      *string
+}
+
 type DeletedRecord struct {
 	ID          uuid.UUID
 	DeletedAt   time.Time
@@ -96,13 +146,29 @@ type DeveloperSlugHistory struct {
 	Slug        string
 }
 
+type DeviceAuthorization struct {
+	ID             int32
+	CreatedAt      time.Time
+	DeviceCodeHash []byte
+	UserCode       string
+	GameID         int32
+	UserID         pgtype.Int4
+	ApprovedAt     pgtype.Timestamptz
+	DeniedAt       pgtype.Timestamptz
+	PollInterval   int32
+	LastPolledAt   pgtype.Timestamptz
+	ExpiresAt      time.Time
+}
+
 type Game struct {
-	ID          int32
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	DeveloperID int32
-	Uuid        uuid.UUID
-	Slug        string
+	ID                    int32
+	CreatedAt             time.Time
+	UpdatedAt             time.Time
+	DeveloperID           int32
+	Uuid                  uuid.UUID
+	Slug                  string
+	ServerOnlyProgress    bool
+	RequireSignedProgress bool
 }
 
 type GameAvatar struct {
@@ -113,6 +179,21 @@ type GameAvatar struct {
 	GameID    int32
 }
 
+type GameBuild struct {
+	ID              int32
+	CreatedAt       time.Time
+	Uuid            uuid.UUID
+	GameID          int32
+	Name            string
+	CreatedByUserID pgtype.Int4
+}
+
+type GameBuildNonce struct {
+	GameBuildID int32
+	Nonce       string
+	ExpiresAt   time.Time
+}
+
 type GameCompletion struct {
 	GameID              int32
 	UserID              int32
@@ -121,24 +202,116 @@ type GameCompletion struct {
 	HasEveryAchievement bool
 }
 
+type GameServerKey struct {
+	ID              int32
+	CreatedAt       time.Time
+	Uuid            uuid.UUID
+	GameID          int32
+	Comment         string
+	LookupPrefix    string
+	KeyHash         []byte
+	CreatedByUserID pgtype.Int4
+	LastUsedAt      pgtype.Timestamptz
+}
+
 type GameSession struct {
-	ID          uuid.UUID
-	CreatedAt   time.Time
-	Uuid        uuid.UUID
-	GameID      int32
-	UserID      int32
-	GameTokenID int32
-	LastPulseAt time.Time
+	ID            uuid.UUID
+	CreatedAt     time.Time
+	Uuid          uuid.UUID
+	GameID        int32
+	UserID        int32
+	GameTokenID   int32
+	LastPulseAt   time.Time
+	EndedAt       pgtype.Timestamptz
+	GameTokenHash []byte
 }
 
 type GameToken struct {
+	ID           int32
+	CreatedAt    time.Time
+	ExpiresAt    time.Time
+	Uuid         uuid.UUID
+	Comment      string
+	UserID       int32
+	GameID       int32
+	Scopes       []string
+	LookupPrefix *string
+	TokenHash    []byte
+}
+
+type MfaChallenge struct {
+	ID           int32
+	CreatedAt    time.Time
+	Uuid         uuid.UUID
+	UserID       int32
+	ExpiresAt    time.Time
+	AttemptCount int32
+	CompletedAt  pgtype.Timestamptz
+}
+
+type Notification struct {
+	ID               int32
+	CreatedAt        time.Time
+	Uuid             uuid.UUID
+	UserID           int32
+	Kind             string
+	GameID           pgtype.Int4
+	AchievementID    pgtype.Int4
+	GameTokenID      pgtype.Int4
+	AchievementCount pgtype.Int4
+	Email            *string
+	DedupeKey        *string
+	ReadAt           pgtype.Timestamptz
+}
+
+type OauthAuthorizationCode struct {
+	ID            int32
+	CreatedAt     time.Time
+	CodeHash      []byte
+	ClientID      int32
+	UserID        int32
+	RedirectUri   string
+	Scopes        []string
+	CodeChallenge string
+	ExpiresAt     time.Time
+}
+
+type OauthClient struct {
+	ID           int32
+	CreatedAt    time.Time
+	Uuid         uuid.UUID
+	DeveloperID  int32
+	Name         string
+	RedirectUris []string
+	SecretHash   []byte
+}
+
+type OauthRefreshToken struct {
 	ID        int32
 	CreatedAt time.Time
-	ExpiresAt time.Time
-	Uuid      uuid.UUID
-	Comment   string
+	TokenHash []byte
+	ClientID  int32
 	UserID    int32
-	GameID    int32
+	Scopes    []string
+	ExpiresAt time.Time
+}
+
+type OidcAuthorization struct {
+	ID           int32
+	CreatedAt    time.Time
+	State        string
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	UserID       pgtype.Int4
+	ExpiresAt    time.Time
+}
+
+type RateLimitBucket struct {
+	Key       string
+	Tokens    float64
+	UpdatedAt time.Time
+	FullAt    time.Time
 }
 
 type Secret struct {
@@ -148,14 +321,30 @@ type Secret struct {
 	Value string
 }
 
+type SecurityEvent struct {
+	ID          int64
+	CreatedAt   time.Time
+	Uuid        uuid.UUID
+	UserID      int32
+	ActorUserID pgtype.Int4
+	Kind        string
+	IpAddress   *string
+	UserAgent   *string
+	Details     []byte
+	ByAdmin     bool
+}
+
 type Token struct {
-	ID        uuid.UUID
-	Issuer    string
-	Subject   string
-	Audience  string
-	ExpiresAt time.Time
-	NotBefore time.Time
-	IssuedAt  time.Time
+	ID         uuid.UUID
+	Issuer     string
+	Subject    string
+	Audience   string
+	ExpiresAt  time.Time
+	NotBefore  time.Time
+	IssuedAt   time.Time
+	IpAddress  *string
+	UserAgent  *string
+	LastSeenAt pgtype.Timestamptz
 }
 
 type TokenDisallowList struct {
@@ -170,14 +359,31 @@ type User struct {
 	UpdatedAt time.Time
 	Uuid      uuid.UUID
 	Slug      string
+	// markdown-subset bio, validated by validation.ValidBioText before being stored
+	BioText  *string
+	Pronouns *string
+	// ISO 3166-1 alpha-2 country code
+	Country *string
 }
 
 type UserAvatar struct {
-	ID        int32
-	CreatedAt time.Time
-	Uuid      uuid.UUID
-	Blurhash  string
-	UserID    int32
+	ID              int32
+	CreatedAt       time.Time
+	Uuid            uuid.UUID
+	Blurhash        string
+	UserID          int32
+	RemovedAt       pgtype.Timestamptz
+	RemovedByUserID pgtype.Int4
+}
+
+type UserCurrentAvatar struct {
+	ID              int32
+	CreatedAt       time.Time
+	Uuid            uuid.UUID
+	Blurhash        string
+	UserID          int32
+	RemovedAt       pgtype.Timestamptz
+	RemovedByUserID pgtype.Int4
 }
 
 type UserDisplayName struct {
@@ -196,6 +402,18 @@ type UserEmail struct {
 	ConfirmedAt pgtype.Timestamptz
 }
 
+type UserIdentity struct {
+	ID         int32
+	CreatedAt  time.Time
+	Uuid       uuid.UUID
+	UserID     int32
+	Provider   string
+	Issuer     string
+	Subject    string
+	Email      *string
+	LastUsedAt pgtype.Timestamptz
+}
+
 type UserLatestDisplayName struct {
 	ID          int32
 	CreatedAt   time.Time
@@ -212,6 +430,24 @@ type UserLatestEmail struct {
 	ConfirmedAt pgtype.Timestamptz
 }
 
+type UserLink struct {
+	ID         int32
+	CreatedAt  time.Time
+	Uuid       uuid.UUID
+	UserID     int32
+	Position   int32
+	Url        string
+	CheckedAt  pgtype.Timestamptz
+	VerifiedAt pgtype.Timestamptz
+}
+
+type UserMfa struct {
+	UserID       int32
+	CreatedAt    time.Time
+	ConfirmedAt  pgtype.Timestamptz
+	LastUsedStep pgtype.Int8
+}
+
 type UserPassword struct {
 	ID          int32
 	CreatedAt   time.Time
@@ -220,9 +456,103 @@ type UserPassword struct {
 	EncodedHash string
 }
 
+type UserRecoveryCode struct {
+	ID          int32
+	CreatedAt   time.Time
+	UserID      int32
+	EncodedHash string
+	UsedAt      pgtype.Timestamptz
+}
+
+type UserRole struct {
+	UserID          int32
+	Role            string
+	GrantedAt       time.Time
+	GrantedByUserID pgtype.Int4
+}
+
+type UserShowcase struct {
+	UserID         int32
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	FeaturedGameID pgtype.Int4
+	HiddenSections []string
+}
+
+type UserShowcaseAchievement struct {
+	UserID        int32
+	Slot          int16
+	AchievementID int32
+}
+
+type UserShowcaseGame struct {
+	UserID int32
+	Slot   int16
+	GameID int32
+}
+
 type UserSlugHistory struct {
 	ID        int32
 	CreatedAt time.Time
 	UserID    int32
 	Slug      string
 }
+
+type UserSuspension struct {
+	ID             int32
+	CreatedAt      time.Time
+	Uuid           uuid.UUID
+	UserID         int32
+	ActorUserID    pgtype.Int4
+	Reason         string
+	EndsAt         pgtype.Timestamptz
+	LiftedAt       pgtype.Timestamptz
+	LiftedByUserID pgtype.Int4
+}
+
+type WebauthnCeremony struct {
+	ID          int32
+	CreatedAt   time.Time
+	Uuid        uuid.UUID
+	UserID      pgtype.Int4
+	Kind        string
+	SessionData []byte
+	ExpiresAt   time.Time
+}
+
+type WebauthnCredential struct {
+	ID           int32
+	CreatedAt    time.Time
+	Uuid         uuid.UUID
+	UserID       int32
+	CredentialID []byte
+	Name         string
+	Credential   []byte
+	LastUsedAt   pgtype.Timestamptz
+}
+
+type Webhook struct {
+	ID        int32
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Uuid      uuid.UUID
+	GameID    int32
+	Url       string
+	Events    []string
+	Enabled   bool
+}
+
+type WebhookDelivery struct {
+	ID             int32
+	CreatedAt      time.Time
+	Uuid           uuid.UUID
+	WebhookID      int32
+	Event          []byte
+	Status         string
+	AttemptCount   int32
+	NextAttemptAt  time.Time
+	LastAttemptAt  pgtype.Timestamptz
+	LastStatusCode pgtype.Int4
+	LastError      *string
+	DeliveredAt    pgtype.Timestamptz
+}
@@ -0,0 +1,275 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: moderation.sql
+
+package query
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const createUserSuspension = `-- name: CreateUserSuspension :one
+insert into user_suspension (user_id, actor_user_id, reason, ends_at)
+values ($1, $2, $3, $4::timestamptz)
+returning id, created_at, uuid, user_id, actor_user_id, reason, ends_at, lifted_at, lifted_by_user_id
+`
+
+type CreateUserSuspensionParams struct {
+	UserID      int32
+	ActorUserID pgtype.Int4
+	Reason      string
+	EndsAt      pgtype.Timestamptz
+}
+
+func (q *Queries) CreateUserSuspension(ctx context.Context, arg CreateUserSuspensionParams) (UserSuspension, error) {
+	row := q.db.QueryRow(ctx, createUserSuspension,
+		arg.UserID,
+		arg.ActorUserID,
+		arg.Reason,
+		arg.EndsAt,
+	)
+	var i UserSuspension
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.Uuid,
+		&i.UserID,
+		&i.ActorUserID,
+		&i.Reason,
+		&i.EndsAt,
+		&i.LiftedAt,
+		&i.LiftedByUserID,
+	)
+	return i, err
+}
+
+const forceUserSlug = `-- name: ForceUserSlug :exec
+update users
+set slug = $1
+where id = $2
+`
+
+type ForceUserSlugParams struct {
+	Slug   string
+	UserID int32
+}
+
+func (q *Queries) ForceUserSlug(ctx context.Context, arg ForceUserSlugParams) error {
+	_, err := q.db.Exec(ctx, forceUserSlug, arg.Slug, arg.UserID)
+	return err
+}
+
+const getActiveUserSuspension = `-- name: GetActiveUserSuspension :one
+select us.id, us.created_at, us.uuid, us.user_id, us.actor_user_id, us.reason, us.ends_at, us.lifted_at, us.lifted_by_user_id
+from user_suspension us
+     join users u on us.user_id = u.id
+where u.uuid = $1
+  and us.lifted_at is null
+  and (us.ends_at is null or us.ends_at > now())
+order by us.ends_at desc nulls first
+limit 1
+`
+
+func (q *Queries) GetActiveUserSuspension(ctx context.Context, userUuid uuid.UUID) (UserSuspension, error) {
+	row := q.db.QueryRow(ctx, getActiveUserSuspension, userUuid)
+	var i UserSuspension
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.Uuid,
+		&i.UserID,
+		&i.ActorUserID,
+		&i.Reason,
+		&i.EndsAt,
+		&i.LiftedAt,
+		&i.LiftedByUserID,
+	)
+	return i, err
+}
+
+const getAdminSecurityEvents = `-- name: GetAdminSecurityEvents :many
+select se.uuid, se.created_at, se.kind, se.details, u.uuid as user_uuid, u.slug as user_slug, actor.uuid as actor_uuid, actor.slug as actor_slug
+from security_event se
+     join users u on se.user_id = u.id
+     left join users actor on se.actor_user_id = actor.id
+where se.by_admin
+  and ($2::integer is null or se.user_id = $2::integer)
+  and ($3::uuid is null or se.uuid < $3::uuid)
+order by se.uuid desc
+limit $1
+`
+
+type GetAdminSecurityEventsParams struct {
+	Limit  int32
+	UserID pgtype.Int4
+	After  uuid.NullUUID
+}
+
+type GetAdminSecurityEventsRow struct {
+	Uuid      uuid.UUID
+	CreatedAt time.Time
+	Kind      string
+	Details   []byte
+	UserUuid  uuid.UUID
+	UserSlug  string
+	ActorUuid uuid.NullUUID
+	ActorSlug *string
+}
+
+func (q *Queries) GetAdminSecurityEvents(ctx context.Context, arg GetAdminSecurityEventsParams) ([]GetAdminSecurityEventsRow, error) {
+	rows, err := q.db.Query(ctx, getAdminSecurityEvents, arg.Limit, arg.UserID, arg.After)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetAdminSecurityEventsRow
+	for rows.Next() {
+		var i GetAdminSecurityEventsRow
+		if err := rows.Scan(
+			&i.Uuid,
+			&i.CreatedAt,
+			&i.Kind,
+			&i.Details,
+			&i.UserUuid,
+			&i.UserSlug,
+			&i.ActorUuid,
+			&i.ActorSlug,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUserEmails = `-- name: GetUserEmails :many
+select id, created_at, updated_at, user_id, email, confirmed_at
+from user_email
+where user_id = $1
+order by created_at desc
+`
+
+func (q *Queries) GetUserEmails(ctx context.Context, userID int32) ([]UserEmail, error) {
+	rows, err := q.db.Query(ctx, getUserEmails, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UserEmail
+	for rows.Next() {
+		var i UserEmail
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.Email,
+			&i.ConfirmedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUserSuspensions = `-- name: GetUserSuspensions :many
+select us.uuid, us.created_at, us.reason, us.ends_at, us.lifted_at, actor.slug as actor_slug, lifter.slug as lifted_by_slug
+from user_suspension us
+     left outer join users actor on us.actor_user_id = actor.id
+     left outer join users lifter on us.lifted_by_user_id = lifter.id
+where us.user_id = $1
+order by us.uuid desc
+`
+
+type GetUserSuspensionsRow struct {
+	Uuid         uuid.UUID
+	CreatedAt    time.Time
+	Reason       string
+	EndsAt       pgtype.Timestamptz
+	LiftedAt     pgtype.Timestamptz
+	ActorSlug    *string
+	LiftedBySlug *string
+}
+
+func (q *Queries) GetUserSuspensions(ctx context.Context, userID int32) ([]GetUserSuspensionsRow, error) {
+	rows, err := q.db.Query(ctx, getUserSuspensions, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUserSuspensionsRow
+	for rows.Next() {
+		var i GetUserSuspensionsRow
+		if err := rows.Scan(
+			&i.Uuid,
+			&i.CreatedAt,
+			&i.Reason,
+			&i.EndsAt,
+			&i.LiftedAt,
+			&i.ActorSlug,
+			&i.LiftedBySlug,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const liftUserSuspensions = `-- name: LiftUserSuspensions :execrows
+update user_suspension
+set lifted_at         = now(),
+    lifted_by_user_id = $1
+where user_id = $2
+  and lifted_at is null
+  and (ends_at is null or ends_at > now())
+`
+
+type LiftUserSuspensionsParams struct {
+	LiftedByUserID pgtype.Int4
+	UserID         int32
+}
+
+func (q *Queries) LiftUserSuspensions(ctx context.Context, arg LiftUserSuspensionsParams) (int64, error) {
+	result, err := q.db.Exec(ctx, liftUserSuspensions, arg.LiftedByUserID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const removeUserAvatars = `-- name: RemoveUserAvatars :execrows
+update user_avatar
+set removed_at         = now(),
+    removed_by_user_id = $1
+where user_id = $2
+  and removed_at is null
+`
+
+type RemoveUserAvatarsParams struct {
+	RemovedByUserID pgtype.Int4
+	UserID          int32
+}
+
+func (q *Queries) RemoveUserAvatars(ctx context.Context, arg RemoveUserAvatarsParams) (int64, error) {
+	result, err := q.db.Exec(ctx, removeUserAvatars, arg.RemovedByUserID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
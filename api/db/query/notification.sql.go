@@ -0,0 +1,222 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: notification.sql
+
+package query
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const addEmailConfirmedNotification = `-- name: AddEmailConfirmedNotification :exec
+insert into notification (user_id, kind, email)
+values ($1, 'email-confirmed', $2)
+`
+
+type AddEmailConfirmedNotificationParams struct {
+	UserID int32
+	Email  *string
+}
+
+func (q *Queries) AddEmailConfirmedNotification(ctx context.Context, arg AddEmailConfirmedNotificationParams) error {
+	_, err := q.db.Exec(ctx, addEmailConfirmedNotification, arg.UserID, arg.Email)
+	return err
+}
+
+const addExpiringGameTokenNotifications = `-- name: AddExpiringGameTokenNotifications :execrows
+insert into notification (user_id, kind, game_id, game_token_id, dedupe_key)
+select gt.user_id, 'game-token-expiring', gt.game_id, gt.id, 'game-token-expiring/' || gt.uuid
+from game_token gt
+where gt.expires_at > now() and gt.expires_at <= $1
+on conflict (user_id, dedupe_key) do nothing
+`
+
+func (q *Queries) AddExpiringGameTokenNotifications(ctx context.Context, expiresBefore time.Time) (int64, error) {
+	result, err := q.db.Exec(ctx, addExpiringGameTokenNotifications, expiresBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const addRareAchievementNotifications = `-- name: AddRareAchievementNotifications :execrows
+insert into notification (user_id, kind, game_id, achievement_id, dedupe_key)
+select u.id, 'rare-achievement-unlocked', g.id, ar.id, 'rare-achievement-unlocked/' || ar.id
+from achievement_progress ap
+     join achievement_rarity ar on ap.achievement_id = ar.id
+     join game g on ar.game_id = g.id
+     join users u on ap.user_id = u.id
+where u.uuid = $1
+  and g.uuid = $2
+  and ar.slug = any($3::text[])
+  and ap.progress >= ar.progress_requirement
+  and ap.revoked_at is null
+  and ar.completion_percent < $4::float
+on conflict (user_id, dedupe_key) do nothing
+`
+
+type AddRareAchievementNotificationsParams struct {
+	UserUuid             uuid.UUID
+	GameUuid             uuid.UUID
+	AchievementSlugs     []string
+	MaxCompletionPercent float64
+}
+
+func (q *Queries) AddRareAchievementNotifications(ctx context.Context, arg AddRareAchievementNotificationsParams) (int64, error) {
+	result, err := q.db.Exec(ctx, addRareAchievementNotifications,
+		arg.UserUuid,
+		arg.GameUuid,
+		arg.AchievementSlugs,
+		arg.MaxCompletionPercent,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const countUnreadNotifications = `-- name: CountUnreadNotifications :one
+select count(*)
+from notification
+where user_id = $1 and read_at is null
+`
+
+func (q *Queries) CountUnreadNotifications(ctx context.Context, userID int32) (int64, error) {
+	row := q.db.QueryRow(ctx, countUnreadNotifications, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const getUserNotifications = `-- name: GetUserNotifications :many
+select n.uuid,
+       n.created_at,
+       n.read_at,
+       n.kind,
+       n.achievement_count,
+       n.email,
+       g.uuid as game_uuid,
+       g.slug as game_slug,
+       d.slug as developer_slug,
+       a.slug as achievement_slug,
+       a.name as achievement_name,
+       ar.completion_percent as achievement_rarity,
+       gt.uuid as game_token_uuid,
+       gt.expires_at as game_token_expires_at,
+       gt.comment as game_token_comment
+from notification n
+     left outer join game g on n.game_id = g.id
+     left outer join developer d on g.developer_id = d.id
+     left outer join achievement a on n.achievement_id = a.id
+     left outer join achievement_rarity ar on n.achievement_id = ar.id
+     left outer join game_token gt on n.game_token_id = gt.id
+where n.user_id = $2
+  and (not $3::bool or n.read_at is null)
+  and ($4::uuid is null or n.uuid < $4::uuid)
+order by n.uuid desc
+limit $1
+`
+
+type GetUserNotificationsParams struct {
+	Limit      int32
+	UserID     int32
+	UnreadOnly bool
+	After      uuid.NullUUID
+}
+
+type GetUserNotificationsRow struct {
+	Uuid               uuid.UUID
+	CreatedAt          time.Time
+	ReadAt             pgtype.Timestamptz
+	Kind               string
+	AchievementCount   pgtype.Int4
+	Email              *string
+	GameUuid           uuid.NullUUID
+	GameSlug           *string
+	DeveloperSlug      *string
+	AchievementSlug    *string
+	AchievementName    *string
+	AchievementRarity  pgtype.Float8
+	GameTokenUuid      uuid.NullUUID
+	GameTokenExpiresAt pgtype.Timestamptz
+	GameTokenComment   *string
+}
+
+func (q *Queries) GetUserNotifications(ctx context.Context, arg GetUserNotificationsParams) ([]GetUserNotificationsRow, error) {
+	rows, err := q.db.Query(ctx, getUserNotifications,
+		arg.Limit,
+		arg.UserID,
+		arg.UnreadOnly,
+		arg.After,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUserNotificationsRow
+	for rows.Next() {
+		var i GetUserNotificationsRow
+		if err := rows.Scan(
+			&i.Uuid,
+			&i.CreatedAt,
+			&i.ReadAt,
+			&i.Kind,
+			&i.AchievementCount,
+			&i.Email,
+			&i.GameUuid,
+			&i.GameSlug,
+			&i.DeveloperSlug,
+			&i.AchievementSlug,
+			&i.AchievementName,
+			&i.AchievementRarity,
+			&i.GameTokenUuid,
+			&i.GameTokenExpiresAt,
+			&i.GameTokenComment,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markAllNotificationsRead = `-- name: MarkAllNotificationsRead :execrows
+update notification
+set read_at = now()
+where user_id = $1 and read_at is null
+`
+
+func (q *Queries) MarkAllNotificationsRead(ctx context.Context, userID int32) (int64, error) {
+	result, err := q.db.Exec(ctx, markAllNotificationsRead, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const markNotificationRead = `-- name: MarkNotificationRead :execrows
+update notification
+set read_at = coalesce(read_at, now())
+where user_id = $1 and uuid = $2
+`
+
+type MarkNotificationReadParams struct {
+	UserID int32
+	Uuid   uuid.UUID
+}
+
+func (q *Queries) MarkNotificationRead(ctx context.Context, arg MarkNotificationReadParams) (int64, error) {
+	result, err := q.db.Exec(ctx, markNotificationRead, arg.UserID, arg.Uuid)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
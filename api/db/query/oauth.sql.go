@@ -0,0 +1,411 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: oauth.sql
+
+package query
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const createOAuthAuthorizationCode = `-- name: CreateOAuthAuthorizationCode :exec
+insert into oauth_authorization_code (code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, expires_at)
+values ($1, $2, $3, $4, $5::text[], $6, $7)
+`
+
+type CreateOAuthAuthorizationCodeParams struct {
+	CodeHash      []byte
+	ClientID      int32
+	UserID        int32
+	RedirectUri   string
+	Scopes        []string
+	CodeChallenge string
+	ExpiresAt     time.Time
+}
+
+func (q *Queries) CreateOAuthAuthorizationCode(ctx context.Context, arg CreateOAuthAuthorizationCodeParams) error {
+	_, err := q.db.Exec(ctx, createOAuthAuthorizationCode,
+		arg.CodeHash,
+		arg.ClientID,
+		arg.UserID,
+		arg.RedirectUri,
+		arg.Scopes,
+		arg.CodeChallenge,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
+const createOAuthClient = `-- name: CreateOAuthClient :one
+insert into oauth_client (developer_id, name, redirect_uris, secret_hash)
+select d.id, $1, $2::text[], $3
+from developer d
+where d.uuid = $4
+returning id, created_at, uuid, developer_id, name, redirect_uris, secret_hash
+`
+
+type CreateOAuthClientParams struct {
+	Name          string
+	RedirectUris  []string
+	SecretHash    []byte
+	DeveloperUuid uuid.UUID
+}
+
+func (q *Queries) CreateOAuthClient(ctx context.Context, arg CreateOAuthClientParams) (OauthClient, error) {
+	row := q.db.QueryRow(ctx, createOAuthClient,
+		arg.Name,
+		arg.RedirectUris,
+		arg.SecretHash,
+		arg.DeveloperUuid,
+	)
+	var i OauthClient
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.Uuid,
+		&i.DeveloperID,
+		&i.Name,
+		&i.RedirectUris,
+		&i.SecretHash,
+	)
+	return i, err
+}
+
+const createOAuthRefreshToken = `-- name: CreateOAuthRefreshToken :exec
+insert into oauth_refresh_token (token_hash, client_id, user_id, scopes, expires_at)
+values ($1, $2, $3, $4::text[], $5)
+`
+
+type CreateOAuthRefreshTokenParams struct {
+	TokenHash []byte
+	ClientID  int32
+	UserID    int32
+	Scopes    []string
+	ExpiresAt time.Time
+}
+
+func (q *Queries) CreateOAuthRefreshToken(ctx context.Context, arg CreateOAuthRefreshTokenParams) error {
+	_, err := q.db.Exec(ctx, createOAuthRefreshToken,
+		arg.TokenHash,
+		arg.ClientID,
+		arg.UserID,
+		arg.Scopes,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
+const deleteExpiredOAuthAuthorizationCodes = `-- name: DeleteExpiredOAuthAuthorizationCodes :exec
+delete
+from oauth_authorization_code
+where expires_at <= now()
+`
+
+func (q *Queries) DeleteExpiredOAuthAuthorizationCodes(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, deleteExpiredOAuthAuthorizationCodes)
+	return err
+}
+
+const deleteOAuthClient = `-- name: DeleteOAuthClient :execrows
+delete
+from oauth_client oc
+    using developer d
+where oc.developer_id = d.id and d.uuid = $1 and oc.uuid = $2
+`
+
+type DeleteOAuthClientParams struct {
+	DeveloperUuid uuid.UUID
+	ClientUuid    uuid.UUID
+}
+
+func (q *Queries) DeleteOAuthClient(ctx context.Context, arg DeleteOAuthClientParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteOAuthClient, arg.DeveloperUuid, arg.ClientUuid)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const findOAuthClient = `-- name: FindOAuthClient :one
+select oc.id, oc.created_at, oc.uuid, oc.developer_id, oc.name, oc.redirect_uris, oc.secret_hash, d.slug as developer_slug
+from oauth_client oc
+     join developer d on oc.developer_id = d.id
+where oc.uuid = $1
+`
+
+type FindOAuthClientRow struct {
+	ID            int32
+	CreatedAt     time.Time
+	Uuid          uuid.UUID
+	DeveloperID   int32
+	Name          string
+	RedirectUris  []string
+	SecretHash    []byte
+	DeveloperSlug string
+}
+
+func (q *Queries) FindOAuthClient(ctx context.Context, clientUuid uuid.UUID) (FindOAuthClientRow, error) {
+	row := q.db.QueryRow(ctx, findOAuthClient, clientUuid)
+	var i FindOAuthClientRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.Uuid,
+		&i.DeveloperID,
+		&i.Name,
+		&i.RedirectUris,
+		&i.SecretHash,
+		&i.DeveloperSlug,
+	)
+	return i, err
+}
+
+const getDeveloperOAuthClients = `-- name: GetDeveloperOAuthClients :many
+select oc.id, oc.created_at, oc.uuid, oc.developer_id, oc.name, oc.redirect_uris, oc.secret_hash
+from oauth_client oc
+     join developer d on oc.developer_id = d.id
+where d.uuid = $1
+order by oc.id
+`
+
+func (q *Queries) GetDeveloperOAuthClients(ctx context.Context, developerUuid uuid.UUID) ([]OauthClient, error) {
+	rows, err := q.db.Query(ctx, getDeveloperOAuthClients, developerUuid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []OauthClient
+	for rows.Next() {
+		var i OauthClient
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.Uuid,
+			&i.DeveloperID,
+			&i.Name,
+			&i.RedirectUris,
+			&i.SecretHash,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUserAchievementProgress = `-- name: GetUserAchievementProgress :many
+select ap.progress, ap.updated_at, a.slug as achievement_slug, a.name as achievement_name,
+       a.description as achievement_description, a.progress_requirement, g.uuid as game_uuid, g.slug as game_slug,
+       d.slug as developer_slug
+from achievement_progress ap
+     join achievement a on ap.achievement_id = a.id
+     join game g on a.game_id = g.id
+     join developer d on g.developer_id = d.id
+where ap.user_id = $1 and ap.revoked_at is null
+order by ap.updated_at desc, a.id
+`
+
+type GetUserAchievementProgressRow struct {
+	Progress               int32
+	UpdatedAt              time.Time
+	AchievementSlug        string
+	AchievementName        string
+	AchievementDescription string
+	ProgressRequirement    int32
+	GameUuid               uuid.UUID
+	GameSlug               string
+	DeveloperSlug          string
+}
+
+func (q *Queries) GetUserAchievementProgress(ctx context.Context, userID int32) ([]GetUserAchievementProgressRow, error) {
+	rows, err := q.db.Query(ctx, getUserAchievementProgress, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUserAchievementProgressRow
+	for rows.Next() {
+		var i GetUserAchievementProgressRow
+		if err := rows.Scan(
+			&i.Progress,
+			&i.UpdatedAt,
+			&i.AchievementSlug,
+			&i.AchievementName,
+			&i.AchievementDescription,
+			&i.ProgressRequirement,
+			&i.GameUuid,
+			&i.GameSlug,
+			&i.DeveloperSlug,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUserOAuthApps = `-- name: GetUserOAuthApps :many
+select oc.uuid, oc.name, d.slug as developer_slug, array_agg(distinct s.scope)::text[] as scopes,
+       min(ort.created_at)::timestamptz as authorized_at
+from oauth_refresh_token ort
+     join oauth_client oc on ort.client_id = oc.id
+     join developer d on oc.developer_id = d.id
+     cross join unnest(ort.scopes) as s(scope)
+where ort.user_id = $1 and ort.expires_at > now()
+group by oc.id, d.slug
+order by oc.id
+`
+
+type GetUserOAuthAppsRow struct {
+	Uuid          uuid.UUID
+	Name          string
+	DeveloperSlug string
+	Scopes        []string
+	AuthorizedAt  time.Time
+}
+
+func (q *Queries) GetUserOAuthApps(ctx context.Context, userID int32) ([]GetUserOAuthAppsRow, error) {
+	rows, err := q.db.Query(ctx, getUserOAuthApps, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUserOAuthAppsRow
+	for rows.Next() {
+		var i GetUserOAuthAppsRow
+		if err := rows.Scan(
+			&i.Uuid,
+			&i.Name,
+			&i.DeveloperSlug,
+			&i.Scopes,
+			&i.AuthorizedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const hasOAuthGrant = `-- name: HasOAuthGrant :one
+select exists (select ort.id, ort.created_at, token_hash, client_id, user_id, scopes, expires_at, oc.id, oc.created_at, uuid, developer_id, name, redirect_uris, secret_hash
+               from oauth_refresh_token ort
+                    join oauth_client oc on ort.client_id = oc.id
+               where ort.user_id = $1 and oc.uuid = $2 and ort.expires_at > now())
+`
+
+type HasOAuthGrantParams struct {
+	UserID     int32
+	ClientUuid uuid.UUID
+}
+
+func (q *Queries) HasOAuthGrant(ctx context.Context, arg HasOAuthGrantParams) (bool, error) {
+	row := q.db.QueryRow(ctx, hasOAuthGrant, arg.UserID, arg.ClientUuid)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const isDeveloperMember = `-- name: IsDeveloperMember :one
+select exists (select dm.id, dm.created_at, user_id, developer_id, d.id, d.created_at, updated_at, uuid, slug
+               from developer_member dm
+                    join developer d on dm.developer_id = d.id
+               where dm.user_id = $1 and d.uuid = $2)
+`
+
+type IsDeveloperMemberParams struct {
+	UserID        int32
+	DeveloperUuid uuid.UUID
+}
+
+func (q *Queries) IsDeveloperMember(ctx context.Context, arg IsDeveloperMemberParams) (bool, error) {
+	row := q.db.QueryRow(ctx, isDeveloperMember, arg.UserID, arg.DeveloperUuid)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const revokeUserOAuthApp = `-- name: RevokeUserOAuthApp :execrows
+with revoked_codes as (
+    delete
+    from oauth_authorization_code oac
+        using oauth_client oc
+    where oac.client_id = oc.id and oac.user_id = $1 and oc.uuid = $2
+)
+delete
+from oauth_refresh_token ort
+    using oauth_client oc
+where ort.client_id = oc.id and ort.user_id = $1 and oc.uuid = $2
+`
+
+type RevokeUserOAuthAppParams struct {
+	UserID     int32
+	ClientUuid uuid.UUID
+}
+
+func (q *Queries) RevokeUserOAuthApp(ctx context.Context, arg RevokeUserOAuthAppParams) (int64, error) {
+	result, err := q.db.Exec(ctx, revokeUserOAuthApp, arg.UserID, arg.ClientUuid)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const takeOAuthAuthorizationCode = `-- name: TakeOAuthAuthorizationCode :one
+delete
+from oauth_authorization_code
+where code_hash = $1
+returning id, created_at, code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, expires_at
+`
+
+func (q *Queries) TakeOAuthAuthorizationCode(ctx context.Context, codeHash []byte) (OauthAuthorizationCode, error) {
+	row := q.db.QueryRow(ctx, takeOAuthAuthorizationCode, codeHash)
+	var i OauthAuthorizationCode
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.CodeHash,
+		&i.ClientID,
+		&i.UserID,
+		&i.RedirectUri,
+		&i.Scopes,
+		&i.CodeChallenge,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
+const takeOAuthRefreshToken = `-- name: TakeOAuthRefreshToken :one
+delete
+from oauth_refresh_token
+where token_hash = $1
+returning id, created_at, token_hash, client_id, user_id, scopes, expires_at
+`
+
+func (q *Queries) TakeOAuthRefreshToken(ctx context.Context, tokenHash []byte) (OauthRefreshToken, error) {
+	row := q.db.QueryRow(ctx, takeOAuthRefreshToken, tokenHash)
+	var i OauthRefreshToken
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.TokenHash,
+		&i.ClientID,
+		&i.UserID,
+		&i.Scopes,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
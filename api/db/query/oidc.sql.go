@@ -0,0 +1,282 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: oidc.sql
+
+package query
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const addUserIdentity = `-- name: AddUserIdentity :one
+insert into user_identity (user_id, provider, issuer, subject, email, last_used_at)
+values ($1, $2, $3, $4, $5, now())
+returning id, created_at, uuid, user_id, provider, issuer, subject, email, last_used_at
+`
+
+type AddUserIdentityParams struct {
+	UserID   int32
+	Provider string
+	Issuer   string
+	Subject  string
+	Email    *string
+}
+
+func (q *Queries) AddUserIdentity(ctx context.Context, arg AddUserIdentityParams) (UserIdentity, error) {
+	row := q.db.QueryRow(ctx, addUserIdentity,
+		arg.UserID,
+		arg.Provider,
+		arg.Issuer,
+		arg.Subject,
+		arg.Email,
+	)
+	var i UserIdentity
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.Uuid,
+		&i.UserID,
+		&i.Provider,
+		&i.Issuer,
+		&i.Subject,
+		&i.Email,
+		&i.LastUsedAt,
+	)
+	return i, err
+}
+
+const countUserSignInMethods = `-- name: CountUserSignInMethods :one
+select ((select count(*) from user_password up where up.user_id = $1) +
+       (select count(*) from user_identity ui where ui.user_id = $1) +
+       (select count(*) from webauthn_credential wc where wc.user_id = $1))::integer as count
+`
+
+func (q *Queries) CountUserSignInMethods(ctx context.Context, userID int32) (int32, error) {
+	row := q.db.QueryRow(ctx, countUserSignInMethods, userID)
+	var count int32
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createOidcAuthorization = `-- name: CreateOidcAuthorization :exec
+insert into oidc_authorization (state, provider, nonce, code_verifier, user_id, expires_at)
+values ($1, $2, $3, $4, $5, $6)
+`
+
+type CreateOidcAuthorizationParams struct {
+	State        string
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	UserID       pgtype.Int4
+	ExpiresAt    time.Time
+}
+
+func (q *Queries) CreateOidcAuthorization(ctx context.Context, arg CreateOidcAuthorizationParams) error {
+	_, err := q.db.Exec(ctx, createOidcAuthorization,
+		arg.State,
+		arg.Provider,
+		arg.Nonce,
+		arg.CodeVerifier,
+		arg.UserID,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
+const deleteExpiredOidcAuthorizations = `-- name: DeleteExpiredOidcAuthorizations :exec
+delete
+from oidc_authorization
+where expires_at <= now()
+`
+
+func (q *Queries) DeleteExpiredOidcAuthorizations(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, deleteExpiredOidcAuthorizations)
+	return err
+}
+
+const deleteUserIdentity = `-- name: DeleteUserIdentity :execrows
+delete
+from user_identity
+where user_id = $1 and uuid = $2
+`
+
+type DeleteUserIdentityParams struct {
+	UserID       int32
+	IdentityUuid uuid.UUID
+}
+
+func (q *Queries) DeleteUserIdentity(ctx context.Context, arg DeleteUserIdentityParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteUserIdentity, arg.UserID, arg.IdentityUuid)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const findUserByIdentity = `-- name: FindUserByIdentity :one
+select u.id, u.created_at, u.updated_at, u.uuid, u.slug, u.bio_text, u.pronouns, u.country
+from users u
+     join user_identity ui on u.id = ui.user_id
+where ui.issuer = $1 and ui.subject = $2
+`
+
+type FindUserByIdentityParams struct {
+	Issuer  string
+	Subject string
+}
+
+func (q *Queries) FindUserByIdentity(ctx context.Context, arg FindUserByIdentityParams) (User, error) {
+	row := q.db.QueryRow(ctx, findUserByIdentity, arg.Issuer, arg.Subject)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Uuid,
+		&i.Slug,
+		&i.BioText,
+		&i.Pronouns,
+		&i.Country,
+	)
+	return i, err
+}
+
+const findUsersByConfirmedEmail = `-- name: FindUsersByConfirmedEmail :many
+select u.id, u.created_at, u.updated_at, u.uuid, u.slug, u.bio_text, u.pronouns, u.country
+from users u
+     join user_email ue on u.id = ue.user_id
+where lower(ue.email) = lower($1) and ue.confirmed_at is not null
+`
+
+func (q *Queries) FindUsersByConfirmedEmail(ctx context.Context, email string) ([]User, error) {
+	rows, err := q.db.Query(ctx, findUsersByConfirmedEmail, email)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Uuid,
+			&i.Slug,
+			&i.BioText,
+			&i.Pronouns,
+			&i.Country,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUserIdentities = `-- name: GetUserIdentities :many
+select id, created_at, uuid, user_id, provider, issuer, subject, email, last_used_at
+from user_identity
+where user_id = $1
+order by id
+`
+
+func (q *Queries) GetUserIdentities(ctx context.Context, userID int32) ([]UserIdentity, error) {
+	rows, err := q.db.Query(ctx, getUserIdentities, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UserIdentity
+	for rows.Next() {
+		var i UserIdentity
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.Uuid,
+			&i.UserID,
+			&i.Provider,
+			&i.Issuer,
+			&i.Subject,
+			&i.Email,
+			&i.LastUsedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockUserSignInMethods = `-- name: LockUserSignInMethods :exec
+select id
+from users
+where id = $1
+for update
+`
+
+// locks the user, so that concurrent removals of their sign in methods can't remove every method
+func (q *Queries) LockUserSignInMethods(ctx context.Context, userID int32) error {
+	_, err := q.db.Exec(ctx, lockUserSignInMethods, userID)
+	return err
+}
+
+const takeOidcAuthorization = `-- name: TakeOidcAuthorization :one
+delete
+from oidc_authorization
+where state = $1
+  and provider = $2
+  and expires_at > now()
+returning id, created_at, state, provider, nonce, code_verifier, user_id, expires_at
+`
+
+type TakeOidcAuthorizationParams struct {
+	State    string
+	Provider string
+}
+
+func (q *Queries) TakeOidcAuthorization(ctx context.Context, arg TakeOidcAuthorizationParams) (OidcAuthorization, error) {
+	row := q.db.QueryRow(ctx, takeOidcAuthorization, arg.State, arg.Provider)
+	var i OidcAuthorization
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.State,
+		&i.Provider,
+		&i.Nonce,
+		&i.CodeVerifier,
+		&i.UserID,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
+const touchUserIdentity = `-- name: TouchUserIdentity :exec
+update user_identity
+set last_used_at = now(),
+    email        = $1
+where issuer = $2 and subject = $3
+`
+
+type TouchUserIdentityParams struct {
+	Email   *string
+	Issuer  string
+	Subject string
+}
+
+func (q *Queries) TouchUserIdentity(ctx context.Context, arg TouchUserIdentityParams) error {
+	_, err := q.db.Exec(ctx, touchUserIdentity, arg.Email, arg.Issuer, arg.Subject)
+	return err
+}
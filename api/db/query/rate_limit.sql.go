@@ -0,0 +1,87 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: rate_limit.sql
+
+package query
+
+import (
+	"context"
+	"time"
+)
+
+const createRateLimitBucket = `-- name: CreateRateLimitBucket :exec
+insert into rate_limit_bucket (key, tokens, updated_at, full_at)
+values ($1, $2, $3, $3)
+on conflict (key) do nothing
+`
+
+type CreateRateLimitBucketParams struct {
+	Key    string
+	Tokens float64
+	Now    time.Time
+}
+
+// creates a full bucket if there isn't one, so that it can be locked by GetRateLimitBucketForUpdate
+func (q *Queries) CreateRateLimitBucket(ctx context.Context, arg CreateRateLimitBucketParams) error {
+	_, err := q.db.Exec(ctx, createRateLimitBucket, arg.Key, arg.Tokens, arg.Now)
+	return err
+}
+
+const deleteFullRateLimitBuckets = `-- name: DeleteFullRateLimitBuckets :execrows
+delete
+from rate_limit_bucket
+where full_at < $1
+`
+
+func (q *Queries) DeleteFullRateLimitBuckets(ctx context.Context, now time.Time) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteFullRateLimitBuckets, now)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const getRateLimitBucketForUpdate = `-- name: GetRateLimitBucketForUpdate :one
+select key, tokens, updated_at, full_at
+from rate_limit_bucket
+where key = $1
+    for update
+`
+
+func (q *Queries) GetRateLimitBucketForUpdate(ctx context.Context, key string) (RateLimitBucket, error) {
+	row := q.db.QueryRow(ctx, getRateLimitBucketForUpdate, key)
+	var i RateLimitBucket
+	err := row.Scan(
+		&i.Key,
+		&i.Tokens,
+		&i.UpdatedAt,
+		&i.FullAt,
+	)
+	return i, err
+}
+
+const updateRateLimitBucket = `-- name: UpdateRateLimitBucket :exec
+update rate_limit_bucket
+set tokens     = $1,
+    updated_at = $2,
+    full_at    = $3
+where key = $4
+`
+
+type UpdateRateLimitBucketParams struct {
+	Tokens    float64
+	UpdatedAt time.Time
+	FullAt    time.Time
+	Key       string
+}
+
+func (q *Queries) UpdateRateLimitBucket(ctx context.Context, arg UpdateRateLimitBucketParams) error {
+	_, err := q.db.Exec(ctx, updateRateLimitBucket,
+		arg.Tokens,
+		arg.UpdatedAt,
+		arg.FullAt,
+		arg.Key,
+	)
+	return err
+}
@@ -0,0 +1,236 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: report.sql
+
+package query
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const createContentReport = `-- name: CreateContentReport :execrows
+insert into content_report (reporter_user_id, target_kind, target_user_id, target_avatar_id, target_game_id,
+                            target_achievement_id, reason, details)
+values ($1, $2, $3, $4,
+        $5, $6, $7, $8)
+on conflict do nothing
+`
+
+type CreateContentReportParams struct {
+	ReporterUserID      pgtype.Int4
+	TargetKind          string
+	TargetUserID        pgtype.Int4
+	TargetAvatarID      pgtype.Int4
+	TargetGameID        pgtype.Int4
+	TargetAchievementID pgtype.Int4
+	Reason              string
+	Details             string
+}
+
+func (q *Queries) CreateContentReport(ctx context.Context, arg CreateContentReportParams) (int64, error) {
+	result, err := q.db.Exec(ctx, createContentReport,
+		arg.ReporterUserID,
+		arg.TargetKind,
+		arg.TargetUserID,
+		arg.TargetAvatarID,
+		arg.TargetGameID,
+		arg.TargetAchievementID,
+		arg.Reason,
+		arg.Details,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const getContentReportForUpdate = `-- name: GetContentReportForUpdate :one
+select id, created_at, uuid, reporter_user_id, target_kind, target_user_id, target_avatar_id, target_game_id, target_achievement_id, reason, details, state, resolved_at, resolved_by_user_id, resolution_note
+from content_report
+where uuid = $1
+for update
+`
+
+func (q *Queries) GetContentReportForUpdate(ctx context.Context, argUuid uuid.UUID) (ContentReport, error) {
+	row := q.db.QueryRow(ctx, getContentReportForUpdate, argUuid)
+	var i ContentReport
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.Uuid,
+		&i.ReporterUserID,
+		&i.TargetKind,
+		&i.TargetUserID,
+		&i.TargetAvatarID,
+		&i.TargetGameID,
+		&i.TargetAchievementID,
+		&i.Reason,
+		&i.Details,
+		&i.State,
+		&i.ResolvedAt,
+		&i.ResolvedByUserID,
+		&i.ResolutionNote,
+	)
+	return i, err
+}
+
+const getContentReports = `-- name: GetContentReports :many
+select cr.uuid,
+       cr.created_at,
+       cr.target_kind,
+       cr.reason,
+       cr.details,
+       cr.state,
+       cr.resolved_at,
+       cr.resolution_note,
+       reporter.slug          as reporter_slug,
+       resolver.slug          as resolved_by_slug,
+       tu.uuid                as target_user_uuid,
+       tu.slug                as target_user_slug,
+       ua.uuid                as target_avatar_uuid,
+       ua.removed_at          as target_avatar_removed_at,
+       g.uuid                 as target_game_uuid,
+       g.slug                 as target_game_slug,
+       d.slug                 as target_developer_slug,
+       a.slug                 as target_achievement_slug
+from content_report cr
+     left outer join users reporter on cr.reporter_user_id = reporter.id
+     left outer join users resolver on cr.resolved_by_user_id = resolver.id
+     left outer join users tu on cr.target_user_id = tu.id
+     left outer join user_avatar ua on cr.target_avatar_id = ua.id
+     left outer join game g on cr.target_game_id = g.id
+     left outer join developer d on g.developer_id = d.id
+     left outer join achievement a on cr.target_achievement_id = a.id
+where ($2::text is null or cr.state = $2::text)
+  and ($3::text is null or cr.target_kind = $3::text)
+  and ($4::uuid is null or cr.uuid < $4::uuid)
+order by cr.uuid desc
+limit $1
+`
+
+type GetContentReportsParams struct {
+	Limit      int32
+	State      *string
+	TargetKind *string
+	After      uuid.NullUUID
+}
+
+type GetContentReportsRow struct {
+	Uuid                  uuid.UUID
+	CreatedAt             time.Time
+	TargetKind            string
+	Reason                string
+	Details               string
+	State                 string
+	ResolvedAt            pgtype.Timestamptz
+	ResolutionNote        *string
+	ReporterSlug          *string
+	ResolvedBySlug        *string
+	TargetUserUuid        uuid.NullUUID
+	TargetUserSlug        *string
+	TargetAvatarUuid      uuid.NullUUID
+	TargetAvatarRemovedAt pgtype.Timestamptz
+	TargetGameUuid        uuid.NullUUID
+	TargetGameSlug        *string
+	TargetDeveloperSlug   *string
+	TargetAchievementSlug *string
+}
+
+func (q *Queries) GetContentReports(ctx context.Context, arg GetContentReportsParams) ([]GetContentReportsRow, error) {
+	rows, err := q.db.Query(ctx, getContentReports,
+		arg.Limit,
+		arg.State,
+		arg.TargetKind,
+		arg.After,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetContentReportsRow
+	for rows.Next() {
+		var i GetContentReportsRow
+		if err := rows.Scan(
+			&i.Uuid,
+			&i.CreatedAt,
+			&i.TargetKind,
+			&i.Reason,
+			&i.Details,
+			&i.State,
+			&i.ResolvedAt,
+			&i.ResolutionNote,
+			&i.ReporterSlug,
+			&i.ResolvedBySlug,
+			&i.TargetUserUuid,
+			&i.TargetUserSlug,
+			&i.TargetAvatarUuid,
+			&i.TargetAvatarRemovedAt,
+			&i.TargetGameUuid,
+			&i.TargetGameSlug,
+			&i.TargetDeveloperSlug,
+			&i.TargetAchievementSlug,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const resolveContentReport = `-- name: ResolveContentReport :exec
+update content_report
+set state               = $1,
+    resolved_at         = now(),
+    resolved_by_user_id = $2,
+    resolution_note     = $3
+where id = $4
+`
+
+type ResolveContentReportParams struct {
+	State            string
+	ResolvedByUserID pgtype.Int4
+	ResolutionNote   *string
+	ID               int32
+}
+
+func (q *Queries) ResolveContentReport(ctx context.Context, arg ResolveContentReportParams) error {
+	_, err := q.db.Exec(ctx, resolveContentReport,
+		arg.State,
+		arg.ResolvedByUserID,
+		arg.ResolutionNote,
+		arg.ID,
+	)
+	return err
+}
+
+const resolveOpenAvatarReports = `-- name: ResolveOpenAvatarReports :execrows
+update content_report
+set state               = 'actioned',
+    resolved_at         = now(),
+    resolved_by_user_id = $1,
+    resolution_note     = $2
+where target_avatar_id = $3
+  and state = 'open'
+`
+
+type ResolveOpenAvatarReportsParams struct {
+	ResolvedByUserID pgtype.Int4
+	ResolutionNote   *string
+	AvatarID         pgtype.Int4
+}
+
+func (q *Queries) ResolveOpenAvatarReports(ctx context.Context, arg ResolveOpenAvatarReportsParams) (int64, error) {
+	result, err := q.db.Exec(ctx, resolveOpenAvatarReports, arg.ResolvedByUserID, arg.ResolutionNote, arg.AvatarID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
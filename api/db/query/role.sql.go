@@ -0,0 +1,121 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: role.sql
+
+package query
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const consumeAdminSetupToken = `-- name: ConsumeAdminSetupToken :execrows
+delete
+from admin_setup_token
+where token_hash = $1
+`
+
+func (q *Queries) ConsumeAdminSetupToken(ctx context.Context, tokenHash []byte) (int64, error) {
+	result, err := q.db.Exec(ctx, consumeAdminSetupToken, tokenHash)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const createAdminSetupToken = `-- name: CreateAdminSetupToken :execrows
+insert into admin_setup_token (token_hash)
+values ($1)
+on conflict (id) do nothing
+`
+
+func (q *Queries) CreateAdminSetupToken(ctx context.Context, tokenHash []byte) (int64, error) {
+	result, err := q.db.Exec(ctx, createAdminSetupToken, tokenHash)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteAdminSetupToken = `-- name: DeleteAdminSetupToken :exec
+delete
+from admin_setup_token
+`
+
+func (q *Queries) DeleteAdminSetupToken(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, deleteAdminSetupToken)
+	return err
+}
+
+const deleteUserRole = `-- name: DeleteUserRole :execrows
+delete
+from user_role
+where user_id = $1
+`
+
+func (q *Queries) DeleteUserRole(ctx context.Context, userID int32) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteUserRole, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const getUserRole = `-- name: GetUserRole :one
+select role
+from user_role
+where user_id = $1
+`
+
+func (q *Queries) GetUserRole(ctx context.Context, userID int32) (string, error) {
+	row := q.db.QueryRow(ctx, getUserRole, userID)
+	var role string
+	err := row.Scan(&role)
+	return role, err
+}
+
+const replaceAdminSetupToken = `-- name: ReplaceAdminSetupToken :exec
+insert into admin_setup_token (token_hash)
+values ($1)
+on conflict (id) do update
+    set token_hash = excluded.token_hash,
+        created_at = now()
+`
+
+func (q *Queries) ReplaceAdminSetupToken(ctx context.Context, tokenHash []byte) error {
+	_, err := q.db.Exec(ctx, replaceAdminSetupToken, tokenHash)
+	return err
+}
+
+const rootExists = `-- name: RootExists :one
+select exists(select 1 from user_role where role = 'root')
+`
+
+func (q *Queries) RootExists(ctx context.Context) (bool, error) {
+	row := q.db.QueryRow(ctx, rootExists)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const setUserRole = `-- name: SetUserRole :exec
+insert into user_role (user_id, role, granted_by_user_id)
+values ($1, $2, $3)
+on conflict (user_id) do update
+    set role               = excluded.role,
+        granted_at         = now(),
+        granted_by_user_id = excluded.granted_by_user_id
+`
+
+type SetUserRoleParams struct {
+	UserID          int32
+	Role            string
+	GrantedByUserID pgtype.Int4
+}
+
+func (q *Queries) SetUserRole(ctx context.Context, arg SetUserRoleParams) error {
+	_, err := q.db.Exec(ctx, setUserRole, arg.UserID, arg.Role, arg.GrantedByUserID)
+	return err
+}
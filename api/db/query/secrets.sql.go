@@ -25,6 +25,37 @@ func (q *Queries) SecretCreate(ctx context.Context, arg SecretCreateParams) erro
 	return err
 }
 
+const secretDelete = `-- name: SecretDelete :exec
+delete from secret where path = $1 and key = $2
+`
+
+type SecretDeleteParams struct {
+	Path string
+	Key  string
+}
+
+func (q *Queries) SecretDelete(ctx context.Context, arg SecretDeleteParams) error {
+	_, err := q.db.Exec(ctx, secretDelete, arg.Path, arg.Key)
+	return err
+}
+
+const secretPut = `-- name: SecretPut :exec
+insert into secret(path, key, value)
+values ($1, $2, $3)
+on conflict (path, key) do update set value = excluded.value
+`
+
+type SecretPutParams struct {
+	Path  string
+	Key   string
+	Value string
+}
+
+func (q *Queries) SecretPut(ctx context.Context, arg SecretPutParams) error {
+	_, err := q.db.Exec(ctx, secretPut, arg.Path, arg.Key, arg.Value)
+	return err
+}
+
 const secretRead = `-- name: SecretRead :one
 select value from secret where path = $1 and key = $2
 `
@@ -0,0 +1,94 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: security_event.sql
+
+package query
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const createSecurityEvent = `-- name: CreateSecurityEvent :exec
+insert into security_event (user_id, actor_user_id, by_admin, kind, ip_address, user_agent, details)
+values ($1, $2, $2::integer is not null, $3, $4,
+        $5, $6)
+`
+
+type CreateSecurityEventParams struct {
+	UserID      int32
+	ActorUserID pgtype.Int4
+	Kind        string
+	IpAddress   *string
+	UserAgent   *string
+	Details     []byte
+}
+
+func (q *Queries) CreateSecurityEvent(ctx context.Context, arg CreateSecurityEventParams) error {
+	_, err := q.db.Exec(ctx, createSecurityEvent,
+		arg.UserID,
+		arg.ActorUserID,
+		arg.Kind,
+		arg.IpAddress,
+		arg.UserAgent,
+		arg.Details,
+	)
+	return err
+}
+
+const getUserSecurityEvents = `-- name: GetUserSecurityEvents :many
+select se.uuid, se.created_at, se.kind, se.ip_address, se.user_agent, se.details, se.by_admin
+from security_event se
+where se.user_id = $2
+  and ($3::uuid is null or se.uuid < $3::uuid)
+order by se.uuid desc
+limit $1
+`
+
+type GetUserSecurityEventsParams struct {
+	Limit  int32
+	UserID int32
+	After  uuid.NullUUID
+}
+
+type GetUserSecurityEventsRow struct {
+	Uuid      uuid.UUID
+	CreatedAt time.Time
+	Kind      string
+	IpAddress *string
+	UserAgent *string
+	Details   []byte
+	ByAdmin   bool
+}
+
+func (q *Queries) GetUserSecurityEvents(ctx context.Context, arg GetUserSecurityEventsParams) ([]GetUserSecurityEventsRow, error) {
+	rows, err := q.db.Query(ctx, getUserSecurityEvents, arg.Limit, arg.UserID, arg.After)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUserSecurityEventsRow
+	for rows.Next() {
+		var i GetUserSecurityEventsRow
+		if err := rows.Scan(
+			&i.Uuid,
+			&i.CreatedAt,
+			&i.Kind,
+			&i.IpAddress,
+			&i.UserAgent,
+			&i.Details,
+			&i.ByAdmin,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,178 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: server_key.sql
+
+package query
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const createGameServerKey = `-- name: CreateGameServerKey :one
+insert into game_server_key (game_id, comment, lookup_prefix, key_hash, created_by_user_id)
+select g.id, $1, $2::text, $3::bytea, $4
+from game g
+where g.uuid = $5
+returning id, created_at, uuid, game_id, comment, lookup_prefix, key_hash, created_by_user_id, last_used_at
+`
+
+type CreateGameServerKeyParams struct {
+	Comment         string
+	LookupPrefix    string
+	KeyHash         []byte
+	CreatedByUserID pgtype.Int4
+	GameUuid        uuid.UUID
+}
+
+func (q *Queries) CreateGameServerKey(ctx context.Context, arg CreateGameServerKeyParams) (GameServerKey, error) {
+	row := q.db.QueryRow(ctx, createGameServerKey,
+		arg.Comment,
+		arg.LookupPrefix,
+		arg.KeyHash,
+		arg.CreatedByUserID,
+		arg.GameUuid,
+	)
+	var i GameServerKey
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.Uuid,
+		&i.GameID,
+		&i.Comment,
+		&i.LookupPrefix,
+		&i.KeyHash,
+		&i.CreatedByUserID,
+		&i.LastUsedAt,
+	)
+	return i, err
+}
+
+const deleteGameServerKey = `-- name: DeleteGameServerKey :execrows
+delete
+from game_server_key gsk
+using game g
+where gsk.game_id = g.id and g.uuid = $1 and gsk.uuid = $2
+`
+
+type DeleteGameServerKeyParams struct {
+	GameUuid uuid.UUID
+	KeyUuid  uuid.UUID
+}
+
+func (q *Queries) DeleteGameServerKey(ctx context.Context, arg DeleteGameServerKeyParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteGameServerKey, arg.GameUuid, arg.KeyUuid)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const findGameServerKey = `-- name: FindGameServerKey :one
+select gsk.uuid, gsk.key_hash, g.uuid as game_uuid
+from game_server_key gsk
+     join game g on gsk.game_id = g.id
+where gsk.lookup_prefix = $1::text
+`
+
+type FindGameServerKeyRow struct {
+	Uuid     uuid.UUID
+	KeyHash  []byte
+	GameUuid uuid.UUID
+}
+
+func (q *Queries) FindGameServerKey(ctx context.Context, lookupPrefix string) (FindGameServerKeyRow, error) {
+	row := q.db.QueryRow(ctx, findGameServerKey, lookupPrefix)
+	var i FindGameServerKeyRow
+	err := row.Scan(&i.Uuid, &i.KeyHash, &i.GameUuid)
+	return i, err
+}
+
+const getGameServerKeys = `-- name: GetGameServerKeys :many
+select gsk.id, gsk.created_at, gsk.uuid, gsk.game_id, gsk.comment, gsk.lookup_prefix, gsk.key_hash, gsk.created_by_user_id, gsk.last_used_at, u.slug as created_by_slug
+from game_server_key gsk
+     join game g on gsk.game_id = g.id
+     left outer join users u on gsk.created_by_user_id = u.id
+where g.uuid = $1
+order by gsk.uuid
+`
+
+type GetGameServerKeysRow struct {
+	ID              int32
+	CreatedAt       time.Time
+	Uuid            uuid.UUID
+	GameID          int32
+	Comment         string
+	LookupPrefix    string
+	KeyHash         []byte
+	CreatedByUserID pgtype.Int4
+	LastUsedAt      pgtype.Timestamptz
+	CreatedBySlug   *string
+}
+
+func (q *Queries) GetGameServerKeys(ctx context.Context, gameUuid uuid.UUID) ([]GetGameServerKeysRow, error) {
+	rows, err := q.db.Query(ctx, getGameServerKeys, gameUuid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetGameServerKeysRow
+	for rows.Next() {
+		var i GetGameServerKeysRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.Uuid,
+			&i.GameID,
+			&i.Comment,
+			&i.LookupPrefix,
+			&i.KeyHash,
+			&i.CreatedByUserID,
+			&i.LastUsedAt,
+			&i.CreatedBySlug,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const isGamePlayer = `-- name: IsGamePlayer :one
+select exists (select gt.id, gt.created_at, expires_at, gt.uuid, comment, user_id, game_id, scopes, lookup_prefix, token_hash, g.id, g.created_at, g.updated_at, developer_id, g.uuid, g.slug, server_only_progress, require_signed_progress, u.id, u.created_at, u.updated_at, u.uuid, u.slug, bio_text, pronouns, country
+               from game_token gt
+                    join game g on gt.game_id = g.id
+                    join users u on gt.user_id = u.id
+               where g.uuid = $1 and u.uuid = $2)
+`
+
+type IsGamePlayerParams struct {
+	GameUuid uuid.UUID
+	UserUuid uuid.UUID
+}
+
+// players have connected their account to the game by creating a game token for it
+func (q *Queries) IsGamePlayer(ctx context.Context, arg IsGamePlayerParams) (bool, error) {
+	row := q.db.QueryRow(ctx, isGamePlayer, arg.GameUuid, arg.UserUuid)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const touchGameServerKey = `-- name: TouchGameServerKey :exec
+update game_server_key
+set last_used_at = now()
+where uuid = $1
+`
+
+func (q *Queries) TouchGameServerKey(ctx context.Context, argUuid uuid.UUID) error {
+	_, err := q.db.Exec(ctx, touchGameServerKey, argUuid)
+	return err
+}
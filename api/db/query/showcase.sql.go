@@ -0,0 +1,242 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: showcase.sql
+
+package query
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const addUserShowcaseAchievement = `-- name: AddUserShowcaseAchievement :exec
+insert into user_showcase_achievement (user_id, slot, achievement_id)
+values ($1, $2, $3)
+`
+
+type AddUserShowcaseAchievementParams struct {
+	UserID        int32
+	Slot          int16
+	AchievementID int32
+}
+
+func (q *Queries) AddUserShowcaseAchievement(ctx context.Context, arg AddUserShowcaseAchievementParams) error {
+	_, err := q.db.Exec(ctx, addUserShowcaseAchievement, arg.UserID, arg.Slot, arg.AchievementID)
+	return err
+}
+
+const addUserShowcaseGame = `-- name: AddUserShowcaseGame :exec
+insert into user_showcase_game (user_id, slot, game_id)
+values ($1, $2, $3)
+`
+
+type AddUserShowcaseGameParams struct {
+	UserID int32
+	Slot   int16
+	GameID int32
+}
+
+func (q *Queries) AddUserShowcaseGame(ctx context.Context, arg AddUserShowcaseGameParams) error {
+	_, err := q.db.Exec(ctx, addUserShowcaseGame, arg.UserID, arg.Slot, arg.GameID)
+	return err
+}
+
+const clearUserShowcaseAchievements = `-- name: ClearUserShowcaseAchievements :exec
+delete
+from user_showcase_achievement
+where user_id = $1
+`
+
+func (q *Queries) ClearUserShowcaseAchievements(ctx context.Context, userID int32) error {
+	_, err := q.db.Exec(ctx, clearUserShowcaseAchievements, userID)
+	return err
+}
+
+const clearUserShowcaseGames = `-- name: ClearUserShowcaseGames :exec
+delete
+from user_showcase_game
+where user_id = $1
+`
+
+func (q *Queries) ClearUserShowcaseGames(ctx context.Context, userID int32) error {
+	_, err := q.db.Exec(ctx, clearUserShowcaseGames, userID)
+	return err
+}
+
+const findUserPlayedGame = `-- name: FindUserPlayedGame :one
+select g.id
+from game g
+where g.uuid = $1
+  and exists (select id, created_at, uuid, game_id, user_id, game_token_id, last_pulse_at, ended_at, game_token_hash from game_session gs where gs.game_id = g.id and gs.user_id = $2)
+`
+
+type FindUserPlayedGameParams struct {
+	GameUuid uuid.UUID
+	UserID   int32
+}
+
+func (q *Queries) FindUserPlayedGame(ctx context.Context, arg FindUserPlayedGameParams) (int32, error) {
+	row := q.db.QueryRow(ctx, findUserPlayedGame, arg.GameUuid, arg.UserID)
+	var id int32
+	err := row.Scan(&id)
+	return id, err
+}
+
+const findUserUnlockedAchievement = `-- name: FindUserUnlockedAchievement :one
+select a.id
+from achievement a
+     join game g on a.game_id = g.id
+     join achievement_progress ap on a.id = ap.achievement_id and ap.progress >= a.progress_requirement
+where g.uuid = $1 and a.slug = $2 and ap.user_id = $3 and ap.revoked_at is null
+`
+
+type FindUserUnlockedAchievementParams struct {
+	GameUuid uuid.UUID
+	Slug     string
+	UserID   int32
+}
+
+func (q *Queries) FindUserUnlockedAchievement(ctx context.Context, arg FindUserUnlockedAchievementParams) (int32, error) {
+	row := q.db.QueryRow(ctx, findUserUnlockedAchievement, arg.GameUuid, arg.Slug, arg.UserID)
+	var id int32
+	err := row.Scan(&id)
+	return id, err
+}
+
+const getUserShowcase = `-- name: GetUserShowcase :one
+select us.hidden_sections, g.uuid as featured_game_uuid
+from user_showcase us
+     join users u on us.user_id = u.id
+     left join game g on us.featured_game_id = g.id
+where u.uuid = $1
+`
+
+type GetUserShowcaseRow struct {
+	HiddenSections   []string
+	FeaturedGameUuid uuid.NullUUID
+}
+
+func (q *Queries) GetUserShowcase(ctx context.Context, userUuid uuid.UUID) (GetUserShowcaseRow, error) {
+	row := q.db.QueryRow(ctx, getUserShowcase, userUuid)
+	var i GetUserShowcaseRow
+	err := row.Scan(&i.HiddenSections, &i.FeaturedGameUuid)
+	return i, err
+}
+
+const getUserShowcaseAchievements = `-- name: GetUserShowcaseAchievements :many
+select usa.slot,
+       g.uuid as game_uuid,
+       a.slug,
+       a.name,
+       a.description,
+       coalesce(ar.completion_percent, 0)::double precision as rarity
+from user_showcase_achievement usa
+     join users u on usa.user_id = u.id
+     join achievement a on usa.achievement_id = a.id
+     join game g on a.game_id = g.id
+     left join achievement_rarity ar on a.id = ar.id
+where u.uuid = $1
+order by usa.slot
+`
+
+type GetUserShowcaseAchievementsRow struct {
+	Slot        int16
+	GameUuid    uuid.UUID
+	Slug        string
+	Name        string
+	Description string
+	Rarity      float64
+}
+
+func (q *Queries) GetUserShowcaseAchievements(ctx context.Context, userUuid uuid.UUID) ([]GetUserShowcaseAchievementsRow, error) {
+	rows, err := q.db.Query(ctx, getUserShowcaseAchievements, userUuid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUserShowcaseAchievementsRow
+	for rows.Next() {
+		var i GetUserShowcaseAchievementsRow
+		if err := rows.Scan(
+			&i.Slot,
+			&i.GameUuid,
+			&i.Slug,
+			&i.Name,
+			&i.Description,
+			&i.Rarity,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUserShowcaseGames = `-- name: GetUserShowcaseGames :many
+select usg.slot,
+       g.uuid as game_uuid,
+       coalesce(gc.unlock_count, 0)::bigint as unlock_count,
+       (select count(*) from achievement ga where ga.game_id = g.id) as achievement_count
+from user_showcase_game usg
+     join users u on usg.user_id = u.id
+     join game g on usg.game_id = g.id
+     left join game_completion gc on g.id = gc.game_id and u.id = gc.user_id
+where u.uuid = $1
+order by usg.slot
+`
+
+type GetUserShowcaseGamesRow struct {
+	Slot             int16
+	GameUuid         uuid.UUID
+	UnlockCount      int64
+	AchievementCount int64
+}
+
+func (q *Queries) GetUserShowcaseGames(ctx context.Context, userUuid uuid.UUID) ([]GetUserShowcaseGamesRow, error) {
+	rows, err := q.db.Query(ctx, getUserShowcaseGames, userUuid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUserShowcaseGamesRow
+	for rows.Next() {
+		var i GetUserShowcaseGamesRow
+		if err := rows.Scan(
+			&i.Slot,
+			&i.GameUuid,
+			&i.UnlockCount,
+			&i.AchievementCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const upsertUserShowcase = `-- name: UpsertUserShowcase :exec
+insert into user_showcase (user_id, featured_game_id, hidden_sections)
+values ($1, $2, $3::text[])
+on conflict (user_id) do update set featured_game_id = excluded.featured_game_id,
+                                    hidden_sections  = excluded.hidden_sections
+`
+
+type UpsertUserShowcaseParams struct {
+	UserID         int32
+	FeaturedGameID pgtype.Int4
+	HiddenSections []string
+}
+
+func (q *Queries) UpsertUserShowcase(ctx context.Context, arg UpsertUserShowcaseParams) error {
+	_, err := q.db.Exec(ctx, upsertUserShowcase, arg.UserID, arg.FeaturedGameID, arg.HiddenSections)
+	return err
+}
@@ -14,30 +14,38 @@ import (
 
 const createGameToken = `-- name: CreateGameToken :one
 with target_user as (
-    select id from users where users.uuid = $3
+    select id from users where users.uuid = $6
 ), target_game as (
     select g.id, g.uuid, g.slug, d.slug as developer_slug
     from game g
     join developer d on g.developer_id = d.id
-    where g.uuid = $4
+    where g.uuid = $7
 )
-insert into game_token (expires_at, comment, game_id, user_id)
-values ($1, $2, (select id from target_game), (select id from target_user))
+insert into game_token (expires_at, comment, scopes, lookup_prefix, token_hash, game_id, user_id)
+values ($1, $2, $3::text[], $4::text, $5::bytea, (select id from target_game),
+        (select id from target_user))
+on conflict (lookup_prefix) do nothing
 returning
     game_token.uuid,
     game_token.expires_at,
     game_token.created_at,
     game_token.comment,
+    game_token.scopes,
+    game_token.lookup_prefix::text as lookup_prefix,
+    game_token.user_id,
     (select uuid as game_uuid from target_game),
     (select slug as game_slug from target_game),
     (select developer_slug from target_game)
 `
 
 type CreateGameTokenParams struct {
-	ExpiresAt time.Time
-	Comment   string
-	UserUuid  uuid.UUID
-	GameUuid  uuid.UUID
+	ExpiresAt    time.Time
+	Comment      string
+	Scopes       []string
+	LookupPrefix string
+	TokenHash    []byte
+	UserUuid     uuid.UUID
+	GameUuid     uuid.UUID
 }
 
 type CreateGameTokenRow struct {
@@ -45,15 +53,22 @@ type CreateGameTokenRow struct {
 	ExpiresAt     time.Time
 	CreatedAt     time.Time
 	Comment       string
+	Scopes        []string
+	LookupPrefix  string
+	UserID        int32
 	GameUuid      uuid.UUID
 	GameSlug      string
 	DeveloperSlug string
 }
 
+// nothing is returned if the lookup prefix collides, rather than failing the transaction the token is created in
 func (q *Queries) CreateGameToken(ctx context.Context, arg CreateGameTokenParams) (CreateGameTokenRow, error) {
 	row := q.db.QueryRow(ctx, createGameToken,
 		arg.ExpiresAt,
 		arg.Comment,
+		arg.Scopes,
+		arg.LookupPrefix,
+		arg.TokenHash,
 		arg.UserUuid,
 		arg.GameUuid,
 	)
@@ -63,6 +78,9 @@ func (q *Queries) CreateGameToken(ctx context.Context, arg CreateGameTokenParams
 		&i.ExpiresAt,
 		&i.CreatedAt,
 		&i.Comment,
+		&i.Scopes,
+		&i.LookupPrefix,
+		&i.UserID,
 		&i.GameUuid,
 		&i.GameSlug,
 		&i.DeveloperSlug,
@@ -71,9 +89,10 @@ func (q *Queries) CreateGameToken(ctx context.Context, arg CreateGameTokenParams
 }
 
 const createToken = `-- name: CreateToken :one
-insert into token (issuer, subject, audience, expires_at, not_before, issued_at)
-values ($1, $2, $3, $4, $5, $6)
-returning id, issuer, subject, audience, expires_at, not_before, issued_at
+insert into token (issuer, subject, audience, expires_at, not_before, issued_at, ip_address, user_agent)
+values ($1, $2, $3, $4, $5, $6, $7,
+        $8)
+returning id, issuer, subject, audience, expires_at, not_before, issued_at, ip_address, user_agent, last_seen_at
 `
 
 type CreateTokenParams struct {
@@ -83,6 +102,8 @@ type CreateTokenParams struct {
 	ExpiresAt time.Time
 	NotBefore time.Time
 	IssuedAt  time.Time
+	IpAddress *string
+	UserAgent *string
 }
 
 func (q *Queries) CreateToken(ctx context.Context, arg CreateTokenParams) (Token, error) {
@@ -93,6 +114,8 @@ func (q *Queries) CreateToken(ctx context.Context, arg CreateTokenParams) (Token
 		arg.ExpiresAt,
 		arg.NotBefore,
 		arg.IssuedAt,
+		arg.IpAddress,
+		arg.UserAgent,
 	)
 	var i Token
 	err := row.Scan(
@@ -103,10 +126,43 @@ func (q *Queries) CreateToken(ctx context.Context, arg CreateTokenParams) (Token
 		&i.ExpiresAt,
 		&i.NotBefore,
 		&i.IssuedAt,
+		&i.IpAddress,
+		&i.UserAgent,
+		&i.LastSeenAt,
 	)
 	return i, err
 }
 
+const deleteExpiredDisallowedTokens = `-- name: DeleteExpiredDisallowedTokens :execrows
+delete
+from token_disallow_list tdl
+    using token t
+where tdl.token_id = t.id and t.expires_at < $1
+`
+
+func (q *Queries) DeleteExpiredDisallowedTokens(ctx context.Context, expiredBefore time.Time) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteExpiredDisallowedTokens, expiredBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteExpiredTokens = `-- name: DeleteExpiredTokens :execrows
+delete
+from token t
+where t.expires_at < $1
+  and not exists (select token_id, created_at from token_disallow_list tdl where tdl.token_id = t.id)
+`
+
+func (q *Queries) DeleteExpiredTokens(ctx context.Context, expiredBefore time.Time) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteExpiredTokens, expiredBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const disallowToken = `-- name: DisallowToken :exec
 insert into token_disallow_list (token_id) values ($1)
 `
@@ -117,10 +173,20 @@ func (q *Queries) DisallowToken(ctx context.Context, tokenID uuid.UUID) error {
 }
 
 const expireToken = `-- name: ExpireToken :execrows
-delete
-from game_token gt
-where gt.user_id = (select u.id from users u where u.uuid = $1)
-  and gt.uuid = $2
+with target_token as (
+    select gt.id
+    from game_token gt
+    where gt.user_id = (select u.id from users u where u.uuid = $1)
+      and gt.uuid = $2
+      and gt.expires_at > now()
+), ended_sessions as (
+    update game_session gs
+    set ended_at = now()
+    where gs.game_token_id = (select id from target_token) and gs.ended_at is null
+)
+update game_token gt
+set expires_at = now()
+where gt.id = (select id from target_token)
 `
 
 type ExpireTokenParams struct {
@@ -128,6 +194,7 @@ type ExpireTokenParams struct {
 	Uuid     uuid.UUID
 }
 
+// the token is expired rather than deleted since its game sessions still refer to it, and they're ended along with it
 func (q *Queries) ExpireToken(ctx context.Context, arg ExpireTokenParams) (int64, error) {
 	result, err := q.db.Exec(ctx, expireToken, arg.UserUuid, arg.Uuid)
 	if err != nil {
@@ -136,29 +203,68 @@ func (q *Queries) ExpireToken(ctx context.Context, arg ExpireTokenParams) (int64
 	return result.RowsAffected(), nil
 }
 
+const findLegacyTokenWithUser = `-- name: FindLegacyTokenWithUser :one
+select gt.uuid, gt.token_hash, gt.scopes, u.uuid as user_uuid, g.uuid as game_uuid
+from game_token gt
+join game g on gt.game_id = g.id
+join users u on gt.user_id = u.id
+where gt.uuid = $1 and gt.token_hash is null and gt.expires_at > now()
+limit 1
+`
+
+type FindLegacyTokenWithUserRow struct {
+	Uuid      uuid.UUID
+	TokenHash []byte
+	Scopes    []string
+	UserUuid  uuid.UUID
+	GameUuid  uuid.UUID
+}
+
+func (q *Queries) FindLegacyTokenWithUser(ctx context.Context, argUuid uuid.UUID) (FindLegacyTokenWithUserRow, error) {
+	row := q.db.QueryRow(ctx, findLegacyTokenWithUser, argUuid)
+	var i FindLegacyTokenWithUserRow
+	err := row.Scan(
+		&i.Uuid,
+		&i.TokenHash,
+		&i.Scopes,
+		&i.UserUuid,
+		&i.GameUuid,
+	)
+	return i, err
+}
+
 const findTokenWithUser = `-- name: FindTokenWithUser :one
-select u.uuid as user_uuid, g.uuid as game_uuid
+select gt.uuid, gt.token_hash, gt.scopes, u.uuid as user_uuid, g.uuid as game_uuid
 from game_token gt
 join game g on gt.game_id = g.id
 join users u on gt.user_id = u.id
-where gt.uuid = $1 and gt.expires_at > now()
+where gt.lookup_prefix = $1::text and gt.expires_at > now()
 limit 1
 `
 
 type FindTokenWithUserRow struct {
-	UserUuid uuid.UUID
-	GameUuid uuid.UUID
+	Uuid      uuid.UUID
+	TokenHash []byte
+	Scopes    []string
+	UserUuid  uuid.UUID
+	GameUuid  uuid.UUID
 }
 
-func (q *Queries) FindTokenWithUser(ctx context.Context, argUuid uuid.UUID) (FindTokenWithUserRow, error) {
-	row := q.db.QueryRow(ctx, findTokenWithUser, argUuid)
+func (q *Queries) FindTokenWithUser(ctx context.Context, lookupPrefix string) (FindTokenWithUserRow, error) {
+	row := q.db.QueryRow(ctx, findTokenWithUser, lookupPrefix)
 	var i FindTokenWithUserRow
-	err := row.Scan(&i.UserUuid, &i.GameUuid)
+	err := row.Scan(
+		&i.Uuid,
+		&i.TokenHash,
+		&i.Scopes,
+		&i.UserUuid,
+		&i.GameUuid,
+	)
 	return i, err
 }
 
 const findUserGameTokens = `-- name: FindUserGameTokens :many
-select gt.created_at, gt.expires_at, gt.uuid, gt.comment, g.uuid as game_uuid, g.slug as game_slug, d.slug as developer_slug
+select gt.created_at, gt.expires_at, gt.uuid, gt.comment, gt.scopes, gt.lookup_prefix, g.uuid as game_uuid, g.slug as game_slug, d.slug as developer_slug
 from game_token gt
 join game g on gt.game_id = g.id
 join developer d on g.developer_id = d.id -- TODO: developer_latest_display_name
@@ -171,6 +277,8 @@ type FindUserGameTokensRow struct {
 	ExpiresAt     time.Time
 	Uuid          uuid.UUID
 	Comment       string
+	Scopes        []string
+	LookupPrefix  *string
 	GameUuid      uuid.UUID
 	GameSlug      string
 	DeveloperSlug string
@@ -190,6 +298,8 @@ func (q *Queries) FindUserGameTokens(ctx context.Context, userUuid uuid.UUID) ([
 			&i.ExpiresAt,
 			&i.Uuid,
 			&i.Comment,
+			&i.Scopes,
+			&i.LookupPrefix,
 			&i.GameUuid,
 			&i.GameSlug,
 			&i.DeveloperSlug,
@@ -203,3 +313,108 @@ func (q *Queries) FindUserGameTokens(ctx context.Context, userUuid uuid.UUID) ([
 	}
 	return items, nil
 }
+
+const getUserSessionTokens = `-- name: GetUserSessionTokens :many
+select t.id, t.issuer, t.subject, t.audience, t.expires_at, t.not_before, t.issued_at, t.ip_address, t.user_agent, t.last_seen_at
+from token t
+where t.subject = $1 and t.audience = $2 and t.expires_at > now()
+  and not exists (select token_id, created_at from token_disallow_list tdl where tdl.token_id = t.id)
+order by coalesce(t.last_seen_at, t.issued_at) desc
+`
+
+type GetUserSessionTokensParams struct {
+	Subject  string
+	Audience string
+}
+
+func (q *Queries) GetUserSessionTokens(ctx context.Context, arg GetUserSessionTokensParams) ([]Token, error) {
+	rows, err := q.db.Query(ctx, getUserSessionTokens, arg.Subject, arg.Audience)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Token
+	for rows.Next() {
+		var i Token
+		if err := rows.Scan(
+			&i.ID,
+			&i.Issuer,
+			&i.Subject,
+			&i.Audience,
+			&i.ExpiresAt,
+			&i.NotBefore,
+			&i.IssuedAt,
+			&i.IpAddress,
+			&i.UserAgent,
+			&i.LastSeenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const isTokenDisallowed = `-- name: IsTokenDisallowed :one
+select exists (select token_id, created_at from token_disallow_list tdl where tdl.token_id = $1)
+`
+
+func (q *Queries) IsTokenDisallowed(ctx context.Context, tokenID uuid.UUID) (bool, error) {
+	row := q.db.QueryRow(ctx, isTokenDisallowed, tokenID)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const rotateGameToken = `-- name: RotateGameToken :execrows
+with target_token as (
+    select gt.id
+    from game_token gt
+    where gt.user_id = (select u.id from users u where u.uuid = $3)
+      and gt.uuid = $4
+      and gt.expires_at > now()
+), ended_sessions as (
+    update game_session gs
+    set ended_at = now()
+    where gs.game_token_id = (select id from target_token) and gs.ended_at is null
+)
+update game_token gt
+set lookup_prefix = $1::text,
+    token_hash    = $2::bytea
+where gt.id = (select id from target_token)
+`
+
+type RotateGameTokenParams struct {
+	LookupPrefix string
+	TokenHash    []byte
+	UserUuid     uuid.UUID
+	Uuid         uuid.UUID
+}
+
+// the sessions started with the old secret are ended along with it
+func (q *Queries) RotateGameToken(ctx context.Context, arg RotateGameTokenParams) (int64, error) {
+	result, err := q.db.Exec(ctx, rotateGameToken,
+		arg.LookupPrefix,
+		arg.TokenHash,
+		arg.UserUuid,
+		arg.Uuid,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const touchToken = `-- name: TouchToken :exec
+update token
+set last_seen_at = now()
+where id = $1
+`
+
+func (q *Queries) TouchToken(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.Exec(ctx, touchToken, id)
+	return err
+}
@@ -13,7 +13,7 @@ import (
 )
 
 const addUser = `-- name: AddUser :one
-insert into users (slug) values ($1) returning id, created_at, updated_at, uuid, slug
+insert into users (slug) values ($1) returning id, created_at, updated_at, uuid, slug, bio_text, pronouns, country
 `
 
 func (q *Queries) AddUser(ctx context.Context, slug string) (User, error) {
@@ -25,6 +25,9 @@ func (q *Queries) AddUser(ctx context.Context, slug string) (User, error) {
 		&i.UpdatedAt,
 		&i.Uuid,
 		&i.Slug,
+		&i.BioText,
+		&i.Pronouns,
+		&i.Country,
 	)
 	return i, err
 }
@@ -72,7 +75,7 @@ func (q *Queries) AddUserSlugHistory(ctx context.Context, arg AddUserSlugHistory
 }
 
 const allUsersWithDisplayNames = `-- name: AllUsersWithDisplayNames :many
-select u.id, u.created_at, u.updated_at, u.uuid, u.slug, uldn.display_name
+select u.id, u.created_at, u.updated_at, u.uuid, u.slug, u.bio_text, u.pronouns, u.country, uldn.display_name
 from users u
     left outer join user_latest_display_name uldn on u.id = uldn.user_id
 `
@@ -83,6 +86,9 @@ type AllUsersWithDisplayNamesRow struct {
 	UpdatedAt   time.Time
 	Uuid        uuid.UUID
 	Slug        string
+	BioText     *string
+	Pronouns    *string
+	Country     *string
 	DisplayName *string
 }
 
@@ -101,6 +107,9 @@ func (q *Queries) AllUsersWithDisplayNames(ctx context.Context) ([]AllUsersWithD
 			&i.UpdatedAt,
 			&i.Uuid,
 			&i.Slug,
+			&i.BioText,
+			&i.Pronouns,
+			&i.Country,
 			&i.DisplayName,
 		); err != nil {
 			return nil, err
@@ -113,8 +122,22 @@ func (q *Queries) AllUsersWithDisplayNames(ctx context.Context) ([]AllUsersWithD
 	return items, nil
 }
 
+const deleteUserPassword = `-- name: DeleteUserPassword :execrows
+delete
+from user_password
+where user_id = $1
+`
+
+func (q *Queries) DeleteUserPassword(ctx context.Context, userID int32) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteUserPassword, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const findUser = `-- name: FindUser :one
-select id, created_at, updated_at, uuid, slug from users where users.uuid = $1 limit 1
+select id, created_at, updated_at, uuid, slug, bio_text, pronouns, country from users where users.uuid = $1 limit 1
 `
 
 func (q *Queries) FindUser(ctx context.Context, argUuid uuid.UUID) (User, error) {
@@ -126,12 +149,15 @@ func (q *Queries) FindUser(ctx context.Context, argUuid uuid.UUID) (User, error)
 		&i.UpdatedAt,
 		&i.Uuid,
 		&i.Slug,
+		&i.BioText,
+		&i.Pronouns,
+		&i.Country,
 	)
 	return i, err
 }
 
 const findUserById = `-- name: FindUserById :one
-select id, created_at, updated_at, uuid, slug from users where users.id = $1 limit 1
+select id, created_at, updated_at, uuid, slug, bio_text, pronouns, country from users where users.id = $1 limit 1
 `
 
 func (q *Queries) FindUserById(ctx context.Context, userID int32) (User, error) {
@@ -143,12 +169,15 @@ func (q *Queries) FindUserById(ctx context.Context, userID int32) (User, error)
 		&i.UpdatedAt,
 		&i.Uuid,
 		&i.Slug,
+		&i.BioText,
+		&i.Pronouns,
+		&i.Country,
 	)
 	return i, err
 }
 
 const findUserBySlug = `-- name: FindUserBySlug :one
-select id, created_at, updated_at, uuid, slug from users where slug = $1 limit 1
+select id, created_at, updated_at, uuid, slug, bio_text, pronouns, country from users where slug = $1 limit 1
 `
 
 func (q *Queries) FindUserBySlug(ctx context.Context, slug string) (User, error) {
@@ -160,12 +189,15 @@ func (q *Queries) FindUserBySlug(ctx context.Context, slug string) (User, error)
 		&i.UpdatedAt,
 		&i.Uuid,
 		&i.Slug,
+		&i.BioText,
+		&i.Pronouns,
+		&i.Country,
 	)
 	return i, err
 }
 
 const findUserBySlugWithPassword = `-- name: FindUserBySlugWithPassword :one
-select u.id, u.created_at, u.updated_at, u.uuid, u.slug, up.encoded_hash
+select u.id, u.created_at, u.updated_at, u.uuid, u.slug, u.bio_text, u.pronouns, u.country, up.encoded_hash
 from users u
      join user_password up on u.id = up.user_id
 where u.slug = $1
@@ -178,6 +210,9 @@ type FindUserBySlugWithPasswordRow struct {
 	UpdatedAt   time.Time
 	Uuid        uuid.UUID
 	Slug        string
+	BioText     *string
+	Pronouns    *string
+	Country     *string
 	EncodedHash string
 }
 
@@ -190,11 +225,48 @@ func (q *Queries) FindUserBySlugWithPassword(ctx context.Context, slug string) (
 		&i.UpdatedAt,
 		&i.Uuid,
 		&i.Slug,
+		&i.BioText,
+		&i.Pronouns,
+		&i.Country,
 		&i.EncodedHash,
 	)
 	return i, err
 }
 
+const findUserLink = `-- name: FindUserLink :one
+select ul.id, ul.created_at, ul.uuid, ul.user_id, ul.position, ul.url, ul.checked_at, ul.verified_at, u.slug as user_slug
+from user_link ul
+     join users u on ul.user_id = u.id
+where ul.user_id = $1 and ul.uuid = $2
+`
+
+type FindUserLinkParams struct {
+	UserID   int32
+	LinkUuid uuid.UUID
+}
+
+type FindUserLinkRow struct {
+	UserLink UserLink
+	UserSlug string
+}
+
+func (q *Queries) FindUserLink(ctx context.Context, arg FindUserLinkParams) (FindUserLinkRow, error) {
+	row := q.db.QueryRow(ctx, findUserLink, arg.UserID, arg.LinkUuid)
+	var i FindUserLinkRow
+	err := row.Scan(
+		&i.UserLink.ID,
+		&i.UserLink.CreatedAt,
+		&i.UserLink.Uuid,
+		&i.UserLink.UserID,
+		&i.UserLink.Position,
+		&i.UserLink.Url,
+		&i.UserLink.CheckedAt,
+		&i.UserLink.VerifiedAt,
+		&i.UserSlug,
+	)
+	return i, err
+}
+
 const getUserDevelopers = `-- name: GetUserDevelopers :many
 select d.slug, d.created_at, dm.created_at as joined_at
 from developer_member dm
@@ -306,7 +378,7 @@ select
     ua.blurhash as avatar_blurhash
 from users u
      left outer join user_latest_display_name uldn on u.id = uldn.user_id
-     left outer join user_avatar ua on u.id = ua.user_id
+     left outer join user_current_avatar ua on u.id = ua.user_id
 where u.uuid = $1
 limit 1
 `
@@ -372,6 +444,103 @@ func (q *Queries) GetUserWithName(ctx context.Context, userUuid uuid.UUID) (GetU
 	return i, err
 }
 
+const getUsersLinks = `-- name: GetUsersLinks :many
+select u.uuid as user_uuid, ul.id, ul.created_at, ul.uuid, ul.user_id, ul.position, ul.url, ul.checked_at, ul.verified_at
+from user_link ul
+     join users u on ul.user_id = u.id
+where u.uuid = any($1::uuid[])
+order by ul.user_id, ul.position
+`
+
+type GetUsersLinksRow struct {
+	UserUuid uuid.UUID
+	UserLink UserLink
+}
+
+func (q *Queries) GetUsersLinks(ctx context.Context, userUuids []uuid.UUID) ([]GetUsersLinksRow, error) {
+	rows, err := q.db.Query(ctx, getUsersLinks, userUuids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUsersLinksRow
+	for rows.Next() {
+		var i GetUsersLinksRow
+		if err := rows.Scan(
+			&i.UserUuid,
+			&i.UserLink.ID,
+			&i.UserLink.CreatedAt,
+			&i.UserLink.Uuid,
+			&i.UserLink.UserID,
+			&i.UserLink.Position,
+			&i.UserLink.Url,
+			&i.UserLink.CheckedAt,
+			&i.UserLink.VerifiedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUsersProfileFields = `-- name: GetUsersProfileFields :many
+select u.uuid, u.bio_text, u.pronouns, u.country
+from users u
+where u.uuid = any($1::uuid[])
+`
+
+type GetUsersProfileFieldsRow struct {
+	Uuid     uuid.UUID
+	BioText  *string
+	Pronouns *string
+	Country  *string
+}
+
+func (q *Queries) GetUsersProfileFields(ctx context.Context, userUuids []uuid.UUID) ([]GetUsersProfileFieldsRow, error) {
+	rows, err := q.db.Query(ctx, getUsersProfileFields, userUuids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUsersProfileFieldsRow
+	for rows.Next() {
+		var i GetUsersProfileFieldsRow
+		if err := rows.Scan(
+			&i.Uuid,
+			&i.BioText,
+			&i.Pronouns,
+			&i.Country,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const removeUserLinksExcept = `-- name: RemoveUserLinksExcept :exec
+delete
+from user_link
+where user_id = $1 and not (url = any($2::text[]))
+`
+
+type RemoveUserLinksExceptParams struct {
+	UserID int32
+	Urls   []string
+}
+
+func (q *Queries) RemoveUserLinksExcept(ctx context.Context, arg RemoveUserLinksExceptParams) error {
+	_, err := q.db.Exec(ctx, removeUserLinksExcept, arg.UserID, arg.Urls)
+	return err
+}
+
 const replacePassword = `-- name: ReplacePassword :exec
 update user_password
     set encoded_hash = $1
@@ -388,6 +557,23 @@ func (q *Queries) ReplacePassword(ctx context.Context, arg ReplacePasswordParams
 	return err
 }
 
+const setUserLinkVerified = `-- name: SetUserLinkVerified :exec
+update user_link
+set checked_at  = now(),
+    verified_at = case when $1::boolean then coalesce(verified_at, now()) end
+where id = $2
+`
+
+type SetUserLinkVerifiedParams struct {
+	Verified bool
+	ID       int32
+}
+
+func (q *Queries) SetUserLinkVerified(ctx context.Context, arg SetUserLinkVerifiedParams) error {
+	_, err := q.db.Exec(ctx, setUserLinkVerified, arg.Verified, arg.ID)
+	return err
+}
+
 const updateSessionProfile = `-- name: UpdateSessionProfile :exec
 with target_user as (
     select u1.id, u1.slug as old_slug, uldn.display_name as latest_display_name
@@ -416,3 +602,45 @@ func (q *Queries) UpdateSessionProfile(ctx context.Context, arg UpdateSessionPro
 	_, err := q.db.Exec(ctx, updateSessionProfile, arg.NewDisplayName, arg.Uuid, arg.NewSlug)
 	return err
 }
+
+const updateUserProfileFields = `-- name: UpdateUserProfileFields :exec
+update users
+set bio_text = case when $1::text is null then bio_text else nullif($1::text, '') end,
+    pronouns = case when $2::text is null then pronouns else nullif($2::text, '') end,
+    country  = case when $3::text is null then country else nullif($3::text, '') end
+where id = $4
+`
+
+type UpdateUserProfileFieldsParams struct {
+	BioText  *string
+	Pronouns *string
+	Country  *string
+	UserID   int32
+}
+
+func (q *Queries) UpdateUserProfileFields(ctx context.Context, arg UpdateUserProfileFieldsParams) error {
+	_, err := q.db.Exec(ctx, updateUserProfileFields,
+		arg.BioText,
+		arg.Pronouns,
+		arg.Country,
+		arg.UserID,
+	)
+	return err
+}
+
+const upsertUserLinks = `-- name: UpsertUserLinks :exec
+insert into user_link (user_id, url, position)
+select $1, links.url, links.position
+from unnest($2::text[]) with ordinality as links(url, position)
+on conflict (user_id, url) do update set position = excluded.position
+`
+
+type UpsertUserLinksParams struct {
+	UserID int32
+	Urls   []string
+}
+
+func (q *Queries) UpsertUserLinks(ctx context.Context, arg UpsertUserLinksParams) error {
+	_, err := q.db.Exec(ctx, upsertUserLinks, arg.UserID, arg.Urls)
+	return err
+}
@@ -0,0 +1,216 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: webauthn.sql
+
+package query
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const addWebAuthnCredential = `-- name: AddWebAuthnCredential :one
+insert into webauthn_credential (user_id, credential_id, name, credential)
+values ($1, $2, $3, $4)
+returning id, created_at, uuid, user_id, credential_id, name, credential, last_used_at
+`
+
+type AddWebAuthnCredentialParams struct {
+	UserID       int32
+	CredentialID []byte
+	Name         string
+	Credential   []byte
+}
+
+func (q *Queries) AddWebAuthnCredential(ctx context.Context, arg AddWebAuthnCredentialParams) (WebauthnCredential, error) {
+	row := q.db.QueryRow(ctx, addWebAuthnCredential,
+		arg.UserID,
+		arg.CredentialID,
+		arg.Name,
+		arg.Credential,
+	)
+	var i WebauthnCredential
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.Uuid,
+		&i.UserID,
+		&i.CredentialID,
+		&i.Name,
+		&i.Credential,
+		&i.LastUsedAt,
+	)
+	return i, err
+}
+
+const createWebAuthnCeremony = `-- name: CreateWebAuthnCeremony :one
+insert into webauthn_ceremony (user_id, kind, session_data, expires_at)
+values ($1, $2, $3, $4)
+returning uuid
+`
+
+type CreateWebAuthnCeremonyParams struct {
+	UserID      pgtype.Int4
+	Kind        string
+	SessionData []byte
+	ExpiresAt   time.Time
+}
+
+func (q *Queries) CreateWebAuthnCeremony(ctx context.Context, arg CreateWebAuthnCeremonyParams) (uuid.UUID, error) {
+	row := q.db.QueryRow(ctx, createWebAuthnCeremony,
+		arg.UserID,
+		arg.Kind,
+		arg.SessionData,
+		arg.ExpiresAt,
+	)
+	var uuid uuid.UUID
+	err := row.Scan(&uuid)
+	return uuid, err
+}
+
+const deleteExpiredWebAuthnCeremonies = `-- name: DeleteExpiredWebAuthnCeremonies :exec
+delete
+from webauthn_ceremony
+where expires_at <= now()
+`
+
+func (q *Queries) DeleteExpiredWebAuthnCeremonies(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, deleteExpiredWebAuthnCeremonies)
+	return err
+}
+
+const deleteWebAuthnCredential = `-- name: DeleteWebAuthnCredential :execrows
+delete
+from webauthn_credential
+where user_id = $1 and uuid = $2
+`
+
+type DeleteWebAuthnCredentialParams struct {
+	UserID         int32
+	CredentialUuid uuid.UUID
+}
+
+func (q *Queries) DeleteWebAuthnCredential(ctx context.Context, arg DeleteWebAuthnCredentialParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteWebAuthnCredential, arg.UserID, arg.CredentialUuid)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const getUserWebAuthnCredentials = `-- name: GetUserWebAuthnCredentials :many
+select id, created_at, uuid, user_id, credential_id, name, credential, last_used_at
+from webauthn_credential
+where user_id = $1
+order by id
+`
+
+func (q *Queries) GetUserWebAuthnCredentials(ctx context.Context, userID int32) ([]WebauthnCredential, error) {
+	rows, err := q.db.Query(ctx, getUserWebAuthnCredentials, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebauthnCredential
+	for rows.Next() {
+		var i WebauthnCredential
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.Uuid,
+			&i.UserID,
+			&i.CredentialID,
+			&i.Name,
+			&i.Credential,
+			&i.LastUsedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getWebAuthnCredentialsByUserUuid = `-- name: GetWebAuthnCredentialsByUserUuid :many
+select wc.id, wc.created_at, wc.uuid, wc.user_id, wc.credential_id, wc.name, wc.credential, wc.last_used_at
+from webauthn_credential wc
+     join users u on wc.user_id = u.id
+where u.uuid = $1
+order by wc.id
+`
+
+func (q *Queries) GetWebAuthnCredentialsByUserUuid(ctx context.Context, userUuid uuid.UUID) ([]WebauthnCredential, error) {
+	rows, err := q.db.Query(ctx, getWebAuthnCredentialsByUserUuid, userUuid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebauthnCredential
+	for rows.Next() {
+		var i WebauthnCredential
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.Uuid,
+			&i.UserID,
+			&i.CredentialID,
+			&i.Name,
+			&i.Credential,
+			&i.LastUsedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const takeWebAuthnCeremony = `-- name: TakeWebAuthnCeremony :one
+delete
+from webauthn_ceremony
+where uuid = $1
+  and kind = $2
+  and user_id is not distinct from $3
+  and expires_at > now()
+returning session_data
+`
+
+type TakeWebAuthnCeremonyParams struct {
+	CeremonyUuid uuid.UUID
+	Kind         string
+	UserID       pgtype.Int4
+}
+
+func (q *Queries) TakeWebAuthnCeremony(ctx context.Context, arg TakeWebAuthnCeremonyParams) ([]byte, error) {
+	row := q.db.QueryRow(ctx, takeWebAuthnCeremony, arg.CeremonyUuid, arg.Kind, arg.UserID)
+	var session_data []byte
+	err := row.Scan(&session_data)
+	return session_data, err
+}
+
+const updateWebAuthnCredential = `-- name: UpdateWebAuthnCredential :exec
+update webauthn_credential
+set credential   = $1,
+    last_used_at = now()
+where credential_id = $2
+`
+
+type UpdateWebAuthnCredentialParams struct {
+	Credential   []byte
+	CredentialID []byte
+}
+
+func (q *Queries) UpdateWebAuthnCredential(ctx context.Context, arg UpdateWebAuthnCredentialParams) error {
+	_, err := q.db.Exec(ctx, updateWebAuthnCredential, arg.Credential, arg.CredentialID)
+	return err
+}
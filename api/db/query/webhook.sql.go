@@ -0,0 +1,332 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: webhook.sql
+
+package query
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const claimWebhookDeliveries = `-- name: ClaimWebhookDeliveries :many
+update webhook_delivery wd
+set attempt_count   = wd.attempt_count + 1,
+    last_attempt_at = now(),
+    next_attempt_at = $2
+from webhook w
+where wd.webhook_id = w.id
+  and wd.id in (select pending.id
+                from webhook_delivery pending
+                where pending.status = 'pending' and pending.next_attempt_at <= now()
+                order by pending.next_attempt_at
+                limit $1 for update skip locked)
+returning wd.id, wd.uuid, wd.webhook_id, wd.event, wd.attempt_count, w.url
+`
+
+type ClaimWebhookDeliveriesParams struct {
+	Limit          int32
+	LeaseExpiresAt time.Time
+}
+
+type ClaimWebhookDeliveriesRow struct {
+	ID           int32
+	Uuid         uuid.UUID
+	WebhookID    int32
+	Event        []byte
+	AttemptCount int32
+	Url          string
+}
+
+func (q *Queries) ClaimWebhookDeliveries(ctx context.Context, arg ClaimWebhookDeliveriesParams) ([]ClaimWebhookDeliveriesRow, error) {
+	rows, err := q.db.Query(ctx, claimWebhookDeliveries, arg.Limit, arg.LeaseExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ClaimWebhookDeliveriesRow
+	for rows.Next() {
+		var i ClaimWebhookDeliveriesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Uuid,
+			&i.WebhookID,
+			&i.Event,
+			&i.AttemptCount,
+			&i.Url,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const createWebhook = `-- name: CreateWebhook :one
+insert into webhook (game_id, url, events)
+select g.id, $1, $2::text[]
+from game g
+where g.uuid = $3
+returning id, created_at, updated_at, uuid, game_id, url, events, enabled
+`
+
+type CreateWebhookParams struct {
+	Url      string
+	Events   []string
+	GameUuid uuid.UUID
+}
+
+func (q *Queries) CreateWebhook(ctx context.Context, arg CreateWebhookParams) (Webhook, error) {
+	row := q.db.QueryRow(ctx, createWebhook, arg.Url, arg.Events, arg.GameUuid)
+	var i Webhook
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Uuid,
+		&i.GameID,
+		&i.Url,
+		&i.Events,
+		&i.Enabled,
+	)
+	return i, err
+}
+
+const deleteWebhook = `-- name: DeleteWebhook :one
+delete
+from webhook w
+using game g
+where w.game_id = g.id and g.uuid = $1 and w.uuid = $2
+returning w.id
+`
+
+type DeleteWebhookParams struct {
+	GameUuid    uuid.UUID
+	WebhookUuid uuid.UUID
+}
+
+func (q *Queries) DeleteWebhook(ctx context.Context, arg DeleteWebhookParams) (int32, error) {
+	row := q.db.QueryRow(ctx, deleteWebhook, arg.GameUuid, arg.WebhookUuid)
+	var id int32
+	err := row.Scan(&id)
+	return id, err
+}
+
+const failWebhookDelivery = `-- name: FailWebhookDelivery :exec
+update webhook_delivery
+set status           = case when $1::bool then 'failed' else 'pending' end,
+    next_attempt_at  = $2,
+    last_status_code = $3,
+    last_error       = $4
+where id = $5
+`
+
+type FailWebhookDeliveryParams struct {
+	GiveUp        bool
+	NextAttemptAt time.Time
+	StatusCode    pgtype.Int4
+	Error         *string
+	ID            int32
+}
+
+func (q *Queries) FailWebhookDelivery(ctx context.Context, arg FailWebhookDeliveryParams) error {
+	_, err := q.db.Exec(ctx, failWebhookDelivery,
+		arg.GiveUp,
+		arg.NextAttemptAt,
+		arg.StatusCode,
+		arg.Error,
+		arg.ID,
+	)
+	return err
+}
+
+const findGameWebhook = `-- name: FindGameWebhook :one
+select w.id, w.created_at, w.updated_at, w.uuid, w.game_id, w.url, w.events, w.enabled
+from webhook w
+     join game g on w.game_id = g.id
+where g.uuid = $1 and w.uuid = $2
+`
+
+type FindGameWebhookParams struct {
+	GameUuid    uuid.UUID
+	WebhookUuid uuid.UUID
+}
+
+func (q *Queries) FindGameWebhook(ctx context.Context, arg FindGameWebhookParams) (Webhook, error) {
+	row := q.db.QueryRow(ctx, findGameWebhook, arg.GameUuid, arg.WebhookUuid)
+	var i Webhook
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Uuid,
+		&i.GameID,
+		&i.Url,
+		&i.Events,
+		&i.Enabled,
+	)
+	return i, err
+}
+
+const getGameWebhooks = `-- name: GetGameWebhooks :many
+select w.id, w.created_at, w.updated_at, w.uuid, w.game_id, w.url, w.events, w.enabled
+from webhook w
+     join game g on w.game_id = g.id
+where g.uuid = $1
+order by w.uuid
+`
+
+func (q *Queries) GetGameWebhooks(ctx context.Context, gameUuid uuid.UUID) ([]Webhook, error) {
+	rows, err := q.db.Query(ctx, getGameWebhooks, gameUuid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Webhook
+	for rows.Next() {
+		var i Webhook
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Uuid,
+			&i.GameID,
+			&i.Url,
+			&i.Events,
+			&i.Enabled,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getWebhookDeliveries = `-- name: GetWebhookDeliveries :many
+select wd.id, wd.created_at, wd.uuid, wd.webhook_id, wd.event, wd.status, wd.attempt_count, wd.next_attempt_at, wd.last_attempt_at, wd.last_status_code, wd.last_error, wd.delivered_at
+from webhook_delivery wd
+where wd.webhook_id = $2
+  and ($3::uuid is null or wd.uuid < $3::uuid)
+order by wd.uuid desc
+limit $1
+`
+
+type GetWebhookDeliveriesParams struct {
+	Limit     int32
+	WebhookID int32
+	After     uuid.NullUUID
+}
+
+func (q *Queries) GetWebhookDeliveries(ctx context.Context, arg GetWebhookDeliveriesParams) ([]WebhookDelivery, error) {
+	rows, err := q.db.Query(ctx, getWebhookDeliveries, arg.Limit, arg.WebhookID, arg.After)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebhookDelivery
+	for rows.Next() {
+		var i WebhookDelivery
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.Uuid,
+			&i.WebhookID,
+			&i.Event,
+			&i.Status,
+			&i.AttemptCount,
+			&i.NextAttemptAt,
+			&i.LastAttemptAt,
+			&i.LastStatusCode,
+			&i.LastError,
+			&i.DeliveredAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const isGameDeveloperMember = `-- name: IsGameDeveloperMember :one
+select exists (select dm.id, dm.created_at, user_id, dm.developer_id, g.id, g.created_at, updated_at, g.developer_id, uuid, slug, server_only_progress, require_signed_progress
+               from developer_member dm
+                    join game g on dm.developer_id = g.developer_id
+               where dm.user_id = $1 and g.uuid = $2)
+`
+
+type IsGameDeveloperMemberParams struct {
+	UserID   int32
+	GameUuid uuid.UUID
+}
+
+func (q *Queries) IsGameDeveloperMember(ctx context.Context, arg IsGameDeveloperMemberParams) (bool, error) {
+	row := q.db.QueryRow(ctx, isGameDeveloperMember, arg.UserID, arg.GameUuid)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const replayWebhookDelivery = `-- name: ReplayWebhookDelivery :one
+insert into webhook_delivery (webhook_id, event)
+select wd.webhook_id, wd.event
+from webhook_delivery wd
+where wd.webhook_id = $1 and wd.uuid = $2
+returning id, created_at, uuid, webhook_id, event, status, attempt_count, next_attempt_at, last_attempt_at, last_status_code, last_error, delivered_at
+`
+
+type ReplayWebhookDeliveryParams struct {
+	WebhookID    int32
+	DeliveryUuid uuid.UUID
+}
+
+func (q *Queries) ReplayWebhookDelivery(ctx context.Context, arg ReplayWebhookDeliveryParams) (WebhookDelivery, error) {
+	row := q.db.QueryRow(ctx, replayWebhookDelivery, arg.WebhookID, arg.DeliveryUuid)
+	var i WebhookDelivery
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.Uuid,
+		&i.WebhookID,
+		&i.Event,
+		&i.Status,
+		&i.AttemptCount,
+		&i.NextAttemptAt,
+		&i.LastAttemptAt,
+		&i.LastStatusCode,
+		&i.LastError,
+		&i.DeliveredAt,
+	)
+	return i, err
+}
+
+const succeedWebhookDelivery = `-- name: SucceedWebhookDelivery :exec
+update webhook_delivery
+set status           = 'succeeded',
+    delivered_at     = now(),
+    last_status_code = $1,
+    last_error       = null
+where id = $2
+`
+
+type SucceedWebhookDeliveryParams struct {
+	StatusCode pgtype.Int4
+	ID         int32
+}
+
+func (q *Queries) SucceedWebhookDelivery(ctx context.Context, arg SucceedWebhookDeliveryParams) error {
+	_, err := q.db.Exec(ctx, succeedWebhookDelivery, arg.StatusCode, arg.ID)
+	return err
+}
@@ -21,7 +21,7 @@ from achievement_progress ap
      join achievement_rarity ar on ap.achievement_id = ar.id and ap.progress >= ar.progress_requirement
      join game g on ar.game_id = g.id
      join users u on ap.user_id = u.id
-where u.uuid = @user_uuid and ar.completion_percent <= @max_completion_percent::float
+where u.uuid = @user_uuid and ar.completion_percent <= @max_completion_percent::float and ap.revoked_at is null
 order by ar.completion_percent
 limit $1;
 
@@ -48,6 +48,7 @@ from achievement_progress ap
      join developer d on g.developer_id = d.id
 where u.uuid = @user_uuid
   and ap.progress >= a.progress_requirement
+  and ap.revoked_at is null
 order by ap.created_at desc
 limit $1;
 
@@ -61,6 +62,7 @@ from achievement_progress ap
      left outer join user_latest_display_name uldn on u.id = uldn.user_id
 where u.uuid != @excluded_user_uuid
   and ap.progress >= a.progress_requirement
+  and ap.revoked_at is null
 order by ap.created_at desc
 limit $1;
 
@@ -86,7 +88,7 @@ from achievement_progress ap
      join achievement_rarity ar on ap.achievement_id = ar.id
      join game g on ar.game_id = g.id
      join users u on ap.user_id = u.id
-where g.uuid = @game_uuid and ap.progress >= ar.progress_requirement
+where g.uuid = @game_uuid and ap.progress >= ar.progress_requirement and ap.revoked_at is null
 order by ap.created_at desc
 limit $1;
 
@@ -0,0 +1,86 @@
+-- name: CreateAchievementAnomaly :exec
+insert into achievement_anomaly (user_id, achievement_id, game_session_id, kind, details)
+values (@user_id, @achievement_id, sqlc.narg(game_session_id), @kind, @details)
+on conflict do nothing;
+
+-- name: GetGameSessionStart :one
+-- the game session's start, and how many achievements its game has
+select gs.id,
+       gs.created_at,
+       gs.user_id,
+       (select count(*) from achievement a where a.game_id = gs.game_id) as achievement_count
+from game_session gs
+where gs.uuid = @session_uuid;
+
+-- name: GetRecentUnlocks :many
+select ap.achievement_id, ap.unlocked_at
+from achievement_progress ap
+     join achievement a on ap.achievement_id = a.id
+     join game_session gs on a.game_id = gs.game_id
+where gs.id = @game_session_id
+  and ap.user_id = gs.user_id
+  and ap.unlocked_at >= @unlocked_since::timestamptz
+  and ap.revoked_at is null;
+
+-- name: GetAchievementAnomalies :many
+select aa.uuid,
+       aa.created_at,
+       aa.kind,
+       aa.details,
+       aa.state,
+       aa.reviewed_at,
+       reviewer.slug                 as reviewed_by_slug,
+       u.uuid                        as user_uuid,
+       u.slug                        as user_slug,
+       g.uuid                        as game_uuid,
+       g.slug                        as game_slug,
+       a.slug                        as achievement_slug,
+       ap.progress,
+       a.progress_requirement,
+       ap.unlocked_at,
+       (ap.revoked_at is not null)::bool as revoked,
+       gs.uuid                       as game_session_uuid
+from achievement_anomaly aa
+     join users u on aa.user_id = u.id
+     join achievement a on aa.achievement_id = a.id
+     join game g on a.game_id = g.id
+     left outer join achievement_progress ap on aa.user_id = ap.user_id and aa.achievement_id = ap.achievement_id
+     left outer join users reviewer on aa.reviewed_by_user_id = reviewer.id
+     left outer join game_session gs on aa.game_session_id = gs.id
+where (sqlc.narg(game_uuid)::uuid is null or g.uuid = sqlc.narg(game_uuid)::uuid)
+  and (sqlc.narg(state)::text is null or aa.state = sqlc.narg(state)::text)
+  and (sqlc.narg(after)::uuid is null or aa.uuid < sqlc.narg(after)::uuid)
+order by aa.uuid desc
+limit $1;
+
+-- name: GetAchievementAnomalyForUpdate :one
+select aa.*
+from achievement_anomaly aa
+     join achievement a on aa.achievement_id = a.id
+     join game g on a.game_id = g.id
+where aa.uuid = @uuid
+  and (sqlc.narg(game_uuid)::uuid is null or g.uuid = sqlc.narg(game_uuid)::uuid)
+for update of aa;
+
+-- name: DismissAchievementAnomaly :exec
+update achievement_anomaly
+set state               = 'dismissed',
+    reviewed_at         = now(),
+    reviewed_by_user_id = @reviewed_by_user_id
+where id = @id;
+
+-- name: RevokeAchievementProgress :exec
+update achievement_progress
+set revoked_at         = coalesce(revoked_at, now()),
+    revoked_by_user_id = coalesce(revoked_by_user_id, @revoked_by_user_id)
+where user_id = @user_id
+  and achievement_id = @achievement_id;
+
+-- name: ResolveRevokedAchievementAnomalies :exec
+update achievement_anomaly
+set state               = 'revoked',
+    reviewed_at         = now(),
+    reviewed_by_user_id = @reviewed_by_user_id
+where user_id = @user_id
+  and achievement_id = @achievement_id
+  and state = 'open';
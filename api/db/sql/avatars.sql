@@ -20,3 +20,15 @@ from game g
 join achievement a on g.id = a.game_id
 where g.uuid = @game_uuid and a.slug = @achievement_slug
 returning *;
+
+-- name: GetUserCurrentAvatarId :one
+select id
+from user_current_avatar
+where user_id = @user_id;
+
+-- name: RemoveUserAvatar :execrows
+update user_avatar
+set removed_at         = now(),
+    removed_by_user_id = @removed_by_user_id
+where id = @avatar_id
+  and removed_at is null;
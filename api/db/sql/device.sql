@@ -0,0 +1,58 @@
+-- name: CreateDeviceAuthorization :one
+insert into device_authorization (device_code_hash, user_code, game_id, poll_interval, expires_at)
+select @device_code_hash, @user_code, g.id, @poll_interval, @expires_at
+from game g
+where g.uuid = @game_uuid
+returning id;
+
+-- name: FindPendingDeviceAuthorization :one
+select da.created_at, da.expires_at, g.uuid as game_uuid, g.slug as game_slug, d.slug as developer_slug
+from device_authorization da
+     join game g on da.game_id = g.id
+     join developer d on g.developer_id = d.id
+where da.user_code = @user_code
+  and da.approved_at is null
+  and da.denied_at is null
+  and da.expires_at > now();
+
+-- name: ApproveDeviceAuthorization :execrows
+update device_authorization
+set user_id     = @user_id,
+    approved_at = now()
+where user_code = @user_code
+  and approved_at is null
+  and denied_at is null
+  and expires_at > now();
+
+-- name: DenyDeviceAuthorization :execrows
+update device_authorization
+set user_id   = @user_id,
+    denied_at = now()
+where user_code = @user_code
+  and approved_at is null
+  and denied_at is null
+  and expires_at > now();
+
+-- name: GetDeviceAuthorizationForUpdate :one
+select da.*, g.uuid as game_uuid, u.uuid as user_uuid
+from device_authorization da
+     join game g on da.game_id = g.id
+     left join users u on da.user_id = u.id
+where da.device_code_hash = @device_code_hash
+for update of da;
+
+-- name: TouchDeviceAuthorizationPoll :exec
+update device_authorization
+set last_polled_at = now(),
+    poll_interval  = @poll_interval
+where id = @id;
+
+-- name: DeleteDeviceAuthorization :exec
+delete
+from device_authorization
+where id = @id;
+
+-- name: DeleteExpiredDeviceAuthorizations :exec
+delete
+from device_authorization
+where expires_at <= now() - interval '1 day';
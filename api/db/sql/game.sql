@@ -24,3 +24,14 @@ select g.slug,
 from game g
      join developer d on g.developer_id = d.id
 where g.uuid = @game_uuid;
+
+-- name: GetGameProgressSettings :one
+select server_only_progress, require_signed_progress
+from game
+where uuid = @game_uuid;
+
+-- name: SetGameProgressSettings :exec
+update game
+set server_only_progress    = @server_only_progress,
+    require_signed_progress = @require_signed_progress
+where uuid = @game_uuid;
@@ -0,0 +1,37 @@
+-- name: CreateGameBuild :one
+insert into game_build (game_id, name, created_by_user_id)
+select g.id, @name, @created_by_user_id
+from game g
+where g.uuid = @game_uuid
+returning *;
+
+-- name: GetGameBuilds :many
+select gb.*, u.slug as created_by_slug
+from game_build gb
+     join game g on gb.game_id = g.id
+     left outer join users u on gb.created_by_user_id = u.id
+where g.uuid = @game_uuid
+order by gb.uuid;
+
+-- name: DeleteGameBuild :one
+delete
+from game_build gb
+using game g
+where gb.game_id = g.id and g.uuid = @game_uuid and gb.uuid = @build_uuid
+returning gb.id;
+
+-- name: FindGameBuild :one
+select gb.id
+from game_build gb
+     join game g on gb.game_id = g.id
+where g.uuid = @game_uuid and gb.uuid = @build_uuid;
+
+-- name: UseGameBuildNonce :execrows
+insert into game_build_nonce (game_build_id, nonce, expires_at)
+values (@game_build_id, @nonce, @expires_at)
+on conflict do nothing;
+
+-- name: DeleteExpiredGameBuildNonces :execrows
+delete
+from game_build_nonce
+where expires_at <= now();
@@ -15,12 +15,16 @@ select target_user.user_count, target_session.last_pulse_at, target_game.game_co
 from target_user, target_session, target_game, disallow_jwt;
 
 -- name: GetValidSession :one
-select gs.last_pulse_at, gt.uuid as game_token_uuid
+select gs.last_pulse_at, gt.uuid as game_token_uuid, gt.scopes as game_token_scopes, gs.game_token_hash
 from game_session gs
     join game_token gt on gs.game_token_id = gt.id
     join game g on gs.game_id = g.id
     join users u on gs.user_id = u.id
 where not exists (select * from token_disallow_list tdl where tdl.token_id = @session_token_uuid)
+  and gs.ended_at is null
+  and gt.expires_at > now()
+  -- the session was started with the token's current secret, or with its RID before it was ever rotated
+  and gs.game_token_hash is not distinct from gt.token_hash
   and g.uuid = @game_uuid
   and u.uuid = @user_uuid
   and gs.uuid = @session_uuid
@@ -32,7 +36,7 @@ from achievement_progress ap
 join users u on ap.user_id = u.id
 join achievement a on ap.achievement_id = a.id
 join game g on a.game_id = g.id
-where u.uuid = @user_uuid and g.uuid = @game_uuid;
+where u.uuid = @user_uuid and g.uuid = @game_uuid and ap.revoked_at is null;
 
 -- name: UpdateGameSessionUserProgress :batchone
 with target_user as (
@@ -43,14 +47,26 @@ with target_user as (
     join game g on a.game_id = g.id
     where a.slug = @achievement_slug and g.uuid = @game_uuid
 )
-insert into achievement_progress (user_id, achievement_id, progress)
-select target_user.id, target_achievement.id, @new_progress
+insert into achievement_progress (user_id, achievement_id, progress, unlocked_at)
+select target_user.id,
+       target_achievement.id,
+       @new_progress,
+       case when @new_progress >= target_achievement.progress_requirement then now() end
 from target_user, target_achievement
 where @new_progress <= target_achievement.progress_requirement
 on conflict (user_id, achievement_id)
-    do update set progress = excluded.progress
+    do update set progress    = excluded.progress,
+                  unlocked_at = coalesce(achievement_progress.unlocked_at, excluded.unlocked_at)
     where excluded.progress >= achievement_progress.progress
-returning (select target_achievement.slug from target_achievement), achievement_progress.progress;
+returning (select target_achievement.slug from target_achievement),
+          achievement_progress.progress,
+          achievement_progress.user_id,
+          achievement_progress.achievement_id,
+          (select target_achievement.progress_requirement from target_achievement),
+          -- subqueries see the table as it was before the insert, so this is the progress being replaced
+          coalesce((select ap.progress
+                    from achievement_progress ap, target_user, target_achievement
+                    where ap.user_id = target_user.id and ap.achievement_id = target_achievement.id), 0)::integer as old_progress;
 
 -- name: CreateGameSession :one
 with target_game as (
@@ -58,10 +74,15 @@ with target_game as (
 ), target_user as (
     select id from users where users.uuid = @user_uuid
 ), target_game_token as (
-    select id from game_token where game_token.uuid = @game_token_uuid
+    -- nothing is created if the token was rotated or expired after the request was authenticated
+    select id
+    from game_token
+    where game_token.uuid = @game_token_uuid
+      and game_token.token_hash is not distinct from sqlc.narg(game_token_hash)::bytea
+      and game_token.expires_at > now()
 )
-insert into game_session (game_id, user_id, game_token_id)
-select target_game.id, target_user.id, target_game_token.id
+insert into game_session (game_id, user_id, game_token_id, game_token_hash)
+select target_game.id, target_user.id, target_game_token.id, sqlc.narg(game_token_hash)::bytea
 from target_game, target_user, target_game_token
 returning *;
 
@@ -69,4 +90,29 @@ returning *;
 update game_session
 set last_pulse_at = now()
 where uuid = @session_uuid
-returning last_pulse_at;
\ No newline at end of file
+returning last_pulse_at;
+
+-- name: EndGameSession :execrows
+update game_session
+set ended_at = now()
+where uuid = @session_uuid and ended_at is null;
+
+-- name: GetUserActiveGameSessions :many
+select gs.uuid, gs.created_at, gs.last_pulse_at, g.uuid as game_uuid, g.slug as game_slug, d.slug as developer_slug,
+       gt.uuid as game_token_uuid, gt.comment as game_token_comment
+from game_session gs
+     join game g on gs.game_id = g.id
+     join developer d on g.developer_id = d.id
+     join game_token gt on gs.game_token_id = gt.id
+where gs.user_id = @user_id and gs.ended_at is null and gs.last_pulse_at > @active_after
+order by gs.last_pulse_at desc;
+
+-- name: EndUserGameSession :execrows
+update game_session
+set ended_at = now()
+where user_id = @user_id and uuid = @session_uuid and ended_at is null;
+
+-- name: EndUserGameSessions :execrows
+update game_session
+set ended_at = now()
+where user_id = @user_id and ended_at is null;
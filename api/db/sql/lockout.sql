@@ -0,0 +1,44 @@
+-- name: LockAccountLockout :one
+-- the row is created if the user has none, and locked until the end of the transaction either way, so that concurrent
+-- attempts are counted one at a time
+insert into account_lockout (user_id, kind, last_failed_at)
+values (@user_id, @kind, @now)
+on conflict (user_id, kind) do update
+    set kind = excluded.kind
+returning *;
+
+-- name: RecordFailedAttempt :one
+-- failures older than @reset_before are forgotten, so that occasional typos never add up to a lockout
+insert into account_lockout (user_id, kind, failed_count, last_failed_at)
+values (@user_id, @kind, 1, @failed_at)
+on conflict (user_id, kind) do update
+    set failed_count   = case
+                             when account_lockout.last_failed_at < @reset_before::timestamptz then 1
+                             else account_lockout.failed_count + 1 end,
+        lockout_count  = case
+                             when account_lockout.last_failed_at < @reset_before::timestamptz then 0
+                             else account_lockout.lockout_count end,
+        last_failed_at = excluded.last_failed_at
+returning *;
+
+-- name: LockAccount :exec
+-- the failed count starts over once the lockout ends, and each further lockout lasts longer
+update account_lockout
+set failed_count  = 0,
+    lockout_count = lockout_count + 1,
+    locked_until  = @locked_until::timestamptz
+where user_id = @user_id
+  and kind = @kind;
+
+-- name: ClearFailedAttempts :exec
+delete
+from account_lockout
+where user_id = @user_id
+  and kind = @kind;
+
+-- name: FindUserLockoutContact :one
+select u.slug, ue.email
+from users u
+     join user_email ue on u.id = ue.user_id
+where u.id = @user_id
+  and ue.confirmed_at is not null;
@@ -0,0 +1,65 @@
+-- name: FindUserMfa :one
+select *
+from user_mfa
+where user_id = @user_id;
+
+-- name: StartUserMfaEnrollment :execrows
+insert into user_mfa (user_id)
+values (@user_id)
+on conflict (user_id) do update set created_at = now()
+where user_mfa.confirmed_at is null;
+
+-- name: ConfirmUserMfa :execrows
+update user_mfa
+set confirmed_at = now()
+where user_id = @user_id and confirmed_at is null;
+
+-- name: UseUserMfaStep :execrows
+update user_mfa
+set last_used_step = @step::bigint
+where user_id = @user_id and (last_used_step is null or last_used_step < @step::bigint);
+
+-- name: DeleteUserMfa :exec
+delete
+from user_mfa
+where user_id = @user_id;
+
+-- name: DeleteUserRecoveryCodes :exec
+delete
+from user_recovery_code
+where user_id = @user_id;
+
+-- name: AddUserRecoveryCodes :exec
+insert into user_recovery_code (user_id, encoded_hash)
+select @user_id, unnest(@encoded_hashes::text[]);
+
+-- name: GetUnusedRecoveryCodes :many
+select id, encoded_hash
+from user_recovery_code
+where user_id = @user_id and used_at is null;
+
+-- name: UseRecoveryCode :execrows
+update user_recovery_code
+set used_at = now()
+where id = @id and used_at is null;
+
+-- name: CreateMfaChallenge :one
+insert into mfa_challenge (user_id, expires_at)
+values (@user_id, @expires_at)
+returning *;
+
+-- name: AttemptMfaChallenge :one
+update mfa_challenge mc
+set attempt_count = mc.attempt_count + 1
+from users u
+where mc.uuid = @challenge_uuid
+  and mc.user_id = u.id
+  and mc.completed_at is null
+  and mc.expires_at > now()
+  and mc.attempt_count < @max_attempts
+returning mc.id, u.id as user_id, u.uuid as user_uuid;
+
+-- name: CompleteMfaChallenge :execrows
+update mfa_challenge
+set completed_at = now()
+where id = @id and completed_at is null;
@@ -0,0 +1,59 @@
+-- name: GetActiveUserSuspension :one
+select us.*
+from user_suspension us
+     join users u on us.user_id = u.id
+where u.uuid = @user_uuid
+  and us.lifted_at is null
+  and (us.ends_at is null or us.ends_at > now())
+order by us.ends_at desc nulls first
+limit 1;
+
+-- name: CreateUserSuspension :one
+insert into user_suspension (user_id, actor_user_id, reason, ends_at)
+values (@user_id, @actor_user_id, @reason, sqlc.narg(ends_at)::timestamptz)
+returning *;
+
+-- name: LiftUserSuspensions :execrows
+update user_suspension
+set lifted_at         = now(),
+    lifted_by_user_id = @lifted_by_user_id
+where user_id = @user_id
+  and lifted_at is null
+  and (ends_at is null or ends_at > now());
+
+-- name: GetUserSuspensions :many
+select us.uuid, us.created_at, us.reason, us.ends_at, us.lifted_at, actor.slug as actor_slug, lifter.slug as lifted_by_slug
+from user_suspension us
+     left outer join users actor on us.actor_user_id = actor.id
+     left outer join users lifter on us.lifted_by_user_id = lifter.id
+where us.user_id = @user_id
+order by us.uuid desc;
+
+-- name: ForceUserSlug :exec
+update users
+set slug = @slug
+where id = @user_id;
+
+-- name: RemoveUserAvatars :execrows
+update user_avatar
+set removed_at         = now(),
+    removed_by_user_id = @removed_by_user_id
+where user_id = @user_id
+  and removed_at is null;
+
+-- name: GetUserEmails :many
+select *
+from user_email
+where user_id = @user_id
+order by created_at desc;
+
+-- name: GetAdminSecurityEvents :many
+select se.uuid, se.created_at, se.kind, se.details, u.uuid as user_uuid, u.slug as user_slug, actor.uuid as actor_uuid, actor.slug as actor_slug
+from security_event se
+     join users u on se.user_id = u.id
+     left join users actor on se.actor_user_id = actor.id
+where se.by_admin
+  and (sqlc.narg(user_id)::integer is null or se.user_id = sqlc.narg(user_id)::integer)
+  and (sqlc.narg(after)::uuid is null or se.uuid < sqlc.narg(after)::uuid)
+order by se.uuid desc
+limit $1;
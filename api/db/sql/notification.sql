@@ -0,0 +1,68 @@
+-- name: AddRareAchievementNotifications :execrows
+insert into notification (user_id, kind, game_id, achievement_id, dedupe_key)
+select u.id, 'rare-achievement-unlocked', g.id, ar.id, 'rare-achievement-unlocked/' || ar.id
+from achievement_progress ap
+     join achievement_rarity ar on ap.achievement_id = ar.id
+     join game g on ar.game_id = g.id
+     join users u on ap.user_id = u.id
+where u.uuid = @user_uuid
+  and g.uuid = @game_uuid
+  and ar.slug = any(@achievement_slugs::text[])
+  and ap.progress >= ar.progress_requirement
+  and ap.revoked_at is null
+  and ar.completion_percent < @max_completion_percent::float
+on conflict (user_id, dedupe_key) do nothing;
+
+-- name: AddExpiringGameTokenNotifications :execrows
+insert into notification (user_id, kind, game_id, game_token_id, dedupe_key)
+select gt.user_id, 'game-token-expiring', gt.game_id, gt.id, 'game-token-expiring/' || gt.uuid
+from game_token gt
+where gt.expires_at > now() and gt.expires_at <= @expires_before
+on conflict (user_id, dedupe_key) do nothing;
+
+-- name: AddEmailConfirmedNotification :exec
+insert into notification (user_id, kind, email)
+values (@user_id, 'email-confirmed', @email);
+
+-- name: GetUserNotifications :many
+select n.uuid,
+       n.created_at,
+       n.read_at,
+       n.kind,
+       n.achievement_count,
+       n.email,
+       g.uuid as game_uuid,
+       g.slug as game_slug,
+       d.slug as developer_slug,
+       a.slug as achievement_slug,
+       a.name as achievement_name,
+       ar.completion_percent as achievement_rarity,
+       gt.uuid as game_token_uuid,
+       gt.expires_at as game_token_expires_at,
+       gt.comment as game_token_comment
+from notification n
+     left outer join game g on n.game_id = g.id
+     left outer join developer d on g.developer_id = d.id
+     left outer join achievement a on n.achievement_id = a.id
+     left outer join achievement_rarity ar on n.achievement_id = ar.id
+     left outer join game_token gt on n.game_token_id = gt.id
+where n.user_id = @user_id
+  and (not @unread_only::bool or n.read_at is null)
+  and (sqlc.narg(after)::uuid is null or n.uuid < sqlc.narg(after)::uuid)
+order by n.uuid desc
+limit $1;
+
+-- name: CountUnreadNotifications :one
+select count(*)
+from notification
+where user_id = @user_id and read_at is null;
+
+-- name: MarkNotificationRead :execrows
+update notification
+set read_at = coalesce(read_at, now())
+where user_id = @user_id and uuid = @uuid;
+
+-- name: MarkAllNotificationsRead :execrows
+update notification
+set read_at = now()
+where user_id = @user_id and read_at is null;
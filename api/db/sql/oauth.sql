@@ -0,0 +1,96 @@
+-- name: IsDeveloperMember :one
+select exists (select *
+               from developer_member dm
+                    join developer d on dm.developer_id = d.id
+               where dm.user_id = @user_id and d.uuid = @developer_uuid);
+
+-- name: GetDeveloperOAuthClients :many
+select oc.*
+from oauth_client oc
+     join developer d on oc.developer_id = d.id
+where d.uuid = @developer_uuid
+order by oc.id;
+
+-- name: CreateOAuthClient :one
+insert into oauth_client (developer_id, name, redirect_uris, secret_hash)
+select d.id, @name, @redirect_uris::text[], sqlc.narg(secret_hash)
+from developer d
+where d.uuid = @developer_uuid
+returning *;
+
+-- name: DeleteOAuthClient :execrows
+delete
+from oauth_client oc
+    using developer d
+where oc.developer_id = d.id and d.uuid = @developer_uuid and oc.uuid = @client_uuid;
+
+-- name: FindOAuthClient :one
+select oc.*, d.slug as developer_slug
+from oauth_client oc
+     join developer d on oc.developer_id = d.id
+where oc.uuid = @client_uuid;
+
+-- name: CreateOAuthAuthorizationCode :exec
+insert into oauth_authorization_code (code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, expires_at)
+values (@code_hash, @client_id, @user_id, @redirect_uri, @scopes::text[], @code_challenge, @expires_at);
+
+-- name: TakeOAuthAuthorizationCode :one
+delete
+from oauth_authorization_code
+where code_hash = @code_hash
+returning *;
+
+-- name: DeleteExpiredOAuthAuthorizationCodes :exec
+delete
+from oauth_authorization_code
+where expires_at <= now();
+
+-- name: CreateOAuthRefreshToken :exec
+insert into oauth_refresh_token (token_hash, client_id, user_id, scopes, expires_at)
+values (@token_hash, @client_id, @user_id, @scopes::text[], @expires_at);
+
+-- name: TakeOAuthRefreshToken :one
+delete
+from oauth_refresh_token
+where token_hash = @token_hash
+returning *;
+
+-- name: HasOAuthGrant :one
+select exists (select *
+               from oauth_refresh_token ort
+                    join oauth_client oc on ort.client_id = oc.id
+               where ort.user_id = @user_id and oc.uuid = @client_uuid and ort.expires_at > now());
+
+-- name: GetUserOAuthApps :many
+select oc.uuid, oc.name, d.slug as developer_slug, array_agg(distinct s.scope)::text[] as scopes,
+       min(ort.created_at)::timestamptz as authorized_at
+from oauth_refresh_token ort
+     join oauth_client oc on ort.client_id = oc.id
+     join developer d on oc.developer_id = d.id
+     cross join unnest(ort.scopes) as s(scope)
+where ort.user_id = @user_id and ort.expires_at > now()
+group by oc.id, d.slug
+order by oc.id;
+
+-- name: RevokeUserOAuthApp :execrows
+with revoked_codes as (
+    delete
+    from oauth_authorization_code oac
+        using oauth_client oc
+    where oac.client_id = oc.id and oac.user_id = @user_id and oc.uuid = @client_uuid
+)
+delete
+from oauth_refresh_token ort
+    using oauth_client oc
+where ort.client_id = oc.id and ort.user_id = @user_id and oc.uuid = @client_uuid;
+
+-- name: GetUserAchievementProgress :many
+select ap.progress, ap.updated_at, a.slug as achievement_slug, a.name as achievement_name,
+       a.description as achievement_description, a.progress_requirement, g.uuid as game_uuid, g.slug as game_slug,
+       d.slug as developer_slug
+from achievement_progress ap
+     join achievement a on ap.achievement_id = a.id
+     join game g on a.game_id = g.id
+     join developer d on g.developer_id = d.id
+where ap.user_id = @user_id and ap.revoked_at is null
+order by ap.updated_at desc, a.id;
@@ -0,0 +1,62 @@
+-- name: FindUserByIdentity :one
+select u.*
+from users u
+     join user_identity ui on u.id = ui.user_id
+where ui.issuer = @issuer and ui.subject = @subject;
+
+-- name: TouchUserIdentity :exec
+update user_identity
+set last_used_at = now(),
+    email        = sqlc.narg(email)
+where issuer = @issuer and subject = @subject;
+
+-- name: AddUserIdentity :one
+insert into user_identity (user_id, provider, issuer, subject, email, last_used_at)
+values (@user_id, @provider, @issuer, @subject, sqlc.narg(email), now())
+returning *;
+
+-- name: GetUserIdentities :many
+select *
+from user_identity
+where user_id = @user_id
+order by id;
+
+-- name: DeleteUserIdentity :execrows
+delete
+from user_identity
+where user_id = @user_id and uuid = @identity_uuid;
+
+-- name: LockUserSignInMethods :exec
+-- locks the user, so that concurrent removals of their sign in methods can't remove every method
+select id
+from users
+where id = @user_id
+for update;
+
+-- name: CountUserSignInMethods :one
+select ((select count(*) from user_password up where up.user_id = @user_id) +
+       (select count(*) from user_identity ui where ui.user_id = @user_id) +
+       (select count(*) from webauthn_credential wc where wc.user_id = @user_id))::integer as count;
+
+-- name: FindUsersByConfirmedEmail :many
+select u.*
+from users u
+     join user_email ue on u.id = ue.user_id
+where lower(ue.email) = lower(@email) and ue.confirmed_at is not null;
+
+-- name: CreateOidcAuthorization :exec
+insert into oidc_authorization (state, provider, nonce, code_verifier, user_id, expires_at)
+values (@state, @provider, @nonce, @code_verifier, sqlc.narg(user_id), @expires_at);
+
+-- name: TakeOidcAuthorization :one
+delete
+from oidc_authorization
+where state = @state
+  and provider = @provider
+  and expires_at > now()
+returning *;
+
+-- name: DeleteExpiredOidcAuthorizations :exec
+delete
+from oidc_authorization
+where expires_at <= now();
@@ -0,0 +1,23 @@
+-- name: CreateRateLimitBucket :exec
+-- creates a full bucket if there isn't one, so that it can be locked by GetRateLimitBucketForUpdate
+insert into rate_limit_bucket (key, tokens, updated_at, full_at)
+values (@key, @tokens, @now, @now)
+on conflict (key) do nothing;
+
+-- name: GetRateLimitBucketForUpdate :one
+select *
+from rate_limit_bucket
+where key = @key
+    for update;
+
+-- name: UpdateRateLimitBucket :exec
+update rate_limit_bucket
+set tokens     = @tokens,
+    updated_at = @updated_at,
+    full_at    = @full_at
+where key = @key;
+
+-- name: DeleteFullRateLimitBuckets :execrows
+delete
+from rate_limit_bucket
+where full_at < @now;
@@ -0,0 +1,62 @@
+-- name: CreateContentReport :execrows
+insert into content_report (reporter_user_id, target_kind, target_user_id, target_avatar_id, target_game_id,
+                            target_achievement_id, reason, details)
+values (@reporter_user_id, @target_kind, sqlc.narg(target_user_id), sqlc.narg(target_avatar_id),
+        sqlc.narg(target_game_id), sqlc.narg(target_achievement_id), @reason, @details)
+on conflict do nothing;
+
+-- name: GetContentReports :many
+select cr.uuid,
+       cr.created_at,
+       cr.target_kind,
+       cr.reason,
+       cr.details,
+       cr.state,
+       cr.resolved_at,
+       cr.resolution_note,
+       reporter.slug          as reporter_slug,
+       resolver.slug          as resolved_by_slug,
+       tu.uuid                as target_user_uuid,
+       tu.slug                as target_user_slug,
+       ua.uuid                as target_avatar_uuid,
+       ua.removed_at          as target_avatar_removed_at,
+       g.uuid                 as target_game_uuid,
+       g.slug                 as target_game_slug,
+       d.slug                 as target_developer_slug,
+       a.slug                 as target_achievement_slug
+from content_report cr
+     left outer join users reporter on cr.reporter_user_id = reporter.id
+     left outer join users resolver on cr.resolved_by_user_id = resolver.id
+     left outer join users tu on cr.target_user_id = tu.id
+     left outer join user_avatar ua on cr.target_avatar_id = ua.id
+     left outer join game g on cr.target_game_id = g.id
+     left outer join developer d on g.developer_id = d.id
+     left outer join achievement a on cr.target_achievement_id = a.id
+where (sqlc.narg(state)::text is null or cr.state = sqlc.narg(state)::text)
+  and (sqlc.narg(target_kind)::text is null or cr.target_kind = sqlc.narg(target_kind)::text)
+  and (sqlc.narg(after)::uuid is null or cr.uuid < sqlc.narg(after)::uuid)
+order by cr.uuid desc
+limit $1;
+
+-- name: GetContentReportForUpdate :one
+select *
+from content_report
+where uuid = @uuid
+for update;
+
+-- name: ResolveContentReport :exec
+update content_report
+set state               = @state,
+    resolved_at         = now(),
+    resolved_by_user_id = @resolved_by_user_id,
+    resolution_note     = sqlc.narg(resolution_note)
+where id = @id;
+
+-- name: ResolveOpenAvatarReports :execrows
+update content_report
+set state               = 'actioned',
+    resolved_at         = now(),
+    resolved_by_user_id = @resolved_by_user_id,
+    resolution_note     = sqlc.narg(resolution_note)
+where target_avatar_id = @avatar_id
+  and state = 'open';
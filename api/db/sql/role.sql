@@ -0,0 +1,41 @@
+-- name: GetUserRole :one
+select role
+from user_role
+where user_id = @user_id;
+
+-- name: SetUserRole :exec
+insert into user_role (user_id, role, granted_by_user_id)
+values (@user_id, @role, sqlc.narg(granted_by_user_id))
+on conflict (user_id) do update
+    set role               = excluded.role,
+        granted_at         = now(),
+        granted_by_user_id = excluded.granted_by_user_id;
+
+-- name: DeleteUserRole :execrows
+delete
+from user_role
+where user_id = @user_id;
+
+-- name: RootExists :one
+select exists(select 1 from user_role where role = 'root');
+
+-- name: CreateAdminSetupToken :execrows
+insert into admin_setup_token (token_hash)
+values (@token_hash)
+on conflict (id) do nothing;
+
+-- name: ReplaceAdminSetupToken :exec
+insert into admin_setup_token (token_hash)
+values (@token_hash)
+on conflict (id) do update
+    set token_hash = excluded.token_hash,
+        created_at = now();
+
+-- name: ConsumeAdminSetupToken :execrows
+delete
+from admin_setup_token
+where token_hash = @token_hash;
+
+-- name: DeleteAdminSetupToken :exec
+delete
+from admin_setup_token;
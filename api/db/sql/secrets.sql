@@ -10,3 +10,11 @@ update secret
     set value = @value
 where path = @path and key = @key;
 
+
+-- name: SecretPut :exec
+insert into secret(path, key, value)
+values (@path, @key, @value)
+on conflict (path, key) do update set value = excluded.value;
+
+-- name: SecretDelete :exec
+delete from secret where path = @path and key = @key;
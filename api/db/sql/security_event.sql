@@ -0,0 +1,12 @@
+-- name: CreateSecurityEvent :exec
+insert into security_event (user_id, actor_user_id, by_admin, kind, ip_address, user_agent, details)
+values (@user_id, sqlc.narg(actor_user_id), sqlc.narg(actor_user_id)::integer is not null, @kind, sqlc.narg(ip_address),
+        sqlc.narg(user_agent), @details);
+
+-- name: GetUserSecurityEvents :many
+select se.uuid, se.created_at, se.kind, se.ip_address, se.user_agent, se.details, se.by_admin
+from security_event se
+where se.user_id = @user_id
+  and (sqlc.narg(after)::uuid is null or se.uuid < sqlc.narg(after)::uuid)
+order by se.uuid desc
+limit $1;
@@ -0,0 +1,39 @@
+-- name: CreateGameServerKey :one
+insert into game_server_key (game_id, comment, lookup_prefix, key_hash, created_by_user_id)
+select g.id, @comment, @lookup_prefix::text, @key_hash::bytea, @created_by_user_id
+from game g
+where g.uuid = @game_uuid
+returning *;
+
+-- name: GetGameServerKeys :many
+select gsk.*, u.slug as created_by_slug
+from game_server_key gsk
+     join game g on gsk.game_id = g.id
+     left outer join users u on gsk.created_by_user_id = u.id
+where g.uuid = @game_uuid
+order by gsk.uuid;
+
+-- name: DeleteGameServerKey :execrows
+delete
+from game_server_key gsk
+using game g
+where gsk.game_id = g.id and g.uuid = @game_uuid and gsk.uuid = @key_uuid;
+
+-- name: FindGameServerKey :one
+select gsk.uuid, gsk.key_hash, g.uuid as game_uuid
+from game_server_key gsk
+     join game g on gsk.game_id = g.id
+where gsk.lookup_prefix = @lookup_prefix::text;
+
+-- name: TouchGameServerKey :exec
+update game_server_key
+set last_used_at = now()
+where uuid = @uuid;
+
+-- name: IsGamePlayer :one
+-- players have connected their account to the game by creating a game token for it
+select exists (select *
+               from game_token gt
+                    join game g on gt.game_id = g.id
+                    join users u on gt.user_id = u.id
+               where g.uuid = @game_uuid and u.uuid = @user_uuid);
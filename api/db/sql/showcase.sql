@@ -0,0 +1,70 @@
+-- name: GetUserShowcase :one
+select us.hidden_sections, g.uuid as featured_game_uuid
+from user_showcase us
+     join users u on us.user_id = u.id
+     left join game g on us.featured_game_id = g.id
+where u.uuid = @user_uuid;
+
+-- name: GetUserShowcaseAchievements :many
+select usa.slot,
+       g.uuid as game_uuid,
+       a.slug,
+       a.name,
+       a.description,
+       coalesce(ar.completion_percent, 0)::double precision as rarity
+from user_showcase_achievement usa
+     join users u on usa.user_id = u.id
+     join achievement a on usa.achievement_id = a.id
+     join game g on a.game_id = g.id
+     left join achievement_rarity ar on a.id = ar.id
+where u.uuid = @user_uuid
+order by usa.slot;
+
+-- name: GetUserShowcaseGames :many
+select usg.slot,
+       g.uuid as game_uuid,
+       coalesce(gc.unlock_count, 0)::bigint as unlock_count,
+       (select count(*) from achievement ga where ga.game_id = g.id) as achievement_count
+from user_showcase_game usg
+     join users u on usg.user_id = u.id
+     join game g on usg.game_id = g.id
+     left join game_completion gc on g.id = gc.game_id and u.id = gc.user_id
+where u.uuid = @user_uuid
+order by usg.slot;
+
+-- name: FindUserPlayedGame :one
+select g.id
+from game g
+where g.uuid = @game_uuid
+  and exists (select * from game_session gs where gs.game_id = g.id and gs.user_id = @user_id);
+
+-- name: FindUserUnlockedAchievement :one
+select a.id
+from achievement a
+     join game g on a.game_id = g.id
+     join achievement_progress ap on a.id = ap.achievement_id and ap.progress >= a.progress_requirement
+where g.uuid = @game_uuid and a.slug = @slug and ap.user_id = @user_id and ap.revoked_at is null;
+
+-- name: UpsertUserShowcase :exec
+insert into user_showcase (user_id, featured_game_id, hidden_sections)
+values (@user_id, sqlc.narg(featured_game_id), @hidden_sections::text[])
+on conflict (user_id) do update set featured_game_id = excluded.featured_game_id,
+                                    hidden_sections  = excluded.hidden_sections;
+
+-- name: ClearUserShowcaseAchievements :exec
+delete
+from user_showcase_achievement
+where user_id = @user_id;
+
+-- name: AddUserShowcaseAchievement :exec
+insert into user_showcase_achievement (user_id, slot, achievement_id)
+values (@user_id, @slot, @achievement_id);
+
+-- name: ClearUserShowcaseGames :exec
+delete
+from user_showcase_game
+where user_id = @user_id;
+
+-- name: AddUserShowcaseGame :exec
+insert into user_showcase_game (user_id, slot, game_id)
+values (@user_id, @slot, @game_id);
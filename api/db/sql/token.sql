@@ -1,13 +1,14 @@
 -- name: CreateToken :one
-insert into token (issuer, subject, audience, expires_at, not_before, issued_at)
-values ($1, $2, $3, $4, $5, $6)
+insert into token (issuer, subject, audience, expires_at, not_before, issued_at, ip_address, user_agent)
+values (@issuer, @subject, @audience, @expires_at, @not_before, @issued_at, sqlc.narg(ip_address),
+        sqlc.narg(user_agent))
 returning *;
 
 -- name: DisallowToken :exec
 insert into token_disallow_list (token_id) values ($1);
 
 -- name: FindUserGameTokens :many
-select gt.created_at, gt.expires_at, gt.uuid, gt.comment, g.uuid as game_uuid, g.slug as game_slug, d.slug as developer_slug
+select gt.created_at, gt.expires_at, gt.uuid, gt.comment, gt.scopes, gt.lookup_prefix, g.uuid as game_uuid, g.slug as game_slug, d.slug as developer_slug
 from game_token gt
 join game g on gt.game_id = g.id
 join developer d on g.developer_id = d.id -- TODO: developer_latest_display_name
@@ -23,27 +24,97 @@ with target_user as (
     join developer d on g.developer_id = d.id
     where g.uuid = @game_uuid
 )
-insert into game_token (expires_at, comment, game_id, user_id)
-values (@expires_at, @comment, (select id from target_game), (select id from target_user))
+insert into game_token (expires_at, comment, scopes, lookup_prefix, token_hash, game_id, user_id)
+values (@expires_at, @comment, @scopes::text[], @lookup_prefix::text, @token_hash::bytea, (select id from target_game),
+        (select id from target_user))
+-- nothing is returned if the lookup prefix collides, rather than failing the transaction the token is created in
+on conflict (lookup_prefix) do nothing
 returning
     game_token.uuid,
     game_token.expires_at,
     game_token.created_at,
     game_token.comment,
+    game_token.scopes,
+    game_token.lookup_prefix::text as lookup_prefix,
+    game_token.user_id,
     (select uuid as game_uuid from target_game),
     (select slug as game_slug from target_game),
     (select developer_slug from target_game);
 
 -- name: ExpireToken :execrows
-delete
-from game_token gt
-where gt.user_id = (select u.id from users u where u.uuid = @user_uuid)
-  and gt.uuid = @uuid;
+-- the token is expired rather than deleted since its game sessions still refer to it, and they're ended along with it
+with target_token as (
+    select gt.id
+    from game_token gt
+    where gt.user_id = (select u.id from users u where u.uuid = @user_uuid)
+      and gt.uuid = @uuid
+      and gt.expires_at > now()
+), ended_sessions as (
+    update game_session gs
+    set ended_at = now()
+    where gs.game_token_id = (select id from target_token) and gs.ended_at is null
+)
+update game_token gt
+set expires_at = now()
+where gt.id = (select id from target_token);
 
 -- name: FindTokenWithUser :one
-select u.uuid as user_uuid, g.uuid as game_uuid
+select gt.uuid, gt.token_hash, gt.scopes, u.uuid as user_uuid, g.uuid as game_uuid
+from game_token gt
+join game g on gt.game_id = g.id
+join users u on gt.user_id = u.id
+where gt.lookup_prefix = @lookup_prefix::text and gt.expires_at > now()
+limit 1;
+
+-- name: FindLegacyTokenWithUser :one
+select gt.uuid, gt.token_hash, gt.scopes, u.uuid as user_uuid, g.uuid as game_uuid
 from game_token gt
 join game g on gt.game_id = g.id
 join users u on gt.user_id = u.id
-where gt.uuid = @uuid and gt.expires_at > now()
-limit 1;
\ No newline at end of file
+where gt.uuid = @uuid and gt.token_hash is null and gt.expires_at > now()
+limit 1;
+
+-- name: RotateGameToken :execrows
+-- the sessions started with the old secret are ended along with it
+with target_token as (
+    select gt.id
+    from game_token gt
+    where gt.user_id = (select u.id from users u where u.uuid = @user_uuid)
+      and gt.uuid = @uuid
+      and gt.expires_at > now()
+), ended_sessions as (
+    update game_session gs
+    set ended_at = now()
+    where gs.game_token_id = (select id from target_token) and gs.ended_at is null
+)
+update game_token gt
+set lookup_prefix = @lookup_prefix::text,
+    token_hash    = @token_hash::bytea
+where gt.id = (select id from target_token);
+
+-- name: IsTokenDisallowed :one
+select exists (select * from token_disallow_list tdl where tdl.token_id = @token_id);
+
+-- name: DeleteExpiredDisallowedTokens :execrows
+delete
+from token_disallow_list tdl
+    using token t
+where tdl.token_id = t.id and t.expires_at < @expired_before;
+
+-- name: DeleteExpiredTokens :execrows
+delete
+from token t
+where t.expires_at < @expired_before
+  and not exists (select * from token_disallow_list tdl where tdl.token_id = t.id);
+
+-- name: TouchToken :exec
+update token
+set last_seen_at = now()
+where id = @id;
+
+-- name: GetUserSessionTokens :many
+select t.*
+from token t
+where t.subject = @subject and t.audience = @audience and t.expires_at > now()
+  and not exists (select * from token_disallow_list tdl where tdl.token_id = t.id)
+order by coalesce(t.last_seen_at, t.issued_at) desc;
@@ -20,7 +20,7 @@ select
     ua.blurhash as avatar_blurhash
 from users u
      left outer join user_latest_display_name uldn on u.id = uldn.user_id
-     left outer join user_avatar ua on u.id = ua.user_id
+     left outer join user_current_avatar ua on u.id = ua.user_id
 where u.uuid = @user_uuid
 limit 1;
 
@@ -64,6 +64,11 @@ insert into user_password(user_id, encoded_hash) values ($1, $2);
 -- name: GetUserPassword :one
 select * from user_password where user_id = @user_id;
 
+-- name: DeleteUserPassword :execrows
+delete
+from user_password
+where user_id = @user_id;
+
 -- name: ReplacePassword :exec
 update user_password
     set encoded_hash = @encoded_hash
@@ -97,3 +102,45 @@ select d.slug, d.created_at, dm.created_at as joined_at
 from developer_member dm
      join developer d on dm.developer_id = d.id
 where dm.user_id = $1;
+
+-- name: GetUsersProfileFields :many
+select u.uuid, u.bio_text, u.pronouns, u.country
+from users u
+where u.uuid = any(@user_uuids::uuid[]);
+
+-- name: UpdateUserProfileFields :exec
+update users
+set bio_text = case when sqlc.narg(bio_text)::text is null then bio_text else nullif(sqlc.narg(bio_text)::text, '') end,
+    pronouns = case when sqlc.narg(pronouns)::text is null then pronouns else nullif(sqlc.narg(pronouns)::text, '') end,
+    country  = case when sqlc.narg(country)::text is null then country else nullif(sqlc.narg(country)::text, '') end
+where id = @user_id;
+
+-- name: GetUsersLinks :many
+select u.uuid as user_uuid, sqlc.embed(ul)
+from user_link ul
+     join users u on ul.user_id = u.id
+where u.uuid = any(@user_uuids::uuid[])
+order by ul.user_id, ul.position;
+
+-- name: RemoveUserLinksExcept :exec
+delete
+from user_link
+where user_id = @user_id and not (url = any(@urls::text[]));
+
+-- name: UpsertUserLinks :exec
+insert into user_link (user_id, url, position)
+select @user_id, links.url, links.position
+from unnest(@urls::text[]) with ordinality as links(url, position)
+on conflict (user_id, url) do update set position = excluded.position;
+
+-- name: FindUserLink :one
+select sqlc.embed(ul), u.slug as user_slug
+from user_link ul
+     join users u on ul.user_id = u.id
+where ul.user_id = @user_id and ul.uuid = @link_uuid;
+
+-- name: SetUserLinkVerified :exec
+update user_link
+set checked_at  = now(),
+    verified_at = case when @verified::boolean then coalesce(verified_at, now()) end
+where id = @id;
@@ -0,0 +1,47 @@
+-- name: GetUserWebAuthnCredentials :many
+select *
+from webauthn_credential
+where user_id = @user_id
+order by id;
+
+-- name: GetWebAuthnCredentialsByUserUuid :many
+select wc.*
+from webauthn_credential wc
+     join users u on wc.user_id = u.id
+where u.uuid = @user_uuid
+order by wc.id;
+
+-- name: AddWebAuthnCredential :one
+insert into webauthn_credential (user_id, credential_id, name, credential)
+values (@user_id, @credential_id, @name, @credential)
+returning *;
+
+-- name: UpdateWebAuthnCredential :exec
+update webauthn_credential
+set credential   = @credential,
+    last_used_at = now()
+where credential_id = @credential_id;
+
+-- name: DeleteWebAuthnCredential :execrows
+delete
+from webauthn_credential
+where user_id = @user_id and uuid = @credential_uuid;
+
+-- name: CreateWebAuthnCeremony :one
+insert into webauthn_ceremony (user_id, kind, session_data, expires_at)
+values (sqlc.narg(user_id), @kind, @session_data, @expires_at)
+returning uuid;
+
+-- name: TakeWebAuthnCeremony :one
+delete
+from webauthn_ceremony
+where uuid = @ceremony_uuid
+  and kind = @kind
+  and user_id is not distinct from sqlc.narg(user_id)
+  and expires_at > now()
+returning session_data;
+
+-- name: DeleteExpiredWebAuthnCeremonies :exec
+delete
+from webauthn_ceremony
+where expires_at <= now();
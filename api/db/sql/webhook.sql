@@ -0,0 +1,77 @@
+-- name: IsGameDeveloperMember :one
+select exists (select *
+               from developer_member dm
+                    join game g on dm.developer_id = g.developer_id
+               where dm.user_id = @user_id and g.uuid = @game_uuid);
+
+-- name: CreateWebhook :one
+insert into webhook (game_id, url, events)
+select g.id, @url, @events::text[]
+from game g
+where g.uuid = @game_uuid
+returning *;
+
+-- name: GetGameWebhooks :many
+select w.*
+from webhook w
+     join game g on w.game_id = g.id
+where g.uuid = @game_uuid
+order by w.uuid;
+
+-- name: FindGameWebhook :one
+select w.*
+from webhook w
+     join game g on w.game_id = g.id
+where g.uuid = @game_uuid and w.uuid = @webhook_uuid;
+
+-- name: DeleteWebhook :one
+delete
+from webhook w
+using game g
+where w.game_id = g.id and g.uuid = @game_uuid and w.uuid = @webhook_uuid
+returning w.id;
+
+-- name: GetWebhookDeliveries :many
+select wd.*
+from webhook_delivery wd
+where wd.webhook_id = @webhook_id
+  and (sqlc.narg(after)::uuid is null or wd.uuid < sqlc.narg(after)::uuid)
+order by wd.uuid desc
+limit $1;
+
+-- name: ReplayWebhookDelivery :one
+insert into webhook_delivery (webhook_id, event)
+select wd.webhook_id, wd.event
+from webhook_delivery wd
+where wd.webhook_id = @webhook_id and wd.uuid = @delivery_uuid
+returning *;
+
+-- name: ClaimWebhookDeliveries :many
+update webhook_delivery wd
+set attempt_count   = wd.attempt_count + 1,
+    last_attempt_at = now(),
+    next_attempt_at = @lease_expires_at
+from webhook w
+where wd.webhook_id = w.id
+  and wd.id in (select pending.id
+                from webhook_delivery pending
+                where pending.status = 'pending' and pending.next_attempt_at <= now()
+                order by pending.next_attempt_at
+                limit $1 for update skip locked)
+returning wd.id, wd.uuid, wd.webhook_id, wd.event, wd.attempt_count, w.url;
+
+-- name: SucceedWebhookDelivery :exec
+update webhook_delivery
+set status           = 'succeeded',
+    delivered_at     = now(),
+    last_status_code = @status_code,
+    last_error       = null
+where id = @id;
+
+-- name: FailWebhookDelivery :exec
+update webhook_delivery
+set status           = case when @give_up::bool then 'failed' else 'pending' end,
+    next_attempt_at  = @next_attempt_at,
+    last_status_code = sqlc.narg(status_code),
+    last_error       = @error
+where id = @id;
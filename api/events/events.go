@@ -0,0 +1,210 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dresswithpockets/openstats/app/auth"
+	"github.com/dresswithpockets/openstats/app/db"
+	"github.com/dresswithpockets/openstats/app/log"
+	"github.com/dresswithpockets/openstats/app/rid"
+	"github.com/google/uuid"
+)
+
+// Channel is the postgres NOTIFY channel that user events are published on. See publish_user_event in the webhooks
+// migration for how events are published.
+const Channel = "openstats_user_events"
+
+type Kind string
+
+const (
+	AchievementUnlocked Kind = "achievement-unlocked"
+	ProgressChanged     Kind = "progress-changed"
+	SessionStarted      Kind = "session-started"
+	SessionEnded        Kind = "session-ended"
+	GameCompleted       Kind = "game-completed"
+)
+
+// Event is the payload of a notification on Channel, and the event queued for webhook deliveries
+type Event struct {
+	Kind                Kind          `json:"kind"`
+	UserUuid            uuid.UUID     `json:"userUuid"`
+	GameUuid            uuid.UUID     `json:"gameUuid"`
+	SessionUuid         uuid.NullUUID `json:"sessionUuid"`
+	AchievementSlug     string        `json:"achievementSlug"`
+	Progress            int32         `json:"progress"`
+	ProgressRequirement int32         `json:"progressRequirement"`
+}
+
+type AchievementProgressMessage struct {
+	User                rid.RID `json:"user" readOnly:"true"`
+	Game                rid.RID `json:"game" readOnly:"true"`
+	Achievement         string  `json:"achievement" readOnly:"true" doc:"The slug of the achievement"`
+	Progress            int32   `json:"progress" readOnly:"true"`
+	ProgressRequirement int32   `json:"progressRequirement" readOnly:"true"`
+}
+
+type AchievementUnlockedMessage struct {
+	AchievementProgressMessage
+}
+
+type ProgressChangedMessage struct {
+	AchievementProgressMessage
+}
+
+type GameSessionMessage struct {
+	User    rid.RID `json:"user" readOnly:"true"`
+	Game    rid.RID `json:"game" readOnly:"true"`
+	Session rid.RID `json:"session" readOnly:"true"`
+}
+
+type SessionStartedMessage struct {
+	GameSessionMessage
+}
+
+type SessionEndedMessage struct {
+	GameSessionMessage
+}
+
+type GameCompletedMessage struct {
+	User rid.RID `json:"user" readOnly:"true"`
+	Game rid.RID `json:"game" readOnly:"true"`
+}
+
+// MessageTypes maps each SSE event name to the type of message sent with it, for use with sse.Register
+var MessageTypes = map[string]any{
+	string(AchievementUnlocked): AchievementUnlockedMessage{},
+	string(ProgressChanged):     ProgressChangedMessage{},
+	string(SessionStarted):      SessionStartedMessage{},
+	string(SessionEnded):        SessionEndedMessage{},
+	string(GameCompleted):       GameCompletedMessage{},
+}
+
+var ErrUnknownKind = errors.New("unknown event kind")
+
+// Message returns the public representation of the event, which is one of the types in MessageTypes. It returns
+// ErrUnknownKind if the event's kind has no message, e.g. if it was published by a newer version of the server.
+func (e Event) Message() (any, error) {
+	userRid := rid.From(auth.UserRidPrefix, e.UserUuid)
+	gameRid := rid.From(auth.GameRidPrefix, e.GameUuid)
+
+	switch e.Kind {
+	case AchievementUnlocked, ProgressChanged:
+		progress := AchievementProgressMessage{
+			User:                userRid,
+			Game:                gameRid,
+			Achievement:         e.AchievementSlug,
+			Progress:            e.Progress,
+			ProgressRequirement: e.ProgressRequirement,
+		}
+
+		if e.Kind == AchievementUnlocked {
+			return AchievementUnlockedMessage{progress}, nil
+		}
+
+		return ProgressChangedMessage{progress}, nil
+	case SessionStarted, SessionEnded:
+		session := GameSessionMessage{
+			User:    userRid,
+			Game:    gameRid,
+			Session: rid.From(auth.GameSessionRidPrefix, e.SessionUuid.UUID),
+		}
+
+		if e.Kind == SessionStarted {
+			return SessionStartedMessage{session}, nil
+		}
+
+		return SessionEndedMessage{session}, nil
+	case GameCompleted:
+		return GameCompletedMessage{
+			User: userRid,
+			Game: gameRid,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrUnknownKind, e.Kind)
+}
+
+// subscriberBufferSize is the number of events that may be queued for a subscriber before new events are dropped
+const subscriberBufferSize = 32
+
+type Broker struct {
+	mu          sync.RWMutex
+	subscribers map[uuid.UUID]map[chan Event]struct{}
+}
+
+func NewBroker() *Broker {
+	return &Broker{
+		subscribers: map[uuid.UUID]map[chan Event]struct{}{},
+	}
+}
+
+// Subscribe returns a channel which receives every event published for the user, and a function which must be called
+// once the subscriber is no longer interested in events.
+func (b *Broker) Subscribe(userUuid uuid.UUID) (<-chan Event, func()) {
+	events := make(chan Event, subscriberBufferSize)
+
+	b.mu.Lock()
+	if b.subscribers[userUuid] == nil {
+		b.subscribers[userUuid] = map[chan Event]struct{}{}
+	}
+	b.subscribers[userUuid][events] = struct{}{}
+	b.mu.Unlock()
+
+	unsubscribe := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		delete(b.subscribers[userUuid], events)
+		if len(b.subscribers[userUuid]) == 0 {
+			delete(b.subscribers, userUuid)
+		}
+	}
+
+	return events, unsubscribe
+}
+
+// Publish sends the event to every subscriber of the event's user. Subscribers which aren't keeping up will miss the
+// event rather than block the publisher.
+func (b *Broker) Publish(event Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for events := range b.subscribers[event.UserUuid] {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
+
+var Default = NewBroker()
+
+// Run relays every event published on Channel to the Default broker until ctx is done. If the listening connection
+// fails, Run reconnects after retryDelay.
+func Run(ctx context.Context, retryDelay time.Duration) {
+	for {
+		err := db.DB.Listen(ctx, Channel, func(payload string) {
+			var event Event
+			if err := json.Unmarshal([]byte(payload), &event); err != nil {
+				log.Logger.Error("error decoding user event", "error", err, "payload", payload)
+				return
+			}
+
+			Default.Publish(event)
+		})
+		if err != nil {
+			log.Logger.Error("error listening for user events", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryDelay):
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dresswithpockets/openstats/app/anomalies"
+	"github.com/dresswithpockets/openstats/app/auth"
+	"github.com/dresswithpockets/openstats/app/db"
+	"github.com/dresswithpockets/openstats/app/db/query"
+	"github.com/dresswithpockets/openstats/app/rid"
+	"github.com/dresswithpockets/openstats/app/validation"
+	"github.com/google/uuid"
+	"github.com/rotisserie/eris"
+)
+
+// Anomaly is progress towards an achievement which was flagged as suspicious when it was submitted
+type Anomaly struct {
+	RID                 rid.RID           `json:"rid" readOnly:"true"`
+	CreatedAt           time.Time         `json:"createdAt" readOnly:"true"`
+	Kind                anomalies.Kind    `json:"kind" readOnly:"true" enum:"burst-unlock,unlock-at-session-start,progress-jump"`
+	Details             map[string]string `json:"details" readOnly:"true" doc:"Depends on the kind, e.g. how many achievements were unlocked in the burst, or the progress before and after the jump"`
+	State               anomalies.State   `json:"state" readOnly:"true" enum:"open,dismissed,revoked"`
+	ReviewedAt          *time.Time        `json:"reviewedAt,omitempty" readOnly:"true"`
+	ReviewedBy          string            `json:"reviewedBy,omitempty" readOnly:"true" doc:"The slug of the user who reviewed the anomaly"`
+	User                rid.RID           `json:"user" readOnly:"true"`
+	UserSlug            string            `json:"userSlug" readOnly:"true"`
+	Game                rid.RID           `json:"game" readOnly:"true"`
+	GameSlug            string            `json:"gameSlug" readOnly:"true"`
+	Achievement         string            `json:"achievement" readOnly:"true" doc:"The slug of the achievement"`
+	Progress            int32             `json:"progress" readOnly:"true" doc:"The user's current progress towards the achievement"`
+	ProgressRequirement int32             `json:"progressRequirement" readOnly:"true"`
+	UnlockedAt          *time.Time        `json:"unlockedAt,omitempty" readOnly:"true"`
+	Revoked             bool              `json:"revoked" readOnly:"true" doc:"Whether the unlock has been revoked"`
+	Session             *rid.RID          `json:"session,omitempty" readOnly:"true" doc:"The game session the progress was submitted in"`
+}
+
+func (a *Anomaly) MapFromRow(row query.GetAchievementAnomaliesRow) error {
+	*a = Anomaly{
+		RID:                 rid.From(anomalies.AnomalyRidPrefix, row.Uuid),
+		CreatedAt:           row.CreatedAt,
+		Kind:                anomalies.Kind(row.Kind),
+		State:               anomalies.State(row.State),
+		User:                rid.From(auth.UserRidPrefix, row.UserUuid),
+		UserSlug:            row.UserSlug,
+		Game:                rid.From(GameRidPrefix, row.GameUuid),
+		GameSlug:            row.GameSlug,
+		Achievement:         row.AchievementSlug,
+		Progress:            row.Progress.Int32,
+		ProgressRequirement: row.ProgressRequirement,
+		Revoked:             row.Revoked,
+	}
+
+	if row.ReviewedAt.Valid {
+		a.ReviewedAt = &row.ReviewedAt.Time
+	}
+
+	if row.ReviewedBySlug != nil {
+		a.ReviewedBy = *row.ReviewedBySlug
+	}
+
+	if row.UnlockedAt.Valid {
+		a.UnlockedAt = &row.UnlockedAt.Time
+	}
+
+	if row.GameSessionUuid.Valid {
+		sessionRid := rid.From(auth.GameSessionRidPrefix, row.GameSessionUuid.UUID)
+		a.Session = &sessionRid
+	}
+
+	return eris.Wrap(json.Unmarshal(row.Details, &a.Details), "error decoding anomaly details")
+}
+
+type AnomalyList struct {
+	Anomalies []Anomaly `json:"anomalies"`
+}
+
+// GetAnomalies gets anomalies newest first, optionally only those in the game
+func GetAnomalies(ctx context.Context, gameUuid uuid.NullUUID, state validation.Optional[string], after validation.Optional[rid.RID], limit int) (AnomalyList, error) {
+	params := query.GetAchievementAnomaliesParams{Limit: int32(limit), GameUuid: gameUuid}
+	if state.HasValue {
+		params.State = &state.Value
+	}
+
+	// TODO: a huma validator for rid prefix...
+	if after.HasValue {
+		if after.Value.Prefix != anomalies.AnomalyRidPrefix {
+			return AnomalyList{}, huma.Error400BadRequest("invalid anomaly id")
+		}
+
+		params.After = uuid.NullUUID{UUID: after.Value.ID, Valid: true}
+	}
+
+	rows, err := db.Queries.GetAchievementAnomalies(ctx, params)
+	if err != nil {
+		return AnomalyList{}, eris.Wrap(err, "error getting achievement anomalies")
+	}
+
+	items := make([]Anomaly, len(rows))
+	for idx := range rows {
+		if err = items[idx].MapFromRow(rows[idx]); err != nil {
+			return AnomalyList{}, err
+		}
+	}
+
+	return AnomalyList{Anomalies: items}, nil
+}
+
+// ResolveAnomalyBody is how a reviewer resolves an anomaly
+type ResolveAnomalyBody struct {
+	State anomalies.State `json:"state" enum:"dismissed,revoked" doc:"Dismiss the anomaly, or revoke the unlock it was flagged for. Revoking resolves every other open anomaly for the same unlock."`
+}
+
+// ResolveAnomaly resolves the anomaly as the current session's user. If gameUuid is set, the anomaly must belong to that
+// game.
+func ResolveAnomaly(ctx context.Context, anomalyRid rid.RID, gameUuid uuid.NullUUID, state anomalies.State) error {
+	principal, hasPrincipal := auth.GetPrincipal(ctx)
+	if !hasPrincipal {
+		// shouldn't ever get here due to middleware check
+		return huma.Error401Unauthorized("no session")
+	}
+
+	// TODO: a huma validator for rid prefix...
+	if anomalyRid.Prefix != anomalies.AnomalyRidPrefix {
+		return huma.Error404NotFound("anomaly not found")
+	}
+
+	err := anomalies.Resolve(ctx, principal.User.ID, anomalyRid.ID, gameUuid, state)
+	if errors.Is(err, anomalies.ErrAnomalyNotFound) {
+		return huma.Error404NotFound("anomaly not found")
+	}
+
+	if errors.Is(err, anomalies.ErrAnomalyAlreadyReviewed) {
+		return huma.Error409Conflict("the anomaly has already been reviewed")
+	}
+
+	return err
+}
+
+type GetGameAnomaliesInput struct {
+	GameRID rid.RID                      `path:"game"`
+	State   validation.Optional[string]  `query:"state,omitempty" enum:"open,dismissed,revoked" doc:"Only return anomalies in this state"`
+	After   validation.Optional[rid.RID] `query:"after,omitempty" doc:"Only return anomalies older than this anomaly"`
+	Limit   validation.Optional[int]     `query:"limit" minimum:"1" maximum:"50" doc:"default = 20"`
+}
+
+type GetGameAnomaliesOutput struct {
+	Body AnomalyList
+}
+
+func HandleGetGameAnomalies(ctx context.Context, input *GetGameAnomaliesInput) (*GetGameAnomaliesOutput, error) {
+	if err := ensureGameDeveloper(ctx, input.GameRID); err != nil {
+		return nil, err
+	}
+
+	gameUuid := uuid.NullUUID{UUID: input.GameRID.ID, Valid: true}
+	list, err := GetAnomalies(ctx, gameUuid, input.State, input.After, input.Limit.ValueOr(20))
+	if err != nil {
+		return nil, err
+	}
+
+	return &GetGameAnomaliesOutput{Body: list}, nil
+}
+
+type ResolveGameAnomalyInput struct {
+	GameRID    rid.RID `path:"game"`
+	AnomalyRID rid.RID `path:"anomaly"`
+	Body       ResolveAnomalyBody
+}
+
+func HandleResolveGameAnomaly(ctx context.Context, input *ResolveGameAnomalyInput) (*struct{}, error) {
+	if err := ensureGameDeveloper(ctx, input.GameRID); err != nil {
+		return nil, err
+	}
+
+	gameUuid := uuid.NullUUID{UUID: input.GameRID.ID, Valid: true}
+	return nil, ResolveAnomaly(ctx, input.AnomalyRID, gameUuid, input.Body.State)
+}
@@ -5,7 +5,9 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/danielgtaylor/huma/v2"
@@ -85,8 +87,50 @@ type SignInInput struct {
 	Body SignInBody
 }
 
+type SignInResult struct {
+	MfaRequired  bool     `json:"mfaRequired" doc:"When true, no session was created; the challenge must be completed at /sign-in/mfa"`
+	MfaChallenge *rid.RID `json:"mfaChallenge,omitempty"`
+}
+
 type SignInOutput struct {
-	SetCookie http.Cookie `header:"Set-Cookie"`
+	SetCookie *http.Cookie `header:"Set-Cookie"`
+	Body      SignInResult
+}
+
+// newSessionCookie creates the cookie used to authenticate the user's session, for a token created by
+// auth.CreateSessionToken
+func newSessionCookie(signedJwt string, token query.Token) http.Cookie {
+	return http.Cookie{
+		Name:     auth.SessionCookieName,
+		Path:     "/",
+		Value:    signedJwt,
+		MaxAge:   int(token.ExpiresAt.Sub(time.Now().UTC()).Seconds()),
+		Expires:  token.ExpiresAt,
+		Secure:   env.GetBool("OPENSTATS_SESSION_COOKIE_SECURE"),
+		SameSite: http.SameSiteStrictMode,
+	}
+}
+
+// humaAccountLockedError converts an auth.AccountLockedError into a 429 Too Many Requests, telling the client when
+// to retry. Other errors are returned as is.
+func humaAccountLockedError(err error) error {
+	var lockedErr *auth.AccountLockedError
+	if !errors.As(err, &lockedErr) {
+		return err
+	}
+
+	retryAfter := strconv.Itoa(int(math.Ceil(lockedErr.RetryAfter.Seconds())))
+	return huma.ErrorWithHeaders(huma.Error429TooManyRequests(lockedErr.Error()), http.Header{"Retry-After": {retryAfter}})
+}
+
+// humaUserSuspendedError tells a suspended user why they can't sign in
+func humaUserSuspendedError(err error) error {
+	var suspendedErr *auth.UserSuspendedError
+	if !errors.As(err, &suspendedErr) {
+		return err
+	}
+
+	return huma.Error403Forbidden(suspendedErr.Error())
 }
 
 func HandlePostSignIn(ctx context.Context, loginBody *SignInInput) (*SignInOutput, error) {
@@ -99,8 +143,14 @@ func HandlePostSignIn(ctx context.Context, loginBody *SignInInput) (*SignInOutpu
 		return nil, findErr
 	}
 
+	if err := auth.ReserveAttempt(ctx, result.ID, auth.SignInAttempts); err != nil {
+		return nil, humaAccountLockedError(err)
+	}
+
 	verifyErr := password.VerifyPassword(loginBody.Body.Password, result.EncodedHash)
 	if errors.Is(verifyErr, password.ErrHashMismatch) {
+		auth.RecordSecurityEvent(ctx, result.ID, auth.SecurityEventSignInFailed, map[string]string{"method": "password"})
+
 		return nil, huma.Error404NotFound("credentials don't match")
 	}
 
@@ -108,22 +158,39 @@ func HandlePostSignIn(ctx context.Context, loginBody *SignInInput) (*SignInOutpu
 		return nil, verifyErr
 	}
 
+	mfaEnabled, mfaErr := auth.IsMfaEnabled(ctx, result.ID)
+	if mfaErr != nil {
+		return nil, mfaErr
+	}
+
+	if mfaEnabled {
+		challenge, challengeErr := auth.CreateMfaChallenge(ctx, result.ID)
+		if challengeErr != nil {
+			return nil, challengeErr
+		}
+
+		challengeRid := rid.From(MfaChallengeRidPrefix, challenge.Uuid)
+		return &SignInOutput{
+			Body: SignInResult{
+				MfaRequired:  true,
+				MfaChallenge: &challengeRid,
+			},
+		}, nil
+	}
+
+	// failures are only forgotten once the user is signed in, since MFA codes count towards them too
+	if err := auth.ClearFailedAttempts(ctx, db.Queries, result.ID, auth.SignInAttempts); err != nil {
+		return nil, err
+	}
+
 	signedJwt, token, createErr := auth.CreateSessionToken(ctx, result.Uuid)
 	if createErr != nil {
-		return nil, createErr
+		return nil, humaUserSuspendedError(createErr)
 	}
 
-	return &SignInOutput{
-		SetCookie: http.Cookie{
-			Name:     auth.SessionCookieName,
-			Path:     "/",
-			Value:    signedJwt,
-			MaxAge:   int(token.ExpiresAt.Sub(time.Now().UTC()).Seconds()),
-			Expires:  token.ExpiresAt,
-			Secure:   env.GetBool("OPENSTATS_SESSION_COOKIE_SECURE"),
-			SameSite: http.SameSiteStrictMode,
-		},
-	}, nil
+	auth.RecordSecurityEvent(ctx, result.ID, auth.SecurityEventSignIn, map[string]string{"method": "password"})
+	cookie := newSessionCookie(signedJwt, token)
+	return &SignInOutput{SetCookie: &cookie}, nil
 }
 
 type ResetPasswordInput struct {
@@ -143,10 +210,17 @@ func HandleResetPassword(ctx context.Context, input *ResetPasswordInput) (*Reset
 		return nil, huma.Error404NotFound("mismatched code or slug")
 	}
 
-	if err = auth.ReplaceUserPasswordWithTotpValidation(ctx, user.ID, input.Body.Code, input.Body.Password); err != nil {
+	err = auth.ReplaceUserPasswordWithTotpValidation(ctx, user.ID, input.Body.Code, input.Body.Password)
+	if errors.Is(err, auth.ErrInvalidTotpCode) {
 		return nil, huma.Error404NotFound("mismatched code or slug")
 	}
 
+	if err != nil {
+		return nil, humaAccountLockedError(err)
+	}
+
+	auth.RecordSecurityEvent(ctx, user.ID, auth.SecurityEventPasswordReset, nil)
+
 	return &ResetPasswordOutput{}, nil
 }
 
@@ -234,15 +308,7 @@ func HandlePostSignUp(ctx context.Context, registerBody *SignUpRequest) (*SignUp
 	}
 
 	return &SignUpResponse{
-		SetCookie: http.Cookie{
-			Name:     auth.SessionCookieName,
-			Path:     "/",
-			Value:    signedJwt,
-			MaxAge:   int(token.ExpiresAt.Sub(time.Now().UTC()).Seconds()),
-			Expires:  token.ExpiresAt,
-			Secure:   env.GetBool("OPENSTATS_SESSION_COOKIE_SECURE"),
-			SameSite: http.SameSiteStrictMode,
-		},
+		SetCookie: newSessionCookie(signedJwt, token),
 		Body: Registration{
 			Email:                 registerBody.Body.Email,
 			EmailConfirmationSent: emailSent,
@@ -0,0 +1,77 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dresswithpockets/openstats/app/auth"
+	"github.com/dresswithpockets/openstats/app/rid"
+)
+
+type DeviceUserCodeInput struct {
+	UserCode string `path:"userCode" doc:"The code shown by the game. Case and dashes are ignored."`
+}
+
+// deviceError converts errors from device authorization into client errors where appropriate
+func deviceError(err error) error {
+	if errors.Is(err, auth.ErrInvalidUserCode) {
+		return huma.Error404NotFound("the code is invalid or expired; check the code shown by the game")
+	}
+
+	return err
+}
+
+type GetDeviceAuthorizationOutput struct {
+	Body struct {
+		Game      InternalGame `json:"game" readOnly:"true" doc:"The game requesting a game token for the current user"`
+		ExpiresAt time.Time    `json:"expiresAt" readOnly:"true"`
+	}
+}
+
+func HandleGetDeviceAuthorization(ctx context.Context, input *DeviceUserCodeInput) (*GetDeviceAuthorizationOutput, error) {
+	row, err := auth.FindPendingDeviceAuthorization(ctx, input.UserCode)
+	if err != nil {
+		return nil, deviceError(err)
+	}
+
+	output := &GetDeviceAuthorizationOutput{}
+	output.Body.Game = InternalGame{
+		RID: rid.From(GameRidPrefix, row.GameUuid),
+		Developer: Developer{
+			FriendlyName: row.DeveloperSlug,
+		},
+		FriendlyName: row.GameSlug,
+	}
+	output.Body.ExpiresAt = row.ExpiresAt
+	return output, nil
+}
+
+func HandleApproveDeviceAuthorization(ctx context.Context, input *DeviceUserCodeInput) (*struct{}, error) {
+	principal, hasPrincipal := auth.GetPrincipal(ctx)
+	if !hasPrincipal {
+		// shouldn't ever get here due to middleware check
+		return nil, huma.Error401Unauthorized("no session")
+	}
+
+	if err := auth.ApproveDeviceAuthorization(ctx, input.UserCode, principal.User.ID); err != nil {
+		return nil, deviceError(err)
+	}
+
+	return &struct{}{}, nil
+}
+
+func HandleDenyDeviceAuthorization(ctx context.Context, input *DeviceUserCodeInput) (*struct{}, error) {
+	principal, hasPrincipal := auth.GetPrincipal(ctx)
+	if !hasPrincipal {
+		// shouldn't ever get here due to middleware check
+		return nil, huma.Error401Unauthorized("no session")
+	}
+
+	if err := auth.DenyDeviceAuthorization(ctx, input.UserCode, principal.User.ID); err != nil {
+		return nil, deviceError(err)
+	}
+
+	return &struct{}{}, nil
+}
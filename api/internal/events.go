@@ -0,0 +1,38 @@
+package internal
+
+import (
+	"context"
+
+	"github.com/danielgtaylor/huma/v2/sse"
+	"github.com/dresswithpockets/openstats/app/auth"
+	"github.com/dresswithpockets/openstats/app/events"
+	"github.com/dresswithpockets/openstats/app/log"
+)
+
+func HandleGetSessionEvents(ctx context.Context, _ *struct{}, send sse.Sender) {
+	principal, hasPrincipal := auth.GetPrincipal(ctx)
+	if !hasPrincipal {
+		// shouldn't ever get here due to middleware check
+		return
+	}
+
+	userEvents, unsubscribe := events.Default.Subscribe(principal.User.Uuid)
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-userEvents:
+			message, err := event.Message()
+			if err != nil {
+				log.Logger.Warn("skipping user event", "error", err)
+				continue
+			}
+
+			if err = send.Data(message); err != nil {
+				return
+			}
+		}
+	}
+}
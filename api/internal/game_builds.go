@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"context"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dresswithpockets/openstats/app/auth"
+	"github.com/dresswithpockets/openstats/app/db"
+	"github.com/dresswithpockets/openstats/app/db/query"
+	"github.com/dresswithpockets/openstats/app/rid"
+	"github.com/rotisserie/eris"
+)
+
+type GameBuild struct {
+	RID       rid.RID   `json:"rid" readOnly:"true" required:"false"`
+	CreatedAt time.Time `json:"createdAt" readOnly:"true" required:"false"`
+	Name      string    `json:"name" minLength:"1" maxLength:"128" doc:"The build's version or platform, e.g. 1.2.0-windows"`
+	CreatedBy string    `json:"createdBy,omitempty" readOnly:"true" required:"false" doc:"The slug of the developer member who created the build"`
+	Secret    string    `json:"secret,omitempty" readOnly:"true" required:"false" doc:"The secret the build signs its progress with. Only returned when the build is created."`
+}
+
+func (b *GameBuild) MapFromRow(row query.GetGameBuildsRow) {
+	*b = GameBuild{
+		RID:       rid.From(auth.GameBuildRidPrefix, row.Uuid),
+		CreatedAt: row.CreatedAt,
+		Name:      row.Name,
+	}
+
+	if row.CreatedBySlug != nil {
+		b.CreatedBy = *row.CreatedBySlug
+	}
+}
+
+type GameBuildList struct {
+	Builds []GameBuild `json:"builds"`
+}
+
+type GameBuildsInput struct {
+	GameRID rid.RID `path:"game"`
+}
+
+type GetGameBuildsOutput struct {
+	Body GameBuildList
+}
+
+func HandleGetGameBuilds(ctx context.Context, input *GameBuildsInput) (*GetGameBuildsOutput, error) {
+	if err := ensureGameDeveloper(ctx, input.GameRID); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Queries.GetGameBuilds(ctx, input.GameRID.ID)
+	if err != nil {
+		return nil, eris.Wrap(err, "error getting game builds")
+	}
+
+	items := make([]GameBuild, len(rows))
+	for idx := range rows {
+		items[idx].MapFromRow(rows[idx])
+	}
+
+	return &GetGameBuildsOutput{Body: GameBuildList{Builds: items}}, nil
+}
+
+type PostGameBuildInput struct {
+	GameRID rid.RID `path:"game"`
+	Body    GameBuild
+}
+
+type PostGameBuildOutput struct {
+	Body GameBuild
+}
+
+func HandlePostGameBuild(ctx context.Context, input *PostGameBuildInput) (*PostGameBuildOutput, error) {
+	if err := ensureGameDeveloper(ctx, input.GameRID); err != nil {
+		return nil, err
+	}
+
+	principal, _ := auth.GetPrincipal(ctx)
+	build, secret, err := auth.CreateGameBuild(ctx, input.GameRID.ID, principal.User.ID, input.Body.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PostGameBuildOutput{
+		Body: GameBuild{
+			RID:       rid.From(auth.GameBuildRidPrefix, build.Uuid),
+			CreatedAt: build.CreatedAt,
+			Name:      build.Name,
+			CreatedBy: principal.User.Slug,
+			Secret:    secret,
+		},
+	}, nil
+}
+
+type GameBuildInput struct {
+	GameRID  rid.RID `path:"game"`
+	BuildRID rid.RID `path:"build"`
+}
+
+func HandleDeleteGameBuild(ctx context.Context, input *GameBuildInput) (*struct{}, error) {
+	if err := ensureGameDeveloper(ctx, input.GameRID); err != nil {
+		return nil, err
+	}
+
+	// TODO: a huma validator for rid prefix...
+	if input.BuildRID.Prefix != auth.GameBuildRidPrefix {
+		return nil, huma.Error400BadRequest("invalid build id")
+	}
+
+	deleted, err := auth.DeleteGameBuild(ctx, input.GameRID.ID, input.BuildRID.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !deleted {
+		return nil, huma.Error404NotFound("build not found")
+	}
+
+	return nil, nil
+}
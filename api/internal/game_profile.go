@@ -103,6 +103,19 @@ func GetGameProfile(ctx context.Context, gameUuid uuid.UUID) (*GameProfile, erro
 		}
 	}
 
+	var userRefs []*InternalUser
+	for idx := range recentAchievements {
+		userRefs = append(userRefs, &recentAchievements[idx].User)
+	}
+
+	for idx := range recentCompletionists {
+		userRefs = append(userRefs, &recentCompletionists[idx].User)
+	}
+
+	if err = loadUserProfileFields(ctx, userRefs...); err != nil {
+		return nil, err
+	}
+
 	return &GameProfile{
 		Game: InternalGame{
 			RID: rid.From(GameRidPrefix, gameUuid),
@@ -0,0 +1,63 @@
+package internal
+
+import (
+	"context"
+
+	"github.com/dresswithpockets/openstats/app/db"
+	"github.com/dresswithpockets/openstats/app/db/query"
+	"github.com/dresswithpockets/openstats/app/rid"
+	"github.com/rotisserie/eris"
+)
+
+type GameSettings struct {
+	ServerOnlyProgress    bool `json:"serverOnlyProgress" doc:"Only accept progress from the game's servers, authenticated by a server key. Game sessions may not submit progress."`
+	RequireSignedProgress bool `json:"requireSignedProgress" doc:"Only accept progress from game sessions which is signed by one of the game's builds. See X-Openstats-Signature."`
+}
+
+type GameSettingsInput struct {
+	GameRID rid.RID `path:"game"`
+}
+
+type GameSettingsOutput struct {
+	Body GameSettings
+}
+
+func HandleGetGameSettings(ctx context.Context, input *GameSettingsInput) (*GameSettingsOutput, error) {
+	if err := ensureGameDeveloper(ctx, input.GameRID); err != nil {
+		return nil, err
+	}
+
+	settings, err := db.Queries.GetGameProgressSettings(ctx, input.GameRID.ID)
+	if err != nil {
+		return nil, eris.Wrap(err, "error getting game settings")
+	}
+
+	return &GameSettingsOutput{
+		Body: GameSettings{
+			ServerOnlyProgress:    settings.ServerOnlyProgress,
+			RequireSignedProgress: settings.RequireSignedProgress,
+		},
+	}, nil
+}
+
+type PutGameSettingsInput struct {
+	GameRID rid.RID `path:"game"`
+	Body    GameSettings
+}
+
+func HandlePutGameSettings(ctx context.Context, input *PutGameSettingsInput) (*GameSettingsOutput, error) {
+	if err := ensureGameDeveloper(ctx, input.GameRID); err != nil {
+		return nil, err
+	}
+
+	err := db.Queries.SetGameProgressSettings(ctx, query.SetGameProgressSettingsParams{
+		ServerOnlyProgress:    input.Body.ServerOnlyProgress,
+		RequireSignedProgress: input.Body.RequireSignedProgress,
+		GameUuid:              input.GameRID.ID,
+	})
+	if err != nil {
+		return nil, eris.Wrap(err, "error updating game settings")
+	}
+
+	return &GameSettingsOutput{Body: input.Body}, nil
+}
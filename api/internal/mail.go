@@ -6,7 +6,9 @@ import (
 	"github.com/dresswithpockets/openstats/app/auth"
 	"github.com/dresswithpockets/openstats/app/db"
 	"github.com/dresswithpockets/openstats/app/db/query"
+	"github.com/dresswithpockets/openstats/app/log"
 	"github.com/dresswithpockets/openstats/app/mail"
+	"github.com/dresswithpockets/openstats/app/notifications"
 	"github.com/pquerna/otp/totp"
 	"github.com/rotisserie/eris"
 	"strconv"
@@ -75,6 +77,10 @@ func ValidateUserEmail(ctx context.Context, userId int32, email, passcode string
 		return false, nil
 	}
 
+	if err := auth.ReserveAttempt(ctx, userId, auth.CodeAttempts); err != nil {
+		return false, err
+	}
+
 	hmacSecret, dbErr := db.Queries.SecretRead(ctx, query.SecretReadParams{
 		Path: db.PrivateUser2faHmacSecretPath,
 		Key:  strconv.FormatInt(int64(userId), 10),
@@ -89,6 +95,14 @@ func ValidateUserEmail(ctx context.Context, userId int32, email, passcode string
 		return false, eris.Wrap(validateErr, "error validating OTP")
 	}
 
+	if !validated {
+		return false, nil
+	}
+
+	if err := auth.ClearFailedAttempts(ctx, db.Queries, userId, auth.CodeAttempts); err != nil {
+		return false, err
+	}
+
 	_, dbErr = db.Queries.ConfirmEmail(ctx, query.ConfirmEmailParams{
 		UserID: userId,
 		Email:  email,
@@ -98,5 +112,11 @@ func ValidateUserEmail(ctx context.Context, userId int32, email, passcode string
 		return false, eris.Wrap(dbErr, "error confirming user email in db")
 	}
 
-	return validated, nil
+	auth.RecordSecurityEvent(ctx, userId, auth.SecurityEventEmailConfirmed, map[string]string{"email": email})
+
+	if notifyErr := notifications.NotifyEmailConfirmed(ctx, userId, email); notifyErr != nil {
+		log.Logger.Error("error notifying user of email confirmation", "error", notifyErr)
+	}
+
+	return true, nil
 }
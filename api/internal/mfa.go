@@ -0,0 +1,185 @@
+package internal
+
+import (
+	"context"
+	"errors"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dresswithpockets/openstats/app/auth"
+	"github.com/dresswithpockets/openstats/app/password"
+	"github.com/dresswithpockets/openstats/app/rid"
+)
+
+const MfaChallengeRidPrefix = "mc"
+
+type MfaEnrollment struct {
+	Uri   string `json:"uri" readOnly:"true" doc:"The otpauth:// key URI to add to an authenticator app"`
+	QrPng []byte `json:"qrPng" readOnly:"true" contentEncoding:"base64" doc:"A base64-encoded PNG of a QR code for the key URI"`
+}
+
+type PostMfaEnrollOutput struct {
+	Body MfaEnrollment
+}
+
+func HandlePostMfaEnroll(ctx context.Context, _ *struct{}) (*PostMfaEnrollOutput, error) {
+	principal, hasPrincipal := auth.GetPrincipal(ctx)
+	if !hasPrincipal {
+		// shouldn't ever get here due to middleware check
+		return nil, huma.Error401Unauthorized("no session")
+	}
+
+	enrollment, err := auth.StartMfaEnrollment(ctx, principal.User)
+	if errors.Is(err, auth.ErrMfaAlreadyEnabled) {
+		return nil, huma.Error409Conflict("mfa is already enabled")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &PostMfaEnrollOutput{
+		Body: MfaEnrollment{
+			Uri:   enrollment.Uri,
+			QrPng: enrollment.QrPng,
+		},
+	}, nil
+}
+
+type PostMfaConfirmInput struct {
+	Body struct {
+		Code string `json:"code" minLength:"6" maxLength:"6" pattern:"[0-9]+" doc:"A code from the authenticator app"`
+	}
+}
+
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recoveryCodes" readOnly:"true" doc:"One-time codes which can be used in place of an authenticator app code. These are only shown once."`
+}
+
+type RecoveryCodesOutput struct {
+	Body RecoveryCodes
+}
+
+func HandlePostMfaConfirm(ctx context.Context, input *PostMfaConfirmInput) (*RecoveryCodesOutput, error) {
+	principal, hasPrincipal := auth.GetPrincipal(ctx)
+	if !hasPrincipal {
+		// shouldn't ever get here due to middleware check
+		return nil, huma.Error401Unauthorized("no session")
+	}
+
+	recoveryCodes, err := auth.ConfirmMfaEnrollment(ctx, principal.User.ID, input.Body.Code)
+	if errors.Is(err, auth.ErrMfaNotEnrolling) {
+		return nil, huma.Error404NotFound("mfa enrollment hasn't been started")
+	}
+
+	if errors.Is(err, auth.ErrMfaAlreadyEnabled) {
+		return nil, huma.Error409Conflict("mfa is already enabled")
+	}
+
+	if errors.Is(err, auth.ErrInvalidMfaCode) {
+		return nil, huma.Error400BadRequest("invalid code")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &RecoveryCodesOutput{Body: RecoveryCodes{RecoveryCodes: recoveryCodes}}, nil
+}
+
+type MfaPasswordInput struct {
+	Body struct {
+		CurrentPassword string `json:"currentPassword" required:"true" pattern:"[a-zA-Z0-9!@#$%^&*]+" patternDescription:"alphanum with specials" minLength:"10" maxLength:"32"`
+	}
+}
+
+func HandleDeleteMfa(ctx context.Context, input *MfaPasswordInput) (*struct{}, error) {
+	principal, hasPrincipal := auth.GetPrincipal(ctx)
+	if !hasPrincipal {
+		// shouldn't ever get here due to middleware check
+		return nil, huma.Error401Unauthorized("no session")
+	}
+
+	err := auth.DisableMfa(ctx, principal.User.ID, input.Body.CurrentPassword)
+	if errors.Is(err, password.ErrHashMismatch) {
+		return nil, huma.Error400BadRequest("incorrect password")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &struct{}{}, nil
+}
+
+func HandlePostRecoveryCodes(ctx context.Context, input *MfaPasswordInput) (*RecoveryCodesOutput, error) {
+	principal, hasPrincipal := auth.GetPrincipal(ctx)
+	if !hasPrincipal {
+		// shouldn't ever get here due to middleware check
+		return nil, huma.Error401Unauthorized("no session")
+	}
+
+	recoveryCodes, err := auth.RegenerateRecoveryCodes(ctx, principal.User.ID, input.Body.CurrentPassword)
+	if errors.Is(err, password.ErrHashMismatch) {
+		return nil, huma.Error400BadRequest("incorrect password")
+	}
+
+	if errors.Is(err, auth.ErrMfaNotEnabled) {
+		return nil, huma.Error404NotFound("mfa isn't enabled")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &RecoveryCodesOutput{Body: RecoveryCodes{RecoveryCodes: recoveryCodes}}, nil
+}
+
+type MfaChallengeBody struct {
+	Challenge    rid.RID `json:"challenge" doc:"The challenge returned by sign-in"`
+	Code         string  `json:"code,omitempty" required:"false" minLength:"6" maxLength:"6" pattern:"[0-9]+" doc:"A code from the authenticator app. Mutually exclusive with recoveryCode"`
+	RecoveryCode string  `json:"recoveryCode,omitempty" required:"false" maxLength:"32" doc:"One of the user's unused recovery codes. Mutually exclusive with code"`
+}
+
+func (b *MfaChallengeBody) Resolve(_ huma.Context) []error {
+	if (len(b.Code) == 0) == (len(b.RecoveryCode) == 0) {
+		return []error{&huma.ErrorDetail{
+			Location: "body.code",
+			Message:  "Exactly one of code or recoveryCode must be provided",
+			Value:    b.Code,
+		}}
+	}
+
+	return nil
+}
+
+type PostSignInMfaInput struct {
+	Body MfaChallengeBody
+}
+
+func HandlePostSignInMfa(ctx context.Context, input *PostSignInMfaInput) (*SignInOutput, error) {
+	// TODO: huma validator for rid prefix...
+	if input.Body.Challenge.Prefix != MfaChallengeRidPrefix {
+		return nil, huma.Error400BadRequest("invalid challenge id")
+	}
+
+	userUuid, err := auth.CompleteMfaChallenge(ctx, input.Body.Challenge.ID, input.Body.Code, input.Body.RecoveryCode)
+	if errors.Is(err, auth.ErrInvalidMfaChallenge) {
+		return nil, huma.Error401Unauthorized("the challenge is invalid or expired; sign in again")
+	}
+
+	if errors.Is(err, auth.ErrInvalidMfaCode) {
+		return nil, huma.Error401Unauthorized("invalid code")
+	}
+
+	if err != nil {
+		return nil, humaAccountLockedError(err)
+	}
+
+	signedJwt, token, err := auth.CreateSessionToken(ctx, userUuid)
+	if err != nil {
+		return nil, humaUserSuspendedError(err)
+	}
+
+	cookie := newSessionCookie(signedJwt, token)
+	return &SignInOutput{SetCookie: &cookie}, nil
+}
@@ -0,0 +1,197 @@
+package internal
+
+import (
+	"context"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dresswithpockets/openstats/app/auth"
+	"github.com/dresswithpockets/openstats/app/db"
+	"github.com/dresswithpockets/openstats/app/db/query"
+	"github.com/dresswithpockets/openstats/app/notifications"
+	"github.com/dresswithpockets/openstats/app/rid"
+	"github.com/dresswithpockets/openstats/app/validation"
+	"github.com/google/uuid"
+)
+
+const NotificationRidPrefix = "n"
+
+type NotificationAchievement struct {
+	Slug   string   `json:"slug" readOnly:"true"`
+	Name   string   `json:"name" readOnly:"true"`
+	Rarity *float64 `json:"rarity,omitempty" readOnly:"true" doc:"Of players who have ever played this achievement's game, the fraction who have completed this achievement"`
+}
+
+type NotificationGameToken struct {
+	RID       rid.RID   `json:"rid" readOnly:"true"`
+	ExpiresAt time.Time `json:"expiresAt" readOnly:"true"`
+	Comment   string    `json:"comment" readOnly:"true"`
+}
+
+type Notification struct {
+	RID       rid.RID            `json:"rid" readOnly:"true"`
+	CreatedAt time.Time          `json:"createdAt" readOnly:"true"`
+	ReadAt    *time.Time         `json:"readAt,omitempty" readOnly:"true"`
+	Kind      notifications.Kind `json:"kind" readOnly:"true" enum:"rare-achievement-unlocked,game-achievements-added,game-token-expiring,email-confirmed"`
+
+	Game             *InternalGame            `json:"game,omitempty" readOnly:"true" doc:"Set for rare-achievement-unlocked, game-achievements-added, and game-token-expiring"`
+	Achievement      *NotificationAchievement `json:"achievement,omitempty" readOnly:"true" doc:"Set for rare-achievement-unlocked"`
+	AchievementCount *int32                   `json:"achievementCount,omitempty" readOnly:"true" doc:"Set for game-achievements-added; the number of achievements added to the game"`
+	GameToken        *NotificationGameToken   `json:"gameToken,omitempty" readOnly:"true" doc:"Set for game-token-expiring"`
+	Email            *string                  `json:"email,omitempty" readOnly:"true" doc:"Set for email-confirmed"`
+}
+
+func (n *Notification) MapFromRow(row query.GetUserNotificationsRow) {
+	*n = Notification{
+		RID:       rid.From(NotificationRidPrefix, row.Uuid),
+		CreatedAt: row.CreatedAt,
+		Kind:      notifications.Kind(row.Kind),
+		Email:     row.Email,
+	}
+
+	if row.ReadAt.Valid {
+		n.ReadAt = &row.ReadAt.Time
+	}
+
+	if row.GameUuid.Valid {
+		n.Game = &InternalGame{
+			RID: rid.From(GameRidPrefix, row.GameUuid.UUID),
+		}
+
+		if row.DeveloperSlug != nil {
+			n.Game.Developer.FriendlyName = *row.DeveloperSlug
+		}
+
+		if row.GameSlug != nil {
+			n.Game.FriendlyName = *row.GameSlug
+		}
+	}
+
+	if row.AchievementSlug != nil && row.AchievementName != nil {
+		n.Achievement = &NotificationAchievement{
+			Slug: *row.AchievementSlug,
+			Name: *row.AchievementName,
+		}
+
+		if row.AchievementRarity.Valid {
+			n.Achievement.Rarity = &row.AchievementRarity.Float64
+		}
+	}
+
+	if row.AchievementCount.Valid {
+		n.AchievementCount = &row.AchievementCount.Int32
+	}
+
+	if row.GameTokenUuid.Valid && row.GameTokenExpiresAt.Valid && row.GameTokenComment != nil {
+		n.GameToken = &NotificationGameToken{
+			RID:       rid.From(GameTokenRidPrefix, row.GameTokenUuid.UUID),
+			ExpiresAt: row.GameTokenExpiresAt.Time,
+			Comment:   *row.GameTokenComment,
+		}
+	}
+}
+
+type NotificationList struct {
+	Notifications []Notification `json:"notifications"`
+	UnreadCount   int64          `json:"unreadCount" doc:"The total number of unread notifications, regardless of the filters applied"`
+}
+
+type GetNotificationsInput struct {
+	UnreadOnly bool                         `query:"unreadOnly" doc:"If true, only unread notifications are returned"`
+	After      validation.Optional[rid.RID] `query:"after,omitempty" doc:"Only return notifications older than this notification"`
+	Limit      validation.Optional[int]     `query:"limit" minimum:"1" maximum:"50" doc:"default = 20"`
+}
+
+type GetNotificationsOutput struct {
+	Body NotificationList
+}
+
+func HandleGetNotifications(ctx context.Context, input *GetNotificationsInput) (*GetNotificationsOutput, error) {
+	principal, hasPrincipal := auth.GetPrincipal(ctx)
+	if !hasPrincipal {
+		// shouldn't ever get here due to middleware check
+		return nil, huma.Error401Unauthorized("no session")
+	}
+
+	// TODO: a huma validator for rid prefix...
+	var after uuid.NullUUID
+	if input.After.HasValue {
+		if input.After.Value.Prefix != NotificationRidPrefix {
+			return nil, huma.Error400BadRequest("invalid notification id")
+		}
+
+		after = uuid.NullUUID{UUID: input.After.Value.ID, Valid: true}
+	}
+
+	rows, err := db.Queries.GetUserNotifications(ctx, query.GetUserNotificationsParams{
+		Limit:      int32(input.Limit.ValueOr(20)),
+		UserID:     principal.User.ID,
+		UnreadOnly: input.UnreadOnly,
+		After:      after,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	unreadCount, err := db.Queries.CountUnreadNotifications(ctx, principal.User.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]Notification, len(rows))
+	for idx := range rows {
+		items[idx].MapFromRow(rows[idx])
+	}
+
+	return &GetNotificationsOutput{
+		Body: NotificationList{
+			Notifications: items,
+			UnreadCount:   unreadCount,
+		},
+	}, nil
+}
+
+type ReadNotificationInput struct {
+	NotificationRID rid.RID `path:"notificationRID" example:"n_31F0otb4FIVRqQWdsISFl"`
+}
+
+func HandleReadNotification(ctx context.Context, input *ReadNotificationInput) (*struct{}, error) {
+	principal, hasPrincipal := auth.GetPrincipal(ctx)
+	if !hasPrincipal {
+		// shouldn't ever get here due to middleware check
+		return nil, huma.Error401Unauthorized("no session")
+	}
+
+	// TODO: a huma validator for rid prefix...
+	if input.NotificationRID.Prefix != NotificationRidPrefix {
+		return nil, huma.Error400BadRequest("invalid notification id")
+	}
+
+	rows, err := db.Queries.MarkNotificationRead(ctx, query.MarkNotificationReadParams{
+		UserID: principal.User.ID,
+		Uuid:   input.NotificationRID.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if rows == 0 {
+		return nil, huma.Error404NotFound("notification not found")
+	}
+
+	return &struct{}{}, nil
+}
+
+func HandleReadAllNotifications(ctx context.Context, _ *struct{}) (*struct{}, error) {
+	principal, hasPrincipal := auth.GetPrincipal(ctx)
+	if !hasPrincipal {
+		// shouldn't ever get here due to middleware check
+		return nil, huma.Error401Unauthorized("no session")
+	}
+
+	if _, err := db.Queries.MarkAllNotificationsRead(ctx, principal.User.ID); err != nil {
+		return nil, err
+	}
+
+	return &struct{}{}, nil
+}
@@ -0,0 +1,423 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dresswithpockets/openstats/app/auth"
+	"github.com/dresswithpockets/openstats/app/db"
+	"github.com/dresswithpockets/openstats/app/db/query"
+	"github.com/dresswithpockets/openstats/app/rid"
+)
+
+type OAuthClient struct {
+	RID          rid.RID   `json:"rid" readOnly:"true" required:"false"`
+	CreatedAt    time.Time `json:"createdAt" readOnly:"true" required:"false"`
+	Name         string    `json:"name" minLength:"1" maxLength:"64"`
+	RedirectUris []string  `json:"redirectUris" minItems:"1" maxItems:"10" uniqueItems:"true" doc:"The exact URIs users may be redirected back to after consenting"`
+	Confidential bool      `json:"confidential" doc:"Confidential clients are given a secret to authenticate with at the token endpoint. Apps that can't keep a secret, like mobile or browser apps, should be public."`
+	Secret       string    `json:"secret,omitempty" readOnly:"true" required:"false" doc:"The client's secret. Only returned when a confidential client is created."`
+}
+
+func (c *OAuthClient) MapFromRow(row query.OauthClient) {
+	*c = OAuthClient{
+		RID:          rid.From(auth.OAuthClientRidPrefix, row.Uuid),
+		CreatedAt:    row.CreatedAt,
+		Name:         row.Name,
+		RedirectUris: row.RedirectUris,
+		Confidential: row.SecretHash != nil,
+	}
+}
+
+// ensureDeveloperMember returns an error if the current session's user isn't a member of the developer
+func ensureDeveloperMember(ctx context.Context, developerRid rid.RID) error {
+	principal, hasPrincipal := auth.GetPrincipal(ctx)
+	if !hasPrincipal {
+		// shouldn't ever get here due to middleware check
+		return huma.Error401Unauthorized("no session")
+	}
+
+	// TODO: huma validator for rid prefix...
+	if developerRid.Prefix != DeveloperRidPrefix {
+		return huma.Error400BadRequest("invalid developer id")
+	}
+
+	isMember, err := db.Queries.IsDeveloperMember(ctx, query.IsDeveloperMemberParams{
+		UserID:        principal.User.ID,
+		DeveloperUuid: developerRid.ID,
+	})
+	if err != nil {
+		return err
+	}
+
+	if !isMember {
+		return huma.Error403Forbidden("only members of the developer may manage its OAuth clients")
+	}
+
+	return nil
+}
+
+type DeveloperOAuthClientsInput struct {
+	DeveloperRID rid.RID `path:"developer"`
+}
+
+type GetDeveloperOAuthClientsOutput struct {
+	Body struct {
+		Clients []OAuthClient `json:"clients"`
+	}
+}
+
+func HandleGetDeveloperOAuthClients(ctx context.Context, input *DeveloperOAuthClientsInput) (*GetDeveloperOAuthClientsOutput, error) {
+	if err := ensureDeveloperMember(ctx, input.DeveloperRID); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Queries.GetDeveloperOAuthClients(ctx, input.DeveloperRID.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &GetDeveloperOAuthClientsOutput{}
+	output.Body.Clients = make([]OAuthClient, len(rows))
+	for idx := range rows {
+		output.Body.Clients[idx].MapFromRow(rows[idx])
+	}
+
+	return output, nil
+}
+
+type PostDeveloperOAuthClientInput struct {
+	DeveloperRID rid.RID `path:"developer"`
+	Body         OAuthClient
+}
+
+func (i *PostDeveloperOAuthClientInput) Resolve(_ huma.Context) []error {
+	var errs []error
+	for idx, redirectUri := range i.Body.RedirectUris {
+		parsed, err := url.Parse(redirectUri)
+		if err == nil && parsed.IsAbs() && parsed.Fragment == "" && (parsed.Scheme != "http" || parsed.Hostname() == "localhost" || parsed.Hostname() == "127.0.0.1") {
+			continue
+		}
+
+		errs = append(errs, &huma.ErrorDetail{
+			Location: "body.redirectUris[" + strconv.Itoa(idx) + "]",
+			Message:  "redirect URIs must be absolute, have no fragment, and only use http for localhost",
+			Value:    redirectUri,
+		})
+	}
+
+	return errs
+}
+
+type PostDeveloperOAuthClientOutput struct {
+	Body OAuthClient
+}
+
+func HandlePostDeveloperOAuthClient(ctx context.Context, input *PostDeveloperOAuthClientInput) (*PostDeveloperOAuthClientOutput, error) {
+	if err := ensureDeveloperMember(ctx, input.DeveloperRID); err != nil {
+		return nil, err
+	}
+
+	client, secret, err := auth.CreateOAuthClient(ctx, input.DeveloperRID.ID, input.Body.Name, input.Body.RedirectUris, input.Body.Confidential)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &PostDeveloperOAuthClientOutput{}
+	output.Body.MapFromRow(client)
+	output.Body.Secret = secret
+	return output, nil
+}
+
+type DeveloperOAuthClientInput struct {
+	DeveloperRID rid.RID `path:"developer"`
+	ClientRID    rid.RID `path:"client"`
+}
+
+func HandleDeleteDeveloperOAuthClient(ctx context.Context, input *DeveloperOAuthClientInput) (*struct{}, error) {
+	if err := ensureDeveloperMember(ctx, input.DeveloperRID); err != nil {
+		return nil, err
+	}
+
+	if input.ClientRID.Prefix != auth.OAuthClientRidPrefix {
+		return nil, huma.Error400BadRequest("invalid client id")
+	}
+
+	rows, err := db.Queries.DeleteOAuthClient(ctx, query.DeleteOAuthClientParams{
+		DeveloperUuid: input.DeveloperRID.ID,
+		ClientUuid:    input.ClientRID.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if rows == 0 {
+		return nil, huma.Error404NotFound("client not found")
+	}
+
+	return &struct{}{}, nil
+}
+
+type OAuthScope struct {
+	Name        string `json:"name" readOnly:"true"`
+	Description string `json:"description" readOnly:"true"`
+}
+
+type OAuthAuthorizationRequest struct {
+	ResponseType        string `query:"response_type" json:"response_type" enum:"code"`
+	ClientId            string `query:"client_id" json:"client_id"`
+	RedirectUri         string `query:"redirect_uri" json:"redirect_uri"`
+	Scope               string `query:"scope" json:"scope"`
+	State               string `query:"state" json:"state,omitempty" required:"false"`
+	CodeChallenge       string `query:"code_challenge" json:"code_challenge"`
+	CodeChallengeMethod string `query:"code_challenge_method" json:"code_challenge_method" enum:"S256"`
+}
+
+// validate checks the client and its redirect_uri, which must be valid before the user can be redirected back to the
+// client with any other error
+func (r *OAuthAuthorizationRequest) validate(ctx context.Context) (query.FindOAuthClientRow, []string, error) {
+	client, err := auth.FindOAuthClient(ctx, r.ClientId)
+	if errors.Is(err, auth.ErrUnknownOAuthClient) {
+		return client, nil, huma.Error400BadRequest("unknown client")
+	}
+
+	if err != nil {
+		return client, nil, err
+	}
+
+	if err = auth.ValidateOAuthRedirectUri(client, r.RedirectUri); err != nil {
+		return client, nil, huma.Error400BadRequest("redirect_uri isn't registered for the client")
+	}
+
+	scopes, err := auth.ParseOAuthScopes(r.Scope)
+	if err != nil {
+		return client, nil, huma.Error400BadRequest(err.Error())
+	}
+
+	return client, scopes, nil
+}
+
+// redirect builds the URL that sends the user back to the client, carrying the state the client gave us
+func (r *OAuthAuthorizationRequest) redirect(values url.Values) (string, error) {
+	redirectUrl, err := url.Parse(r.RedirectUri)
+	if err != nil {
+		return "", err
+	}
+
+	params := redirectUrl.Query()
+	for key, value := range values {
+		params[key] = value
+	}
+
+	if len(r.State) > 0 {
+		params.Set("state", r.State)
+	}
+
+	redirectUrl.RawQuery = params.Encode()
+	return redirectUrl.String(), nil
+}
+
+type GetOAuthAuthorizationOutput struct {
+	Body struct {
+		Client struct {
+			RID           rid.RID `json:"rid" readOnly:"true"`
+			Name          string  `json:"name" readOnly:"true"`
+			DeveloperSlug string  `json:"developerSlug" readOnly:"true"`
+		} `json:"client" readOnly:"true"`
+		Scopes []OAuthScope `json:"scopes" readOnly:"true" doc:"The access the client is requesting, to show on the consent screen"`
+	}
+}
+
+func HandleGetOAuthAuthorization(ctx context.Context, input *OAuthAuthorizationRequest) (*GetOAuthAuthorizationOutput, error) {
+	client, scopes, err := input.validate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &GetOAuthAuthorizationOutput{}
+	output.Body.Client.RID = rid.From(auth.OAuthClientRidPrefix, client.Uuid)
+	output.Body.Client.Name = client.Name
+	output.Body.Client.DeveloperSlug = client.DeveloperSlug
+	output.Body.Scopes = make([]OAuthScope, len(scopes))
+	for idx, scope := range scopes {
+		output.Body.Scopes[idx] = OAuthScope{Name: scope, Description: auth.OAuthScopes[scope]}
+	}
+
+	return output, nil
+}
+
+type PostOAuthAuthorizationInput struct {
+	Body struct {
+		OAuthAuthorizationRequest
+		Approve bool `json:"approve" doc:"Whether the user consented to the client's request"`
+	}
+}
+
+type PostOAuthAuthorizationOutput struct {
+	Body struct {
+		RedirectUrl string `json:"redirectUrl" readOnly:"true" doc:"The client's URL to send the user back to, with either an authorization code or an error"`
+	}
+}
+
+func HandlePostOAuthAuthorization(ctx context.Context, input *PostOAuthAuthorizationInput) (*PostOAuthAuthorizationOutput, error) {
+	principal, hasPrincipal := auth.GetPrincipal(ctx)
+	if !hasPrincipal {
+		// shouldn't ever get here due to middleware check
+		return nil, huma.Error401Unauthorized("no session")
+	}
+
+	request := &input.Body.OAuthAuthorizationRequest
+	client, scopes, err := request.validate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	values := url.Values{"error": {"access_denied"}}
+	if input.Body.Approve {
+		code, err := auth.CreateOAuthAuthorizationCode(ctx, client, principal.User.ID, request.RedirectUri, scopes, request.CodeChallenge, request.CodeChallengeMethod)
+		if errors.Is(err, auth.ErrInvalidOAuthChallenge) {
+			return nil, huma.Error400BadRequest(err.Error())
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		values = url.Values{"code": {code}}
+	}
+
+	redirectUrl, err := request.redirect(values)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &PostOAuthAuthorizationOutput{}
+	output.Body.RedirectUrl = redirectUrl
+	return output, nil
+}
+
+type OAuthApp struct {
+	RID           rid.RID   `json:"rid" readOnly:"true"`
+	Name          string    `json:"name" readOnly:"true"`
+	DeveloperSlug string    `json:"developerSlug" readOnly:"true"`
+	Scopes        []string  `json:"scopes" readOnly:"true"`
+	AuthorizedAt  time.Time `json:"authorizedAt" readOnly:"true"`
+}
+
+type GetOAuthAppsOutput struct {
+	Body struct {
+		Apps []OAuthApp `json:"apps"`
+	}
+}
+
+func HandleGetOAuthApps(ctx context.Context, _ *struct{}) (*GetOAuthAppsOutput, error) {
+	principal, hasPrincipal := auth.GetPrincipal(ctx)
+	if !hasPrincipal {
+		// shouldn't ever get here due to middleware check
+		return nil, huma.Error401Unauthorized("no session")
+	}
+
+	rows, err := db.Queries.GetUserOAuthApps(ctx, principal.User.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &GetOAuthAppsOutput{}
+	output.Body.Apps = make([]OAuthApp, len(rows))
+	for idx, row := range rows {
+		output.Body.Apps[idx] = OAuthApp{
+			RID:           rid.From(auth.OAuthClientRidPrefix, row.Uuid),
+			Name:          row.Name,
+			DeveloperSlug: row.DeveloperSlug,
+			Scopes:        row.Scopes,
+			AuthorizedAt:  row.AuthorizedAt,
+		}
+	}
+
+	return output, nil
+}
+
+type DeleteOAuthAppInput struct {
+	ClientRID rid.RID `path:"clientRID"`
+}
+
+func HandleDeleteOAuthApp(ctx context.Context, input *DeleteOAuthAppInput) (*struct{}, error) {
+	principal, hasPrincipal := auth.GetPrincipal(ctx)
+	if !hasPrincipal {
+		// shouldn't ever get here due to middleware check
+		return nil, huma.Error401Unauthorized("no session")
+	}
+
+	if input.ClientRID.Prefix != auth.OAuthClientRidPrefix {
+		return nil, huma.Error400BadRequest("invalid client id")
+	}
+
+	rows, err := db.Queries.RevokeUserOAuthApp(ctx, query.RevokeUserOAuthAppParams{
+		UserID:     principal.User.ID,
+		ClientUuid: input.ClientRID.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if rows == 0 {
+		return nil, huma.Error404NotFound("app not found")
+	}
+
+	return &struct{}{}, nil
+}
+
+type AchievementProgress struct {
+	DeveloperSlug       string    `json:"developerSlug" readOnly:"true"`
+	GameRID             rid.RID   `json:"gameRid" readOnly:"true"`
+	GameSlug            string    `json:"gameSlug" readOnly:"true"`
+	Slug                string    `json:"slug" readOnly:"true"`
+	Name                string    `json:"name" readOnly:"true"`
+	Description         string    `json:"description" readOnly:"true"`
+	Progress            int32     `json:"progress" readOnly:"true"`
+	ProgressRequirement int32     `json:"progressRequirement" readOnly:"true"`
+	Unlocked            bool      `json:"unlocked" readOnly:"true"`
+	UpdatedAt           time.Time `json:"updatedAt" readOnly:"true"`
+}
+
+type GetSessionAchievementsOutput struct {
+	Body struct {
+		Achievements []AchievementProgress `json:"achievements"`
+	}
+}
+
+func HandleGetSessionAchievements(ctx context.Context, _ *struct{}) (*GetSessionAchievementsOutput, error) {
+	principal, hasPrincipal := auth.GetPrincipal(ctx)
+	if !hasPrincipal {
+		// shouldn't ever get here due to middleware check
+		return nil, huma.Error401Unauthorized("no session")
+	}
+
+	rows, err := db.Queries.GetUserAchievementProgress(ctx, principal.User.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &GetSessionAchievementsOutput{}
+	output.Body.Achievements = make([]AchievementProgress, len(rows))
+	for idx, row := range rows {
+		output.Body.Achievements[idx] = AchievementProgress{
+			DeveloperSlug:       row.DeveloperSlug,
+			GameRID:             rid.From(GameRidPrefix, row.GameUuid),
+			GameSlug:            row.GameSlug,
+			Slug:                row.AchievementSlug,
+			Name:                row.AchievementName,
+			Description:         row.AchievementDescription,
+			Progress:            row.Progress,
+			ProgressRequirement: row.ProgressRequirement,
+			Unlocked:            row.Progress >= row.ProgressRequirement,
+			UpdatedAt:           row.UpdatedAt,
+		}
+	}
+
+	return output, nil
+}
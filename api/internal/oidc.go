@@ -0,0 +1,302 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dresswithpockets/openstats/app/auth"
+	"github.com/dresswithpockets/openstats/app/db"
+	"github.com/dresswithpockets/openstats/app/db/query"
+	"github.com/dresswithpockets/openstats/app/env"
+	"github.com/dresswithpockets/openstats/app/log"
+	"github.com/dresswithpockets/openstats/app/rid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const UserIdentityRidPrefix = "ui"
+
+type OidcProvider struct {
+	Name        string `json:"name" readOnly:"true"`
+	DisplayName string `json:"displayName" readOnly:"true"`
+}
+
+type GetOidcProvidersOutput struct {
+	Body struct {
+		Providers []OidcProvider `json:"providers"`
+	}
+}
+
+func HandleGetOidcProviders(_ context.Context, _ *struct{}) (*GetOidcProvidersOutput, error) {
+	output := &GetOidcProvidersOutput{}
+	output.Body.Providers = make([]OidcProvider, len(auth.OidcProviders))
+	for idx, provider := range auth.OidcProviders {
+		output.Body.Providers[idx] = OidcProvider{
+			Name:        provider.Name,
+			DisplayName: provider.DisplayName,
+		}
+	}
+
+	return output, nil
+}
+
+type BeginOidcAuthorizationInput struct {
+	Provider string `path:"provider"`
+}
+
+type BeginOidcAuthorizationOutput struct {
+	Body struct {
+		AuthorizationUrl string `json:"authorizationUrl" readOnly:"true" doc:"The provider's URL to send the user to. Once they've authorized openstats, they'll be redirected back to the callback."`
+	}
+}
+
+func beginOidcAuthorization(ctx context.Context, providerName string, userId pgtype.Int4) (*BeginOidcAuthorizationOutput, error) {
+	provider, err := auth.FindOidcProvider(providerName)
+	if err != nil {
+		return nil, huma.Error404NotFound("provider not found")
+	}
+
+	authorizationUrl, err := auth.BeginOidcAuthorization(ctx, provider, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &BeginOidcAuthorizationOutput{}
+	output.Body.AuthorizationUrl = authorizationUrl
+	return output, nil
+}
+
+func HandleBeginOidcSignIn(ctx context.Context, input *BeginOidcAuthorizationInput) (*BeginOidcAuthorizationOutput, error) {
+	return beginOidcAuthorization(ctx, input.Provider, pgtype.Int4{})
+}
+
+func HandleBeginOidcLink(ctx context.Context, input *BeginOidcAuthorizationInput) (*BeginOidcAuthorizationOutput, error) {
+	principal, hasPrincipal := auth.GetPrincipal(ctx)
+	if !hasPrincipal {
+		// shouldn't ever get here due to middleware check
+		return nil, huma.Error401Unauthorized("no session")
+	}
+
+	return beginOidcAuthorization(ctx, input.Provider, pgtype.Int4{Int32: principal.User.ID, Valid: true})
+}
+
+type OidcCallbackInput struct {
+	Provider         string `path:"provider"`
+	State            string `query:"state"`
+	Code             string `query:"code"`
+	Error            string `query:"error"`
+	ErrorDescription string `query:"error_description"`
+}
+
+type OidcCallbackOutput struct {
+	Status    int
+	Location  string       `header:"Location"`
+	SetCookie *http.Cookie `header:"Set-Cookie"`
+}
+
+// oidcCompleteRedirect redirects the user back to the web app once the callback has been handled, with the outcome
+// in the query string
+func oidcCompleteRedirect(values url.Values) (*OidcCallbackOutput, error) {
+	completeUrl, err := url.Parse(env.GetString("OPENSTATS_OIDC_COMPLETE_URL"))
+	if err != nil {
+		return nil, err
+	}
+
+	completeUrl.RawQuery = values.Encode()
+	return &OidcCallbackOutput{
+		Status:   http.StatusSeeOther,
+		Location: completeUrl.String(),
+	}, nil
+}
+
+func HandleOidcCallback(ctx context.Context, input *OidcCallbackInput) (*OidcCallbackOutput, error) {
+	provider, err := auth.FindOidcProvider(input.Provider)
+	if err != nil {
+		return nil, huma.Error404NotFound("provider not found")
+	}
+
+	if len(input.Error) > 0 {
+		log.Logger.Info("OpenID Connect provider returned an error", "provider", provider.Name, "error", input.Error, "description", input.ErrorDescription)
+		return oidcCompleteRedirect(url.Values{"error": {"provider-error"}})
+	}
+
+	authorization, identity, err := auth.FinishOidcAuthorization(ctx, provider, input.State, input.Code)
+	if errors.Is(err, auth.ErrInvalidOidcAuthorization) {
+		return oidcCompleteRedirect(url.Values{"error": {"invalid-authorization"}})
+	}
+
+	if errors.Is(err, auth.ErrOidcFailed) {
+		log.Logger.Info("OpenID Connect verification failed", "provider", provider.Name, "error", err)
+		return oidcCompleteRedirect(url.Values{"error": {"verification-failed"}})
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if authorization.UserID.Valid {
+		err = auth.LinkOidcIdentity(ctx, authorization.UserID.Int32, identity)
+		if errors.Is(err, auth.ErrIdentityAlreadyLinked) {
+			return oidcCompleteRedirect(url.Values{"error": {"already-linked"}})
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return oidcCompleteRedirect(url.Values{"linked": {provider.Name}})
+	}
+
+	user, err := auth.SignInWithOidc(ctx, provider, identity)
+	if errors.Is(err, auth.ErrOidcEmailInUse) {
+		return oidcCompleteRedirect(url.Values{"error": {"email-in-use"}})
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	mfaEnabled, err := auth.IsMfaEnabled(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if mfaEnabled {
+		challenge, err := auth.CreateMfaChallenge(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		challengeRid := rid.From(MfaChallengeRidPrefix, challenge.Uuid)
+		return oidcCompleteRedirect(url.Values{"mfaChallenge": {challengeRid.String()}})
+	}
+
+	signedJwt, token, err := auth.CreateSessionToken(ctx, user.Uuid)
+	var suspendedErr *auth.UserSuspendedError
+	if errors.As(err, &suspendedErr) {
+		return oidcCompleteRedirect(url.Values{"error": {"suspended"}})
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	auth.RecordSecurityEvent(ctx, user.ID, auth.SecurityEventSignIn, map[string]string{"method": "oidc", "provider": provider.Name})
+
+	output, err := oidcCompleteRedirect(url.Values{"signedIn": {provider.Name}})
+	if err != nil {
+		return nil, err
+	}
+
+	cookie := newSessionCookie(signedJwt, token)
+	output.SetCookie = &cookie
+	return output, nil
+}
+
+type UserIdentity struct {
+	RID        rid.RID    `json:"rid" readOnly:"true"`
+	CreatedAt  time.Time  `json:"createdAt" readOnly:"true"`
+	Provider   string     `json:"provider" readOnly:"true"`
+	Email      string     `json:"email,omitempty" readOnly:"true"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty" readOnly:"true"`
+}
+
+func (i *UserIdentity) MapFromRow(row query.UserIdentity) {
+	*i = UserIdentity{
+		RID:       rid.From(UserIdentityRidPrefix, row.Uuid),
+		CreatedAt: row.CreatedAt,
+		Provider:  row.Provider,
+	}
+
+	if row.Email != nil {
+		i.Email = *row.Email
+	}
+
+	if row.LastUsedAt.Valid {
+		i.LastUsedAt = &row.LastUsedAt.Time
+	}
+}
+
+type GetUserIdentitiesOutput struct {
+	Body struct {
+		Identities []UserIdentity `json:"identities"`
+	}
+}
+
+func HandleGetUserIdentities(ctx context.Context, _ *struct{}) (*GetUserIdentitiesOutput, error) {
+	principal, hasPrincipal := auth.GetPrincipal(ctx)
+	if !hasPrincipal {
+		// shouldn't ever get here due to middleware check
+		return nil, huma.Error401Unauthorized("no session")
+	}
+
+	rows, err := db.Queries.GetUserIdentities(ctx, principal.User.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &GetUserIdentitiesOutput{}
+	output.Body.Identities = make([]UserIdentity, len(rows))
+	for idx := range rows {
+		output.Body.Identities[idx].MapFromRow(rows[idx])
+	}
+
+	return output, nil
+}
+
+type DeleteUserIdentityInput struct {
+	IdentityRID rid.RID `path:"identityRID"`
+}
+
+func HandleDeleteUserIdentity(ctx context.Context, input *DeleteUserIdentityInput) (*struct{}, error) {
+	principal, hasPrincipal := auth.GetPrincipal(ctx)
+	if !hasPrincipal {
+		// shouldn't ever get here due to middleware check
+		return nil, huma.Error401Unauthorized("no session")
+	}
+
+	// TODO: huma validator for rid prefix...
+	if input.IdentityRID.Prefix != UserIdentityRidPrefix {
+		return nil, huma.Error400BadRequest("invalid identity id")
+	}
+
+	err := db.DB.Transact(ctx, func(ctx context.Context, qtx *query.Queries) error {
+		if err := qtx.LockUserSignInMethods(ctx, principal.User.ID); err != nil {
+			return err
+		}
+
+		rows, err := qtx.DeleteUserIdentity(ctx, query.DeleteUserIdentityParams{
+			UserID:       principal.User.ID,
+			IdentityUuid: input.IdentityRID.ID,
+		})
+		if err != nil {
+			return err
+		}
+
+		if rows == 0 {
+			return huma.Error404NotFound("identity not found")
+		}
+
+		// users created by signing in with a provider don't have a password, so they mustn't be locked out by
+		// removing their only identity
+		methods, err := qtx.CountUserSignInMethods(ctx, principal.User.ID)
+		if err != nil {
+			return err
+		}
+
+		if methods == 0 {
+			return huma.Error409Conflict("can't remove the only way to sign in; add a password, passkey, or another identity first")
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &struct{}{}, nil
+}
@@ -0,0 +1,242 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dresswithpockets/openstats/app/auth"
+	"github.com/dresswithpockets/openstats/app/db"
+	"github.com/dresswithpockets/openstats/app/db/query"
+	"github.com/dresswithpockets/openstats/app/log"
+	"github.com/dresswithpockets/openstats/app/rid"
+	"github.com/rotisserie/eris"
+)
+
+const (
+	PasskeyRidPrefix         = "pk"
+	PasskeyCeremonyRidPrefix = "pc"
+)
+
+type Passkey struct {
+	RID        rid.RID    `json:"rid" readOnly:"true"`
+	CreatedAt  time.Time  `json:"createdAt" readOnly:"true"`
+	Name       string     `json:"name" readOnly:"true"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty" readOnly:"true"`
+}
+
+func (p *Passkey) MapFromRow(row query.WebauthnCredential) {
+	*p = Passkey{
+		RID:       rid.From(PasskeyRidPrefix, row.Uuid),
+		CreatedAt: row.CreatedAt,
+		Name:      row.Name,
+	}
+
+	if row.LastUsedAt.Valid {
+		p.LastUsedAt = &row.LastUsedAt.Time
+	}
+}
+
+type PasskeyCeremony struct {
+	Ceremony rid.RID         `json:"ceremony" readOnly:"true" doc:"Identifies this ceremony when finishing it"`
+	Options  json.RawMessage `json:"options" readOnly:"true" doc:"The options to pass to navigator.credentials.create() or navigator.credentials.get()"`
+}
+
+type PasskeyCeremonyOutput struct {
+	Body PasskeyCeremony
+}
+
+// passkeyError converts errors from passkey ceremonies into client errors where appropriate
+func passkeyError(err error) error {
+	if errors.Is(err, auth.ErrInvalidWebAuthnCeremony) {
+		return huma.Error400BadRequest("the ceremony is invalid or expired; start a new one")
+	}
+
+	if errors.Is(err, auth.ErrWebAuthnFailed) {
+		log.Logger.Info("passkey verification failed", "error", err)
+		return huma.Error401Unauthorized("passkey verification failed")
+	}
+
+	return err
+}
+
+type GetPasskeysOutput struct {
+	Body struct {
+		Passkeys []Passkey `json:"passkeys"`
+	}
+}
+
+func HandleGetPasskeys(ctx context.Context, _ *struct{}) (*GetPasskeysOutput, error) {
+	principal, hasPrincipal := auth.GetPrincipal(ctx)
+	if !hasPrincipal {
+		// shouldn't ever get here due to middleware check
+		return nil, huma.Error401Unauthorized("no session")
+	}
+
+	rows, err := db.Queries.GetUserWebAuthnCredentials(ctx, principal.User.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &GetPasskeysOutput{}
+	output.Body.Passkeys = make([]Passkey, len(rows))
+	for idx := range rows {
+		output.Body.Passkeys[idx].MapFromRow(rows[idx])
+	}
+
+	return output, nil
+}
+
+func HandleBeginPasskeyRegistration(ctx context.Context, _ *struct{}) (*PasskeyCeremonyOutput, error) {
+	principal, hasPrincipal := auth.GetPrincipal(ctx)
+	if !hasPrincipal {
+		// shouldn't ever get here due to middleware check
+		return nil, huma.Error401Unauthorized("no session")
+	}
+
+	ceremonyUuid, options, err := auth.BeginPasskeyRegistration(ctx, principal.User)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PasskeyCeremonyOutput{
+		Body: PasskeyCeremony{
+			Ceremony: rid.From(PasskeyCeremonyRidPrefix, ceremonyUuid),
+			Options:  options,
+		},
+	}, nil
+}
+
+type FinishPasskeyRegistrationInput struct {
+	Body struct {
+		Ceremony   rid.RID         `json:"ceremony"`
+		Name       string          `json:"name" minLength:"1" maxLength:"64" doc:"A name to help the user recognize the passkey"`
+		Credential json.RawMessage `json:"credential" doc:"The PublicKeyCredential returned by navigator.credentials.create(), serialized as JSON"`
+	}
+}
+
+type FinishPasskeyRegistrationOutput struct {
+	Body Passkey
+}
+
+func HandleFinishPasskeyRegistration(ctx context.Context, input *FinishPasskeyRegistrationInput) (*FinishPasskeyRegistrationOutput, error) {
+	principal, hasPrincipal := auth.GetPrincipal(ctx)
+	if !hasPrincipal {
+		// shouldn't ever get here due to middleware check
+		return nil, huma.Error401Unauthorized("no session")
+	}
+
+	// TODO: huma validator for rid prefix...
+	if input.Body.Ceremony.Prefix != PasskeyCeremonyRidPrefix {
+		return nil, huma.Error400BadRequest("invalid ceremony id")
+	}
+
+	row, err := auth.FinishPasskeyRegistration(ctx, principal.User, input.Body.Ceremony.ID, input.Body.Name, input.Body.Credential)
+	if db.IsUniqueConstraintErr(err) {
+		return nil, huma.Error409Conflict("that passkey is already registered")
+	}
+
+	if err != nil {
+		return nil, passkeyError(err)
+	}
+
+	output := &FinishPasskeyRegistrationOutput{}
+	output.Body.MapFromRow(row)
+	return output, nil
+}
+
+type DeletePasskeyInput struct {
+	PasskeyRID rid.RID `path:"passkeyRID"`
+}
+
+func HandleDeletePasskey(ctx context.Context, input *DeletePasskeyInput) (*struct{}, error) {
+	principal, hasPrincipal := auth.GetPrincipal(ctx)
+	if !hasPrincipal {
+		// shouldn't ever get here due to middleware check
+		return nil, huma.Error401Unauthorized("no session")
+	}
+
+	// TODO: huma validator for rid prefix...
+	if input.PasskeyRID.Prefix != PasskeyRidPrefix {
+		return nil, huma.Error400BadRequest("invalid passkey id")
+	}
+
+	err := db.DB.Transact(ctx, func(ctx context.Context, qtx *query.Queries) error {
+		if err := qtx.LockUserSignInMethods(ctx, principal.User.ID); err != nil {
+			return err
+		}
+
+		rows, err := qtx.DeleteWebAuthnCredential(ctx, query.DeleteWebAuthnCredentialParams{
+			UserID:         principal.User.ID,
+			CredentialUuid: input.PasskeyRID.ID,
+		})
+		if err != nil {
+			return err
+		}
+
+		if rows == 0 {
+			return huma.Error404NotFound("passkey not found")
+		}
+
+		// users created by signing in with a provider may have unlinked every identity, leaving only their passkeys
+		methods, err := qtx.CountUserSignInMethods(ctx, principal.User.ID)
+		if err != nil {
+			return err
+		}
+
+		if methods == 0 {
+			return huma.Error409Conflict("can't remove the only way to sign in; add a password, passkey, or another identity first")
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &struct{}{}, nil
+}
+
+func HandleBeginPasskeySignIn(ctx context.Context, _ *struct{}) (*PasskeyCeremonyOutput, error) {
+	ceremonyUuid, options, err := auth.BeginPasskeySignIn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PasskeyCeremonyOutput{
+		Body: PasskeyCeremony{
+			Ceremony: rid.From(PasskeyCeremonyRidPrefix, ceremonyUuid),
+			Options:  options,
+		},
+	}, nil
+}
+
+type FinishPasskeySignInInput struct {
+	Body struct {
+		Ceremony   rid.RID         `json:"ceremony"`
+		Credential json.RawMessage `json:"credential" doc:"The PublicKeyCredential returned by navigator.credentials.get(), serialized as JSON"`
+	}
+}
+
+func HandleFinishPasskeySignIn(ctx context.Context, input *FinishPasskeySignInInput) (*SignInOutput, error) {
+	// TODO: huma validator for rid prefix...
+	if input.Body.Ceremony.Prefix != PasskeyCeremonyRidPrefix {
+		return nil, huma.Error400BadRequest("invalid ceremony id")
+	}
+
+	userUuid, err := auth.FinishPasskeySignIn(ctx, input.Body.Ceremony.ID, input.Body.Credential)
+	if err != nil {
+		return nil, passkeyError(err)
+	}
+
+	signedJwt, token, err := auth.CreateSessionToken(ctx, userUuid)
+	if err != nil {
+		return nil, humaUserSuspendedError(eris.Wrap(err, "error creating session token"))
+	}
+
+	cookie := newSessionCookie(signedJwt, token)
+	return &SignInOutput{SetCookie: &cookie}, nil
+}
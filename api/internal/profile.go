@@ -57,7 +57,8 @@ type ProfileOtherUserUnlockedAchievement struct {
 }
 
 type UserProfile struct {
-	User InternalUser `json:"user"`
+	User     InternalUser    `json:"user"`
+	Showcase ProfileShowcase `json:"showcase" readOnly:"true" doc:"The parts of the profile curated by the user"`
 
 	UnlockedAchievements []ProfileUnlockedAchievement `json:"unlockedAchievements,omitempty" doc:"Most recent achievements unlocked by this user" readOnly:"true"`
 	RarestAchievements   []ProfileRareAchievement     `json:"rarestAchievements,omitempty" doc:"The rarest achievements unlocked by this user" readOnly:"true"`
@@ -74,45 +75,63 @@ func GetUserProfile(ctx context.Context, userUuid uuid.UUID) (UserProfile, error
 		return UserProfile{}, err
 	}
 
-	recentUserAchievements, err := db.Queries.GetUserRecentAchievements(ctx, query.GetUserRecentAchievementsParams{
-		UserUuid: userUuid,
-		Limit:    20,
-	})
-
-	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+	showcase, err := getProfileShowcase(ctx, userUuid)
+	if err != nil {
 		log.Println(err)
-		return UserProfile{}, eris.Wrap(err, "couldn't get user's recent achievements")
+		return UserProfile{}, err
 	}
 
-	recentOtherUserAchievements, err := db.Queries.GetOtherUserRecentAchievements(ctx, query.GetOtherUserRecentAchievementsParams{
-		ExcludedUserUuid: userUuid,
-		Limit:            20,
-	})
+	var recentUserAchievements []query.GetUserRecentAchievementsRow
+	if showcase.Shows(SectionUnlockedAchievements) {
+		recentUserAchievements, err = db.Queries.GetUserRecentAchievements(ctx, query.GetUserRecentAchievementsParams{
+			UserUuid: userUuid,
+			Limit:    20,
+		})
 
-	if err != nil && !errors.Is(err, sql.ErrNoRows) {
-		log.Println(err)
-		return UserProfile{}, eris.Wrap(err, "couldn't get other users' recent achievements")
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Println(err)
+			return UserProfile{}, eris.Wrap(err, "couldn't get user's recent achievements")
+		}
 	}
 
-	rarestAchievements, err := db.Queries.GetUsersRarestAchievements(ctx, query.GetUsersRarestAchievementsParams{
-		UserUuid:             userUuid,
-		MaxCompletionPercent: 0.1,
-		Limit:                10,
-	})
+	var recentOtherUserAchievements []query.GetOtherUserRecentAchievementsRow
+	if showcase.Shows(SectionOtherUserAchievements) {
+		recentOtherUserAchievements, err = db.Queries.GetOtherUserRecentAchievements(ctx, query.GetOtherUserRecentAchievementsParams{
+			ExcludedUserUuid: userUuid,
+			Limit:            20,
+		})
 
-	if err != nil && !errors.Is(err, sql.ErrNoRows) {
-		log.Println(err)
-		return UserProfile{}, eris.Wrap(err, "couldn't get user's rarest achievements")
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Println(err)
+			return UserProfile{}, eris.Wrap(err, "couldn't get other users' recent achievements")
+		}
 	}
 
-	completedGames, err := db.Queries.GetUsersCompletedGames(ctx, query.GetUsersCompletedGamesParams{
-		UserUuid: userUuid,
-		Limit:    5,
-	})
+	var rarestAchievements []query.GetUsersRarestAchievementsRow
+	if showcase.Shows(SectionRarestAchievements) {
+		rarestAchievements, err = db.Queries.GetUsersRarestAchievements(ctx, query.GetUsersRarestAchievementsParams{
+			UserUuid:             userUuid,
+			MaxCompletionPercent: 0.1,
+			Limit:                10,
+		})
+
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Println(err)
+			return UserProfile{}, eris.Wrap(err, "couldn't get user's rarest achievements")
+		}
+	}
 
-	if err != nil && !errors.Is(err, sql.ErrNoRows) {
-		log.Println(err)
-		return UserProfile{}, eris.Wrap(err, "couldn't get user's completed games")
+	var completedGames []query.GetUsersCompletedGamesRow
+	if showcase.Shows(SectionCompletedGames) {
+		completedGames, err = db.Queries.GetUsersCompletedGames(ctx, query.GetUsersCompletedGamesParams{
+			UserUuid: userUuid,
+			Limit:    5,
+		})
+
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Println(err)
+			return UserProfile{}, eris.Wrap(err, "couldn't get user's completed games")
+		}
 	}
 
 	unlocks := make([]ProfileUnlockedAchievement, len(recentUserAchievements))
@@ -156,7 +175,7 @@ func GetUserProfile(ctx context.Context, userUuid uuid.UUID) (UserProfile, error
 		}
 	}
 
-	otherUserUnlocks := make([]ProfileOtherUserUnlockedAchievement, len(recentUserAchievements))
+	otherUserUnlocks := make([]ProfileOtherUserUnlockedAchievement, len(recentOtherUserAchievements))
 	for idx, achievement := range recentOtherUserAchievements {
 		otherUserUnlocks[idx] = ProfileOtherUserUnlockedAchievement{
 			ProfileUnlockedAchievement: ProfileUnlockedAchievement{
@@ -188,7 +207,7 @@ func GetUserProfile(ctx context.Context, userUuid uuid.UUID) (UserProfile, error
 		}
 	}
 
-	return UserProfile{
+	profile := UserProfile{
 		User: InternalUser{
 			RID: rid.RID{
 				Prefix: auth.UserRidPrefix,
@@ -199,9 +218,21 @@ func GetUserProfile(ctx context.Context, userUuid uuid.UUID) (UserProfile, error
 			DisplayName: &sessionProfile.DisplayName,
 			Avatar:      avatar,
 		},
+		Showcase:              showcase,
 		UnlockedAchievements:  unlocks,
 		RarestAchievements:    rarest,
 		CompletedGames:        completed,
 		OtherUserAchievements: otherUserUnlocks,
-	}, nil
+	}
+
+	userRefs := []*InternalUser{&profile.User}
+	for idx := range profile.OtherUserAchievements {
+		userRefs = append(userRefs, &profile.OtherUserAchievements[idx].User)
+	}
+
+	if err = loadUserProfileFields(ctx, userRefs...); err != nil {
+		return UserProfile{}, err
+	}
+
+	return profile, nil
 }
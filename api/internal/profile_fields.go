@@ -0,0 +1,243 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dresswithpockets/openstats/app/auth"
+	"github.com/dresswithpockets/openstats/app/db"
+	"github.com/dresswithpockets/openstats/app/db/query"
+	"github.com/dresswithpockets/openstats/app/log"
+	"github.com/dresswithpockets/openstats/app/rid"
+	"github.com/dresswithpockets/openstats/app/users"
+	"github.com/dresswithpockets/openstats/app/validation"
+	"github.com/google/uuid"
+	"github.com/rotisserie/eris"
+)
+
+const UserLinkRidPrefix = "ul"
+
+type ProfileLink struct {
+	RID        rid.RID    `json:"rid" readOnly:"true" required:"false"`
+	Url        string     `json:"url" format:"uri" maxLength:"2048"`
+	VerifiedAt *time.Time `json:"verifiedAt,omitempty" readOnly:"true" required:"false" doc:"When the linked page was verified to link back to this user's profile with rel=me"`
+}
+
+func (l *ProfileLink) MapFromRow(row query.UserLink) {
+	*l = ProfileLink{
+		RID: rid.From(UserLinkRidPrefix, row.Uuid),
+		Url: row.Url,
+	}
+
+	if row.VerifiedAt.Valid {
+		l.VerifiedAt = &row.VerifiedAt.Time
+	}
+}
+
+// loadUserProfileFields populates the bio, pronouns, country, and links of every user, by RID
+func loadUserProfileFields(ctx context.Context, internalUsers ...*InternalUser) error {
+	if len(internalUsers) == 0 {
+		return nil
+	}
+
+	byUuid := make(map[uuid.UUID][]*InternalUser, len(internalUsers))
+	userUuids := make([]uuid.UUID, 0, len(internalUsers))
+	for _, user := range internalUsers {
+		if _, exists := byUuid[user.RID.ID]; !exists {
+			userUuids = append(userUuids, user.RID.ID)
+		}
+
+		byUuid[user.RID.ID] = append(byUuid[user.RID.ID], user)
+	}
+
+	fields, err := db.Queries.GetUsersProfileFields(ctx, userUuids)
+	if err != nil {
+		return eris.Wrap(err, "couldn't get users' profile fields")
+	}
+
+	for _, row := range fields {
+		for _, user := range byUuid[row.Uuid] {
+			user.BioText = row.BioText
+			user.Pronouns = row.Pronouns
+			user.Country = row.Country
+		}
+	}
+
+	links, err := db.Queries.GetUsersLinks(ctx, userUuids)
+	if err != nil {
+		return eris.Wrap(err, "couldn't get users' links")
+	}
+
+	for _, row := range links {
+		var link ProfileLink
+		link.MapFromRow(row.UserLink)
+
+		for _, user := range byUuid[row.UserUuid] {
+			user.Links = append(user.Links, link)
+		}
+	}
+
+	return nil
+}
+
+// Resolve validates the profile fields which can't be expressed with huma's validation tags
+func (i *PostSessionRequest) Resolve(_ huma.Context) []error {
+	var errs []error
+	user := i.Body.User
+
+	if user.BioText != nil && !validation.ValidBioText(*user.BioText) {
+		errs = append(errs, &huma.ErrorDetail{
+			Location: "body.user.bioText",
+			Message:  validation.GetValidationDetail("bioText"),
+			Value:    *user.BioText,
+		})
+	}
+
+	if user.Pronouns != nil && !validation.ValidPronouns(*user.Pronouns) {
+		errs = append(errs, &huma.ErrorDetail{
+			Location: "body.user.pronouns",
+			Message:  validation.GetValidationDetail("pronouns"),
+			Value:    *user.Pronouns,
+		})
+	}
+
+	if user.Country != nil && *user.Country != "" && !validation.ValidCountry(*user.Country) {
+		errs = append(errs, &huma.ErrorDetail{
+			Location: "body.user.country",
+			Message:  validation.GetValidationDetail("country"),
+			Value:    *user.Country,
+		})
+	}
+
+	if len(user.Links) > validation.MaxProfileLinks {
+		errs = append(errs, &huma.ErrorDetail{
+			Location: "body.user.links",
+			Message:  fmt.Sprintf("must have no more than %v links", validation.MaxProfileLinks),
+		})
+	}
+
+	seen := make(map[string]bool, len(user.Links))
+	for idx, link := range user.Links {
+		if !validation.ValidProfileLink(link.Url) {
+			errs = append(errs, &huma.ErrorDetail{
+				Location: fmt.Sprintf("body.user.links[%d].url", idx),
+				Message:  validation.GetValidationDetail("link"),
+				Value:    link.Url,
+			})
+		}
+
+		if seen[link.Url] {
+			errs = append(errs, &huma.ErrorDetail{
+				Location: fmt.Sprintf("body.user.links[%d].url", idx),
+				Message:  "links must be unique",
+				Value:    link.Url,
+			})
+		}
+
+		seen[link.Url] = true
+	}
+
+	return errs
+}
+
+// updateUserProfileFields updates the user's bio, pronouns, country, and links. Nil fields are left unchanged, and
+// empty fields are cleared. Links which are kept keep their verification.
+func updateUserProfileFields(ctx context.Context, qtx *query.Queries, userId int32, user InternalUser) error {
+	err := qtx.UpdateUserProfileFields(ctx, query.UpdateUserProfileFieldsParams{
+		BioText:  user.BioText,
+		Pronouns: user.Pronouns,
+		Country:  user.Country,
+		UserID:   userId,
+	})
+	if err != nil {
+		return eris.Wrap(err, "couldn't update user's profile fields")
+	}
+
+	if user.Links == nil {
+		return nil
+	}
+
+	urls := make([]string, len(user.Links))
+	for idx, link := range user.Links {
+		urls[idx] = link.Url
+	}
+
+	err = qtx.RemoveUserLinksExcept(ctx, query.RemoveUserLinksExceptParams{
+		UserID: userId,
+		Urls:   urls,
+	})
+	if err != nil {
+		return eris.Wrap(err, "couldn't remove user's links")
+	}
+
+	err = qtx.UpsertUserLinks(ctx, query.UpsertUserLinksParams{
+		UserID: userId,
+		Urls:   urls,
+	})
+	return eris.Wrap(err, "couldn't update user's links")
+}
+
+type VerifySessionProfileLinkInput struct {
+	LinkRID rid.RID `path:"linkRID"`
+}
+
+type VerifySessionProfileLinkOutput struct {
+	Body ProfileLink
+}
+
+func HandleVerifySessionProfileLink(ctx context.Context, input *VerifySessionProfileLinkInput) (*VerifySessionProfileLinkOutput, error) {
+	principal, hasPrincipal := auth.GetPrincipal(ctx)
+	if !hasPrincipal {
+		// shouldn't ever get here due to middleware check
+		return nil, huma.Error401Unauthorized("no session")
+	}
+
+	// TODO: huma validator for rid prefix...
+	if input.LinkRID.Prefix != UserLinkRidPrefix {
+		return nil, huma.Error400BadRequest("invalid link id")
+	}
+
+	link, err := db.Queries.FindUserLink(ctx, query.FindUserLinkParams{
+		UserID:   principal.User.ID,
+		LinkUuid: input.LinkRID.ID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, huma.Error404NotFound("link not found")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	userRid := rid.From(auth.UserRidPrefix, principal.User.Uuid)
+	profileUrls := users.ProfileUrls(link.UserSlug, userRid.String())
+	verified, err := users.VerifyRelMe(ctx, link.UserLink.Url, profileUrls)
+	if err != nil {
+		// the link being unreachable isn't an error on our part, it just means the link can't be verified
+		log.Logger.Info("couldn't verify rel=me link", "url", link.UserLink.Url, "error", err)
+	}
+
+	err = db.Queries.SetUserLinkVerified(ctx, query.SetUserLinkVerifiedParams{
+		Verified: verified,
+		ID:       link.UserLink.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := db.Queries.FindUserLink(ctx, query.FindUserLinkParams{
+		UserID:   principal.User.ID,
+		LinkUuid: input.LinkRID.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	output := &VerifySessionProfileLinkOutput{}
+	output.Body.MapFromRow(updated.UserLink)
+	return output, nil
+}
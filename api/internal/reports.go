@@ -0,0 +1,129 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dresswithpockets/openstats/app/auth"
+	"github.com/dresswithpockets/openstats/app/db"
+	"github.com/dresswithpockets/openstats/app/db/query"
+	"github.com/dresswithpockets/openstats/app/rid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rotisserie/eris"
+)
+
+const ContentReportRidPrefix = "cr"
+
+// ReportTargetKind is the kind of content a report is about
+type ReportTargetKind string
+
+const (
+	ReportTargetUser        ReportTargetKind = "user"
+	ReportTargetAvatar      ReportTargetKind = "avatar"
+	ReportTargetGame        ReportTargetKind = "game"
+	ReportTargetAchievement ReportTargetKind = "achievement"
+)
+
+type PostReportInput struct {
+	Body struct {
+		TargetKind  ReportTargetKind `json:"targetKind" enum:"user,avatar,game,achievement"`
+		Target      rid.RID          `json:"target" doc:"The RID of the user for user and avatar reports, or of the game for game and achievement reports"`
+		Achievement string           `json:"achievement,omitempty" required:"false" doc:"The slug of the achievement, for achievement reports"`
+		Reason      string           `json:"reason" enum:"offensive,spam,impersonation,cheating,other"`
+		Details     string           `json:"details,omitempty" required:"false" maxLength:"1024" doc:"Anything else moderators should know"`
+	}
+}
+
+func HandlePostReport(ctx context.Context, input *PostReportInput) (*struct{}, error) {
+	principal, hasPrincipal := auth.GetPrincipal(ctx)
+	if !hasPrincipal {
+		// shouldn't ever get here due to middleware check
+		return nil, huma.Error401Unauthorized("no session")
+	}
+
+	params := query.CreateContentReportParams{
+		ReporterUserID: pgtype.Int4{Int32: principal.User.ID, Valid: true},
+		TargetKind:     string(input.Body.TargetKind),
+		Reason:         input.Body.Reason,
+		Details:        input.Body.Details,
+	}
+
+	// TODO: a huma validator for rid prefix...
+	switch input.Body.TargetKind {
+	case ReportTargetUser, ReportTargetAvatar:
+		if input.Body.Target.Prefix != auth.UserRidPrefix {
+			return nil, huma.Error400BadRequest("target must be a user RID")
+		}
+
+		user, err := db.Queries.FindUser(ctx, input.Body.Target.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, huma.Error404NotFound("user not found")
+		}
+
+		if err != nil {
+			return nil, eris.Wrap(err, "error finding reported user")
+		}
+
+		params.TargetUserID = pgtype.Int4{Int32: user.ID, Valid: true}
+		if input.Body.TargetKind == ReportTargetUser {
+			break
+		}
+
+		// the avatar is reported as it is now, so the user can't evade the report by uploading another
+		avatarId, err := db.Queries.GetUserCurrentAvatarId(ctx, user.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, huma.Error404NotFound("the user has no avatar")
+		}
+
+		if err != nil {
+			return nil, eris.Wrap(err, "error finding reported avatar")
+		}
+
+		params.TargetAvatarID = pgtype.Int4{Int32: avatarId, Valid: true}
+	case ReportTargetGame, ReportTargetAchievement:
+		if input.Body.Target.Prefix != GameRidPrefix {
+			return nil, huma.Error400BadRequest("target must be a game RID")
+		}
+
+		game, err := db.Queries.FindGame(ctx, input.Body.Target.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, huma.Error404NotFound("game not found")
+		}
+
+		if err != nil {
+			return nil, eris.Wrap(err, "error finding reported game")
+		}
+
+		params.TargetGameID = pgtype.Int4{Int32: game.ID, Valid: true}
+		if input.Body.TargetKind == ReportTargetGame {
+			break
+		}
+
+		if len(input.Body.Achievement) == 0 {
+			return nil, huma.Error400BadRequest("achievement is required for achievement reports")
+		}
+
+		achievement, err := db.Queries.FindAchievementBySlug(ctx, query.FindAchievementBySlugParams{
+			AchievementSlug: input.Body.Achievement,
+			GameUuid:        game.Uuid,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, huma.Error404NotFound("achievement not found")
+		}
+
+		if err != nil {
+			return nil, eris.Wrap(err, "error finding reported achievement")
+		}
+
+		params.TargetAchievementID = pgtype.Int4{Int32: achievement.ID, Valid: true}
+	}
+
+	// a duplicate of the reporter's open report is ignored, so reporting is idempotent
+	if _, err := db.Queries.CreateContentReport(ctx, params); err != nil {
+		return nil, eris.Wrap(err, "error creating content report")
+	}
+
+	return nil, nil
+}
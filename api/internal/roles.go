@@ -0,0 +1,46 @@
+package internal
+
+import (
+	"context"
+	"errors"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dresswithpockets/openstats/app/auth"
+)
+
+type PostAdminSetupInput struct {
+	Body struct {
+		Token string `json:"token" minLength:"1" doc:"The setup token logged when the API first started without a root user"`
+	}
+}
+
+type PostAdminSetupOutput struct {
+	Body struct {
+		Role auth.Role `json:"role" readOnly:"true" enum:"root"`
+	}
+}
+
+func HandlePostAdminSetup(ctx context.Context, input *PostAdminSetupInput) (*PostAdminSetupOutput, error) {
+	principal, hasPrincipal := auth.GetPrincipal(ctx)
+	if !hasPrincipal {
+		// shouldn't ever get here due to middleware check
+		return nil, huma.Error401Unauthorized("no session")
+	}
+
+	err := auth.ClaimRoot(ctx, principal.User.ID, input.Body.Token)
+	if errors.Is(err, auth.ErrInvalidAdminSetupToken) {
+		return nil, huma.Error403Forbidden("invalid or already used setup token")
+	}
+
+	if errors.Is(err, auth.ErrRootExists) {
+		return nil, huma.Error409Conflict("a root user already exists")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	output := &PostAdminSetupOutput{}
+	output.Body.Role = auth.RoleRoot
+	return output, nil
+}
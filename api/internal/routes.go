@@ -8,15 +8,19 @@ import (
 	"errors"
 	"image/png"
 	"net/http"
+	"slices"
 	"strconv"
 	"time"
 
 	"github.com/buckket/go-blurhash"
 	"github.com/danielgtaylor/huma/v2"
+	"github.com/danielgtaylor/huma/v2/sse"
 	"github.com/dresswithpockets/openstats/app/auth"
 	"github.com/dresswithpockets/openstats/app/db"
 	"github.com/dresswithpockets/openstats/app/db/query"
+	"github.com/dresswithpockets/openstats/app/events"
 	"github.com/dresswithpockets/openstats/app/media"
+	"github.com/dresswithpockets/openstats/app/ratelimit"
 	"github.com/dresswithpockets/openstats/app/rid"
 	"github.com/dresswithpockets/openstats/app/users"
 	"github.com/dresswithpockets/openstats/app/validation"
@@ -27,6 +31,9 @@ import (
 func RegisterRoutes(api huma.API) {
 	internalApi := huma.NewGroup(api, "/internal")
 
+	// internal routes are authenticated by the session cookie, which browsers attach to requests from any site
+	internalApi.UseMiddleware(auth.CreateCsrfHandler(internalApi))
+
 	var sessionCookieSecurityMap = []map[string][]string{{"SessionCookie": {}}}
 	var requireUserSessionMiddlewares = huma.Middlewares{
 		auth.UserAuthHandler,
@@ -37,16 +44,34 @@ func RegisterRoutes(api huma.API) {
 		auth.CreateRequireNoUserAuthHandler(internalApi),
 	}
 
+	// unauthenticated operations which are easily abused, limited per client IP address
+	var rateLimitedMiddlewares = func(limit string) huma.Middlewares {
+		return append(slices.Clone(disallowUserSessionMiddlewares), ratelimit.CreateRateLimitHandler(internalApi, limit, ratelimit.ByIP))
+	}
+
+	// operations that third-party apps may also use, with an access token that has the scope
+	var oauthSecurityMap = func(scope string) []map[string][]string {
+		return []map[string][]string{{"SessionCookie": {}}, {"OAuth2": {scope}}}
+	}
+	var oauthUserMiddlewares = func(scope string) huma.Middlewares {
+		return huma.Middlewares{
+			auth.UserAuthHandler,
+			auth.OAuthAccessTokenHandler,
+			auth.CreateRequireUserAuthHandler(internalApi),
+			auth.CreateRequireOAuthScopeHandler(internalApi, scope),
+		}
+	}
+
 	huma.Register(internalApi, huma.Operation{
 		Method:      http.MethodGet,
 		Path:        "/send-slug-reminder",
 		OperationID: "send-slug-reminder",
 		Summary:     "Send slug reminder",
 		Description: "Send an email to the email provided containing a list of all users associated with the email",
-		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusBadRequest},
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusBadRequest, http.StatusTooManyRequests},
 		Tags:        []string{"Internal"},
 
-		Middlewares: disallowUserSessionMiddlewares,
+		Middlewares: rateLimitedMiddlewares(ratelimit.SendSlugReminder),
 	}, HandleSendSlugReminder)
 
 	huma.Register(internalApi, huma.Operation{
@@ -55,10 +80,10 @@ func RegisterRoutes(api huma.API) {
 		OperationID: "send-password-reset",
 		Summary:     "Send password reset",
 		Description: "Send a 2FA TOTP code to the email associated with the slug, to use with /reset-password",
-		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusBadRequest},
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusBadRequest, http.StatusTooManyRequests},
 		Tags:        []string{"Internal"},
 
-		Middlewares: disallowUserSessionMiddlewares,
+		Middlewares: rateLimitedMiddlewares(ratelimit.SendPasswordReset),
 	}, HandleSendPasswordReset)
 
 	huma.Register(internalApi, huma.Operation{
@@ -67,7 +92,7 @@ func RegisterRoutes(api huma.API) {
 		OperationID: "reset-password",
 		Summary:     "Reset password",
 		Description: "Given a 2FA TOTP code, changes the user's password and signs them into their account",
-		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusBadRequest},
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusTooManyRequests},
 		Tags:        []string{"Internal"},
 
 		Middlewares: disallowUserSessionMiddlewares,
@@ -84,9 +109,9 @@ func RegisterRoutes(api huma.API) {
 		OperationID: "sign-up",
 		Summary:     "Sign up",
 		Description: "Create a new user and sign into a new session as the new user",
-		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusConflict},
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusConflict, http.StatusTooManyRequests},
 
-		Middlewares: disallowUserSessionMiddlewares,
+		Middlewares: rateLimitedMiddlewares(ratelimit.SignUp),
 	}, HandlePostSignUp)
 
 	huma.Register(sessionApi, huma.Operation{
@@ -95,11 +120,43 @@ func RegisterRoutes(api huma.API) {
 		OperationID: "sign-in",
 		Summary:     "Sign in",
 		Description: "Sign into a new session as an existing user",
-		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized},
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests},
 
-		Middlewares: disallowUserSessionMiddlewares,
+		Middlewares: rateLimitedMiddlewares(ratelimit.SignIn),
 	}, HandlePostSignIn)
 
+	huma.Register(sessionApi, huma.Operation{
+		Method:      http.MethodPost,
+		Path:        "/sign-in/mfa",
+		OperationID: "sign-in-mfa",
+		Summary:     "Complete an MFA sign in",
+		Description: "Complete the MFA challenge returned by sign-in with an authenticator app code or a recovery code, and sign into a new session",
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests},
+
+		Middlewares: rateLimitedMiddlewares(ratelimit.SignIn),
+	}, HandlePostSignInMfa)
+
+	huma.Register(sessionApi, huma.Operation{
+		Method:      http.MethodPost,
+		Path:        "/sign-in/passkey",
+		OperationID: "begin-passkey-sign-in",
+		Summary:     "Begin a passkey sign in",
+		Description: "Start a passkey sign in ceremony. The user is identified by the passkey they choose, so no slug or email is needed.",
+
+		Middlewares: disallowUserSessionMiddlewares,
+	}, HandleBeginPasskeySignIn)
+
+	huma.Register(sessionApi, huma.Operation{
+		Method:      http.MethodPost,
+		Path:        "/sign-in/passkey/finish",
+		OperationID: "finish-passkey-sign-in",
+		Summary:     "Finish a passkey sign in",
+		Description: "Verify the passkey assertion, and sign into a new session as the passkey's user",
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests},
+
+		Middlewares: rateLimitedMiddlewares(ratelimit.SignIn),
+	}, HandleFinishPasskeySignIn)
+
 	huma.Register(sessionApi, huma.Operation{
 		Method:      http.MethodPost,
 		Path:        "/sign-out",
@@ -112,18 +169,102 @@ func RegisterRoutes(api huma.API) {
 		Middlewares: requireUserSessionMiddlewares,
 	}, HandlePostSignOut)
 
+	huma.Register(sessionApi, huma.Operation{
+		Method:      http.MethodPost,
+		Path:        "/sign-out-everywhere",
+		OperationID: "sign-out-everywhere",
+		Summary:     "Sign out everywhere",
+		Description: "Sign out of every web session, including the current one, and end every active game session. Game tokens aren't revoked; games may start new sessions with them.",
+		Errors:      []int{http.StatusUnauthorized},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandlePostSignOutEverywhere)
+
+	huma.Register(sessionApi, huma.Operation{
+		Method:      http.MethodGet,
+		Path:        "/sessions",
+		OperationID: "get-sessions",
+		Summary:     "Get user's sessions",
+		Description: "Get the current user's signed in web sessions, with where they were signed in from and when they were last seen, and their active game sessions",
+		Errors:      []int{http.StatusUnauthorized},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandleGetSessions)
+
+	huma.Register(sessionApi, huma.Operation{
+		Method:      http.MethodGet,
+		Path:        "/security-log",
+		OperationID: "get-security-log",
+		Summary:     "Get user's security log",
+		Description: "Get the history of security-relevant events on the current user's account, newest first, such as sign ins, password and email changes, and game tokens being created or deleted",
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandleGetSecurityLog)
+
+	huma.Register(sessionApi, huma.Operation{
+		Method:      http.MethodPost,
+		Path:        "/admin-setup",
+		OperationID: "admin-setup",
+		Summary:     "Become the root user",
+		Description: "Make the current user root, with the one-time setup token logged when the API first started without a root user. Only possible while there is no root user.",
+		Errors:      []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusConflict},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandlePostAdminSetup)
+
+	huma.Register(sessionApi, huma.Operation{
+		Method:      http.MethodDelete,
+		Path:        "/sessions/web/{sessionRID}",
+		OperationID: "delete-web-session",
+		Summary:     "Sign out a web session",
+		Description: "Sign out one of the current user's web sessions, invalidating its session token",
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandleDeleteWebSession)
+
+	huma.Register(sessionApi, huma.Operation{
+		Method:      http.MethodDelete,
+		Path:        "/sessions/game/{sessionRID}",
+		OperationID: "delete-game-session",
+		Summary:     "End a game session",
+		Description: "End one of the current user's game sessions, invalidating its game session token. The game may start a new session with its game token.",
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandleDeleteGameSession)
+
 	huma.Register(sessionApi, huma.Operation{
 		Method:      http.MethodGet,
 		Path:        "/",
 		OperationID: "get-session",
 		Summary:     "Get session summary",
 		Description: "Get details about the current authenticated session and the associated user",
-		Errors:      []int{http.StatusUnauthorized},
+		Errors:      []int{http.StatusUnauthorized, http.StatusForbidden},
 
-		Security:    sessionCookieSecurityMap,
-		Middlewares: requireUserSessionMiddlewares,
+		Security:    oauthSecurityMap(auth.OAuthScopeReadProfile),
+		Middlewares: oauthUserMiddlewares(auth.OAuthScopeReadProfile),
 	}, HandleGetSession)
 
+	huma.Register(sessionApi, huma.Operation{
+		Method:      http.MethodGet,
+		Path:        "/achievements",
+		OperationID: "get-session-achievements",
+		Summary:     "Get user's achievement progress",
+		Description: "Get the current authenticated user's progress towards every achievement they've made progress on, including locked achievements",
+		Errors:      []int{http.StatusUnauthorized, http.StatusForbidden},
+
+		Security:    oauthSecurityMap(auth.OAuthScopeReadAchievements),
+		Middlewares: oauthUserMiddlewares(auth.OAuthScopeReadAchievements),
+	}, HandleGetSessionAchievements)
+
 	huma.Register(sessionApi, huma.Operation{
 		Method:      http.MethodPost,
 		Path:        "/add-email",
@@ -142,7 +283,7 @@ func RegisterRoutes(api huma.API) {
 		OperationID: "confirm-email",
 		Summary:     "Confirm an email",
 		Description: "Validates an email confirmation TOTP; if successful, the email will be marked as verified",
-		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized},
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusTooManyRequests},
 
 		Security:    sessionCookieSecurityMap,
 		Middlewares: requireUserSessionMiddlewares,
@@ -172,6 +313,167 @@ func RegisterRoutes(api huma.API) {
 		Middlewares: requireUserSessionMiddlewares,
 	}, HandleChangePassword)
 
+	huma.Register(sessionApi, huma.Operation{
+		Method:      http.MethodPost,
+		Path:        "/mfa/totp",
+		OperationID: "enroll-mfa-totp",
+		Summary:     "Start TOTP MFA enrollment",
+		Description: "Generate a new authenticator app secret for the current user. MFA isn't enabled until the enrollment is confirmed.",
+		Errors:      []int{http.StatusUnauthorized, http.StatusConflict},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandlePostMfaEnroll)
+
+	huma.Register(sessionApi, huma.Operation{
+		Method:      http.MethodPost,
+		Path:        "/mfa/totp/confirm",
+		OperationID: "confirm-mfa-totp",
+		Summary:     "Confirm TOTP MFA enrollment",
+		Description: "Enable MFA for the current user by validating a code from their authenticator app. Returns the user's recovery codes.",
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusConflict},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandlePostMfaConfirm)
+
+	huma.Register(sessionApi, huma.Operation{
+		Method:      http.MethodDelete,
+		Path:        "/mfa/totp",
+		OperationID: "delete-mfa-totp",
+		Summary:     "Disable TOTP MFA",
+		Description: "Disable MFA for the current user, removing their authenticator app secret and recovery codes",
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandleDeleteMfa)
+
+	huma.Register(sessionApi, huma.Operation{
+		Method:      http.MethodPost,
+		Path:        "/mfa/recovery-codes",
+		OperationID: "regenerate-mfa-recovery-codes",
+		Summary:     "Regenerate MFA recovery codes",
+		Description: "Replace all of the current user's recovery codes with new ones",
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandlePostRecoveryCodes)
+
+	huma.Register(sessionApi, huma.Operation{
+		Method:      http.MethodGet,
+		Path:        "/passkeys",
+		OperationID: "get-passkeys",
+		Summary:     "Get user's passkeys",
+		Description: "Get all of the current user's passkeys",
+		Errors:      []int{http.StatusUnauthorized},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandleGetPasskeys)
+
+	huma.Register(sessionApi, huma.Operation{
+		Method:      http.MethodPost,
+		Path:        "/passkeys",
+		OperationID: "begin-passkey-registration",
+		Summary:     "Begin passkey registration",
+		Description: "Start a registration ceremony for a new passkey for the current user",
+		Errors:      []int{http.StatusUnauthorized},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandleBeginPasskeyRegistration)
+
+	huma.Register(sessionApi, huma.Operation{
+		Method:      http.MethodPost,
+		Path:        "/passkeys/finish",
+		OperationID: "finish-passkey-registration",
+		Summary:     "Finish passkey registration",
+		Description: "Verify the new passkey, and add it to the current user's passkeys",
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusConflict},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandleFinishPasskeyRegistration)
+
+	huma.Register(sessionApi, huma.Operation{
+		Method:      http.MethodDelete,
+		Path:        "/passkeys/{passkeyRID}",
+		OperationID: "delete-passkey",
+		Summary:     "Remove a passkey",
+		Description: "Remove one of the current user's passkeys, so it can no longer be used to sign in. The user's only remaining way to sign in can't be removed.",
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusConflict},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandleDeletePasskey)
+
+	huma.Register(sessionApi, huma.Operation{
+		Method:      http.MethodGet,
+		Path:        "/oidc",
+		OperationID: "get-oidc-providers",
+		Summary:     "Get identity providers",
+		Description: "Get the external OpenID Connect providers users can sign in with",
+	}, HandleGetOidcProviders)
+
+	huma.Register(sessionApi, huma.Operation{
+		Method:      http.MethodPost,
+		Path:        "/oidc/{provider}/sign-in",
+		OperationID: "begin-oidc-sign-in",
+		Summary:     "Begin signing in with an identity provider",
+		Description: "Start an authorization with the provider. The user must be sent to the returned URL; the provider redirects them back to the callback, which signs them in. On an identity's first sign in, it's linked to the user with a matching confirmed email if the provider has verified it, otherwise a new user is created.",
+		Errors:      []int{http.StatusUnauthorized, http.StatusNotFound},
+
+		Middlewares: disallowUserSessionMiddlewares,
+	}, HandleBeginOidcSignIn)
+
+	huma.Register(sessionApi, huma.Operation{
+		Method:      http.MethodPost,
+		Path:        "/oidc/{provider}/link",
+		OperationID: "begin-oidc-link",
+		Summary:     "Begin linking an identity provider",
+		Description: "Start an authorization with the provider, to link the identity to the current user. The user must be sent to the returned URL; the provider redirects them back to the callback, which links the identity.",
+		Errors:      []int{http.StatusUnauthorized, http.StatusNotFound},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandleBeginOidcLink)
+
+	huma.Register(sessionApi, huma.Operation{
+		Method:        http.MethodGet,
+		Path:          "/oidc/{provider}/callback",
+		OperationID:   "oidc-callback",
+		Summary:       "Identity provider callback",
+		Description:   "The redirect URI registered with the provider. Completes the authorization, then redirects to OPENSTATS_OIDC_COMPLETE_URL with the outcome in the query string: signedIn, linked, mfaChallenge, or error.",
+		DefaultStatus: http.StatusSeeOther,
+		Errors:        []int{http.StatusNotFound},
+	}, HandleOidcCallback)
+
+	huma.Register(sessionApi, huma.Operation{
+		Method:      http.MethodGet,
+		Path:        "/identities",
+		OperationID: "get-identities",
+		Summary:     "Get user's linked identities",
+		Description: "Get all of the external identities linked to the current user",
+		Errors:      []int{http.StatusUnauthorized},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandleGetUserIdentities)
+
+	huma.Register(sessionApi, huma.Operation{
+		Method:      http.MethodDelete,
+		Path:        "/identities/{identityRID}",
+		OperationID: "delete-identity",
+		Summary:     "Unlink an identity",
+		Description: "Unlink one of the current user's external identities, so it can no longer be used to sign in. The user's only remaining way to sign in can't be removed.",
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusConflict},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandleDeleteUserIdentity)
+
 	huma.Register(sessionApi, huma.Operation{
 		Method:      http.MethodPost,
 		Path:        "/profile",
@@ -196,6 +498,42 @@ func RegisterRoutes(api huma.API) {
 		Middlewares: requireUserSessionMiddlewares,
 	}, HandlePostSessionAvatar)
 
+	huma.Register(sessionApi, huma.Operation{
+		Method:      http.MethodPost,
+		Path:        "/profile/links/{linkRID}/verify",
+		OperationID: "verify-session-profile-link",
+		Summary:     "Verify a profile link",
+		Description: "Check that the page at one of the current user's profile links has a rel=me link back to the user's openstats profile. The link is marked verified if it does, and unverified otherwise.",
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandleVerifySessionProfileLink)
+
+	huma.Register(sessionApi, huma.Operation{
+		Method:      http.MethodGet,
+		Path:        "/profile/showcase",
+		OperationID: "get-session-showcase",
+		Summary:     "Get user's showcase",
+		Description: "Get the pinned achievements, pinned games, featured game, and hidden profile sections of the current authenticated user",
+		Errors:      []int{http.StatusUnauthorized, http.StatusForbidden},
+
+		Security:    oauthSecurityMap(auth.OAuthScopeReadProfile),
+		Middlewares: oauthUserMiddlewares(auth.OAuthScopeReadProfile),
+	}, HandleGetSessionShowcase)
+
+	huma.Register(sessionApi, huma.Operation{
+		Method:      http.MethodPut,
+		Path:        "/profile/showcase",
+		OperationID: "update-session-showcase",
+		Summary:     "Update user's showcase",
+		Description: "Replace the showcase of the current authenticated user. Only unlocked achievements and played games may be showcased, and they are shown in the order given.",
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandlePutSessionShowcase)
+
 	huma.Register(sessionApi, huma.Operation{
 		Method:      http.MethodGet,
 		Path:        "/tokens",
@@ -225,13 +563,160 @@ func RegisterRoutes(api huma.API) {
 		Path:        "/tokens/{tokenRID}",
 		OperationID: "delete-game-token",
 		Summary:     "Invalidate a token",
-		Description: "Invalidate one of the current user's tokens",
+		Description: "Invalidate one of the current user's tokens, ending the game sessions started with it",
 		Errors:      []int{http.StatusBadRequest},
 
 		Security:    sessionCookieSecurityMap,
 		Middlewares: requireUserSessionMiddlewares,
 	}, HandleDeleteSessionGameToken)
 
+	huma.Register(sessionApi, huma.Operation{
+		Method:      http.MethodPost,
+		Path:        "/tokens/{tokenRID}/rotate",
+		OperationID: "rotate-game-token",
+		Summary:     "Rotate a token",
+		Description: "Replace the secret of one of the current user's tokens, keeping its game, scopes, and expiry. The old secret stops working immediately, and game sessions started with it are ended.",
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandleRotateSessionGameToken)
+
+	// device authorizations are limited per user, so a signed in user can't guess other players' user codes
+	deviceMiddlewares := append(slices.Clone(requireUserSessionMiddlewares), ratelimit.CreateRateLimitHandler(sessionApi, ratelimit.Device, ratelimit.ByUser))
+
+	huma.Register(sessionApi, huma.Operation{
+		Method:      http.MethodGet,
+		Path:        "/device/{userCode}",
+		OperationID: "get-device-authorization",
+		Summary:     "Get a device authorization",
+		Description: "Get the game requesting a game token with the code the player entered, so they can check it before approving",
+		Errors:      []int{http.StatusUnauthorized, http.StatusNotFound, http.StatusTooManyRequests},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: deviceMiddlewares,
+	}, HandleGetDeviceAuthorization)
+
+	huma.Register(sessionApi, huma.Operation{
+		Method:      http.MethodPost,
+		Path:        "/device/{userCode}/approve",
+		OperationID: "approve-device-authorization",
+		Summary:     "Approve a device authorization",
+		Description: "Approve the game's request, so it receives a new game token for the current user the next time it polls",
+		Errors:      []int{http.StatusUnauthorized, http.StatusNotFound, http.StatusTooManyRequests},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: deviceMiddlewares,
+	}, HandleApproveDeviceAuthorization)
+
+	huma.Register(sessionApi, huma.Operation{
+		Method:      http.MethodPost,
+		Path:        "/device/{userCode}/deny",
+		OperationID: "deny-device-authorization",
+		Summary:     "Deny a device authorization",
+		Description: "Deny the game's request, recording the current user as the one who denied it. The game is told it was denied the next time it polls.",
+		Errors:      []int{http.StatusUnauthorized, http.StatusNotFound, http.StatusTooManyRequests},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: deviceMiddlewares,
+	}, HandleDenyDeviceAuthorization)
+
+	huma.Register(sessionApi, huma.Operation{
+		Method:      http.MethodGet,
+		Path:        "/oauth/authorize",
+		OperationID: "get-oauth-authorization",
+		Summary:     "Get an OAuth authorization request",
+		Description: "Get the third-party app and scopes of an OAuth 2.0 authorization request, for the consent screen. Requests with an unknown client or an unregistered redirect_uri must not be redirected back to the client.",
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandleGetOAuthAuthorization)
+
+	huma.Register(sessionApi, huma.Operation{
+		Method:      http.MethodPost,
+		Path:        "/oauth/authorize",
+		OperationID: "post-oauth-authorization",
+		Summary:     "Approve or deny an OAuth authorization request",
+		Description: "Record the current user's decision on a third-party app's authorization request. Returns the URL to redirect the user back to the app with, which carries an authorization code if they approved.",
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandlePostOAuthAuthorization)
+
+	huma.Register(sessionApi, huma.Operation{
+		Method:      http.MethodGet,
+		Path:        "/oauth/apps",
+		OperationID: "get-oauth-apps",
+		Summary:     "Get user's authorized apps",
+		Description: "Get the third-party apps the current user has authorized, and the scopes they were granted",
+		Errors:      []int{http.StatusUnauthorized},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandleGetOAuthApps)
+
+	huma.Register(sessionApi, huma.Operation{
+		Method:      http.MethodDelete,
+		Path:        "/oauth/apps/{clientRID}",
+		OperationID: "delete-oauth-app",
+		Summary:     "Revoke an authorized app",
+		Description: "Revoke the app's refresh tokens and authorization codes. Access tokens it already has stop working immediately.",
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandleDeleteOAuthApp)
+
+	huma.Register(sessionApi, huma.Operation{
+		Method:      http.MethodGet,
+		Path:        "/notifications",
+		OperationID: "get-notifications",
+		Summary:     "Get user's notifications",
+		Description: "Get the current user's notifications, newest first, along with the number of unread notifications",
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandleGetNotifications)
+
+	huma.Register(sessionApi, huma.Operation{
+		Method:      http.MethodPost,
+		Path:        "/notifications/read",
+		OperationID: "read-all-notifications",
+		Summary:     "Mark all notifications as read",
+		Description: "Mark all of the current user's unread notifications as read",
+		Errors:      []int{http.StatusUnauthorized},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandleReadAllNotifications)
+
+	huma.Register(sessionApi, huma.Operation{
+		Method:      http.MethodPost,
+		Path:        "/notifications/{notificationRID}/read",
+		OperationID: "read-notification",
+		Summary:     "Mark a notification as read",
+		Description: "Mark one of the current user's notifications as read",
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandleReadNotification)
+
+	sse.Register(sessionApi, huma.Operation{
+		Method:      http.MethodGet,
+		Path:        "/events",
+		OperationID: "get-session-events",
+		Summary:     "Stream user's events",
+		Description: "Stream events for the current user as Server-Sent Events - such as achievement unlocks, progress changes, and game sessions starting or ending",
+		Errors:      []int{http.StatusUnauthorized},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, events.MessageTypes, HandleGetSessionEvents)
+
 	userApi := huma.NewGroup(internalApi, "/users/v1")
 	userApi.UseSimpleModifier(func(op *huma.Operation) {
 		op.Tags = append(op.Tags, "Internal/Users")
@@ -256,6 +741,47 @@ func RegisterRoutes(api huma.API) {
 		Description: "Get a user's displayable profile",
 	}, HandleGetUserProfile)
 
+	developerApi := huma.NewGroup(internalApi, "/developers/v1")
+	developerApi.UseSimpleModifier(func(op *huma.Operation) {
+		op.Tags = append(op.Tags, "Internal/Developers")
+	})
+
+	huma.Register(developerApi, huma.Operation{
+		Method:      http.MethodGet,
+		Path:        "/{developer}/oauth-clients",
+		OperationID: "get-developer-oauth-clients",
+		Summary:     "Get a developer's OAuth clients",
+		Description: "Get the third-party apps registered by the developer. Only members of the developer may manage its OAuth clients.",
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandleGetDeveloperOAuthClients)
+
+	huma.Register(developerApi, huma.Operation{
+		Method:      http.MethodPost,
+		Path:        "/{developer}/oauth-clients",
+		OperationID: "create-developer-oauth-client",
+		Summary:     "Create an OAuth client",
+		Description: "Register a new third-party app. Confidential clients are given a secret, which is only returned here.",
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandlePostDeveloperOAuthClient)
+
+	huma.Register(developerApi, huma.Operation{
+		Method:      http.MethodDelete,
+		Path:        "/{developer}/oauth-clients/{client}",
+		OperationID: "delete-developer-oauth-client",
+		Summary:     "Delete an OAuth client",
+		Description: "Delete the third-party app, revoking every authorization users have given it",
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandleDeleteDeveloperOAuthClient)
+
 	gameApi := huma.NewGroup(internalApi, "/games/v1")
 	gameApi.UseSimpleModifier(func(op *huma.Operation) {
 		op.Tags = append(op.Tags, "Internal/Games")
@@ -268,6 +794,206 @@ func RegisterRoutes(api huma.API) {
 		Summary:     "Get a game's profile",
 		Description: "Get a game's displayable profile",
 	}, HandleGetGameProfile)
+
+	huma.Register(gameApi, huma.Operation{
+		Method:      http.MethodGet,
+		Path:        "/{game}/webhooks",
+		OperationID: "get-game-webhooks",
+		Summary:     "Get a game's webhooks",
+		Description: "Get all webhooks subscribed to the game's events. Only members of the game's developer may manage its webhooks.",
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandleGetGameWebhooks)
+
+	huma.Register(gameApi, huma.Operation{
+		Method:      http.MethodPost,
+		Path:        "/{game}/webhooks",
+		OperationID: "create-game-webhook",
+		Summary:     "Create a webhook",
+		Description: "Subscribe a new webhook to the game's events. Deliveries are signed with the returned secret using HMAC-SHA256; see the X-Openstats-Signature header. The URL must resolve to a public address, and redirects aren't followed.",
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandlePostGameWebhook)
+
+	huma.Register(gameApi, huma.Operation{
+		Method:      http.MethodDelete,
+		Path:        "/{game}/webhooks/{webhook}",
+		OperationID: "delete-game-webhook",
+		Summary:     "Delete a webhook",
+		Description: "Delete one of the game's webhooks, along with its delivery log and secret",
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandleDeleteGameWebhook)
+
+	huma.Register(gameApi, huma.Operation{
+		Method:      http.MethodGet,
+		Path:        "/{game}/webhooks/{webhook}/deliveries",
+		OperationID: "get-webhook-deliveries",
+		Summary:     "Get a webhook's deliveries",
+		Description: "Get the webhook's delivery log, newest first",
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandleGetWebhookDeliveries)
+
+	huma.Register(gameApi, huma.Operation{
+		Method:      http.MethodPost,
+		Path:        "/{game}/webhooks/{webhook}/deliveries/{delivery}/replay",
+		OperationID: "replay-webhook-delivery",
+		Summary:     "Replay a webhook delivery",
+		Description: "Queue a new delivery of the same event as an existing delivery",
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandleReplayWebhookDelivery)
+
+	huma.Register(gameApi, huma.Operation{
+		Method:      http.MethodGet,
+		Path:        "/{game}/anomalies",
+		OperationID: "get-game-anomalies",
+		Summary:     "Get a game's progress anomalies",
+		Description: "Get progress towards the game's achievements which was flagged as suspicious, newest first. Only members of the game's developer may review its anomalies.",
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandleGetGameAnomalies)
+
+	huma.Register(gameApi, huma.Operation{
+		Method:        http.MethodPost,
+		Path:          "/{game}/anomalies/{anomaly}/resolve",
+		OperationID:   "resolve-game-anomaly",
+		Summary:       "Resolve a progress anomaly",
+		Description:   "Dismiss an open anomaly, or revoke the unlock it was flagged for. Revoked unlocks don't count towards the achievement's rarity or the game's completions.",
+		DefaultStatus: http.StatusNoContent,
+		Errors:        []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandleResolveGameAnomaly)
+
+	huma.Register(gameApi, huma.Operation{
+		Method:      http.MethodGet,
+		Path:        "/{game}/settings",
+		OperationID: "get-game-settings",
+		Summary:     "Get a game's settings",
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandleGetGameSettings)
+
+	huma.Register(gameApi, huma.Operation{
+		Method:      http.MethodPut,
+		Path:        "/{game}/settings",
+		OperationID: "put-game-settings",
+		Summary:     "Update a game's settings",
+		Description: "Only members of the game's developer may manage the game.",
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandlePutGameSettings)
+
+	huma.Register(gameApi, huma.Operation{
+		Method:      http.MethodGet,
+		Path:        "/{game}/server-keys",
+		OperationID: "get-game-server-keys",
+		Summary:     "Get a game's server keys",
+		Description: "Get the keys the game's servers use to submit progress. Their secrets are never returned.",
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandleGetGameServerKeys)
+
+	huma.Register(gameApi, huma.Operation{
+		Method:      http.MethodPost,
+		Path:        "/{game}/server-keys",
+		OperationID: "create-game-server-key",
+		Summary:     "Create a server key",
+		Description: "Create a key for the game's servers, which may submit progress for any player of the game. The key is only returned when it's created.",
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandlePostGameServerKey)
+
+	huma.Register(gameApi, huma.Operation{
+		Method:        http.MethodDelete,
+		Path:          "/{game}/server-keys/{key}",
+		OperationID:   "delete-game-server-key",
+		Summary:       "Delete a server key",
+		Description:   "Delete one of the game's server keys, so it stops working",
+		DefaultStatus: http.StatusNoContent,
+		Errors:        []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandleDeleteGameServerKey)
+
+	huma.Register(gameApi, huma.Operation{
+		Method:      http.MethodGet,
+		Path:        "/{game}/builds",
+		OperationID: "get-game-builds",
+		Summary:     "Get a game's builds",
+		Description: "Get the builds which may sign the game's progress. Their secrets are never returned.",
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandleGetGameBuilds)
+
+	huma.Register(gameApi, huma.Operation{
+		Method:      http.MethodPost,
+		Path:        "/{game}/builds",
+		OperationID: "create-game-build",
+		Summary:     "Create a build",
+		Description: "Create a build of the game, with a secret to embed in it for signing progress. The secret is only returned when the build is created. See X-Openstats-Signature.",
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandlePostGameBuild)
+
+	huma.Register(gameApi, huma.Operation{
+		Method:        http.MethodDelete,
+		Path:          "/{game}/builds/{build}",
+		OperationID:   "delete-game-build",
+		Summary:       "Delete a build",
+		Description:   "Delete one of the game's builds and its secret, so progress signed by it is no longer accepted",
+		DefaultStatus: http.StatusNoContent,
+		Errors:        []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: requireUserSessionMiddlewares,
+	}, HandleDeleteGameBuild)
+
+	reportApi := huma.NewGroup(internalApi, "/reports/v1")
+	reportApi.UseSimpleModifier(func(op *huma.Operation) {
+		op.Tags = append(op.Tags, "Internal/Reports")
+	})
+
+	huma.Register(reportApi, huma.Operation{
+		Method:        http.MethodPost,
+		Path:          "/",
+		OperationID:   "create-report",
+		Summary:       "Report content",
+		Description:   "Report a user, their avatar, a game, or an achievement for moderators to review. Reporting the same content again while the report is still open has no effect.",
+		DefaultStatus: http.StatusNoContent,
+		Errors:        []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusTooManyRequests},
+
+		Security:    sessionCookieSecurityMap,
+		Middlewares: append(slices.Clone(requireUserSessionMiddlewares), ratelimit.CreateRateLimitHandler(reportApi, ratelimit.Report, ratelimit.ByUser)),
+	}, HandlePostReport)
 }
 
 type SendEmailConfInput struct {
@@ -298,6 +1024,8 @@ func HandleAddEmail(ctx context.Context, input *SendEmailConfInput) (output *Sen
 		return nil, huma.Error409Conflict("email already associated with this user")
 	}
 
+	auth.RecordSecurityEvent(ctx, principal.User.ID, auth.SecurityEventEmailAdded, map[string]string{"email": userEmail.Email})
+
 	var hmacSecret string
 	hmacSecret, err = db.Queries.SecretRead(ctx, query.SecretReadParams{
 		Path: db.PrivateUser2faHmacSecretPath,
@@ -340,7 +1068,7 @@ func HandleConfirmEmail(ctx context.Context, input *ConfirmEmailInput) (output *
 
 	validated, validateErr := ValidateUserEmail(ctx, principal.User.ID, input.Body.Email, input.Body.Code)
 	if validateErr != nil {
-		return nil, validateErr
+		return nil, humaAccountLockedError(validateErr)
 	}
 
 	return &ConfirmEmailOutput{Body: EmailValidationResult{Validated: validated}}, nil
@@ -369,7 +1097,12 @@ func HandleRemoveEmail(ctx context.Context, input *RemoveEmailInput) (output *Re
 		return nil, huma.Error404NotFound("that email isn't associated with this user")
 	}
 
-	return &RemoveEmailOutput{}, err
+	if err != nil {
+		return nil, err
+	}
+
+	auth.RecordSecurityEvent(ctx, principal.User.ID, auth.SecurityEventEmailRemoved, map[string]string{"email": input.Body.Email})
+	return &RemoveEmailOutput{}, nil
 }
 
 type ChangePasswordInput struct {
@@ -391,6 +1124,8 @@ func HandleChangePassword(ctx context.Context, input *ChangePasswordInput) (outp
 		return nil, err
 	}
 
+	auth.RecordSecurityEvent(ctx, principal.User.ID, auth.SecurityEventPasswordChanged, nil)
+
 	return &ChangePasswordOutput{}, nil
 }
 
@@ -399,7 +1134,10 @@ type InternalUser struct {
 	CreatedAt   time.Time     `json:"createdAt,omitempty" readOnly:"true" required:"false"`
 	Slug        *string       `json:"slug,omitempty"`
 	DisplayName *string       `json:"displayName,omitempty"`
-	BioText     *string       `json:"bioText,omitempty"`
+	BioText     *string       `json:"bioText,omitempty" maxLength:"1024" doc:"Shown on the user's profile. Supports a subset of markdown: emphasis, inline code, lists, block quotes, and links."`
+	Pronouns    *string       `json:"pronouns,omitempty" maxLength:"32"`
+	Country     *string       `json:"country,omitempty" maxLength:"2" doc:"ISO 3166-1 alpha-2 country code"`
+	Links       []ProfileLink `json:"links,omitempty" maxItems:"5" doc:"External links shown on the user's profile, in order"`
 	Avatar      *users.Avatar `json:"avatar,omitempty" readOnly:"true" required:"false"`
 }
 
@@ -460,11 +1198,17 @@ func HandlePostSessionProfile(ctx context.Context, input *PostSessionRequest) (*
 		return nil, huma.Error401Unauthorized("no session")
 	}
 
-	updateErr := db.Queries.UpdateSessionProfile(ctx, query.UpdateSessionProfileParams{
-		Uuid:           principal.User.Uuid,
-		NewSlug:        input.Body.User.Slug,
-		NewDisplayName: input.Body.User.DisplayName,
-		// TODO: BioText
+	updateErr := db.DB.Transact(ctx, func(ctx context.Context, qtx *query.Queries) error {
+		err := qtx.UpdateSessionProfile(ctx, query.UpdateSessionProfileParams{
+			Uuid:           principal.User.Uuid,
+			NewSlug:        input.Body.User.Slug,
+			NewDisplayName: input.Body.User.DisplayName,
+		})
+		if err != nil {
+			return err
+		}
+
+		return updateUserProfileFields(ctx, qtx, principal.User.ID, input.Body.User)
 	})
 
 	if db.IsUniqueConstraintErr(updateErr) {
@@ -534,6 +1278,7 @@ func HandlePostSessionAvatar(ctx context.Context, input *PostAvatarInput) (*Post
 	}, nil
 }
 
+const DeveloperRidPrefix = "d"
 const GameRidPrefix = "g"
 const GameTokenRidPrefix = "gt"
 
@@ -548,11 +1293,15 @@ type InternalGame struct {
 }
 
 type GameToken struct {
-	RID       rid.RID      `json:"rid" readOnly:"true" required:"false"`
-	CreatedAt time.Time    `json:"createdAt" readOnly:"true" required:"false"`
-	ExpiresAt time.Time    `json:"expiresAt"`
-	Comment   string       `json:"comment"`
-	Game      InternalGame `json:"game"`
+	RID          rid.RID      `json:"rid" readOnly:"true" required:"false"`
+	CreatedAt    time.Time    `json:"createdAt" readOnly:"true" required:"false"`
+	ExpiresAt    time.Time    `json:"expiresAt"`
+	Comment      string       `json:"comment"`
+	Token        string       `json:"token,omitempty" readOnly:"true" required:"false" doc:"The secret to authenticate the game with. Only returned when the token is created or rotated."`
+	LookupPrefix string       `json:"lookupPrefix,omitempty" readOnly:"true" required:"false" doc:"The part of the token after osgt_ that identifies it"`
+	Legacy       bool         `json:"legacy,omitempty" readOnly:"true" required:"false" doc:"Set if the token was created before tokens were secret, and is still authenticated with its RID. Rotate it to replace it with a secret."`
+	Scopes       []string     `json:"scopes" minItems:"1" uniqueItems:"true" enum:"read-profile,write-progress,read-friends,write-stats" doc:"What the game may do with the token. read-profile: see the user's profile and achievement progress. write-progress: add achievement progress. read-friends: find other users. write-stats: submit game stats."`
+	Game         InternalGame `json:"game"`
 }
 
 func (t *GameToken) MapFromRow(row query.FindUserGameTokensRow) {
@@ -564,6 +1313,8 @@ func (t *GameToken) MapFromRow(row query.FindUserGameTokensRow) {
 		CreatedAt: row.CreatedAt,
 		ExpiresAt: row.ExpiresAt,
 		Comment:   row.Comment,
+		Scopes:    row.Scopes,
+		Legacy:    row.LookupPrefix == nil,
 		Game: InternalGame{
 			RID: rid.RID{
 				Prefix: GameRidPrefix,
@@ -575,6 +1326,10 @@ func (t *GameToken) MapFromRow(row query.FindUserGameTokensRow) {
 			FriendlyName: row.GameSlug,
 		},
 	}
+
+	if row.LookupPrefix != nil {
+		t.LookupPrefix = *row.LookupPrefix
+	}
 }
 
 type GameTokenList struct {
@@ -625,9 +1380,10 @@ func HandlePostSessionGameToken(ctx context.Context, input *PostSessionGameToken
 		return nil, huma.Error400BadRequest("invalid game id")
 	}
 
-	createdToken, createErr := db.Queries.CreateGameToken(ctx, query.CreateGameTokenParams{
+	token, createdToken, createErr := auth.CreateGameToken(ctx, db.Queries, query.CreateGameTokenParams{
 		ExpiresAt: input.Body.ExpiresAt,
 		Comment:   input.Body.Comment,
+		Scopes:    input.Body.Scopes,
 		UserUuid:  principal.User.Uuid,
 		GameUuid:  input.Body.Game.RID.ID,
 	})
@@ -635,12 +1391,21 @@ func HandlePostSessionGameToken(ctx context.Context, input *PostSessionGameToken
 		return nil, createErr
 	}
 
+	tokenRid := rid.From(GameTokenRidPrefix, createdToken.Uuid)
+	auth.RecordSecurityEvent(ctx, principal.User.ID, auth.SecurityEventGameTokenCreated, map[string]string{
+		"gameToken": tokenRid.String(),
+		"game":      createdToken.DeveloperSlug + "/" + createdToken.GameSlug,
+	})
+
 	return &PostSessionGameTokenResponse{
 		Body: GameToken{
-			RID:       rid.From(GameTokenRidPrefix, createdToken.Uuid),
-			CreatedAt: createdToken.CreatedAt,
-			ExpiresAt: createdToken.ExpiresAt,
-			Comment:   createdToken.Comment,
+			RID:          rid.From(GameTokenRidPrefix, createdToken.Uuid),
+			CreatedAt:    createdToken.CreatedAt,
+			ExpiresAt:    createdToken.ExpiresAt,
+			Comment:      createdToken.Comment,
+			Token:        token,
+			LookupPrefix: createdToken.LookupPrefix,
+			Scopes:       createdToken.Scopes,
 			Game: InternalGame{
 				RID: rid.From(GameRidPrefix, createdToken.GameUuid),
 				Developer: Developer{
@@ -680,9 +1445,47 @@ func HandleDeleteSessionGameToken(ctx context.Context, input *DeleteSessionGameT
 		return nil, huma.Error404NotFound("game token not found")
 	}
 
+	auth.RecordSecurityEvent(ctx, principal.User.ID, auth.SecurityEventGameTokenDeleted, map[string]string{"gameToken": input.GameTokenRID.String()})
 	return &struct{}{}, nil
 }
 
+type RotateSessionGameTokenInput struct {
+	GameTokenRID rid.RID `path:"tokenRID" example:"gt_31F0otb4FIVRqQWdsISFl"`
+}
+
+type RotateSessionGameTokenOutput struct {
+	Body struct {
+		Token string `json:"token" readOnly:"true" doc:"The token's new secret. The old secret, or the token's RID if it was a legacy token, no longer authenticates, and game sessions started with it have ended."`
+	}
+}
+
+func HandleRotateSessionGameToken(ctx context.Context, input *RotateSessionGameTokenInput) (*RotateSessionGameTokenOutput, error) {
+	principal, hasPrincipal := auth.GetPrincipal(ctx)
+	if !hasPrincipal {
+		// shouldn't ever get here due to middleware check
+		return nil, huma.Error401Unauthorized("no session")
+	}
+
+	// TODO: is there a way to add a custom validation in huma for RID prefix?
+	if input.GameTokenRID.Prefix != GameTokenRidPrefix {
+		return nil, huma.Error400BadRequest("invalid game token id")
+	}
+
+	token, err := auth.RotateGameToken(ctx, db.Queries, principal.User.Uuid, input.GameTokenRID.ID)
+	if errors.Is(err, auth.ErrGameTokenExpired) {
+		return nil, huma.Error404NotFound("game token not found")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	auth.RecordSecurityEvent(ctx, principal.User.ID, auth.SecurityEventGameTokenRotated, map[string]string{"gameToken": input.GameTokenRID.String()})
+	output := &RotateSessionGameTokenOutput{}
+	output.Body.Token = token
+	return output, nil
+}
+
 type SearchUsersRequest struct {
 	SlugLike string                       `query:"slugLike" required:"true"`
 	After    validation.Optional[rid.RID] `query:"after,omitempty"`
@@ -704,7 +1507,13 @@ func HandleSearchUsers(ctx context.Context, input *SearchUsersRequest) (*SearchU
 	}
 
 	principal, hasPrincipal := auth.GetPrincipal(ctx)
-	isAdmin := hasPrincipal && auth.IsAdmin(principal.User)
+	isAdmin := false
+	if hasPrincipal {
+		var roleErr error
+		if isAdmin, roleErr = auth.IsAdmin(ctx, principal.User.ID); roleErr != nil {
+			return nil, roleErr
+		}
+	}
 
 	var principalUuid uuid.UUID
 	if hasPrincipal {
@@ -716,7 +1525,7 @@ func HandleSearchUsers(ctx context.Context, input *SearchUsersRequest) (*SearchU
 		From("users u").
 		JoinClause("left outer join user_latest_display_name uldn on u.id = uldn.user_id").
 		JoinClause("left outer join user_latest_email ule on u.id = ule.user_id and (? or (? and u.uuid = ?))", isAdmin, hasPrincipal, principalUuid).
-		JoinClause("left outer join user_avatar ua on u.id = ua.user_id").
+		JoinClause("left outer join user_current_avatar ua on u.id = ua.user_id").
 		Where("u.slug like ?", "%"+input.SlugLike+"%").
 		OrderBy("u.uuid desc")
 
@@ -749,7 +1558,6 @@ func HandleSearchUsers(ctx context.Context, input *SearchUsersRequest) (*SearchU
 			&item.DisplayName,
 			&avatarUuid,
 			&avatarBlurhash,
-			// TODO: BioText
 		); scanErr != nil {
 			return nil, eris.Wrap(scanErr, "")
 		}
@@ -764,6 +1572,15 @@ func HandleSearchUsers(ctx context.Context, input *SearchUsersRequest) (*SearchU
 		items = append(items, item)
 	}
 
+	itemRefs := make([]*InternalUser, len(items))
+	for idx := range items {
+		itemRefs[idx] = &items[idx]
+	}
+
+	if err := loadUserProfileFields(ctx, itemRefs...); err != nil {
+		return nil, err
+	}
+
 	return &SearchUsersResponse{
 		Body: InternalUserList{
 			Users: items,
@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dresswithpockets/openstats/app/auth"
+	"github.com/dresswithpockets/openstats/app/db"
+	"github.com/dresswithpockets/openstats/app/db/query"
+	"github.com/dresswithpockets/openstats/app/rid"
+	"github.com/dresswithpockets/openstats/app/validation"
+	"github.com/google/uuid"
+	"github.com/rotisserie/eris"
+)
+
+const SecurityEventRidPrefix = "se"
+
+type SecurityEvent struct {
+	RID       rid.RID                `json:"rid" readOnly:"true"`
+	CreatedAt time.Time              `json:"createdAt" readOnly:"true"`
+	Kind      auth.SecurityEventKind `json:"kind" readOnly:"true" enum:"sign-in,sign-in-failed,account-locked,password-changed,password-reset,password-removed,email-added,email-confirmed,email-removed,game-token-created,game-token-deleted,game-token-rotated,role-granted,role-revoked,user-suspended,user-banned,suspension-lifted,slug-changed,avatar-removed,identity-linked"`
+	IPAddress string                 `json:"ipAddress,omitempty" readOnly:"true" doc:"The IP address of the client that caused the event"`
+	UserAgent string                 `json:"userAgent,omitempty" readOnly:"true" doc:"The user agent of the client that caused the event"`
+	Details   map[string]string      `json:"details" readOnly:"true" doc:"Depends on the kind, e.g. the method used to sign in, or the email that was added"`
+	ByAdmin   bool                   `json:"byAdmin" readOnly:"true" doc:"Whether an admin made this change to the user's account"`
+}
+
+func (e *SecurityEvent) MapFromRow(row query.GetUserSecurityEventsRow) error {
+	*e = SecurityEvent{
+		RID:       rid.From(SecurityEventRidPrefix, row.Uuid),
+		CreatedAt: row.CreatedAt,
+		Kind:      auth.SecurityEventKind(row.Kind),
+		ByAdmin:   row.ByAdmin,
+	}
+
+	if row.IpAddress != nil {
+		e.IPAddress = *row.IpAddress
+	}
+
+	if row.UserAgent != nil {
+		e.UserAgent = *row.UserAgent
+	}
+
+	return eris.Wrap(json.Unmarshal(row.Details, &e.Details), "error decoding security event details")
+}
+
+type SecurityEventList struct {
+	Events []SecurityEvent `json:"events"`
+}
+
+type GetSecurityLogInput struct {
+	After validation.Optional[rid.RID] `query:"after,omitempty" doc:"Only return events older than this event"`
+	Limit validation.Optional[int]     `query:"limit" minimum:"1" maximum:"50" doc:"default = 20"`
+}
+
+type GetSecurityLogOutput struct {
+	Body SecurityEventList
+}
+
+func HandleGetSecurityLog(ctx context.Context, input *GetSecurityLogInput) (*GetSecurityLogOutput, error) {
+	principal, hasPrincipal := auth.GetPrincipal(ctx)
+	if !hasPrincipal {
+		// shouldn't ever get here due to middleware check
+		return nil, huma.Error401Unauthorized("no session")
+	}
+
+	// TODO: a huma validator for rid prefix...
+	var after uuid.NullUUID
+	if input.After.HasValue {
+		if input.After.Value.Prefix != SecurityEventRidPrefix {
+			return nil, huma.Error400BadRequest("invalid security event id")
+		}
+
+		after = uuid.NullUUID{UUID: input.After.Value.ID, Valid: true}
+	}
+
+	rows, err := db.Queries.GetUserSecurityEvents(ctx, query.GetUserSecurityEventsParams{
+		Limit:  int32(input.Limit.ValueOr(20)),
+		UserID: principal.User.ID,
+		After:  after,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]SecurityEvent, len(rows))
+	for idx := range rows {
+		if err = events[idx].MapFromRow(rows[idx]); err != nil {
+			return nil, err
+		}
+	}
+
+	return &GetSecurityLogOutput{Body: SecurityEventList{Events: events}}, nil
+}
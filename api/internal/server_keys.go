@@ -0,0 +1,132 @@
+package internal
+
+import (
+	"context"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dresswithpockets/openstats/app/auth"
+	"github.com/dresswithpockets/openstats/app/db"
+	"github.com/dresswithpockets/openstats/app/db/query"
+	"github.com/dresswithpockets/openstats/app/rid"
+	"github.com/rotisserie/eris"
+)
+
+type GameServerKey struct {
+	RID        rid.RID    `json:"rid" readOnly:"true" required:"false"`
+	CreatedAt  time.Time  `json:"createdAt" readOnly:"true" required:"false"`
+	Comment    string     `json:"comment" maxLength:"256" doc:"What the key is used for, e.g. which servers it's deployed to"`
+	Prefix     string     `json:"prefix" readOnly:"true" required:"false" doc:"The start of the key, so keys can be told apart"`
+	CreatedBy  string     `json:"createdBy,omitempty" readOnly:"true" required:"false" doc:"The slug of the developer member who created the key"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty" readOnly:"true" required:"false"`
+	Key        string     `json:"key,omitempty" readOnly:"true" required:"false" doc:"The secret key. Only returned when the key is created."`
+}
+
+func (k *GameServerKey) MapFromRow(row query.GetGameServerKeysRow) {
+	*k = GameServerKey{
+		RID:       rid.From(auth.GameServerKeyRidPrefix, row.Uuid),
+		CreatedAt: row.CreatedAt,
+		Comment:   row.Comment,
+		Prefix:    auth.GameServerKeyPrefix + "_" + row.LookupPrefix,
+	}
+
+	if row.CreatedBySlug != nil {
+		k.CreatedBy = *row.CreatedBySlug
+	}
+
+	if row.LastUsedAt.Valid {
+		k.LastUsedAt = &row.LastUsedAt.Time
+	}
+}
+
+type GameServerKeyList struct {
+	Keys []GameServerKey `json:"keys"`
+}
+
+type GameServerKeysInput struct {
+	GameRID rid.RID `path:"game"`
+}
+
+type GetGameServerKeysOutput struct {
+	Body GameServerKeyList
+}
+
+func HandleGetGameServerKeys(ctx context.Context, input *GameServerKeysInput) (*GetGameServerKeysOutput, error) {
+	if err := ensureGameDeveloper(ctx, input.GameRID); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Queries.GetGameServerKeys(ctx, input.GameRID.ID)
+	if err != nil {
+		return nil, eris.Wrap(err, "error getting game server keys")
+	}
+
+	items := make([]GameServerKey, len(rows))
+	for idx := range rows {
+		items[idx].MapFromRow(rows[idx])
+	}
+
+	return &GetGameServerKeysOutput{Body: GameServerKeyList{Keys: items}}, nil
+}
+
+type PostGameServerKeyInput struct {
+	GameRID rid.RID `path:"game"`
+	Body    GameServerKey
+}
+
+type PostGameServerKeyOutput struct {
+	Body GameServerKey
+}
+
+func HandlePostGameServerKey(ctx context.Context, input *PostGameServerKeyInput) (*PostGameServerKeyOutput, error) {
+	if err := ensureGameDeveloper(ctx, input.GameRID); err != nil {
+		return nil, err
+	}
+
+	principal, _ := auth.GetPrincipal(ctx)
+	key, row, err := auth.CreateGameServerKey(ctx, input.GameRID.ID, principal.User.ID, input.Body.Comment)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PostGameServerKeyOutput{
+		Body: GameServerKey{
+			RID:       rid.From(auth.GameServerKeyRidPrefix, row.Uuid),
+			CreatedAt: row.CreatedAt,
+			Comment:   row.Comment,
+			Prefix:    auth.GameServerKeyPrefix + "_" + row.LookupPrefix,
+			CreatedBy: principal.User.Slug,
+			Key:       key,
+		},
+	}, nil
+}
+
+type GameServerKeyInput struct {
+	GameRID rid.RID `path:"game"`
+	KeyRID  rid.RID `path:"key"`
+}
+
+func HandleDeleteGameServerKey(ctx context.Context, input *GameServerKeyInput) (*struct{}, error) {
+	if err := ensureGameDeveloper(ctx, input.GameRID); err != nil {
+		return nil, err
+	}
+
+	// TODO: a huma validator for rid prefix...
+	if input.KeyRID.Prefix != auth.GameServerKeyRidPrefix {
+		return nil, huma.Error400BadRequest("invalid server key id")
+	}
+
+	rows, err := db.Queries.DeleteGameServerKey(ctx, query.DeleteGameServerKeyParams{
+		GameUuid: input.GameRID.ID,
+		KeyUuid:  input.KeyRID.ID,
+	})
+	if err != nil {
+		return nil, eris.Wrap(err, "error deleting game server key")
+	}
+
+	if rows == 0 {
+		return nil, huma.Error404NotFound("server key not found")
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,241 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dresswithpockets/openstats/app/auth"
+	"github.com/dresswithpockets/openstats/app/db"
+	"github.com/dresswithpockets/openstats/app/db/query"
+	"github.com/dresswithpockets/openstats/app/env"
+	"github.com/dresswithpockets/openstats/app/rid"
+)
+
+const (
+	WebSessionRidPrefix = "ws"
+
+	// game sessions are active until their token expires, unless they're kept alive by heartbeats
+	gameSessionActiveDuration = time.Hour
+)
+
+type WebSession struct {
+	RID        rid.RID    `json:"rid" readOnly:"true"`
+	CreatedAt  time.Time  `json:"createdAt" readOnly:"true"`
+	ExpiresAt  time.Time  `json:"expiresAt" readOnly:"true"`
+	LastSeenAt *time.Time `json:"lastSeenAt,omitempty" readOnly:"true"`
+	IPAddress  string     `json:"ipAddress,omitempty" readOnly:"true" doc:"The IP address the session was signed in from"`
+	UserAgent  string     `json:"userAgent,omitempty" readOnly:"true" doc:"The user agent the session was signed in with"`
+	Current    bool       `json:"current" readOnly:"true" doc:"Whether this is the session making the request"`
+}
+
+func (s *WebSession) MapFromRow(row query.Token, currentTokenId rid.RID) {
+	*s = WebSession{
+		RID:       rid.From(WebSessionRidPrefix, row.ID),
+		CreatedAt: row.IssuedAt,
+		ExpiresAt: row.ExpiresAt,
+		Current:   row.ID == currentTokenId.ID,
+	}
+
+	if row.LastSeenAt.Valid {
+		s.LastSeenAt = &row.LastSeenAt.Time
+	}
+
+	if row.IpAddress != nil {
+		s.IPAddress = *row.IpAddress
+	}
+
+	if row.UserAgent != nil {
+		s.UserAgent = *row.UserAgent
+	}
+}
+
+type ActiveGameSession struct {
+	RID         rid.RID      `json:"rid" readOnly:"true"`
+	CreatedAt   time.Time    `json:"createdAt" readOnly:"true"`
+	LastPulseAt time.Time    `json:"lastPulseAt" readOnly:"true"`
+	Game        InternalGame `json:"game" readOnly:"true"`
+	GameToken   struct {
+		RID     rid.RID `json:"rid" readOnly:"true"`
+		Comment string  `json:"comment" readOnly:"true"`
+	} `json:"gameToken" readOnly:"true" doc:"The game token the session was started with"`
+}
+
+func (s *ActiveGameSession) MapFromRow(row query.GetUserActiveGameSessionsRow) {
+	*s = ActiveGameSession{
+		RID:         rid.From(auth.GameSessionRidPrefix, row.Uuid),
+		CreatedAt:   row.CreatedAt,
+		LastPulseAt: row.LastPulseAt,
+		Game: InternalGame{
+			RID:          rid.From(GameRidPrefix, row.GameUuid),
+			Developer:    Developer{FriendlyName: row.DeveloperSlug},
+			FriendlyName: row.GameSlug,
+		},
+	}
+
+	s.GameToken.RID = rid.From(GameTokenRidPrefix, row.GameTokenUuid)
+	s.GameToken.Comment = row.GameTokenComment
+}
+
+// getUserSessionTokens gets the user's web sessions which haven't expired or been signed out
+func getUserSessionTokens(ctx context.Context, q *query.Queries, user query.User) ([]query.Token, error) {
+	return q.GetUserSessionTokens(ctx, query.GetUserSessionTokensParams{
+		Subject:  user.Uuid.String(),
+		Audience: auth.SessionAudience,
+	})
+}
+
+type GetSessionsOutput struct {
+	Body struct {
+		WebSessions  []WebSession        `json:"webSessions"`
+		GameSessions []ActiveGameSession `json:"gameSessions"`
+	}
+}
+
+func HandleGetSessions(ctx context.Context, _ *struct{}) (*GetSessionsOutput, error) {
+	principal, hasPrincipal := auth.GetPrincipal(ctx)
+	if !hasPrincipal {
+		// shouldn't ever get here due to middleware check
+		return nil, huma.Error401Unauthorized("no session")
+	}
+
+	tokens, err := getUserSessionTokens(ctx, db.Queries, principal.User)
+	if err != nil {
+		return nil, err
+	}
+
+	gameSessions, err := db.Queries.GetUserActiveGameSessions(ctx, query.GetUserActiveGameSessionsParams{
+		UserID:      principal.User.ID,
+		ActiveAfter: time.Now().UTC().Add(-gameSessionActiveDuration),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	currentTokenId := rid.From(WebSessionRidPrefix, principal.TokenID)
+	output := &GetSessionsOutput{}
+	output.Body.WebSessions = make([]WebSession, len(tokens))
+	for idx := range tokens {
+		output.Body.WebSessions[idx].MapFromRow(tokens[idx], currentTokenId)
+	}
+
+	output.Body.GameSessions = make([]ActiveGameSession, len(gameSessions))
+	for idx := range gameSessions {
+		output.Body.GameSessions[idx].MapFromRow(gameSessions[idx])
+	}
+
+	return output, nil
+}
+
+type DeleteWebSessionInput struct {
+	SessionRID rid.RID `path:"sessionRID"`
+}
+
+func HandleDeleteWebSession(ctx context.Context, input *DeleteWebSessionInput) (*struct{}, error) {
+	principal, hasPrincipal := auth.GetPrincipal(ctx)
+	if !hasPrincipal {
+		// shouldn't ever get here due to middleware check
+		return nil, huma.Error401Unauthorized("no session")
+	}
+
+	// TODO: huma validator for rid prefix...
+	if input.SessionRID.Prefix != WebSessionRidPrefix {
+		return nil, huma.Error400BadRequest("invalid session id")
+	}
+
+	err := db.DB.Transact(ctx, func(ctx context.Context, qtx *query.Queries) error {
+		tokens, err := getUserSessionTokens(ctx, qtx, principal.User)
+		if err != nil {
+			return err
+		}
+
+		for _, token := range tokens {
+			if token.ID == input.SessionRID.ID {
+				return qtx.DisallowToken(ctx, token.ID)
+			}
+		}
+
+		return huma.Error404NotFound("session not found")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &struct{}{}, nil
+}
+
+type DeleteGameSessionInput struct {
+	SessionRID rid.RID `path:"sessionRID"`
+}
+
+func HandleDeleteGameSession(ctx context.Context, input *DeleteGameSessionInput) (*struct{}, error) {
+	principal, hasPrincipal := auth.GetPrincipal(ctx)
+	if !hasPrincipal {
+		// shouldn't ever get here due to middleware check
+		return nil, huma.Error401Unauthorized("no session")
+	}
+
+	// TODO: huma validator for rid prefix...
+	if input.SessionRID.Prefix != auth.GameSessionRidPrefix {
+		return nil, huma.Error400BadRequest("invalid game session id")
+	}
+
+	// ended game sessions no longer authenticate their game session tokens
+	rows, err := db.Queries.EndUserGameSession(ctx, query.EndUserGameSessionParams{
+		UserID:      principal.User.ID,
+		SessionUuid: input.SessionRID.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if rows == 0 {
+		return nil, huma.Error404NotFound("game session not found")
+	}
+
+	return &struct{}{}, nil
+}
+
+type SignOutEverywhereOutput struct {
+	SetCookie http.Cookie `header:"Set-Cookie"`
+}
+
+func HandlePostSignOutEverywhere(ctx context.Context, _ *struct{}) (*SignOutEverywhereOutput, error) {
+	principal, hasPrincipal := auth.GetPrincipal(ctx)
+	if !hasPrincipal {
+		// shouldn't ever get here due to middleware check
+		return nil, huma.Error401Unauthorized("no session")
+	}
+
+	err := db.DB.Transact(ctx, func(ctx context.Context, qtx *query.Queries) error {
+		tokens, err := getUserSessionTokens(ctx, qtx, principal.User)
+		if err != nil {
+			return err
+		}
+
+		for _, token := range tokens {
+			if err = qtx.DisallowToken(ctx, token.ID); err != nil {
+				return err
+			}
+		}
+
+		_, err = qtx.EndUserGameSessions(ctx, principal.User.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &SignOutEverywhereOutput{
+		SetCookie: http.Cookie{
+			Name:     auth.SessionCookieName,
+			Path:     "/",
+			Value:    "",
+			MaxAge:   0,
+			Expires:  time.Now(),
+			Secure:   env.GetBool("OPENSTATS_SESSION_COOKIE_SECURE"),
+			SameSite: http.SameSiteStrictMode,
+		},
+	}, nil
+}
@@ -0,0 +1,292 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dresswithpockets/openstats/app/auth"
+	"github.com/dresswithpockets/openstats/app/db"
+	"github.com/dresswithpockets/openstats/app/db/query"
+	"github.com/dresswithpockets/openstats/app/rid"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rotisserie/eris"
+)
+
+type ProfileSection string
+
+const (
+	SectionFeaturedGame          ProfileSection = "featured-game"
+	SectionShowcaseAchievements  ProfileSection = "showcase-achievements"
+	SectionShowcaseGames         ProfileSection = "showcase-games"
+	SectionUnlockedAchievements  ProfileSection = "unlocked-achievements"
+	SectionRarestAchievements    ProfileSection = "rarest-achievements"
+	SectionCompletedGames        ProfileSection = "completed-games"
+	SectionOtherUserAchievements ProfileSection = "other-user-achievements"
+)
+
+const (
+	// MaxShowcaseAchievements is the number of achievement slots in a showcase. It must be kept in sync with the slot
+	// check constraint on user_showcase_achievement.
+	MaxShowcaseAchievements = 8
+
+	// MaxShowcaseGames is the number of game slots in a showcase. It must be kept in sync with the slot check constraint
+	// on user_showcase_game.
+	MaxShowcaseGames = 4
+)
+
+type ProfileShowcaseAchievement struct {
+	ProfileRareAchievement
+	Slot int16 `json:"slot" readOnly:"true"`
+}
+
+type ProfileShowcaseGame struct {
+	Game             ProfileGame `json:"game" readOnly:"true"`
+	Slot             int16       `json:"slot" readOnly:"true"`
+	UnlockCount      int64       `json:"unlockCount" readOnly:"true" doc:"The number of this game's achievements unlocked by the user"`
+	AchievementCount int64       `json:"achievementCount" readOnly:"true" doc:"The number of achievements in this game"`
+}
+
+type ProfileShowcase struct {
+	FeaturedGame   *ProfileGame                 `json:"featuredGame,omitempty" readOnly:"true"`
+	Achievements   []ProfileShowcaseAchievement `json:"achievements,omitempty" readOnly:"true" doc:"The user's pinned achievements, ordered by slot"`
+	Games          []ProfileShowcaseGame        `json:"games,omitempty" readOnly:"true" doc:"The user's pinned games, ordered by slot"`
+	HiddenSections []ProfileSection             `json:"hiddenSections" readOnly:"true" doc:"The sections of the profile which the user has chosen not to show"`
+}
+
+func (s *ProfileShowcase) Shows(section ProfileSection) bool {
+	return !slices.Contains(s.HiddenSections, section)
+}
+
+func getProfileShowcase(ctx context.Context, userUuid uuid.UUID) (ProfileShowcase, error) {
+	showcase := ProfileShowcase{HiddenSections: []ProfileSection{}}
+
+	settings, err := db.Queries.GetUserShowcase(ctx, userUuid)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return ProfileShowcase{}, eris.Wrap(err, "couldn't get user's showcase")
+	}
+
+	for _, section := range settings.HiddenSections {
+		showcase.HiddenSections = append(showcase.HiddenSections, ProfileSection(section))
+	}
+
+	if settings.FeaturedGameUuid.Valid && showcase.Shows(SectionFeaturedGame) {
+		showcase.FeaturedGame = &ProfileGame{
+			RID:       rid.From(GameRidPrefix, settings.FeaturedGameUuid.UUID),
+			Name:      "", // TODO: game display names
+			AvatarUrl: "", // TODO: game display avatars
+		}
+	}
+
+	if showcase.Shows(SectionShowcaseAchievements) {
+		achievements, err := db.Queries.GetUserShowcaseAchievements(ctx, userUuid)
+		if err != nil {
+			return ProfileShowcase{}, eris.Wrap(err, "couldn't get user's showcase achievements")
+		}
+
+		showcase.Achievements = make([]ProfileShowcaseAchievement, len(achievements))
+		for idx, achievement := range achievements {
+			showcase.Achievements[idx] = ProfileShowcaseAchievement{
+				ProfileRareAchievement: ProfileRareAchievement{
+					Game: ProfileGame{
+						RID:       rid.From(GameRidPrefix, achievement.GameUuid),
+						Name:      "", // TODO: game display names
+						AvatarUrl: "", // TODO: game display avatars
+					},
+					Slug:        achievement.Slug,
+					Name:        achievement.Name,
+					Description: achievement.Description,
+					Rarity:      achievement.Rarity,
+				},
+				Slot: achievement.Slot,
+			}
+		}
+	}
+
+	if showcase.Shows(SectionShowcaseGames) {
+		games, err := db.Queries.GetUserShowcaseGames(ctx, userUuid)
+		if err != nil {
+			return ProfileShowcase{}, eris.Wrap(err, "couldn't get user's showcase games")
+		}
+
+		showcase.Games = make([]ProfileShowcaseGame, len(games))
+		for idx, game := range games {
+			showcase.Games[idx] = ProfileShowcaseGame{
+				Game: ProfileGame{
+					RID:       rid.From(GameRidPrefix, game.GameUuid),
+					Name:      "", // TODO: game display names
+					AvatarUrl: "", // TODO: game display avatars
+				},
+				Slot:             game.Slot,
+				UnlockCount:      game.UnlockCount,
+				AchievementCount: game.AchievementCount,
+			}
+		}
+	}
+
+	return showcase, nil
+}
+
+type GetSessionShowcaseResponse struct {
+	Body ProfileShowcase
+}
+
+func HandleGetSessionShowcase(ctx context.Context, _ *struct{}) (*GetSessionShowcaseResponse, error) {
+	principal, hasPrincipal := auth.GetPrincipal(ctx)
+	if !hasPrincipal {
+		// shouldn't ever get here due to middleware check
+		return nil, huma.Error401Unauthorized("no session")
+	}
+
+	showcase, err := getProfileShowcase(ctx, principal.User.Uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GetSessionShowcaseResponse{Body: showcase}, nil
+}
+
+type ShowcaseAchievementRef struct {
+	Game rid.RID `json:"game" doc:"The game the achievement belongs to"`
+	Slug string  `json:"slug"`
+}
+
+type ShowcaseSettings struct {
+	FeaturedGame   *rid.RID                 `json:"featuredGame,omitempty" required:"false" doc:"A game the user has played, shown prominently on their profile"`
+	Achievements   []ShowcaseAchievementRef `json:"achievements" maxItems:"8" doc:"Achievements the user has unlocked, in slot order"`
+	Games          []rid.RID                `json:"games" maxItems:"4" uniqueItems:"true" doc:"Games the user has played, in slot order"`
+	HiddenSections []ProfileSection         `json:"hiddenSections" uniqueItems:"true" enum:"featured-game,showcase-achievements,showcase-games,unlocked-achievements,rarest-achievements,completed-games,other-user-achievements"`
+}
+
+type PutSessionShowcaseRequest struct {
+	Body ShowcaseSettings
+}
+
+func HandlePutSessionShowcase(ctx context.Context, input *PutSessionShowcaseRequest) (*GetSessionShowcaseResponse, error) {
+	principal, hasPrincipal := auth.GetPrincipal(ctx)
+	if !hasPrincipal {
+		// shouldn't ever get here due to middleware check
+		return nil, huma.Error401Unauthorized("no session")
+	}
+
+	if len(input.Body.Achievements) > MaxShowcaseAchievements || len(input.Body.Games) > MaxShowcaseGames {
+		return nil, huma.Error400BadRequest("too many showcase slots")
+	}
+
+	err := db.DB.Transact(ctx, func(ctx context.Context, qtx *query.Queries) error {
+		var featuredGameId pgtype.Int4
+		if input.Body.FeaturedGame != nil {
+			gameId, err := findPlayedGame(ctx, qtx, principal.User.ID, *input.Body.FeaturedGame, "body.featuredGame")
+			if err != nil {
+				return err
+			}
+
+			featuredGameId = pgtype.Int4{Int32: gameId, Valid: true}
+		}
+
+		hiddenSections := make([]string, len(input.Body.HiddenSections))
+		for idx, section := range input.Body.HiddenSections {
+			hiddenSections[idx] = string(section)
+		}
+
+		err := qtx.UpsertUserShowcase(ctx, query.UpsertUserShowcaseParams{
+			UserID:         principal.User.ID,
+			FeaturedGameID: featuredGameId,
+			HiddenSections: hiddenSections,
+		})
+		if err != nil {
+			return eris.Wrap(err, "couldn't update user's showcase")
+		}
+
+		if err = qtx.ClearUserShowcaseAchievements(ctx, principal.User.ID); err != nil {
+			return eris.Wrap(err, "couldn't clear user's showcase achievements")
+		}
+
+		for slot, ref := range input.Body.Achievements {
+			location := fmt.Sprintf("body.achievements[%d]", slot)
+			if ref.Game.Prefix != GameRidPrefix {
+				return huma.Error422UnprocessableEntity("invalid game id", &huma.ErrorDetail{Location: location + ".game", Value: ref.Game})
+			}
+
+			achievementId, err := qtx.FindUserUnlockedAchievement(ctx, query.FindUserUnlockedAchievementParams{
+				GameUuid: ref.Game.ID,
+				Slug:     ref.Slug,
+				UserID:   principal.User.ID,
+			})
+			if errors.Is(err, sql.ErrNoRows) {
+				return huma.Error422UnprocessableEntity("only unlocked achievements can be showcased", &huma.ErrorDetail{Location: location, Value: ref})
+			}
+
+			if err != nil {
+				return eris.Wrap(err, "couldn't find achievement")
+			}
+
+			err = qtx.AddUserShowcaseAchievement(ctx, query.AddUserShowcaseAchievementParams{
+				UserID:        principal.User.ID,
+				Slot:          int16(slot),
+				AchievementID: achievementId,
+			})
+			if db.IsUniqueConstraintErr(err) {
+				return huma.Error422UnprocessableEntity("an achievement can only be showcased once", &huma.ErrorDetail{Location: location, Value: ref})
+			}
+
+			if err != nil {
+				return eris.Wrap(err, "couldn't add showcase achievement")
+			}
+		}
+
+		if err = qtx.ClearUserShowcaseGames(ctx, principal.User.ID); err != nil {
+			return eris.Wrap(err, "couldn't clear user's showcase games")
+		}
+
+		for slot, gameRid := range input.Body.Games {
+			gameId, err := findPlayedGame(ctx, qtx, principal.User.ID, gameRid, fmt.Sprintf("body.games[%d]", slot))
+			if err != nil {
+				return err
+			}
+
+			err = qtx.AddUserShowcaseGame(ctx, query.AddUserShowcaseGameParams{
+				UserID: principal.User.ID,
+				Slot:   int16(slot),
+				GameID: gameId,
+			})
+			if err != nil {
+				return eris.Wrap(err, "couldn't add showcase game")
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	showcase, err := getProfileShowcase(ctx, principal.User.Uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GetSessionShowcaseResponse{Body: showcase}, nil
+}
+
+// findPlayedGame returns the id of the game if the user has played it, or a validation error for the location otherwise
+func findPlayedGame(ctx context.Context, qtx *query.Queries, userId int32, gameRid rid.RID, location string) (int32, error) {
+	// TODO: huma validator for rid prefix...
+	if gameRid.Prefix != GameRidPrefix {
+		return 0, huma.Error422UnprocessableEntity("invalid game id", &huma.ErrorDetail{Location: location, Value: gameRid})
+	}
+
+	gameId, err := qtx.FindUserPlayedGame(ctx, query.FindUserPlayedGameParams{
+		GameUuid: gameRid.ID,
+		UserID:   userId,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, huma.Error422UnprocessableEntity("only played games can be showcased", &huma.ErrorDetail{Location: location, Value: gameRid})
+	}
+
+	return gameId, eris.Wrap(err, "couldn't find game")
+}
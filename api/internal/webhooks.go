@@ -0,0 +1,336 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dresswithpockets/openstats/app/auth"
+	"github.com/dresswithpockets/openstats/app/db"
+	"github.com/dresswithpockets/openstats/app/db/query"
+	"github.com/dresswithpockets/openstats/app/events"
+	"github.com/dresswithpockets/openstats/app/rid"
+	"github.com/dresswithpockets/openstats/app/safehttp"
+	"github.com/dresswithpockets/openstats/app/validation"
+	"github.com/dresswithpockets/openstats/app/webhooks"
+	"github.com/google/uuid"
+)
+
+type Webhook struct {
+	RID       rid.RID       `json:"rid" readOnly:"true" required:"false"`
+	CreatedAt time.Time     `json:"createdAt" readOnly:"true" required:"false"`
+	Url       string        `json:"url" format:"uri" maxLength:"2048" doc:"The http or https URL that deliveries are POSTed to"`
+	Events    []events.Kind `json:"events" minItems:"1" uniqueItems:"true" enum:"achievement-unlocked,game-completed,session-started,session-ended" doc:"The kinds of events delivered to this webhook"`
+	Enabled   bool          `json:"enabled" readOnly:"true" required:"false"`
+	Secret    string        `json:"secret,omitempty" readOnly:"true" required:"false" doc:"The secret used to sign deliveries. Only returned when the webhook is created."`
+}
+
+func (w *Webhook) MapFromRow(row query.Webhook) {
+	kinds := make([]events.Kind, len(row.Events))
+	for idx, kind := range row.Events {
+		kinds[idx] = events.Kind(kind)
+	}
+
+	*w = Webhook{
+		RID:       rid.From(webhooks.WebhookRidPrefix, row.Uuid),
+		CreatedAt: row.CreatedAt,
+		Url:       row.Url,
+		Events:    kinds,
+		Enabled:   row.Enabled,
+	}
+}
+
+type WebhookDelivery struct {
+	RID            rid.RID     `json:"rid" readOnly:"true"`
+	CreatedAt      time.Time   `json:"createdAt" readOnly:"true"`
+	Status         string      `json:"status" readOnly:"true" enum:"pending,succeeded,failed"`
+	AttemptCount   int32       `json:"attemptCount" readOnly:"true"`
+	NextAttemptAt  *time.Time  `json:"nextAttemptAt,omitempty" readOnly:"true" doc:"Only set while the delivery is pending"`
+	LastAttemptAt  *time.Time  `json:"lastAttemptAt,omitempty" readOnly:"true"`
+	LastStatusCode *int32      `json:"lastStatusCode,omitempty" readOnly:"true" doc:"The HTTP status code of the response to the last attempt, if there was a response"`
+	LastError      *string     `json:"lastError,omitempty" readOnly:"true"`
+	DeliveredAt    *time.Time  `json:"deliveredAt,omitempty" readOnly:"true"`
+	Kind           events.Kind `json:"kind" readOnly:"true"`
+	Data           any         `json:"data" readOnly:"true" doc:"The event data POSTed to the webhook"`
+}
+
+func (d *WebhookDelivery) MapFromRow(row query.WebhookDelivery) error {
+	var event events.Event
+	if err := json.Unmarshal(row.Event, &event); err != nil {
+		return err
+	}
+
+	message, err := event.Message()
+	if err != nil {
+		return err
+	}
+
+	*d = WebhookDelivery{
+		RID:          rid.From(webhooks.DeliveryRidPrefix, row.Uuid),
+		CreatedAt:    row.CreatedAt,
+		Status:       row.Status,
+		AttemptCount: row.AttemptCount,
+		LastError:    row.LastError,
+		Kind:         event.Kind,
+		Data:         message,
+	}
+
+	if row.Status == "pending" {
+		d.NextAttemptAt = &row.NextAttemptAt
+	}
+
+	if row.LastAttemptAt.Valid {
+		d.LastAttemptAt = &row.LastAttemptAt.Time
+	}
+
+	if row.LastStatusCode.Valid {
+		d.LastStatusCode = &row.LastStatusCode.Int32
+	}
+
+	if row.DeliveredAt.Valid {
+		d.DeliveredAt = &row.DeliveredAt.Time
+	}
+
+	return nil
+}
+
+// ensureGameDeveloper returns an error if the current session's user isn't a member of the game's developer
+func ensureGameDeveloper(ctx context.Context, gameRid rid.RID) error {
+	principal, hasPrincipal := auth.GetPrincipal(ctx)
+	if !hasPrincipal {
+		// shouldn't ever get here due to middleware check
+		return huma.Error401Unauthorized("no session")
+	}
+
+	// TODO: huma validator for rid prefix...
+	if gameRid.Prefix != GameRidPrefix {
+		return huma.Error400BadRequest("invalid game id")
+	}
+
+	isMember, err := db.Queries.IsGameDeveloperMember(ctx, query.IsGameDeveloperMemberParams{
+		UserID:   principal.User.ID,
+		GameUuid: gameRid.ID,
+	})
+	if err != nil {
+		return err
+	}
+
+	if !isMember {
+		return huma.Error403Forbidden("only members of the game's developer may manage the game")
+	}
+
+	return nil
+}
+
+// findGameWebhook returns the webhook if it belongs to the game, and the current session's user is a member of the
+// game's developer
+func findGameWebhook(ctx context.Context, gameRid, webhookRid rid.RID) (query.Webhook, error) {
+	if err := ensureGameDeveloper(ctx, gameRid); err != nil {
+		return query.Webhook{}, err
+	}
+
+	if webhookRid.Prefix != webhooks.WebhookRidPrefix {
+		return query.Webhook{}, huma.Error400BadRequest("invalid webhook id")
+	}
+
+	webhook, err := db.Queries.FindGameWebhook(ctx, query.FindGameWebhookParams{
+		GameUuid:    gameRid.ID,
+		WebhookUuid: webhookRid.ID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return query.Webhook{}, huma.Error404NotFound("webhook not found")
+	}
+
+	return webhook, err
+}
+
+type GameWebhooksInput struct {
+	GameRID rid.RID `path:"game"`
+}
+
+type WebhookList struct {
+	Webhooks []Webhook `json:"webhooks"`
+}
+
+type GetGameWebhooksOutput struct {
+	Body WebhookList
+}
+
+func HandleGetGameWebhooks(ctx context.Context, input *GameWebhooksInput) (*GetGameWebhooksOutput, error) {
+	if err := ensureGameDeveloper(ctx, input.GameRID); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Queries.GetGameWebhooks(ctx, input.GameRID.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]Webhook, len(rows))
+	for idx := range rows {
+		items[idx].MapFromRow(rows[idx])
+	}
+
+	return &GetGameWebhooksOutput{Body: WebhookList{Webhooks: items}}, nil
+}
+
+type PostGameWebhookInput struct {
+	GameRID rid.RID `path:"game"`
+	Body    Webhook
+}
+
+func (i *PostGameWebhookInput) Resolve(ctx huma.Context) []error {
+	err := safehttp.ValidateUrl(ctx.Context(), i.Body.Url, webhooks.AllowPrivateAddressesKey)
+	if err == nil {
+		return nil
+	}
+
+	return []error{&huma.ErrorDetail{
+		Location: "body.url",
+		Message:  err.Error(),
+		Value:    i.Body.Url,
+	}}
+}
+
+type PostGameWebhookOutput struct {
+	Body Webhook
+}
+
+func HandlePostGameWebhook(ctx context.Context, input *PostGameWebhookInput) (*PostGameWebhookOutput, error) {
+	if err := ensureGameDeveloper(ctx, input.GameRID); err != nil {
+		return nil, err
+	}
+
+	kinds := make([]string, len(input.Body.Events))
+	for idx, kind := range input.Body.Events {
+		kinds[idx] = string(kind)
+	}
+
+	webhook, secret, err := webhooks.CreateWebhook(ctx, input.GameRID.ID, input.Body.Url, kinds)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &PostGameWebhookOutput{}
+	output.Body.MapFromRow(webhook)
+	output.Body.Secret = secret
+	return output, nil
+}
+
+type GameWebhookInput struct {
+	GameRID    rid.RID `path:"game"`
+	WebhookRID rid.RID `path:"webhook"`
+}
+
+func HandleDeleteGameWebhook(ctx context.Context, input *GameWebhookInput) (*struct{}, error) {
+	if err := ensureGameDeveloper(ctx, input.GameRID); err != nil {
+		return nil, err
+	}
+
+	if input.WebhookRID.Prefix != webhooks.WebhookRidPrefix {
+		return nil, huma.Error400BadRequest("invalid webhook id")
+	}
+
+	deleted, err := webhooks.DeleteWebhook(ctx, input.GameRID.ID, input.WebhookRID.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !deleted {
+		return nil, huma.Error404NotFound("webhook not found")
+	}
+
+	return &struct{}{}, nil
+}
+
+type GetWebhookDeliveriesInput struct {
+	GameRID    rid.RID                      `path:"game"`
+	WebhookRID rid.RID                      `path:"webhook"`
+	After      validation.Optional[rid.RID] `query:"after,omitempty" doc:"Only return deliveries older than this delivery"`
+	Limit      validation.Optional[int]     `query:"limit" minimum:"1" maximum:"100" doc:"default = 20"`
+}
+
+type WebhookDeliveryList struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+}
+
+type GetWebhookDeliveriesOutput struct {
+	Body WebhookDeliveryList
+}
+
+func HandleGetWebhookDeliveries(ctx context.Context, input *GetWebhookDeliveriesInput) (*GetWebhookDeliveriesOutput, error) {
+	webhook, err := findGameWebhook(ctx, input.GameRID, input.WebhookRID)
+	if err != nil {
+		return nil, err
+	}
+
+	var after uuid.NullUUID
+	if input.After.HasValue {
+		if input.After.Value.Prefix != webhooks.DeliveryRidPrefix {
+			return nil, huma.Error400BadRequest("invalid delivery id")
+		}
+
+		after = uuid.NullUUID{UUID: input.After.Value.ID, Valid: true}
+	}
+
+	rows, err := db.Queries.GetWebhookDeliveries(ctx, query.GetWebhookDeliveriesParams{
+		Limit:     int32(input.Limit.ValueOr(20)),
+		WebhookID: webhook.ID,
+		After:     after,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]WebhookDelivery, len(rows))
+	for idx := range rows {
+		if err = items[idx].MapFromRow(rows[idx]); err != nil {
+			return nil, err
+		}
+	}
+
+	return &GetWebhookDeliveriesOutput{Body: WebhookDeliveryList{Deliveries: items}}, nil
+}
+
+type ReplayWebhookDeliveryInput struct {
+	GameRID     rid.RID `path:"game"`
+	WebhookRID  rid.RID `path:"webhook"`
+	DeliveryRID rid.RID `path:"delivery"`
+}
+
+type ReplayWebhookDeliveryOutput struct {
+	Body WebhookDelivery
+}
+
+func HandleReplayWebhookDelivery(ctx context.Context, input *ReplayWebhookDeliveryInput) (*ReplayWebhookDeliveryOutput, error) {
+	webhook, err := findGameWebhook(ctx, input.GameRID, input.WebhookRID)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.DeliveryRID.Prefix != webhooks.DeliveryRidPrefix {
+		return nil, huma.Error400BadRequest("invalid delivery id")
+	}
+
+	replay, err := db.Queries.ReplayWebhookDelivery(ctx, query.ReplayWebhookDeliveryParams{
+		WebhookID:    webhook.ID,
+		DeliveryUuid: input.DeliveryRID.ID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, huma.Error404NotFound("delivery not found")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	output := &ReplayWebhookDeliveryOutput{}
+	if err = output.Body.MapFromRow(replay); err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
@@ -4,15 +4,21 @@ import (
 	"context"
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/danielgtaylor/huma/v2/adapters/humachi"
+	"github.com/dresswithpockets/openstats/app/admin"
 	"github.com/dresswithpockets/openstats/app/auth"
 	"github.com/dresswithpockets/openstats/app/db"
 	"github.com/dresswithpockets/openstats/app/env"
+	"github.com/dresswithpockets/openstats/app/events"
 	"github.com/dresswithpockets/openstats/app/internal"
 	"github.com/dresswithpockets/openstats/app/log"
 	"github.com/dresswithpockets/openstats/app/mail"
 	"github.com/dresswithpockets/openstats/app/media"
+	"github.com/dresswithpockets/openstats/app/notifications"
+	"github.com/dresswithpockets/openstats/app/oauth"
+	"github.com/dresswithpockets/openstats/app/ratelimit"
 	"github.com/dresswithpockets/openstats/app/users"
 	"github.com/dresswithpockets/openstats/app/validation"
+	"github.com/dresswithpockets/openstats/app/webhooks"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/httplog/v3"
 	"github.com/rotisserie/eris"
@@ -21,6 +27,8 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
+	"slices"
+	"time"
 )
 
 func setupRouter() (*chi.Mux, error) {
@@ -81,14 +89,17 @@ func setupRouter() (*chi.Mux, error) {
 	}
 
 	router.Use(httplog.RequestLogger(logger, options))
+	router.Use(auth.ClientInfoMiddleware)
+	// an empty AllowedOrigins would allow every origin, so origins are matched by AllowOriginFunc instead
+	allowedOrigins := auth.AllowedOrigins()
 	router.Use(cors.New(cors.Options{
+		AllowOriginFunc: func(origin string) bool {
+			return slices.Contains(allowedOrigins, origin)
+		},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowCredentials: true,
 	}).Handler)
 
-	// TODO: CSRF middleware
-	// TODO: rate limit middleware
-
 	return router, nil
 }
 
@@ -115,6 +126,31 @@ func main() {
 		"OPENSTATS_HTTPLOG_RESPONSE_HEADERS",
 		"OPENSTATS_HTTPLOG_REQUEST_BODIES",
 		"OPENSTATS_HTTPLOG_RESPONSE_BODIES",
+		"OPENSTATS_NOTIFY_GAME_TOKEN_EXPIRY_INTERVAL",
+		"OPENSTATS_NOTIFY_GAME_TOKEN_EXPIRY_WINDOW",
+		"OPENSTATS_WEBAUTHN_RP_ID",
+		"OPENSTATS_WEBAUTHN_RP_DISPLAY_NAME",
+		"OPENSTATS_WEBAUTHN_RP_ORIGINS",
+		"OPENSTATS_OIDC_PROVIDERS",
+		"OPENSTATS_OIDC_COMPLETE_URL",
+		"OPENSTATS_DEVICE_VERIFICATION_URL",
+		"OPENSTATS_DEVICE_GAME_TOKEN_LIFETIME",
+		"OPENSTATS_OAUTH_AUTHORIZE_URL",
+		"OPENSTATS_TOKEN_SWEEP_INTERVAL",
+		"OPENSTATS_JWT_SESSION_KEYS",
+		"OPENSTATS_JWT_GAME_SESSION_KEYS",
+		"OPENSTATS_JWT_OAUTH_KEYS",
+		"OPENSTATS_ALLOWED_ORIGINS",
+		"OPENSTATS_RATE_LIMIT_STORE",
+		"OPENSTATS_RATE_LIMIT_SIGN_IN",
+		"OPENSTATS_RATE_LIMIT_SIGN_UP",
+		"OPENSTATS_RATE_LIMIT_SEND_PASSWORD_RESET",
+		"OPENSTATS_RATE_LIMIT_SEND_SLUG_REMINDER",
+		"OPENSTATS_RATE_LIMIT_HEARTBEAT",
+		"OPENSTATS_RATE_LIMIT_PROGRESS",
+		"OPENSTATS_RATE_LIMIT_REPORT",
+		"OPENSTATS_RATE_LIMIT_SERVER_PROGRESS",
+		"OPENSTATS_RATE_LIMIT_DEVICE",
 	)
 
 	if err := log.Setup(); err != nil {
@@ -129,17 +165,51 @@ func main() {
 		golog.Fatal(err)
 	}
 
+	if err := ratelimit.Setup(); err != nil {
+		golog.Fatal(err)
+	}
+
+	if err := auth.SetupWebAuthn(); err != nil {
+		golog.Fatal(err)
+	}
+
+	if err := auth.SetupSigningKeys(); err != nil {
+		golog.Fatal(err)
+	}
+
+	if err := auth.SetupOidc(); err != nil {
+		golog.Fatal(err)
+	}
+
 	// TODO: we probably aren't using this anymore, after switching to huma...
 	if err := validation.SetupValidations(); err != nil {
 		golog.Fatal(err)
 	}
 
-	// we need a root admin user in order to do admin operations. The root user is also the only user that can add
-	// other admins
-	if err := auth.AddRootAdminUser(context.Background()); err != nil {
+	// we need a root user in order to do admin operations. The root user is also the only user that can add other
+	// admins
+	if err := auth.BootstrapRoot(context.Background()); err != nil {
 		golog.Fatal(err)
 	}
 
+	go func() {
+		if err := notifications.RunGameTokenExpiryNotifier(context.Background()); err != nil {
+			golog.Fatal(err)
+		}
+	}()
+
+	go func() {
+		if err := auth.RunTokenSweeper(context.Background()); err != nil {
+			golog.Fatal(err)
+		}
+	}()
+
+	go auth.RunDisallowListener(context.Background(), 5*time.Second)
+	go ratelimit.RunPruner(context.Background())
+	go auth.RunNoncePruner(context.Background())
+	go events.Run(context.Background(), 5*time.Second)
+	go webhooks.Run(context.Background())
+
 	config := huma.DefaultConfig("openstats API", "1.0.0")
 	config.Info = &huma.Info{
 		Title:       "openstats API",
@@ -165,17 +235,38 @@ func main() {
 		"GameToken": {
 			Type:         "http",
 			Scheme:       "bearer",
-			BearerFormat: "RID",
-			Description:  "A secret token generated by a user, to authenticate a game to track game stats, sessions, and achievements for them.",
+			BearerFormat: "osgt_{lookupPrefix}_{secret}",
+			Description:  "A secret token generated by a user, to authenticate a game to track game stats, sessions, and achievements for them. Tokens are limited to the scopes the user chose.",
 		},
 		"GameSession": {
 			Type:         "http",
 			Scheme:       "bearer",
 			BearerFormat: "JWT",
-			Description:  "A JWT created when a Game Session is started, used to authenticate all Game Session actions.",
+			Description:  "A JWT created when a Game Session is started, used to authenticate all Game Session actions. When signed with ES256 or EdDSA, they may be verified with the keys published at /.well-known/jwks.json.",
+		},
+		"GameServerKey": {
+			Type:         "http",
+			Scheme:       "bearer",
+			BearerFormat: "osgs_{lookupPrefix}_{secret}",
+			Description:  "A secret key created by a game's developer, to authenticate the game's servers to submit progress for any player of the game.",
+		},
+		"OAuth2": {
+			Type:        "oauth2",
+			Description: "Access tokens issued to third-party apps, which may only use the operations allowed by their scopes.",
+			Flows: &huma.OAuthFlows{
+				AuthorizationCode: &huma.OAuthFlow{
+					AuthorizationURL: env.GetString("OPENSTATS_OAUTH_AUTHORIZE_URL"),
+					TokenURL:         env.GetString("OPENSTATS_APP_BASEURL") + "/oauth/v1/token",
+					RefreshURL:       env.GetString("OPENSTATS_APP_BASEURL") + "/oauth/v1/token",
+					Scopes:           auth.OAuthScopes,
+				},
+			},
 		},
 	}
 
+	// OAuth 2.0 clients send form bodies to the token and device authorization endpoints
+	config.Formats["application/x-www-form-urlencoded"] = oauth.FormFormat
+
 	router, routerErr := setupRouter()
 	if routerErr != nil {
 		golog.Fatal(routerErr)
@@ -199,6 +290,8 @@ func main() {
 	media.SetupLocal(api)
 	users.RegisterRoutes(api)
 	internal.RegisterRoutes(api)
+	oauth.RegisterRoutes(api)
+	admin.RegisterRoutes(api)
 
 	address := env.GetString("OPENSTATS_HTTP_ADDR")
 	if err := http.ListenAndServe(address, router); err != nil {
@@ -0,0 +1,90 @@
+package notifications
+
+import (
+	"context"
+	"time"
+
+	"github.com/dresswithpockets/openstats/app/db"
+	"github.com/dresswithpockets/openstats/app/db/query"
+	"github.com/dresswithpockets/openstats/app/env"
+	"github.com/dresswithpockets/openstats/app/log"
+	"github.com/google/uuid"
+	"github.com/rotisserie/eris"
+)
+
+type Kind string
+
+// these must match the kinds written by the queries in db/sql/notification.sql and by the
+// notify_game_achievements_added trigger
+const (
+	RareAchievementUnlocked Kind = "rare-achievement-unlocked"
+	GameAchievementsAdded   Kind = "game-achievements-added"
+	GameTokenExpiring       Kind = "game-token-expiring"
+	EmailConfirmed          Kind = "email-confirmed"
+)
+
+// RareAchievementMaxRarity is the rarity below which unlocking an achievement generates a notification
+const RareAchievementMaxRarity = 0.01
+
+// NotifyRareAchievementUnlocks notifies the user of any achievements in slugs that they've unlocked and which are
+// rarer than RareAchievementMaxRarity. Each achievement is only ever notified once per user.
+func NotifyRareAchievementUnlocks(ctx context.Context, userUuid, gameUuid uuid.UUID, slugs []string) error {
+	if len(slugs) == 0 {
+		return nil
+	}
+
+	_, err := db.Queries.AddRareAchievementNotifications(ctx, query.AddRareAchievementNotificationsParams{
+		UserUuid:             userUuid,
+		GameUuid:             gameUuid,
+		AchievementSlugs:     slugs,
+		MaxCompletionPercent: RareAchievementMaxRarity,
+	})
+	return eris.Wrap(err, "error adding rare achievement notifications")
+}
+
+func NotifyEmailConfirmed(ctx context.Context, userId int32, email string) error {
+	err := db.Queries.AddEmailConfirmedNotification(ctx, query.AddEmailConfirmedNotificationParams{
+		UserID: userId,
+		Email:  &email,
+	})
+	return eris.Wrap(err, "error adding email confirmed notification")
+}
+
+// NotifyExpiringGameTokens notifies users of each of their game tokens which expire within the window. Each token is
+// only ever notified once.
+func NotifyExpiringGameTokens(ctx context.Context, window time.Duration) (int64, error) {
+	count, err := db.Queries.AddExpiringGameTokenNotifications(ctx, time.Now().UTC().Add(window))
+	return count, eris.Wrap(err, "error adding expiring game token notifications")
+}
+
+// RunGameTokenExpiryNotifier calls NotifyExpiringGameTokens every interval until ctx is done. It is intended to be run
+// in its own goroutine.
+func RunGameTokenExpiryNotifier(ctx context.Context) error {
+	interval, intervalErr := env.GetMatched("OPENSTATS_NOTIFY_GAME_TOKEN_EXPIRY_INTERVAL", time.ParseDuration)
+	if intervalErr != nil {
+		return intervalErr
+	}
+
+	window, windowErr := env.GetMatched("OPENSTATS_NOTIFY_GAME_TOKEN_EXPIRY_WINDOW", time.ParseDuration)
+	if windowErr != nil {
+		return windowErr
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		count, err := NotifyExpiringGameTokens(ctx, window)
+		if err != nil {
+			log.Logger.Error("error notifying users of expiring game tokens", "error", err)
+		} else if count > 0 {
+			log.Logger.Debug("notified users of expiring game tokens", "count", count)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
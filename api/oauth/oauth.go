@@ -0,0 +1,358 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dresswithpockets/openstats/app/auth"
+	"github.com/dresswithpockets/openstats/app/db/query"
+	"github.com/dresswithpockets/openstats/app/env"
+	"github.com/dresswithpockets/openstats/app/rid"
+)
+
+const (
+	GrantTypeDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code"
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeRefreshToken      = "refresh_token"
+)
+
+// Error is an OAuth 2.0 error response (RFC 6749 section 5.2). Unlike the rest of the API these aren't problem
+// details, since OAuth clients expect the error code in the `error` field.
+type Error struct {
+	status      int
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func NewError(status int, code, description string) *Error {
+	return &Error{status: status, Code: code, Description: description}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Description)
+}
+
+func (e *Error) GetStatus() int {
+	return e.status
+}
+
+func (e *Error) ContentType(string) string {
+	return "application/json"
+}
+
+// FormFormat unmarshals application/x-www-form-urlencoded request bodies, which OAuth 2.0 clients send to the token
+// and device authorization endpoints. Each field's first value is used.
+var FormFormat = huma.Format{
+	Marshal: func(_ io.Writer, _ any) error {
+		return errors.New("responses can't be encoded as application/x-www-form-urlencoded")
+	},
+	Unmarshal: func(data []byte, v any) error {
+		values, err := url.ParseQuery(string(data))
+		if err != nil {
+			return err
+		}
+
+		fields := make(map[string]string, len(values))
+		for key := range values {
+			fields[key] = values.Get(key)
+		}
+
+		encoded, err := json.Marshal(fields)
+		if err != nil {
+			return err
+		}
+
+		return json.Unmarshal(encoded, v)
+	},
+}
+
+func RegisterRoutes(api huma.API) {
+	oauthApi := huma.NewGroup(api, "/oauth/v1")
+	oauthApi.UseSimpleModifier(func(op *huma.Operation) {
+		op.Tags = append(op.Tags, "OAuth")
+	})
+
+	huma.Register(oauthApi, huma.Operation{
+		Method:      http.MethodPost,
+		Path:        "/device/code",
+		OperationID: "oauth-device-authorization",
+		Summary:     "Start a device authorization",
+		Description: "Start an OAuth 2.0 device authorization grant (RFC 8628) for a game. Show the user_code and verification_uri to the player, then poll the token endpoint with the device_code until they approve it.",
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized},
+	}, HandleDeviceAuthorization)
+
+	huma.Register(oauthApi, huma.Operation{
+		Method:      http.MethodPost,
+		Path:        "/token",
+		OperationID: "oauth-token",
+		Summary:     "Get a token",
+		Description: "The OAuth 2.0 token endpoint. With the device_code grant, returns a game token once the player has approved the device authorization. With the authorization_code and refresh_token grants, returns scoped access tokens for third-party apps. Confidential clients authenticate with HTTP Basic or client_secret.",
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized},
+	}, HandleToken)
+
+	huma.Register(api, huma.Operation{
+		Method:      http.MethodGet,
+		Path:        "/.well-known/oauth-authorization-server",
+		OperationID: "oauth-metadata",
+		Summary:     "Get authorization server metadata",
+		Description: "Get the OAuth 2.0 authorization server metadata (RFC 8414), so clients can discover the endpoints and scopes",
+		Tags:        []string{"OAuth"},
+	}, HandleMetadata)
+
+	huma.Register(api, huma.Operation{
+		Method:      http.MethodGet,
+		Path:        "/.well-known/jwks.json",
+		OperationID: "jwks",
+		Summary:     "Get the JSON Web Key Set",
+		Description: "Get the public keys that verify game session tokens and OAuth access tokens signed with ES256 or EdDSA, by their kid header. Tokens signed with HS256 can't be verified offline.",
+		Tags:        []string{"OAuth"},
+	}, HandleJwks)
+}
+
+// parseGameClientId gets the game identified by a client_id. Games are public clients, identified by their RID.
+func parseGameClientId(clientId string) (rid.RID, error) {
+	gameRid, err := rid.ParseString(clientId)
+	if err != nil || gameRid.Prefix != auth.GameRidPrefix {
+		return gameRid, NewError(http.StatusUnauthorized, "invalid_client", "client_id must be a game RID")
+	}
+
+	return gameRid, nil
+}
+
+type DeviceAuthorizationInput struct {
+	Body struct {
+		ClientId string `json:"client_id" doc:"The RID of the game requesting authorization"`
+		Scope    string `json:"scope,omitempty" required:"false"`
+	}
+}
+
+type DeviceAuthorizationOutput struct {
+	CacheControl string `header:"Cache-Control"`
+	Body         struct {
+		DeviceCode              string `json:"device_code" doc:"Kept secret by the game, and used to poll the token endpoint"`
+		UserCode                string `json:"user_code" doc:"Shown to the player, to enter at the verification_uri"`
+		VerificationUri         string `json:"verification_uri"`
+		VerificationUriComplete string `json:"verification_uri_complete" doc:"The verification_uri with the user_code included, e.g. for showing as a QR code"`
+		ExpiresIn               int    `json:"expires_in" doc:"Seconds until the device_code and user_code expire"`
+		Interval                int    `json:"interval" doc:"Minimum seconds to wait between polls to the token endpoint"`
+	}
+}
+
+func HandleDeviceAuthorization(ctx context.Context, input *DeviceAuthorizationInput) (*DeviceAuthorizationOutput, error) {
+	gameRid, err := parseGameClientId(input.Body.ClientId)
+	if err != nil {
+		return nil, err
+	}
+
+	authorization, err := auth.StartDeviceAuthorization(ctx, gameRid.ID)
+	if errors.Is(err, auth.ErrUnknownDeviceClient) {
+		return nil, NewError(http.StatusUnauthorized, "invalid_client", "game not found")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	output := &DeviceAuthorizationOutput{CacheControl: "no-store"}
+	output.Body.DeviceCode = authorization.DeviceCode
+	output.Body.UserCode = authorization.UserCode
+	output.Body.VerificationUri = authorization.VerificationUri
+	output.Body.VerificationUriComplete = authorization.VerificationUriComplete
+	output.Body.ExpiresIn = int(time.Until(authorization.ExpiresAt).Seconds())
+	output.Body.Interval = int(authorization.Interval.Seconds())
+	return output, nil
+}
+
+type TokenInput struct {
+	Authorization string `header:"Authorization" doc:"HTTP Basic client authentication, for confidential clients"`
+	Body          struct {
+		GrantType    string `json:"grant_type"`
+		ClientId     string `json:"client_id,omitempty" required:"false" doc:"Required unless the client authenticates with HTTP Basic"`
+		ClientSecret string `json:"client_secret,omitempty" required:"false"`
+		DeviceCode   string `json:"device_code,omitempty" required:"false" doc:"Required for the device_code grant"`
+		Code         string `json:"code,omitempty" required:"false" doc:"Required for the authorization_code grant"`
+		RedirectUri  string `json:"redirect_uri,omitempty" required:"false" doc:"Required for the authorization_code grant"`
+		CodeVerifier string `json:"code_verifier,omitempty" required:"false" doc:"Required for the authorization_code grant"`
+		RefreshToken string `json:"refresh_token,omitempty" required:"false" doc:"Required for the refresh_token grant"`
+		Scope        string `json:"scope,omitempty" required:"false" doc:"Optionally narrows the scopes of a refresh_token grant"`
+	}
+}
+
+type TokenOutput struct {
+	CacheControl string `header:"Cache-Control"`
+	Body         struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+		RefreshToken string `json:"refresh_token,omitempty"`
+		Scope        string `json:"scope,omitempty"`
+	}
+}
+
+func HandleToken(ctx context.Context, input *TokenInput) (*TokenOutput, error) {
+	switch input.Body.GrantType {
+	case GrantTypeDeviceCode:
+		return handleDeviceCodeGrant(ctx, input)
+	case GrantTypeAuthorizationCode, GrantTypeRefreshToken:
+		return handleAppGrant(ctx, input)
+	default:
+		return nil, NewError(http.StatusBadRequest, "unsupported_grant_type", "")
+	}
+}
+
+// authenticateClient finds the third-party app making the request, and verifies its secret if it's confidential
+func authenticateClient(ctx context.Context, input *TokenInput) (query.FindOAuthClientRow, error) {
+	clientId, clientSecret := input.Body.ClientId, input.Body.ClientSecret
+	if len(input.Authorization) > 0 {
+		request := http.Request{Header: http.Header{"Authorization": {input.Authorization}}}
+		basicId, basicSecret, ok := request.BasicAuth()
+		if !ok {
+			return query.FindOAuthClientRow{}, NewError(http.StatusUnauthorized, "invalid_client", "only HTTP Basic client authentication is supported")
+		}
+
+		// RFC 6749 requires the credentials to be form-encoded before they're base64 encoded
+		clientId, _ = url.QueryUnescape(basicId)
+		clientSecret, _ = url.QueryUnescape(basicSecret)
+	}
+
+	client, err := auth.FindOAuthClient(ctx, clientId)
+	if errors.Is(err, auth.ErrUnknownOAuthClient) {
+		return client, NewError(http.StatusUnauthorized, "invalid_client", "unknown client")
+	}
+
+	if err != nil {
+		return client, err
+	}
+
+	if err = auth.AuthenticateOAuthClient(client, clientSecret); err != nil {
+		return client, NewError(http.StatusUnauthorized, "invalid_client", "client authentication failed")
+	}
+
+	return client, nil
+}
+
+func handleAppGrant(ctx context.Context, input *TokenInput) (*TokenOutput, error) {
+	client, err := authenticateClient(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens auth.OAuthTokens
+	if input.Body.GrantType == GrantTypeAuthorizationCode {
+		tokens, err = auth.ExchangeOAuthAuthorizationCode(ctx, client, input.Body.Code, input.Body.RedirectUri, input.Body.CodeVerifier)
+	} else {
+		var scopes []string
+		if len(input.Body.Scope) > 0 {
+			scopes, err = auth.ParseOAuthScopes(input.Body.Scope)
+			if err != nil {
+				return nil, NewError(http.StatusBadRequest, "invalid_scope", err.Error())
+			}
+		}
+
+		tokens, err = auth.RefreshOAuthTokens(ctx, client, input.Body.RefreshToken, scopes)
+	}
+
+	switch {
+	case errors.Is(err, auth.ErrInvalidOAuthGrant):
+		return nil, NewError(http.StatusBadRequest, "invalid_grant", "")
+	case errors.Is(err, auth.ErrInvalidOAuthScope):
+		return nil, NewError(http.StatusBadRequest, "invalid_scope", err.Error())
+	case err != nil:
+		return nil, err
+	}
+
+	output := &TokenOutput{CacheControl: "no-store"}
+	output.Body.AccessToken = tokens.AccessToken
+	output.Body.TokenType = "Bearer"
+	output.Body.ExpiresIn = int(time.Until(tokens.ExpiresAt).Seconds())
+	output.Body.RefreshToken = tokens.RefreshToken
+	output.Body.Scope = strings.Join(tokens.Scopes, " ")
+	return output, nil
+}
+
+func handleDeviceCodeGrant(ctx context.Context, input *TokenInput) (*TokenOutput, error) {
+	gameRid, err := parseGameClientId(input.Body.ClientId)
+	if err != nil {
+		return nil, err
+	}
+
+	token, row, err := auth.PollDeviceAuthorization(ctx, gameRid.ID, input.Body.DeviceCode)
+	switch {
+	case errors.Is(err, auth.ErrDeviceAuthorizationPending):
+		return nil, NewError(http.StatusBadRequest, "authorization_pending", "")
+	case errors.Is(err, auth.ErrDeviceSlowDown):
+		return nil, NewError(http.StatusBadRequest, "slow_down", "")
+	case errors.Is(err, auth.ErrDeviceAccessDenied):
+		return nil, NewError(http.StatusBadRequest, "access_denied", "the player denied the authorization")
+	case errors.Is(err, auth.ErrDeviceCodeExpired):
+		return nil, NewError(http.StatusBadRequest, "expired_token", "the device code has expired; start a new authorization")
+	case errors.Is(err, auth.ErrInvalidDeviceCode):
+		return nil, NewError(http.StatusBadRequest, "invalid_grant", "")
+	case err != nil:
+		return nil, err
+	}
+
+	output := &TokenOutput{CacheControl: "no-store"}
+	output.Body.AccessToken = token
+	output.Body.TokenType = "Bearer"
+	output.Body.ExpiresIn = int(time.Until(row.ExpiresAt).Seconds())
+	output.Body.Scope = strings.Join(row.Scopes, " ")
+	return output, nil
+}
+
+type MetadataOutput struct {
+	Body struct {
+		Issuer                            string   `json:"issuer"`
+		AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+		TokenEndpoint                     string   `json:"token_endpoint"`
+		JwksUri                           string   `json:"jwks_uri"`
+		DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint"`
+		ScopesSupported                   []string `json:"scopes_supported"`
+		ResponseTypesSupported            []string `json:"response_types_supported"`
+		GrantTypesSupported               []string `json:"grant_types_supported"`
+		TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+		CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	}
+}
+
+func HandleMetadata(_ context.Context, _ *struct{}) (*MetadataOutput, error) {
+	baseUrl := env.GetString("OPENSTATS_APP_BASEURL")
+
+	output := &MetadataOutput{}
+	output.Body.Issuer = baseUrl
+	output.Body.AuthorizationEndpoint = env.GetString("OPENSTATS_OAUTH_AUTHORIZE_URL")
+	output.Body.TokenEndpoint = baseUrl + "/oauth/v1/token"
+	output.Body.JwksUri = baseUrl + "/.well-known/jwks.json"
+	output.Body.DeviceAuthorizationEndpoint = baseUrl + "/oauth/v1/device/code"
+	output.Body.ScopesSupported = slices.Sorted(maps.Keys(auth.OAuthScopes))
+	output.Body.ResponseTypesSupported = []string{"code"}
+	output.Body.GrantTypesSupported = []string{GrantTypeAuthorizationCode, GrantTypeRefreshToken, GrantTypeDeviceCode}
+	output.Body.TokenEndpointAuthMethodsSupported = []string{"client_secret_basic", "client_secret_post", "none"}
+	output.Body.CodeChallengeMethodsSupported = []string{auth.OAuthCodeChallengeMethodS256}
+	return output, nil
+}
+
+type JwksOutput struct {
+	CacheControl string `header:"Cache-Control"`
+	Body         struct {
+		Keys []auth.JWK `json:"keys"`
+	}
+}
+
+func HandleJwks(_ context.Context, _ *struct{}) (*JwksOutput, error) {
+	// keys are rotated by publishing the new key as a verify-only key for at least this long before it signs anything,
+	// so caches always have a key before tokens signed by it are seen
+	output := &JwksOutput{CacheControl: "public, max-age=3600"}
+	output.Body.Keys = auth.PublicJWKs()
+	return output, nil
+}
@@ -0,0 +1,222 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dresswithpockets/openstats/app/auth"
+	"github.com/dresswithpockets/openstats/app/env"
+	"github.com/dresswithpockets/openstats/app/log"
+	"github.com/rotisserie/eris"
+)
+
+// The names of each rate limit. Each is configured by OPENSTATS_RATE_LIMIT_{NAME}, e.g. OPENSTATS_RATE_LIMIT_SIGN_IN.
+const (
+	SignIn            = "sign-in"
+	SignUp            = "sign-up"
+	SendPasswordReset = "send-password-reset"
+	SendSlugReminder  = "send-slug-reminder"
+	Heartbeat         = "heartbeat"
+	Progress          = "progress"
+	Report            = "report"
+	ServerProgress    = "server-progress"
+	Device            = "device"
+)
+
+var names = []string{SignIn, SignUp, SendPasswordReset, SendSlugReminder, Heartbeat, Progress, Report, ServerProgress, Device}
+
+// PruneInterval is how often RunPruner deletes buckets which have refilled
+const PruneInterval = 10 * time.Minute
+
+// Limit is a token bucket which holds up to Burst tokens, and refills completely over Period. Each request takes one
+// token, and is rejected if there are none left.
+type Limit struct {
+	Name   string
+	Burst  int
+	Period time.Duration
+}
+
+// ParseLimit parses a limit like 10/1m, which allows bursts of 10 requests and refills 10 requests per minute
+func ParseLimit(name, value string) (Limit, error) {
+	burst, period, ok := strings.Cut(value, "/")
+	if !ok {
+		return Limit{}, eris.Errorf("invalid rate limit '%s', expected e.g. 10/1m", value)
+	}
+
+	limit := Limit{Name: name}
+
+	var err error
+	if limit.Burst, err = strconv.Atoi(burst); err != nil || limit.Burst < 1 {
+		return Limit{}, eris.Errorf("invalid rate limit '%s', expected a positive number of requests", value)
+	}
+
+	if limit.Period, err = time.ParseDuration(period); err != nil || limit.Period <= 0 {
+		return Limit{}, eris.Errorf("invalid rate limit '%s', expected a positive duration", value)
+	}
+
+	return limit, nil
+}
+
+// rate is how many tokens are refilled per second
+func (l Limit) rate() float64 {
+	return float64(l.Burst) / l.Period.Seconds()
+}
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// take refills the bucket by the time elapsed since it was last updated, and takes a token. If there are no tokens,
+// the bucket is unchanged, and take returns how long until there will be a token.
+func (l Limit) take(b bucket, now time.Time) (bucket, time.Duration) {
+	refilled := min(float64(l.Burst), b.tokens+now.Sub(b.updatedAt).Seconds()*l.rate())
+	if refilled >= 1 {
+		return bucket{tokens: refilled - 1, updatedAt: now}, 0
+	}
+
+	return b, time.Duration((1 - refilled) / l.rate() * float64(time.Second))
+}
+
+// fullAt is when the bucket will have refilled, after which it's no different to a new bucket
+func (l Limit) fullAt(b bucket) time.Time {
+	return b.updatedAt.Add(time.Duration((float64(l.Burst) - b.tokens) / l.rate() * float64(time.Second)))
+}
+
+// Store holds the token buckets for every key
+type Store interface {
+	// Take takes a token from the key's bucket. If there are no tokens, it returns how long until there will be one.
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (time.Duration, error)
+
+	// Prune deletes buckets which have refilled
+	Prune(ctx context.Context, now time.Time) error
+}
+
+var (
+	Default Store
+	limits  = make(map[string]Limit)
+)
+
+// Setup loads each limit, and the Default store as configured by OPENSTATS_RATE_LIMIT_STORE. Buckets are held in memory,
+// which is only correct with one replica, or in postgres, which every replica shares.
+func Setup() error {
+	for _, name := range names {
+		key := "OPENSTATS_RATE_LIMIT_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+		limit, err := ParseLimit(name, env.GetString(key))
+		if err != nil {
+			return eris.Wrapf(err, "error parsing %s", key)
+		}
+
+		limits[name] = limit
+	}
+
+	mode := env.GetString("OPENSTATS_RATE_LIMIT_STORE")
+	switch mode {
+	case "Memory":
+		Default = NewMemoryStore()
+	case "Postgres":
+		Default = &PostgresStore{}
+	default:
+		return eris.Errorf("invalid value for OPENSTATS_RATE_LIMIT_STORE: %s", mode)
+	}
+
+	return nil
+}
+
+// RunPruner prunes the Default store every PruneInterval until ctx is done. It is intended to be run in its own
+// goroutine.
+func RunPruner(ctx context.Context) {
+	ticker := time.NewTicker(PruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := Default.Prune(ctx, time.Now().UTC()); err != nil {
+			log.Logger.Error("error pruning rate limit buckets", "error", err)
+		}
+	}
+}
+
+// KeyFunc gets the key whose bucket a request takes from. Requests without a key aren't limited.
+type KeyFunc func(ctx context.Context) (string, bool)
+
+// ByIP limits requests per client IP address
+func ByIP(ctx context.Context) (string, bool) {
+	info, ok := auth.GetClientInfo(ctx)
+	if !ok || len(info.IPAddress) == 0 {
+		return "", false
+	}
+
+	return "ip:" + info.IPAddress, true
+}
+
+// ByUser limits requests per signed-in user. It must follow auth.UserAuthHandler.
+func ByUser(ctx context.Context) (string, bool) {
+	principal, ok := auth.GetPrincipal(ctx)
+	if !ok {
+		return "", false
+	}
+
+	return "user:" + principal.User.Uuid.String(), true
+}
+
+// ByGameToken limits requests per game token, including every game session started with it, so that starting new
+// sessions doesn't refill the bucket. It must follow auth.GameSessionAuthHandler.
+func ByGameToken(ctx context.Context) (string, bool) {
+	principal, ok := auth.GetGameSessionPrincipal(ctx)
+	if !ok {
+		return "", false
+	}
+
+	return "gt:" + principal.GameTokenUuid.String(), true
+}
+
+// ByGameServerKey limits requests per game server key. It must follow auth.GameServerAuthHandler.
+func ByGameServerKey(ctx context.Context) (string, bool) {
+	principal, ok := auth.GetGameServerPrincipal(ctx)
+	if !ok {
+		return "", false
+	}
+
+	return "gk:" + principal.KeyUuid.String(), true
+}
+
+// CreateRateLimitHandler rejects requests with 429 Too Many Requests and a Retry-After header once the key's bucket for
+// the named limit is empty
+func CreateRateLimitHandler(api huma.API, name string, keyFunc KeyFunc) func(ctx huma.Context, next func(huma.Context)) {
+	return func(ctx huma.Context, next func(huma.Context)) {
+		limit, hasLimit := limits[name]
+		key, hasKey := keyFunc(ctx.Context())
+		if !hasLimit || !hasKey {
+			next(ctx)
+			return
+		}
+
+		retryAfter, err := Default.Take(ctx.Context(), name+":"+key, limit, time.Now().UTC())
+		if err != nil {
+			// an unavailable store shouldn't take the API down with it, so requests are let through
+			log.Logger.Error("error taking rate limit token", "error", err, "limit", name)
+			next(ctx)
+			return
+		}
+
+		if retryAfter > 0 {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			ctx.SetHeader("Retry-After", strconv.Itoa(seconds))
+			_ = huma.WriteErr(api, ctx, http.StatusTooManyRequests, "rate limit exceeded, retry after "+strconv.Itoa(seconds)+" seconds")
+			return
+		}
+
+		next(ctx)
+	}
+}
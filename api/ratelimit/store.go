@@ -0,0 +1,95 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/dresswithpockets/openstats/app/db"
+	"github.com/dresswithpockets/openstats/app/db/query"
+	"github.com/rotisserie/eris"
+)
+
+type memoryBucket struct {
+	bucket
+	fullAt time.Time
+}
+
+// MemoryStore holds buckets in memory, so each replica limits requests independently
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]memoryBucket
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]memoryBucket)}
+}
+
+func (s *MemoryStore) Take(_ context.Context, key string, limit Limit, now time.Time) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, exists := s.buckets[key]
+	if !exists {
+		current.bucket = bucket{tokens: float64(limit.Burst), updatedAt: now}
+	}
+
+	taken, retryAfter := limit.take(current.bucket, now)
+	s.buckets[key] = memoryBucket{bucket: taken, fullAt: limit.fullAt(taken)}
+	return retryAfter, nil
+}
+
+func (s *MemoryStore) Prune(_ context.Context, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, current := range s.buckets {
+		if current.fullAt.Before(now) {
+			delete(s.buckets, key)
+		}
+	}
+
+	return nil
+}
+
+// PostgresStore holds buckets in the rate_limit_bucket table, so every replica shares them
+type PostgresStore struct{}
+
+func (s *PostgresStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (retryAfter time.Duration, err error) {
+	err = db.DB.Transact(ctx, func(ctx context.Context, qtx *query.Queries) error {
+		err := qtx.CreateRateLimitBucket(ctx, query.CreateRateLimitBucketParams{
+			Key:    key,
+			Tokens: float64(limit.Burst),
+			Now:    now,
+		})
+		if err != nil {
+			return err
+		}
+
+		// the row lock serializes concurrent requests for the same key across replicas
+		row, err := qtx.GetRateLimitBucketForUpdate(ctx, key)
+		if err != nil {
+			return err
+		}
+
+		var taken bucket
+		taken, retryAfter = limit.take(bucket{tokens: row.Tokens, updatedAt: row.UpdatedAt}, now)
+		if retryAfter > 0 {
+			return nil
+		}
+
+		return qtx.UpdateRateLimitBucket(ctx, query.UpdateRateLimitBucketParams{
+			Tokens:    taken.tokens,
+			UpdatedAt: taken.updatedAt,
+			FullAt:    limit.fullAt(taken),
+			Key:       key,
+		})
+	})
+
+	return retryAfter, eris.Wrap(err, "error taking rate limit token")
+}
+
+func (s *PostgresStore) Prune(ctx context.Context, now time.Time) error {
+	_, err := db.Queries.DeleteFullRateLimitBuckets(ctx, now)
+	return eris.Wrap(err, "error deleting full rate limit buckets")
+}
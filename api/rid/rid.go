@@ -43,11 +43,13 @@ func (R *RID) UnmarshalJSON(bytes []byte) error {
 	return R.UnmarshalText([]byte(text))
 }
 
-func (R *RID) MarshalJSON() ([]byte, error) {
+// MarshalJSON, MarshalText and String have value receivers, so RIDs held by value - e.g. in a map[string]any, or a
+// struct that isn't addressable - are encoded as their string rather than as an object with Prefix and ID
+func (R RID) MarshalJSON() ([]byte, error) {
 	return json.Marshal(R.String())
 }
 
-func (R *RID) MarshalText() ([]byte, error) {
+func (R RID) MarshalText() ([]byte, error) {
 	return []byte(R.String()), nil
 }
 
@@ -77,7 +79,7 @@ func (R *RID) UnmarshalText(text []byte) error {
 	return nil
 }
 
-func (R *RID) String() string {
+func (R RID) String() string {
 	encodedId := Base62Encoding.Encode(R.ID[:])
 	// the padding that the base62 library adds isn't really desirable
 	encodedId = strings.TrimRight(encodedId, "+")
@@ -0,0 +1,56 @@
+package rid
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestMarshalJSON(t *testing.T) {
+	id := From("u", uuid.Must(uuid.NewV7()))
+	want := `"` + id.String() + `"`
+
+	tests := []struct {
+		name  string
+		value any
+		want  string
+	}{
+		{"value", id, want},
+		{"pointer", &id, want},
+		{"in an interface map", map[string]any{"user": id}, `{"user":` + want + `}`},
+		{"in a struct held by value", struct{ User RID }{id}, `{"User":` + want + `}`},
+		{"in a slice", []RID{id}, `[` + want + `]`},
+		{"as a map key", map[RID]int{id: 1}, `{` + want + `:1}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encoded, err := json.Marshal(test.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(encoded) != test.want {
+				t.Fatalf("got %s, want %s", encoded, test.want)
+			}
+		})
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	id := From("u", uuid.Must(uuid.NewV7()))
+	encoded, err := json.Marshal(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded RID
+	if err = json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded != id {
+		t.Fatalf("got %v, want %v", decoded, id)
+	}
+}
@@ -0,0 +1,91 @@
+// Package safehttp makes requests to user-supplied URLs, refusing to connect to loopback, link-local, and private
+// network addresses so that users can't make the API send requests into its own network.
+package safehttp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/dresswithpockets/openstats/app/env"
+)
+
+var (
+	ErrAddressNotAllowed = errors.New("requests to loopback, link-local, and private addresses are not allowed")
+	ErrInvalidUrl        = errors.New("url must be an absolute http or https URL")
+)
+
+// AllowedAddress returns true if ip is a public unicast address
+func AllowedAddress(ip net.IP) bool {
+	return ip != nil && ip.IsGlobalUnicast() && !ip.IsPrivate()
+}
+
+// NewTransport returns a transport whose connections may only be made to addresses accepted by AllowedAddress, unless
+// the allowPrivateKey envvar is true. The address is checked after it's resolved, so DNS can't be used to get around
+// the check.
+func NewTransport(timeout time.Duration, allowPrivateKey string) *http.Transport {
+	return &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: timeout,
+			Control: func(_, address string, _ syscall.RawConn) error {
+				if env.GetBool(allowPrivateKey) {
+					return nil
+				}
+
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+
+				if !AllowedAddress(net.ParseIP(host)) {
+					return ErrAddressNotAllowed
+				}
+
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout: timeout,
+	}
+}
+
+// ValidateUrl returns ErrInvalidUrl if rawUrl isn't an absolute http or https URL, or ErrAddressNotAllowed if its host
+// resolves to an address not accepted by AllowedAddress, unless the allowPrivateKey envvar is true.
+//
+// This only lets users know early that a URL will never work, since DNS may change after the URL is validated. Requests
+// must still be made with a NewTransport.
+func ValidateUrl(ctx context.Context, rawUrl string, allowPrivateKey string) error {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Hostname() == "" {
+		return ErrInvalidUrl
+	}
+
+	if env.GetBool(allowPrivateKey) {
+		return nil
+	}
+
+	if ip := net.ParseIP(parsed.Hostname()); ip != nil {
+		if !AllowedAddress(ip) {
+			return ErrAddressNotAllowed
+		}
+
+		return nil
+	}
+
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, parsed.Hostname())
+	if err != nil {
+		// the host may not exist yet, which is checked again when a request is made
+		return nil
+	}
+
+	for _, address := range addresses {
+		if !AllowedAddress(address.IP) {
+			return ErrAddressNotAllowed
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dresswithpockets/openstats/app/env"
+	"github.com/dresswithpockets/openstats/app/safehttp"
+	"github.com/rotisserie/eris"
+	"golang.org/x/net/html"
+)
+
+const (
+	RelMeTimeout      = 10 * time.Second
+	RelMeMaxBodySize  = 1 << 20
+	RelMeMaxRedirects = 5
+)
+
+// RelMeAllowPrivateAddressesKey is the envvar which, when true, lets rel=me links be fetched from private addresses
+const RelMeAllowPrivateAddressesKey = "OPENSTATS_REL_ME_ALLOW_PRIVATE_ADDRESSES"
+
+var relMeClient = &http.Client{
+	Timeout:   RelMeTimeout,
+	Transport: safehttp.NewTransport(RelMeTimeout, RelMeAllowPrivateAddressesKey),
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= RelMeMaxRedirects {
+			return eris.New("too many redirects")
+		}
+
+		return nil
+	},
+}
+
+// ProfileUrls returns the URLs which a rel=me link may use to refer to the user's openstats profile
+func ProfileUrls(slug, rid string) []string {
+	baseUrl := strings.TrimSuffix(env.GetString("OPENSTATS_APP_BASEURL"), "/")
+	return []string{
+		baseUrl + "/players/" + slug,
+		baseUrl + "/players/" + rid,
+	}
+}
+
+// VerifyRelMe fetches the page at link and returns true if it contains an <a> or <link> element, with a rel attribute
+// including "me", whose href refers to one of profileUrls.
+//
+// Redirects are followed, so the page that's inspected may not be at link. Only the first RelMeMaxBodySize bytes of the
+// page are inspected.
+func VerifyRelMe(ctx context.Context, link string, profileUrls []string) (bool, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return false, eris.Wrap(err, "couldn't create rel=me request")
+	}
+
+	request.Header.Set("Accept", "text/html")
+	request.Header.Set("User-Agent", "openstats-rel-me-verifier")
+
+	response, err := relMeClient.Do(request)
+	if err != nil {
+		return false, eris.Wrap(err, "couldn't fetch rel=me link")
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return false, nil
+	}
+
+	tokenizer := html.NewTokenizer(io.LimitReader(response.Body, RelMeMaxBodySize))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			if errors.Is(tokenizer.Err(), io.EOF) {
+				return false, nil
+			}
+
+			return false, eris.Wrap(tokenizer.Err(), "couldn't parse rel=me page")
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			if token.Data != "a" && token.Data != "link" {
+				continue
+			}
+
+			var rel, href string
+			for _, attr := range token.Attr {
+				switch attr.Key {
+				case "rel":
+					rel = attr.Val
+				case "href":
+					href = attr.Val
+				}
+			}
+
+			if !slices.Contains(strings.Fields(strings.ToLower(rel)), "me") {
+				continue
+			}
+
+			target, err := response.Request.URL.Parse(href)
+			if err != nil {
+				continue
+			}
+
+			if slices.ContainsFunc(profileUrls, func(profileUrl string) bool { return sameUrl(target, profileUrl) }) {
+				return true, nil
+			}
+		}
+	}
+}
+
+// sameUrl compares URLs while ignoring differences in scheme, host case, and trailing slashes
+func sameUrl(target *url.URL, other string) bool {
+	parsed, err := url.Parse(other)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(target.Host, parsed.Host) &&
+		strings.TrimSuffix(target.Path, "/") == strings.TrimSuffix(parsed.Path, "/")
+}
@@ -0,0 +1,86 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dresswithpockets/openstats/app/safehttp"
+)
+
+var testProfileUrls = []string{
+	"https://openstats.example/players/alice",
+	"https://openstats.example/players/u_AZhjuMmhePWkHFALenFEfg",
+}
+
+func newRelMeServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/verified", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`<html><head><link rel="stylesheet" href="/style.css"></head>
+<body><a rel="nofollow me" href="https://OPENSTATS.example/players/alice/">my stats</a></body></html>`))
+	})
+	mux.HandleFunc("/verified-by-rid", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`<link rel="me" href="https://openstats.example/players/u_AZhjuMmhePWkHFALenFEfg">`))
+	})
+	mux.HandleFunc("/not-me", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`<a href="https://openstats.example/players/alice">my stats</a>`))
+	})
+	mux.HandleFunc("/someone-else", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`<a rel="me" href="https://openstats.example/players/bob">my stats</a>`))
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/verified", http.StatusFound)
+	})
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`<a rel="me" href="https://openstats.example/players/alice">my stats</a>`))
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func TestVerifyRelMe(t *testing.T) {
+	t.Setenv(RelMeAllowPrivateAddressesKey, "true")
+
+	server := newRelMeServer()
+	defer server.Close()
+
+	tests := []struct {
+		path     string
+		verified bool
+	}{
+		{"/verified", true},
+		{"/verified-by-rid", true},
+		{"/redirect", true},
+		{"/not-me", false},
+		{"/someone-else", false},
+		{"/missing", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			verified, err := VerifyRelMe(context.Background(), server.URL+test.path, testProfileUrls)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if verified != test.verified {
+				t.Fatalf("got verified = %v, want %v", verified, test.verified)
+			}
+		})
+	}
+}
+
+func TestVerifyRelMeRefusesPrivateAddresses(t *testing.T) {
+	t.Setenv(RelMeAllowPrivateAddressesKey, "false")
+
+	server := newRelMeServer()
+	defer server.Close()
+
+	verified, err := VerifyRelMe(context.Background(), server.URL+"/verified", testProfileUrls)
+	if verified || !errors.Is(err, safehttp.ErrAddressNotAllowed) {
+		t.Fatalf("got (%v, %v), want (false, %v)", verified, err, safehttp.ErrAddressNotAllowed)
+	}
+}
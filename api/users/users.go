@@ -5,15 +5,23 @@ import (
 	"database/sql"
 	"errors"
 	"github.com/danielgtaylor/huma/v2"
+	"github.com/danielgtaylor/huma/v2/sse"
+	"github.com/dresswithpockets/openstats/app/anomalies"
 	"github.com/dresswithpockets/openstats/app/auth"
 	"github.com/dresswithpockets/openstats/app/db"
 	"github.com/dresswithpockets/openstats/app/db/query"
+	"github.com/dresswithpockets/openstats/app/events"
+	"github.com/dresswithpockets/openstats/app/log"
+	"github.com/dresswithpockets/openstats/app/notifications"
+	"github.com/dresswithpockets/openstats/app/ratelimit"
 	"github.com/dresswithpockets/openstats/app/rid"
 	"github.com/dresswithpockets/openstats/app/validation"
 	"github.com/google/uuid"
 	"github.com/rotisserie/eris"
+	"maps"
 	"math/rand"
 	"net/http"
+	"slices"
 	"time"
 )
 
@@ -28,7 +36,7 @@ type User struct {
 	CreatedAt   validation.EpochTime `json:"createdAt" readOnly:"true"`
 	Slug        string               `json:"slug"`
 	DisplayName string               `json:"displayName,omitempty"`
-	BioText     string               `json:"bioText,omitempty"`
+	BioText     *string              `json:"bioText,omitempty"`
 	Avatar      *Avatar              `json:"avatar,omitempty" readOnly:"true"`
 	Email       string               `json:"email,omitempty"`
 	Password    string               `json:"password,omitempty" writeOnly:"true"`
@@ -68,6 +76,7 @@ func RegisterRoutes(api huma.API) {
 
 	requireGameTokenAuthHandler := auth.CreateRequireGameTokenAuthHandler(usersApi)
 	requireGameSessionAuthHandler := auth.CreateRequireGameSessionAuthHandler(usersApi)
+	requireGameServerAuthHandler := auth.CreateRequireGameServerAuthHandler(usersApi)
 	usersApi.UseSimpleModifier(func(op *huma.Operation) {
 		op.Tags = append(op.Tags, "Users")
 	})
@@ -76,8 +85,8 @@ func RegisterRoutes(api huma.API) {
 		Path:        "/",
 		OperationID: "users-search",
 		Method:      http.MethodGet,
-		Security:    []map[string][]string{{"GameToken": {}}},
-		Middlewares: huma.Middlewares{auth.GameTokenAuthHandler, requireGameTokenAuthHandler}, // TODO: https://github.com/danielgtaylor/huma/issues/804
+		Security:    []map[string][]string{{"GameToken": {auth.GameScopeReadFriends}}},
+		Middlewares: huma.Middlewares{auth.GameTokenAuthHandler, requireGameTokenAuthHandler, auth.CreateRequireGameScopeHandler(usersApi, auth.GameScopeReadFriends)}, // TODO: https://github.com/danielgtaylor/huma/issues/804
 		Summary:     "Get users",
 		Description: "Search all users by various criteria",
 	}, HandleSearchUsers)
@@ -86,8 +95,8 @@ func RegisterRoutes(api huma.API) {
 		Path:        "/{user}",
 		OperationID: "users-get",
 		Method:      http.MethodGet,
-		Security:    []map[string][]string{{"GameToken": {}}},
-		Middlewares: huma.Middlewares{auth.GameTokenAuthHandler, requireGameTokenAuthHandler},
+		Security:    []map[string][]string{{"GameToken": {auth.GameScopeReadProfile}}},
+		Middlewares: huma.Middlewares{auth.GameTokenAuthHandler, requireGameTokenAuthHandler, auth.CreateRequireGameScopeHandler(usersApi, auth.GameScopeReadProfile)},
 		Summary:     "Get user",
 		Description: "Get a user by RID, or get the user associated with the Game Token if @me is provided instead of an RID",
 	}, HandleGetUser)
@@ -108,17 +117,40 @@ func RegisterRoutes(api huma.API) {
 		OperationID: "users-game-session-heartbeat",
 		Method:      http.MethodPost,
 		Security:    []map[string][]string{{"GameSession": {}}},
-		Middlewares: huma.Middlewares{auth.GameSessionAuthHandler, requireGameSessionAuthHandler},
+		Errors:      []int{http.StatusUnauthorized, http.StatusTooManyRequests},
+		Middlewares: huma.Middlewares{auth.GameSessionAuthHandler, requireGameSessionAuthHandler, ratelimit.CreateRateLimitHandler(usersApi, ratelimit.Heartbeat, ratelimit.ByGameToken)},
 		Summary:     "Refresh the game session",
 		Description: "Refresh the game session. Update the session's last pulse, and generate a new game session token if the expiration is too close.",
 	}, HandleHeartbeatGameSession)
 
+	huma.Register(usersApi, huma.Operation{
+		Path:        "/{user}/games/{game}/sessions/{session}/end",
+		OperationID: "users-game-session-end",
+		Method:      http.MethodPost,
+		Security:    []map[string][]string{{"GameSession": {}}},
+		Errors:      []int{http.StatusUnauthorized, http.StatusNotFound},
+		Middlewares: huma.Middlewares{auth.GameSessionAuthHandler, requireGameSessionAuthHandler},
+		Summary:     "End the game session",
+		Description: "End the game session. The game session token used to authenticate this request will no longer be valid.",
+	}, HandleEndGameSession)
+
+	sse.Register(usersApi, huma.Operation{
+		Path:        "/{user}/events",
+		OperationID: "users-events",
+		Method:      http.MethodGet,
+		Security:    []map[string][]string{{"GameToken": {auth.GameScopeReadProfile}}},
+		Errors:      []int{http.StatusUnauthorized, http.StatusUnprocessableEntity},
+		Middlewares: huma.Middlewares{auth.GameTokenAuthHandler, requireGameTokenAuthHandler, auth.CreateRequireGameScopeHandler(usersApi, auth.GameScopeReadProfile)},
+		Summary:     "Stream a user's events",
+		Description: "Stream events for the user associated with the Game Token as Server-Sent Events, such as achievement unlocks, progress changes, and game sessions starting or ending. Only events for the Game Token's game are sent.",
+	}, events.MessageTypes, HandleGetUserEvents)
+
 	huma.Register(usersApi, huma.Operation{
 		Path:        "/{user}/games/{game}/achievements",
 		OperationID: "users-get-achievements",
 		Method:      http.MethodGet,
-		Security:    []map[string][]string{{"GameSession": {}}},
-		Middlewares: huma.Middlewares{auth.GameSessionAuthHandler, requireGameSessionAuthHandler},
+		Security:    []map[string][]string{{"GameSession": {auth.GameScopeReadProfile}}},
+		Middlewares: huma.Middlewares{auth.GameSessionAuthHandler, requireGameSessionAuthHandler, auth.CreateRequireGameScopeHandler(usersApi, auth.GameScopeReadProfile)},
 		Summary:     "Get a user's achievements",
 		Description: "Get a user's achievement progress for the game associated with the session",
 	}, HandleGetUserAchievements)
@@ -127,11 +159,23 @@ func RegisterRoutes(api huma.API) {
 		Path:        "/{user}/games/{game}/achievements",
 		OperationID: "users-game-session-set-progress",
 		Method:      http.MethodPost,
-		Security:    []map[string][]string{{"GameSession": {}}},
-		Middlewares: huma.Middlewares{auth.GameSessionAuthHandler, requireGameSessionAuthHandler},
+		Security:    []map[string][]string{{"GameSession": {auth.GameScopeWriteProgress}}},
+		Errors:      []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests},
+		Middlewares: huma.Middlewares{auth.GameSessionAuthHandler, requireGameSessionAuthHandler, auth.CreateRequireGameScopeHandler(usersApi, auth.GameScopeWriteProgress), ratelimit.CreateRateLimitHandler(usersApi, ratelimit.Progress, ratelimit.ByGameToken), auth.CreateRequireSignedProgressHandler(usersApi)},
 		Summary:     "Add achievement progress",
-		Description: "Add new progress to one or multiple achievements for a particular user. Any progress that's lower than the user's current progress for the associated achievement will be ignored.",
+		Description: "Add new progress to one or multiple achievements for a particular user. Any progress that's lower than the user's current progress for the associated achievement will be ignored. Games which only accept progress from their game servers reject this with 403 Forbidden. Games which require signed progress reject it with 401 Unauthorized unless it has an X-Openstats-Build header with the RID of one of the game's builds, and an X-Openstats-Signature header like `t={timestamp},n={nonce},v1={signature}`, where timestamp is the unix time in seconds, nonce is a unique random string of 16 to 64 characters, and signature is the hex-encoded HMAC-SHA256 of `{timestamp}.{nonce}.{method}.{path}.{body}` keyed by the build's secret. The method is uppercase e.g. POST, and the path is this request's path without its query string.",
 	}, HandleSetUserProgress)
+
+	huma.Register(usersApi, huma.Operation{
+		Path:        "/{user}/games/{game}/server-achievements",
+		OperationID: "users-game-server-set-progress",
+		Method:      http.MethodPost,
+		Security:    []map[string][]string{{"GameServerKey": {}}},
+		Errors:      []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusTooManyRequests},
+		Middlewares: huma.Middlewares{auth.GameServerAuthHandler, requireGameServerAuthHandler, ratelimit.CreateRateLimitHandler(usersApi, ratelimit.ServerProgress, ratelimit.ByGameServerKey)},
+		Summary:     "Add achievement progress from a game server",
+		Description: "Add new progress to one or multiple achievements for any player of the game, without a game session. Players have connected their account to the game by creating a Game Token for it. Any progress that's lower than the player's current progress for the associated achievement will be ignored.",
+	}, HandleServerSetUserProgress)
 }
 
 type SearchUsersRequest struct {
@@ -158,7 +202,7 @@ func HandleSearchUsers(ctx context.Context, input *SearchUsersRequest) (*SearchU
 	//       the game (maybe not?)
 
 	builder := db.DB.Builder().
-		Select("u.uuid", "u.created_at", "u.slug", "coalesce(uldn.display_name, '')").
+		Select("u.uuid", "u.created_at", "u.slug", "coalesce(uldn.display_name, '')", "u.bio_text").
 		From("users u").
 		JoinClause("left outer join user_latest_display_name uldn on u.id = uldn.user_id").
 		Where("u.slug like ?", "%"+input.SlugLike+"%").
@@ -188,7 +232,8 @@ func HandleSearchUsers(ctx context.Context, input *SearchUsersRequest) (*SearchU
 			&item.CreatedAt,
 			&item.Slug,
 			&item.DisplayName,
-			// TODO: BioText, AvatarUrl
+			&item.BioText,
+			// TODO: AvatarUrl
 		); scanErr != nil {
 			return nil, eris.Wrap(scanErr, "")
 		}
@@ -281,7 +326,11 @@ func HandleCreateGameSession(ctx context.Context, input *CreateGameSessionInput)
 		return nil, huma.Error401Unauthorized("sessions may only be created for the user and game that the Game Token is associated with")
 	}
 
-	signedToken, gameSession, err := auth.CreateGameSessionToken(ctx, principal.TokenUuid, principal.UserRid, principal.GameRid)
+	signedToken, gameSession, err := auth.CreateGameSessionToken(ctx, principal.TokenUuid, principal.TokenHash, principal.UserRid, principal.GameRid, principal.Scopes)
+	if errors.Is(err, auth.ErrGameTokenExpired) {
+		return nil, huma.Error401Unauthorized("the Game Token was rotated, deleted, or has expired")
+	}
+
 	if err != nil {
 		return nil, err
 	}
@@ -351,7 +400,11 @@ func HandleHeartbeatGameSession(ctx context.Context, input *HeartbeatGameSession
 	gameSessionRid := principal.SessionRid
 	if nextPulseTime.After(principal.ExpiresAt) {
 		// the next pulse will happen too close to the expiration, so we create a new token
-		signedToken, gameSession, createErr := auth.CreateGameSessionToken(ctx, principal.GameTokenUuid, principal.UserRid, principal.GameRid)
+		signedToken, gameSession, createErr := auth.CreateGameSessionToken(ctx, principal.GameTokenUuid, principal.GameTokenHash, principal.UserRid, principal.GameRid, principal.Scopes)
+		if errors.Is(createErr, auth.ErrGameTokenExpired) {
+			return nil, huma.Error401Unauthorized("the Game Token this session was started with was rotated, deleted, or has expired")
+		}
+
 		if createErr != nil {
 			return nil, createErr
 		}
@@ -398,6 +451,88 @@ func HandleHeartbeatGameSession(ctx context.Context, input *HeartbeatGameSession
 	return
 }
 
+type EndGameSessionInput struct {
+	User    rid.RID `path:"user"`
+	Game    rid.RID `path:"game"`
+	Session rid.RID `path:"session"`
+}
+
+func HandleEndGameSession(ctx context.Context, input *EndGameSessionInput) (*struct{}, error) {
+	principal, hasPrincipal := auth.GetGameSessionPrincipal(ctx)
+	if !hasPrincipal || input.User.ID != principal.UserRid.ID || input.Game.ID != principal.GameRid.ID || input.Session.ID != principal.SessionRid.ID {
+		return nil, huma.Error401Unauthorized("sessions must be ended using their own Game Session Token")
+	}
+
+	err := db.DB.Transact(ctx, func(ctx context.Context, qtx *query.Queries) error {
+		rows, endErr := qtx.EndGameSession(ctx, principal.SessionRid.ID)
+		if endErr != nil {
+			return endErr
+		}
+
+		if rows == 0 {
+			return huma.Error404NotFound("game session not found")
+		}
+
+		return qtx.DisallowToken(ctx, principal.TokenID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &struct{}{}, nil
+}
+
+type GetUserEventsInput struct {
+	User string `path:"user" doc:"The user's RID, or @me for the user associated with the Game Token"`
+}
+
+func (i *GetUserEventsInput) Resolve(ctx huma.Context) []error {
+	// events can only be streamed for the Game Token's user, and SSE handlers can't return errors once the stream
+	// has started - so we validate the user up front
+	principal, hasPrincipal := auth.GetGameTokenPrincipal(ctx.Context())
+	if !hasPrincipal || i.User == "@me" || i.User == principal.UserRid.String() {
+		return nil
+	}
+
+	return []error{&huma.ErrorDetail{
+		Location: "path.user",
+		Message:  "events may only be streamed for the user that the Game Token is associated with",
+		Value:    i.User,
+	}}
+}
+
+func HandleGetUserEvents(ctx context.Context, _ *GetUserEventsInput, send sse.Sender) {
+	principal, hasPrincipal := auth.GetGameTokenPrincipal(ctx)
+	if !hasPrincipal {
+		// shouldn't ever get here due to middleware check
+		return
+	}
+
+	userEvents, unsubscribe := events.Default.Subscribe(principal.UserRid.ID)
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-userEvents:
+			if event.GameUuid != principal.GameRid.ID {
+				continue
+			}
+
+			message, err := event.Message()
+			if err != nil {
+				log.Logger.Warn("skipping user event", "error", err)
+				continue
+			}
+
+			if err = send.Data(message); err != nil {
+				return
+			}
+		}
+	}
+}
+
 type GetUserAchievementsRequest struct {
 	User rid.RID `path:"user"`
 	Game rid.RID `path:"game"`
@@ -467,17 +602,89 @@ func HandleSetUserProgress(ctx context.Context, input *SetUserProgressRequest) (
 		return nil, huma.Error401Unauthorized("you may only update progress for the same game that the session was created for")
 	}
 
+	settings, err := db.Queries.GetGameProgressSettings(ctx, input.Game.ID)
+	if err != nil {
+		return nil, eris.Wrap(err, "error getting game progress settings")
+	}
+
+	if settings.ServerOnlyProgress {
+		return nil, huma.Error403Forbidden("this game only accepts progress from its game servers")
+	}
+
+	results, changes, err := saveProgress(ctx, input.User.ID, input.Game.ID, input.Body.Progress)
+	if err != nil {
+		return nil, err
+	}
+
+	// anomaly checks are best-effort too; flagged progress is kept until it's reviewed
+	if checkErr := anomalies.Check(ctx, principal.SessionRid.ID, changes); checkErr != nil {
+		log.Logger.Error("error checking progress for anomalies", "error", checkErr)
+	}
+
+	return &SetUserProgressResponse{
+		Body: UserProgress{Progress: results},
+	}, nil
+}
+
+func HandleServerSetUserProgress(ctx context.Context, input *SetUserProgressRequest) (*SetUserProgressResponse, error) {
+	principal, hasPrincipal := auth.GetGameServerPrincipal(ctx)
+	if !hasPrincipal {
+		return nil, huma.Error401Unauthorized("invalid game server key")
+	}
+
+	if input.Game.ID != principal.GameRid.ID {
+		return nil, huma.Error403Forbidden("you may only update progress for the game that the server key was created for")
+	}
+
+	// TODO: a huma validator for rid prefix...
+	if input.User.Prefix != auth.UserRidPrefix {
+		return nil, huma.Error404NotFound("player not found")
+	}
+
+	isPlayer, err := db.Queries.IsGamePlayer(ctx, query.IsGamePlayerParams{GameUuid: input.Game.ID, UserUuid: input.User.ID})
+	if err != nil {
+		return nil, eris.Wrap(err, "error finding player")
+	}
+
+	if !isPlayer {
+		return nil, huma.Error404NotFound("player not found")
+	}
+
+	suspension, err := auth.GetUserSuspension(ctx, input.User.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if suspension != nil {
+		return nil, huma.Error403Forbidden("the player is suspended")
+	}
+
+	// progress from game servers is trusted, so it isn't checked for anomalies
+	results, _, err := saveProgress(ctx, input.User.ID, input.Game.ID, input.Body.Progress)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SetUserProgressResponse{
+		Body: UserProgress{Progress: results},
+	}, nil
+}
+
+// saveProgress saves the user's progress in the game, ignoring progress lower than their current progress. It returns
+// the user's progress towards each achievement that changed.
+func saveProgress(ctx context.Context, userUuid, gameUuid uuid.UUID, progress map[string]int32) (map[string]int32, []anomalies.ProgressChange, error) {
 	var params []query.UpdateGameSessionUserProgressParams
-	for slug, progress := range input.Body.Progress {
+	for slug, newProgress := range progress {
 		params = append(params, query.UpdateGameSessionUserProgressParams{
-			NewProgress:     progress,
-			UserUuid:        input.User.ID,
+			NewProgress:     newProgress,
+			UserUuid:        userUuid,
 			AchievementSlug: slug,
-			GameUuid:        input.Game.ID,
+			GameUuid:        gameUuid,
 		})
 	}
 
 	results := map[string]int32{}
+	var changes []anomalies.ProgressChange
 	var batchErr error
 	batchResults := db.Queries.UpdateGameSessionUserProgress(ctx, params)
 	batchResults.QueryRow(func(i int, row query.UpdateGameSessionUserProgressRow, err error) {
@@ -491,13 +698,24 @@ func HandleSetUserProgress(ctx context.Context, input *SetUserProgressRequest) (
 		}
 
 		results[row.Slug] = row.Progress
+		changes = append(changes, anomalies.ProgressChange{
+			UserID:              row.UserID,
+			AchievementID:       row.AchievementID,
+			OldProgress:         row.OldProgress,
+			Progress:            row.Progress,
+			ProgressRequirement: row.ProgressRequirement,
+		})
 	})
 
 	if batchErr != nil {
-		return nil, batchErr
+		return nil, nil, batchErr
 	}
 
-	return &SetUserProgressResponse{
-		Body: UserProgress{Progress: results},
-	}, nil
+	// notifications are best-effort; the user's progress has already been saved
+	updatedSlugs := slices.Collect(maps.Keys(results))
+	if notifyErr := notifications.NotifyRareAchievementUnlocks(ctx, userUuid, gameUuid, updatedSlugs); notifyErr != nil {
+		log.Logger.Error("error notifying user of rare achievement unlocks", "error", notifyErr)
+	}
+
+	return results, changes, nil
 }
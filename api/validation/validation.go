@@ -3,11 +3,15 @@ package validation
 import (
 	"fmt"
 	"net/mail"
+	"net/url"
+	"regexp"
 	"slices"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/rotisserie/eris"
+	"golang.org/x/text/language"
 )
 
 const (
@@ -17,6 +21,10 @@ const (
 	MinSlugNameLength    = 2
 	MaxPasswordLength    = 32
 	MinPasswordLength    = 10
+	MaxBioTextLength     = 1024
+	MaxPronounsLength    = 32
+	MaxProfileLinks      = 5
+	MaxProfileLinkLength = 2048
 )
 
 var ValidSlugSpecialCharacters = []rune("!@#$%^&*")
@@ -84,6 +92,10 @@ var validationDetails = map[string]string{
 	//   - password contains only latin characters, numbers, or some special characters: !@#$%^&*
 	"password":    fmt.Sprintf("must be at least %v in length, be no more than %v in length; must only contain letters, numbers, or some special characters: !@#$%%^&*", MinPasswordLength, MaxPasswordLength),
 	"displayName": fmt.Sprintf("must be at least %v in length, be no more than %v in length; may contain any renderable unicode character", MinDisplayNameLength, MaxDisplayNameLength),
+	"bioText":     fmt.Sprintf("must be no more than %v in length; may only use emphasis, inline code, lists, block quotes, and links to http or https URLs - no HTML, images, or headings", MaxBioTextLength),
+	"pronouns":    fmt.Sprintf("must be no more than %v in length", MaxPronounsLength),
+	"country":     "must be an ISO 3166-1 alpha-2 country code, e.g. US",
+	"link":        fmt.Sprintf("must be an absolute http or https URL, no more than %v in length", MaxProfileLinkLength),
 }
 
 func GetValidationDetail(tag string) string {
@@ -164,6 +176,69 @@ func ValidPassword(password string) bool {
 	return true
 }
 
+var (
+	bioHtmlPattern    = regexp.MustCompile(`</?[a-zA-Z][a-zA-Z0-9-]*(\s[^>]*)?/?>|<[!?]`)
+	bioImagePattern   = regexp.MustCompile(`!\[[^\]]*\]\s*[(\[]`)
+	bioHeadingPattern = regexp.MustCompile(`(?m)^ {0,3}#{1,6}(\s|$)`)
+	bioLinkPattern    = regexp.MustCompile(`\]\(\s*<?([^)\s>]*)`)
+	bioLinkRefPattern = regexp.MustCompile(`(?m)^ {0,3}\[[^\]]+\]:\s*<?([^\s>]*)`)
+	bioAutolinkScheme = regexp.MustCompile(`<([a-zA-Z][a-zA-Z0-9+.-]*):`)
+)
+
+// ValidBioText returns true if all of these rules are followed:
+//   - bio is no more than MaxBioTextLength characters in length
+//   - bio contains no raw HTML, images, or headings; the rest of markdown (emphasis, inline code, lists, block quotes,
+//     and links) is allowed
+//   - every link in bio is an absolute http or https URL
+func ValidBioText(bio string) bool {
+	if !utf8.ValidString(bio) || utf8.RuneCountInString(bio) > MaxBioTextLength {
+		return false
+	}
+
+	if bioHtmlPattern.MatchString(bio) || bioImagePattern.MatchString(bio) || bioHeadingPattern.MatchString(bio) {
+		return false
+	}
+
+	for _, match := range bioAutolinkScheme.FindAllStringSubmatch(bio, -1) {
+		if match[1] != "http" && match[1] != "https" {
+			return false
+		}
+	}
+
+	links := append(bioLinkPattern.FindAllStringSubmatch(bio, -1), bioLinkRefPattern.FindAllStringSubmatch(bio, -1)...)
+	for _, match := range links {
+		if !ValidProfileLink(match[1]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func ValidPronouns(pronouns string) bool {
+	return utf8.RuneCountInString(pronouns) <= MaxPronounsLength
+}
+
+// ValidCountry returns true if country is an uppercase ISO 3166-1 alpha-2 code for a country
+func ValidCountry(country string) bool {
+	if len(country) != 2 || country[0] < 'A' || country[0] > 'Z' || country[1] < 'A' || country[1] > 'Z' {
+		return false
+	}
+
+	region, err := language.ParseRegion(country)
+	return err == nil && region.IsCountry()
+}
+
+// ValidProfileLink returns true if link is an absolute http or https URL no more than MaxProfileLinkLength in length
+func ValidProfileLink(link string) bool {
+	if len(link) > MaxProfileLinkLength {
+		return false
+	}
+
+	parsed, err := url.Parse(link)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
 func ErrorIsAny(err error, errs ...error) bool {
 	for _, other := range errs {
 		if eris.Is(err, other) {
@@ -0,0 +1,282 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dresswithpockets/openstats/app/db"
+	"github.com/dresswithpockets/openstats/app/db/query"
+	"github.com/dresswithpockets/openstats/app/events"
+	"github.com/dresswithpockets/openstats/app/log"
+	"github.com/dresswithpockets/openstats/app/rid"
+	"github.com/dresswithpockets/openstats/app/safehttp"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rotisserie/eris"
+)
+
+// SecretPath is the path of each webhook's HMAC secret, keyed by webhook id. The secret is shared with the webhook's
+// developer so that they can verify delivery signatures.
+const SecretPath = "shared.webhook.hmac"
+
+// AllowPrivateAddressesKey is the envvar which, when true, lets webhooks be delivered to private addresses
+const AllowPrivateAddressesKey = "OPENSTATS_WEBHOOK_ALLOW_PRIVATE_ADDRESSES"
+
+const (
+	WebhookRidPrefix  = "wh"
+	DeliveryRidPrefix = "wd"
+)
+
+const (
+	SignatureHeader = "X-Openstats-Signature"
+	EventHeader     = "X-Openstats-Event"
+	DeliveryHeader  = "X-Openstats-Delivery"
+)
+
+const (
+	PollInterval   = 5 * time.Second
+	BatchSize      = 20
+	RequestTimeout = 10 * time.Second
+	MaxAttempts    = 10
+	BaseRetryDelay = 30 * time.Second
+	MaxRetryDelay  = 6 * time.Hour
+)
+
+// Kinds lists the event kinds that webhooks may subscribe to
+var Kinds = []events.Kind{
+	events.AchievementUnlocked,
+	events.GameCompleted,
+	events.SessionStarted,
+	events.SessionEnded,
+}
+
+// Payload is the JSON body POSTed to a webhook's url
+type Payload struct {
+	Delivery rid.RID     `json:"delivery"`
+	Kind     events.Kind `json:"kind"`
+	Data     any         `json:"data"`
+}
+
+// Sign returns the value of the SignatureHeader for the body, in the format `t={timestamp},v1={signature}`, where
+// timestamp is the unix time in seconds and signature is the hex-encoded HMAC-SHA256 of `{timestamp}.{body}`.
+//
+// Receivers should recompute the signature with their secret, compare it in constant time, and reject deliveries with
+// a timestamp too far in the past.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	unix := strconv.FormatInt(timestamp.Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unix))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return fmt.Sprintf("t=%s,v1=%s", unix, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// CreateWebhook creates a webhook for the game, along with its secret
+func CreateWebhook(ctx context.Context, gameUuid uuid.UUID, url string, kinds []string) (webhook query.Webhook, secret string, err error) {
+	secret = rand.Text()
+	err = db.DB.Transact(ctx, func(ctx context.Context, qtx *query.Queries) (txErr error) {
+		webhook, txErr = qtx.CreateWebhook(ctx, query.CreateWebhookParams{
+			Url:      url,
+			Events:   kinds,
+			GameUuid: gameUuid,
+		})
+		if txErr != nil {
+			return eris.Wrap(txErr, "error adding webhook")
+		}
+
+		return qtx.SecretCreate(ctx, query.SecretCreateParams{
+			Path:  SecretPath,
+			Key:   strconv.FormatInt(int64(webhook.ID), 10),
+			Value: secret,
+		})
+	})
+
+	return
+}
+
+// DeleteWebhook deletes the game's webhook, its delivery log, and its secret. It returns false if the game has no such
+// webhook.
+func DeleteWebhook(ctx context.Context, gameUuid, webhookUuid uuid.UUID) (bool, error) {
+	err := db.DB.Transact(ctx, func(ctx context.Context, qtx *query.Queries) error {
+		webhookId, err := qtx.DeleteWebhook(ctx, query.DeleteWebhookParams{GameUuid: gameUuid, WebhookUuid: webhookUuid})
+		if err != nil {
+			return err
+		}
+
+		return qtx.SecretDelete(ctx, query.SecretDeleteParams{
+			Path: SecretPath,
+			Key:  strconv.FormatInt(int64(webhookId), 10),
+		})
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+
+	return err == nil, eris.Wrap(err, "error deleting webhook")
+}
+
+// RetryDelay returns how long to wait before the next attempt, after the given number of failed attempts
+func RetryDelay(attempts int32) time.Duration {
+	delay := BaseRetryDelay
+	for i := int32(1); i < attempts && delay < MaxRetryDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, MaxRetryDelay)
+}
+
+// client doesn't follow redirects, since a redirect could point the delivery anywhere. Redirects are failed deliveries.
+var client = &http.Client{
+	Timeout:   RequestTimeout,
+	Transport: safehttp.NewTransport(RequestTimeout, AllowPrivateAddressesKey),
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// Run delivers pending webhook deliveries every PollInterval until ctx is done. It is safe to Run on many replicas at
+// once, since deliveries are claimed with `for update skip locked`.
+func Run(ctx context.Context) {
+	ticker := time.NewTicker(PollInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			delivered, err := deliverBatch(ctx)
+			if err != nil {
+				log.Logger.Error("error delivering webhooks", "error", err)
+				break
+			}
+
+			if delivered < BatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func deliverBatch(ctx context.Context) (int, error) {
+	// deliveries are leased for long enough to attempt every delivery in the batch. If this replica dies before it
+	// records the result, the deliveries will be claimed again once the lease expires.
+	deliveries, err := db.Queries.ClaimWebhookDeliveries(ctx, query.ClaimWebhookDeliveriesParams{
+		Limit:          BatchSize,
+		LeaseExpiresAt: time.Now().UTC().Add(2 * RequestTimeout),
+	})
+	if err != nil {
+		return 0, eris.Wrap(err, "error claiming webhook deliveries")
+	}
+
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := deliver(ctx, delivery); err != nil {
+				log.Logger.Error("error recording webhook delivery", "error", err, "delivery", delivery.Uuid)
+			}
+		}()
+	}
+
+	wg.Wait()
+	return len(deliveries), nil
+}
+
+func deliver(ctx context.Context, delivery query.ClaimWebhookDeliveriesRow) error {
+	statusCode, attemptErr := attempt(ctx, delivery)
+	if attemptErr == nil {
+		return db.Queries.SucceedWebhookDelivery(ctx, query.SucceedWebhookDeliveryParams{
+			StatusCode: pgtype.Int4{Int32: int32(statusCode), Valid: true},
+			ID:         delivery.ID,
+		})
+	}
+
+	errorText := attemptErr.Error()
+	return db.Queries.FailWebhookDelivery(ctx, query.FailWebhookDeliveryParams{
+		GiveUp:        delivery.AttemptCount >= MaxAttempts,
+		NextAttemptAt: time.Now().UTC().Add(RetryDelay(delivery.AttemptCount)),
+		StatusCode:    pgtype.Int4{Int32: int32(statusCode), Valid: statusCode != 0},
+		Error:         &errorText,
+		ID:            delivery.ID,
+	})
+}
+
+// attempt POSTs the delivery's payload to the webhook's url, returning the response status code if there was one
+func attempt(ctx context.Context, delivery query.ClaimWebhookDeliveriesRow) (int, error) {
+	var event events.Event
+	if err := json.Unmarshal(delivery.Event, &event); err != nil {
+		return 0, eris.Wrap(err, "error decoding event")
+	}
+
+	message, err := event.Message()
+	if err != nil {
+		return 0, err
+	}
+
+	secret, err := db.Queries.SecretRead(ctx, query.SecretReadParams{
+		Path: SecretPath,
+		Key:  strconv.FormatInt(int64(delivery.WebhookID), 10),
+	})
+	if err != nil {
+		return 0, eris.Wrap(err, "error getting webhook secret")
+	}
+
+	return post(ctx, delivery.Url, secret, rid.From(DeliveryRidPrefix, delivery.Uuid), event.Kind, message)
+}
+
+// post POSTs a delivery's payload to url, signed with the webhook's secret
+func post(ctx context.Context, url, secret string, deliveryRid rid.RID, kind events.Kind, message any) (int, error) {
+	body, err := json.Marshal(Payload{
+		Delivery: deliveryRid,
+		Kind:     kind,
+		Data:     message,
+	})
+	if err != nil {
+		return 0, eris.Wrap(err, "error encoding payload")
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, eris.Wrap(err, "error creating request")
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "openstats-webhooks")
+	request.Header.Set(EventHeader, string(kind))
+	request.Header.Set(DeliveryHeader, deliveryRid.String())
+	request.Header.Set(SignatureHeader, Sign(secret, time.Now(), body))
+
+	response, err := client.Do(request)
+	if err != nil {
+		return 0, eris.Wrap(err, "error sending request")
+	}
+
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 64*1024))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, eris.Errorf("unexpected response status %d", response.StatusCode)
+	}
+
+	return response.StatusCode, nil
+}
@@ -0,0 +1,174 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dresswithpockets/openstats/app/events"
+	"github.com/dresswithpockets/openstats/app/rid"
+	"github.com/dresswithpockets/openstats/app/safehttp"
+	"github.com/google/uuid"
+)
+
+const testSecret = "test-secret"
+
+// receiver is a webhook endpoint which verifies each delivery's signature, and responds with each of statuses in turn
+type receiver struct {
+	t        *testing.T
+	statuses []int
+	received []Payload
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		r.t.Errorf("error reading delivery body: %v", err)
+		return
+	}
+
+	header := req.Header.Get(SignatureHeader)
+	var unix, signature string
+	for part := range strings.SplitSeq(header, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			unix = value
+		case "v1":
+			signature = value
+		}
+	}
+
+	seconds, err := strconv.ParseInt(unix, 10, 64)
+	if err != nil || time.Since(time.Unix(seconds, 0)) > time.Minute {
+		r.t.Errorf("delivery has an invalid timestamp: %q", header)
+	}
+
+	mac := hmac.New(sha256.New, []byte(testSecret))
+	mac.Write([]byte(unix + "."))
+	mac.Write(body)
+	if !hmac.Equal([]byte(signature), []byte(hex.EncodeToString(mac.Sum(nil)))) {
+		r.t.Errorf("delivery has an invalid signature: %q", header)
+	}
+
+	var payload Payload
+	if err = json.Unmarshal(body, &payload); err != nil {
+		r.t.Errorf("error decoding delivery: %v", err)
+	}
+
+	if req.Header.Get(EventHeader) != string(payload.Kind) || req.Header.Get(DeliveryHeader) != payload.Delivery.String() {
+		r.t.Errorf("delivery headers don't match its payload: %v", req.Header)
+	}
+
+	r.received = append(r.received, payload)
+
+	status := r.statuses[0]
+	if len(r.statuses) > 1 {
+		r.statuses = r.statuses[1:]
+	}
+
+	if status == http.StatusFound {
+		w.Header().Set("Location", "/elsewhere")
+	}
+
+	w.WriteHeader(status)
+}
+
+func testMessage(t *testing.T) (rid.RID, events.Kind, any) {
+	t.Helper()
+
+	event := events.Event{
+		Kind:     events.GameCompleted,
+		UserUuid: uuid.Must(uuid.NewV7()),
+		GameUuid: uuid.Must(uuid.NewV7()),
+	}
+
+	message, err := event.Message()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rid.From(DeliveryRidPrefix, uuid.Must(uuid.NewV7())), event.Kind, message
+}
+
+func TestPostRetriesUntilDelivered(t *testing.T) {
+	t.Setenv(AllowPrivateAddressesKey, "true")
+
+	r := &receiver{t: t, statuses: []int{http.StatusInternalServerError, http.StatusFound, http.StatusNoContent}}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	deliveryRid, kind, message := testMessage(t)
+	for attempt, want := range []int{http.StatusInternalServerError, http.StatusFound, http.StatusNoContent} {
+		status, err := post(context.Background(), server.URL, testSecret, deliveryRid, kind, message)
+		if status != want {
+			t.Fatalf("attempt %d: got status %d, want %d", attempt+1, status, want)
+		}
+
+		if delivered := err == nil; delivered != (want == http.StatusNoContent) {
+			t.Fatalf("attempt %d: unexpected result %v", attempt+1, err)
+		}
+	}
+
+	if len(r.received) != 3 {
+		t.Fatalf("receiver got %d deliveries, want 3", len(r.received))
+	}
+
+	for _, payload := range r.received {
+		if payload.Delivery != deliveryRid || payload.Kind != kind {
+			t.Errorf("retries should resend the same delivery, got %+v", payload)
+		}
+	}
+}
+
+func TestPostRefusesPrivateAddresses(t *testing.T) {
+	t.Setenv(AllowPrivateAddressesKey, "false")
+
+	r := &receiver{t: t, statuses: []int{http.StatusNoContent}}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	deliveryRid, kind, message := testMessage(t)
+	_, err := post(context.Background(), server.URL, testSecret, deliveryRid, kind, message)
+	if !errors.Is(err, safehttp.ErrAddressNotAllowed) {
+		t.Fatalf("got %v, want %v", err, safehttp.ErrAddressNotAllowed)
+	}
+
+	if len(r.received) != 0 {
+		t.Fatal("the receiver shouldn't have been reached")
+	}
+
+	if err = safehttp.ValidateUrl(context.Background(), server.URL, AllowPrivateAddressesKey); !errors.Is(err, safehttp.ErrAddressNotAllowed) {
+		t.Fatalf("got %v, want %v", err, safehttp.ErrAddressNotAllowed)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	previous := time.Duration(0)
+	for attempts := int32(1); attempts <= MaxAttempts; attempts++ {
+		delay := RetryDelay(attempts)
+		if delay < previous || delay > MaxRetryDelay {
+			t.Fatalf("RetryDelay(%d) = %v, want between %v and %v", attempts, delay, previous, MaxRetryDelay)
+		}
+
+		previous = delay
+	}
+
+	if RetryDelay(1) != BaseRetryDelay {
+		t.Fatalf("RetryDelay(1) = %v, want %v", RetryDelay(1), BaseRetryDelay)
+	}
+
+	if RetryDelay(100) != MaxRetryDelay {
+		t.Fatalf("RetryDelay(100) = %v, want %v", RetryDelay(100), MaxRetryDelay)
+	}
+}